@@ -0,0 +1,732 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+const (
+	accountObjType    = reservedObjTypePrefix + "account"
+	balanceObjType    = reservedObjTypePrefix + "balance"
+	rateObjType       = reservedObjTypePrefix + "rate"
+	conversionObjType = reservedObjTypePrefix + "conversion"
+
+	// defaultCurrencyScale is the number of decimal places of the currencies
+	// not in currencyScales
+	defaultCurrencyScale = 2
+)
+
+var currencyPattern = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// currencyScales are the ISO 4217 minor units of the currencies that don't
+// have two decimal places.
+var currencyScales = map[string]int32{
+	"BHD": 3, "CLP": 0, "IQD": 3, "ISK": 0, "JOD": 3, "JPY": 0, "KRW": 0,
+	"KWD": 3, "LYD": 3, "OMR": 3, "PYG": 0, "TND": 3, "UGX": 0, "VND": 0,
+}
+
+// account holds balances in any number of currencies. Only its owner, the
+// identity that opened it, can move funds out of it. Org is the MSP of the
+// owner, which answers for the account in settlements between organizations.
+type account struct {
+	ID        string    `json:"id"`
+	Owner     string    `json:"owner"`
+	Org       string    `json:"org,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// money is an amount in a currency, with the currency's decimal places.
+type money struct {
+	Currency string   `json:"currency"`
+	Amount   *decimal `json:"amount"`
+}
+
+type balance struct {
+	Account string `json:"account"`
+	money
+}
+
+// exchangeRate is the price of one unit of Base in Quote, as last set by the
+// rate oracle in the transaction TxID.
+type exchangeRate struct {
+	Base      string    `json:"base"`
+	Quote     string    `json:"quote"`
+	Rate      *decimal  `json:"rate"`
+	TxID      string    `json:"txId"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// conversion records an exchange between two currencies of an account and the
+// rate it was made at. Conversions are kept per transaction.
+type conversion struct {
+	ID        string    `json:"id"`
+	TxID      string    `json:"txId"`
+	Account   string    `json:"account"`
+	From      money     `json:"from"`
+	To        money     `json:"to"`
+	Rate      *decimal  `json:"rate"`
+	RateTxID  string    `json:"rateTxId"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+func currencyScale(currency string) int32 {
+	if scale, ok := currencyScales[currency]; ok {
+		return scale
+	}
+
+	return defaultCurrencyScale
+}
+
+// parseMoney parses a positive amount of currency.
+func parseMoney(currency, amountArg string) (money, error) {
+	if !currencyPattern.MatchString(currency) {
+		return money{}, fmt.Errorf("currency must be an ISO 4217 code, e.g. \"EUR\", got \"%s\"", currency)
+	}
+
+	scale := currencyScale(currency)
+	a, err := parseDecimal(amountArg, scale)
+	if err != nil || a.Sign() <= 0 {
+		return money{}, fmt.Errorf("amount must be a positive decimal with at most %d decimal places for %s, got \"%s\"",
+			scale, currency, amountArg)
+	}
+
+	return money{Currency: currency, Amount: a}, nil
+}
+
+func getAccount(stub shim.ChaincodeStubInterface, id string) (*account, error) {
+	accountKey, err := stub.CreateCompositeKey(accountObjType, []string{id})
+	if err != nil {
+		return nil, err
+	}
+
+	var a account
+	if found, err := getJSON(stub, accountKey, &a); err != nil || !found {
+		return nil, err
+	}
+
+	return &a, nil
+}
+
+// requireOwner fails unless the caller owns a.
+func requireOwner(stub shim.ChaincodeStubInterface, a *account) error {
+	id, err := callerID(stub)
+	if err != nil {
+		return err
+	}
+
+	if id != a.Owner {
+		return fmt.Errorf("the caller doesn't own the account %s", a.ID)
+	}
+
+	return nil
+}
+
+// getBalance returns the balance of an account in currency, zero if it never
+// held any.
+func getBalance(stub shim.ChaincodeStubInterface, accountID, currency string) (string, *balance, error) {
+	balanceKey, err := stub.CreateCompositeKey(balanceObjType, []string{accountID, currency})
+	if err != nil {
+		return "", nil, err
+	}
+
+	b := &balance{Account: accountID}
+	found, err := getJSON(stub, balanceKey, b)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if !found {
+		b.money = money{Currency: currency, Amount: newDecimal(0, currencyScale(currency))}
+	}
+
+	return balanceKey, b, nil
+}
+
+// addFunds adds m to the balance of an account.
+func addFunds(stub shim.ChaincodeStubInterface, accountID string, m money) error {
+	balanceKey, b, err := getBalance(stub, accountID, m.Currency)
+	if err != nil {
+		return err
+	}
+
+	b.Amount.add(m.Amount)
+	return putJSON(stub, balanceKey, b)
+}
+
+// takeFunds takes m from the balance of an account, unless the balance is short,
+// which it reports as false.
+func takeFunds(stub shim.ChaincodeStubInterface, accountID string, m money) (bool, error) {
+	balanceKey, b, err := getBalance(stub, accountID, m.Currency)
+	if err != nil {
+		return false, err
+	}
+
+	if b.Amount.cmp(m.Amount) < 0 {
+		return false, nil
+	}
+
+	b.Amount.sub(m.Amount)
+	return true, putJSON(stub, balanceKey, b)
+}
+
+func (cc *SimpleChaincode) openAccount(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.openAccount")
+
+	if len(args) != 1 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d", len(args), 1)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	id := args[0]
+	logger.Debugf("account: %s", id)
+
+	if id == "" || strings.HasPrefix(id, systemAccountPrefix) {
+		message := fmt.Sprintf("an account id must be a non-empty string not starting with %s", systemAccountPrefix)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	a, err := getAccount(stub, id)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the account %s: %s", id, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if a != nil {
+		message := fmt.Sprintf("the account %s already exists", id)
+		logger.Error(message)
+		return pb.Response{Status: 409, Message: message}
+	}
+
+	owner, err := callerID(stub)
+	if err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	org, err := callerMSPID(stub)
+	if err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	now, err := txTime(stub)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the transaction timestamp: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	accountKey, err := stub.CreateCompositeKey(accountObjType, []string{id})
+	if err != nil {
+		message := fmt.Sprintf("unable to create a composite key: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if err := putJSON(stub, accountKey, account{ID: id, Owner: owner, Org: org, CreatedAt: now}); err != nil {
+		message := fmt.Sprintf("unable to put the account %s: %s", id, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.openAccount exited successfully")
+	return shim.Success(nil)
+}
+
+func (cc *SimpleChaincode) deposit(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.deposit")
+	return cc.adjustBalance(stub, args, true)
+}
+
+func (cc *SimpleChaincode) withdraw(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.withdraw")
+	return cc.adjustBalance(stub, args, false)
+}
+
+// adjustBalance moves funds into or out of an account from outside the
+// ledger, e.g. against a bank transfer, which only admins can attest.
+func (cc *SimpleChaincode) adjustBalance(stub shim.ChaincodeStubInterface, args []string, deposit bool) pb.Response {
+	if len(args) != 3 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d", len(args), 3)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	id, currency, amountArg := args[0], args[1], args[2]
+	logger.Debugf("account: %s, currency: %s, amount: %s, deposit: %t", id, currency, amountArg, deposit)
+
+	if err := requireAdmin(stub); err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 403, Message: message}
+	}
+
+	m, err := parseMoney(currency, amountArg)
+	if err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	a, err := getAccount(stub, id)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the account %s: %s", id, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if a == nil {
+		message := fmt.Sprintf("the account %s not found", id)
+		logger.Error(message)
+		return pb.Response{Status: 404, Message: message}
+	}
+
+	lines := transferLines(externalAccount, id, m)
+	if deposit {
+		err = addFunds(stub, id, m)
+	} else {
+		lines = transferLines(id, externalAccount, m)
+
+		var ok bool
+		if ok, err = takeFunds(stub, id, m); err == nil && !ok {
+			message := fmt.Sprintf("the account %s has insufficient %s funds", id, currency)
+			logger.Error(message)
+			return pb.Response{Status: 409, Message: message}
+		}
+	}
+	if err != nil {
+		message := fmt.Sprintf("unable to update the balance of %s: %s", id, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	description := "deposit"
+	if !deposit {
+		description = "withdrawal"
+	}
+
+	if err := postEntry(stub, description, lines...); err != nil {
+		message := fmt.Sprintf("unable to post the journal entry: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.adjustBalance exited successfully")
+	return shim.Success(nil)
+}
+
+func (cc *SimpleChaincode) transferFunds(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.transferFunds")
+
+	if len(args) != 4 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d", len(args), 4)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	from, to, currency, amountArg := args[0], args[1], args[2], args[3]
+	logger.Debugf("from: %s, to: %s, currency: %s, amount: %s", from, to, currency, amountArg)
+
+	m, err := parseMoney(currency, amountArg)
+	if err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	if from == to {
+		message := "the accounts of a transfer must differ"
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	for _, id := range []string{from, to} {
+		a, err := getAccount(stub, id)
+		if err != nil {
+			message := fmt.Sprintf("unable to get the account %s: %s", id, err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		if a == nil {
+			message := fmt.Sprintf("the account %s not found", id)
+			logger.Error(message)
+			return pb.Response{Status: 404, Message: message}
+		}
+
+		if id == from {
+			if err := requireOwner(stub, a); err != nil {
+				message := err.Error()
+				logger.Error(message)
+				return pb.Response{Status: 403, Message: message}
+			}
+		}
+	}
+
+	ok, err := takeFunds(stub, from, m)
+	if err != nil {
+		message := fmt.Sprintf("unable to update the balance of %s: %s", from, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if !ok {
+		message := fmt.Sprintf("the account %s has insufficient %s funds", from, currency)
+		logger.Error(message)
+		return pb.Response{Status: 409, Message: message}
+	}
+
+	if err := addFunds(stub, to, m); err != nil {
+		message := fmt.Sprintf("unable to update the balance of %s: %s", to, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if err := postEntry(stub, "transfer", transferLines(from, to, m)...); err != nil {
+		message := fmt.Sprintf("unable to post the journal entry: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.transferFunds exited successfully")
+	return shim.Success(nil)
+}
+
+// setRate records the rate of a currency pair. Chaincode can't query an
+// exchange rate service itself, as endorsers would see different rates, so an
+// off-chain oracle, holding the admin role, pushes the rates to the ledger.
+func (cc *SimpleChaincode) setRate(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.setRate")
+
+	if len(args) != 3 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d", len(args), 3)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	base, quote, rateArg := args[0], args[1], args[2]
+	logger.Debugf("base: %s, quote: %s, rate: %s", base, quote, rateArg)
+
+	if err := requireAdmin(stub); err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 403, Message: message}
+	}
+
+	if !currencyPattern.MatchString(base) || !currencyPattern.MatchString(quote) || base == quote {
+		message := fmt.Sprintf("a rate must be between two different ISO 4217 currencies, got %s/%s", base, quote)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	rate, err := decimalOf(rateArg)
+	if err != nil || rate.Sign() <= 0 {
+		message := fmt.Sprintf("rate must be a positive decimal, got \"%s\"", rateArg)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	now, err := txTime(stub)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the transaction timestamp: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	rateKey, err := stub.CreateCompositeKey(rateObjType, []string{base, quote})
+	if err != nil {
+		message := fmt.Sprintf("unable to create a composite key: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	r := exchangeRate{Base: base, Quote: quote, Rate: rate, TxID: stub.GetTxID(), UpdatedAt: now}
+	if err := putJSON(stub, rateKey, r); err != nil {
+		message := fmt.Sprintf("unable to put the rate %s/%s: %s", base, quote, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.setRate exited successfully")
+	return shim.Success(nil)
+}
+
+// convert exchanges an amount between two currencies of an account at the
+// current rate of the pair, rounding the proceeds half to even, and records
+// the conversion under the transaction.
+func (cc *SimpleChaincode) convert(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.convert")
+
+	if len(args) != 4 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d", len(args), 4)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	id, fromCurrency, toCurrency, amountArg := args[0], args[1], args[2], args[3]
+	logger.Debugf("account: %s, from: %s, to: %s, amount: %s", id, fromCurrency, toCurrency, amountArg)
+
+	from, err := parseMoney(fromCurrency, amountArg)
+	if err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	a, err := getAccount(stub, id)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the account %s: %s", id, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if a == nil {
+		message := fmt.Sprintf("the account %s not found", id)
+		logger.Error(message)
+		return pb.Response{Status: 404, Message: message}
+	}
+
+	if err := requireOwner(stub, a); err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 403, Message: message}
+	}
+
+	rateKey, err := stub.CreateCompositeKey(rateObjType, []string{fromCurrency, toCurrency})
+	if err != nil {
+		message := fmt.Sprintf("unable to create a composite key: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	var rate exchangeRate
+	found, err := getJSON(stub, rateKey, &rate)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the rate %s/%s: %s", fromCurrency, toCurrency, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if !found {
+		message := fmt.Sprintf("the rate %s/%s not found", fromCurrency, toCurrency)
+		logger.Error(message)
+		return pb.Response{Status: 404, Message: message}
+	}
+
+	to := money{Currency: toCurrency, Amount: from.Amount.mul(rate.Rate, currencyScale(toCurrency))}
+	if to.Amount.Sign() <= 0 {
+		message := fmt.Sprintf("%s %s is worth nothing in %s", from.Amount, fromCurrency, toCurrency)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	ok, err := takeFunds(stub, id, from)
+	if err != nil {
+		message := fmt.Sprintf("unable to update the balance of %s: %s", id, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if !ok {
+		message := fmt.Sprintf("the account %s has insufficient %s funds", id, fromCurrency)
+		logger.Error(message)
+		return pb.Response{Status: 409, Message: message}
+	}
+
+	if err := addFunds(stub, id, to); err != nil {
+		message := fmt.Sprintf("unable to update the balance of %s: %s", id, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	now, err := txTime(stub)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the transaction timestamp: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	c := conversion{
+		ID:        newUUID(stub),
+		TxID:      stub.GetTxID(),
+		Account:   id,
+		From:      from,
+		To:        to,
+		Rate:      rate.Rate,
+		RateTxID:  rate.TxID,
+		Timestamp: now,
+	}
+
+	conversionKey, err := stub.CreateCompositeKey(conversionObjType, []string{c.TxID, c.ID})
+	if err != nil {
+		message := fmt.Sprintf("unable to create a composite key: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if err := putJSON(stub, conversionKey, c); err != nil {
+		message := fmt.Sprintf("unable to put the conversion: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	lines := append(transferLines(id, exchangeAccount, from), transferLines(exchangeAccount, id, to)...)
+	if err := postEntry(stub, "conversion "+c.ID, lines...); err != nil {
+		message := fmt.Sprintf("unable to post the journal entry: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	result, err := json.Marshal(c)
+	if err != nil {
+		message := fmt.Sprintf("unable to marshal the result: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.convert exited successfully")
+	return shim.Success(result)
+}
+
+// getBalances returns the balances of an account in every currency it holds
+// or held.
+func (cc *SimpleChaincode) getBalances(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.getBalances")
+
+	if len(args) != 1 && len(args) != 2 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d or %d", len(args), 1, 2)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	id, format := args[0], formatJSON
+	if len(args) == 2 {
+		format = args[1]
+	}
+	logger.Debugf("account: %s, format: %s", id, format)
+
+	if err := checkFormat(format); err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	a, err := getAccount(stub, id)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the account %s: %s", id, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if a == nil {
+		message := fmt.Sprintf("the account %s not found", id)
+		logger.Error(message)
+		return pb.Response{Status: 404, Message: message}
+	}
+
+	it, err := stub.GetStateByPartialCompositeKey(balanceObjType, []string{id})
+	if err != nil {
+		message := fmt.Sprintf("unable to get an iterator over the balances of %s: %s", id, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+	defer it.Close()
+
+	balances := []balance{}
+	for it.HasNext() {
+		response, err := it.Next()
+		if err != nil {
+			message := fmt.Sprintf("unable to get the next element: %s", err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		var b balance
+		if err := json.Unmarshal(response.Value, &b); err != nil {
+			message := fmt.Sprintf("unable to unmarshal the balance: %s", err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+		balances = append(balances, b)
+	}
+
+	result, err := marshalResult(balances, format)
+	if err != nil {
+		message := fmt.Sprintf("unable to marshal the result: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.getBalances exited successfully")
+	return shim.Success(result)
+}
+
+// getConversions returns the conversions made in a transaction.
+func (cc *SimpleChaincode) getConversions(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.getConversions")
+
+	if len(args) != 1 && len(args) != 2 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d or %d", len(args), 1, 2)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	txID, format := args[0], formatJSON
+	if len(args) == 2 {
+		format = args[1]
+	}
+	logger.Debugf("txId: %s, format: %s", txID, format)
+
+	if err := checkFormat(format); err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	it, err := stub.GetStateByPartialCompositeKey(conversionObjType, []string{txID})
+	if err != nil {
+		message := fmt.Sprintf("unable to get an iterator over the conversions of %s: %s", txID, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+	defer it.Close()
+
+	conversions := []conversion{}
+	for it.HasNext() {
+		response, err := it.Next()
+		if err != nil {
+			message := fmt.Sprintf("unable to get the next element: %s", err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		var c conversion
+		if err := json.Unmarshal(response.Value, &c); err != nil {
+			message := fmt.Sprintf("unable to unmarshal the conversion: %s", err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+		conversions = append(conversions, c)
+	}
+
+	result, err := marshalResult(conversions, format)
+	if err != nil {
+		message := fmt.Sprintf("unable to marshal the result: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.getConversions exited successfully")
+	return shim.Success(result)
+}
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+const (
+	accrualObjType      = reservedObjTypePrefix + "accrual"
+	accrualEntryObjType = reservedObjTypePrefix + "accrualentry"
+
+	// the day-count conventions: actual days over a 365 or 360 day year
+	dayCountAct365 = "ACT/365"
+	dayCountAct360 = "ACT/360"
+
+	// accrualRateScale bounds the decimal places of annual rates
+	accrualRateScale = 8
+
+	oneDay = 24 * time.Hour
+)
+
+var dayCountBases = map[string]int64{dayCountAct365: 365, dayCountAct360: 360}
+
+// accrual is the interest or fee that a record, e.g. a financed invoice,
+// accrues on its principal at an annual rate. It accrues by whole days, from
+// the transaction timestamps, so that every endorser computes the same
+// amount; the part of a day since AccruedUntil is left for the next accrual.
+type accrual struct {
+	RecordID     string    `json:"recordId"`
+	Principal    money     `json:"principal"`
+	Rate         *decimal  `json:"rate"`
+	DayCount     string    `json:"dayCount"`
+	AccruedUntil time.Time `json:"accruedUntil"`
+	Accrued      *decimal  `json:"accrued"`
+	Seq          uint64    `json:"seq"`
+}
+
+// accrualEntry is the audit trail of an accrual: one entry per call to
+// accrue that accrued at least a day.
+type accrualEntry struct {
+	Seq       uint64    `json:"seq"`
+	From      time.Time `json:"from"`
+	To        time.Time `json:"to"`
+	Days      int64     `json:"days"`
+	Principal *decimal  `json:"principal"`
+	Rate      *decimal  `json:"rate"`
+	Amount    *decimal  `json:"amount"`
+	Accrued   *decimal  `json:"accrued"`
+	TxID      string    `json:"txId"`
+}
+
+func accrualKey(stub shim.ChaincodeStubInterface, recordID string) (string, error) {
+	return stub.CreateCompositeKey(accrualObjType, []string{recordID})
+}
+
+// accruedAmount is principal * rate * days / basis, rounded half to even to
+// the currency's decimal places.
+func (a *accrual) accruedAmount(days int64) *decimal {
+	scale := currencyScale(a.Principal.Currency)
+	interest := a.Principal.Amount.mul(a.Rate, a.Principal.Amount.scale+a.Rate.scale)
+	interest = interest.mul(newDecimal(days, 0), interest.scale)
+	return interest.quo(newDecimal(dayCountBases[a.DayCount], 0), scale)
+}
+
+// setAccrual sets the terms a record accrues on from now on, accruing what it
+// accrued on its former terms first.
+func (cc *SimpleChaincode) setAccrual(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.setAccrual")
+
+	if len(args) != 5 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d", len(args), 5)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	recordID, currency, principalArg, rateArg, dayCount := args[0], args[1], args[2], args[3], args[4]
+	logger.Debugf("record: %s, principal: %s %s, rate: %s, day count: %s",
+		recordID, principalArg, currency, rateArg, dayCount)
+
+	if err := requireAdmin(stub); err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 403, Message: message}
+	}
+
+	principal, err := parseMoney(currency, principalArg)
+	if err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	rate, err := decimalOf(rateArg)
+	if err != nil || rate.Sign() < 0 || rate.scale > accrualRateScale {
+		message := fmt.Sprintf("rate must be a non-negative decimal with at most %d decimal places, got \"%s\"",
+			accrualRateScale, rateArg)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	if _, ok := dayCountBases[dayCount]; !ok {
+		message := fmt.Sprintf("unknown day count: %s, expected one of {%s, %s}", dayCount, dayCountAct365, dayCountAct360)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	now, err := txTime(stub)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the transaction timestamp: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	key, err := accrualKey(stub, recordID)
+	if err != nil {
+		message := fmt.Sprintf("unable to create a composite key: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	var a accrual
+	found, err := getJSON(stub, key, &a)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the accrual of %s: %s", recordID, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if found {
+		if a.Principal.Currency != currency {
+			message := fmt.Sprintf("the record %s accrues in %s, not %s", recordID, a.Principal.Currency, currency)
+			logger.Error(message)
+			return pb.Response{Status: 409, Message: message}
+		}
+
+		if _, err := accrueDays(stub, &a, now); err != nil {
+			message := fmt.Sprintf("unable to accrue %s: %s", recordID, err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+	} else {
+		a = accrual{RecordID: recordID, AccruedUntil: now, Accrued: newDecimal(0, currencyScale(currency))}
+	}
+
+	a.Principal, a.Rate, a.DayCount = principal, rate, dayCount
+	if err := putJSON(stub, key, a); err != nil {
+		message := fmt.Sprintf("unable to put the accrual of %s: %s", recordID, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.setAccrual exited successfully")
+	return shim.Success(nil)
+}
+
+// accrueDays accrues a over the whole days until now, recording an entry, and
+// returns it, or nil if not a day has passed.
+func accrueDays(stub shim.ChaincodeStubInterface, a *accrual, now time.Time) (*accrualEntry, error) {
+	days := int64(now.Sub(a.AccruedUntil) / oneDay)
+	if days <= 0 {
+		return nil, nil
+	}
+
+	a.Seq++
+	entry := &accrualEntry{
+		Seq:       a.Seq,
+		From:      a.AccruedUntil,
+		To:        a.AccruedUntil.Add(time.Duration(days) * oneDay),
+		Days:      days,
+		Amount:    a.accruedAmount(days),
+		TxID:      stub.GetTxID(),
+		Principal: a.Principal.Amount,
+		Rate:      a.Rate,
+	}
+	a.Accrued.add(entry.Amount)
+	a.AccruedUntil = entry.To
+	entry.Accrued = &decimal{}
+	entry.Accrued.add(a.Accrued)
+
+	entryKey, err := stub.CreateCompositeKey(accrualEntryObjType, []string{a.RecordID, fmt.Sprintf("%020d", a.Seq)})
+	if err != nil {
+		return nil, err
+	}
+
+	return entry, putJSON(stub, entryKey, entry)
+}
+
+// accrue accrues the interest or fee of a record up to the transaction
+// timestamp and returns the new audit entry, or nothing if not a whole day
+// has passed since the last accrual.
+func (cc *SimpleChaincode) accrue(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.accrue")
+
+	if len(args) != 1 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d", len(args), 1)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	recordID := args[0]
+	logger.Debugf("record: %s", recordID)
+
+	key, err := accrualKey(stub, recordID)
+	if err != nil {
+		message := fmt.Sprintf("unable to create a composite key: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	var a accrual
+	found, err := getJSON(stub, key, &a)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the accrual of %s: %s", recordID, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if !found {
+		message := fmt.Sprintf("the record %s doesn't accrue", recordID)
+		logger.Error(message)
+		return pb.Response{Status: 404, Message: message}
+	}
+
+	now, err := txTime(stub)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the transaction timestamp: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	entry, err := accrueDays(stub, &a, now)
+	if err != nil {
+		message := fmt.Sprintf("unable to accrue %s: %s", recordID, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if entry == nil {
+		logger.Info("SimpleChaincode.accrue exited successfully")
+		return shim.Success(nil)
+	}
+
+	if err := putJSON(stub, key, a); err != nil {
+		message := fmt.Sprintf("unable to put the accrual of %s: %s", recordID, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	result, err := json.Marshal(entry)
+	if err != nil {
+		message := fmt.Sprintf("unable to marshal the result: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.accrue exited successfully")
+	return shim.Success(result)
+}
+
+type accrualTrail struct {
+	accrual
+	Entries []accrualEntry `json:"entries"`
+}
+
+// getAccruals returns the terms and the audit trail of the accruals of a
+// record.
+func (cc *SimpleChaincode) getAccruals(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.getAccruals")
+
+	if len(args) != 1 && len(args) != 2 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d or %d", len(args), 1, 2)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	recordID, format := args[0], formatJSON
+	if len(args) == 2 {
+		format = args[1]
+	}
+	logger.Debugf("record: %s, format: %s", recordID, format)
+
+	if err := checkFormat(format); err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	key, err := accrualKey(stub, recordID)
+	if err != nil {
+		message := fmt.Sprintf("unable to create a composite key: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	trail := accrualTrail{Entries: []accrualEntry{}}
+	found, err := getJSON(stub, key, &trail.accrual)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the accrual of %s: %s", recordID, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if !found {
+		message := fmt.Sprintf("the record %s doesn't accrue", recordID)
+		logger.Error(message)
+		return pb.Response{Status: 404, Message: message}
+	}
+
+	it, err := stub.GetStateByPartialCompositeKey(accrualEntryObjType, []string{recordID})
+	if err != nil {
+		message := fmt.Sprintf("unable to get an iterator over the accruals of %s: %s", recordID, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+	defer it.Close()
+
+	for it.HasNext() {
+		response, err := it.Next()
+		if err != nil {
+			message := fmt.Sprintf("unable to get the next element: %s", err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		var entry accrualEntry
+		if err := json.Unmarshal(response.Value, &entry); err != nil {
+			message := fmt.Sprintf("unable to unmarshal the accrual entry: %s", err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+		trail.Entries = append(trail.Entries, entry)
+	}
+
+	result, err := marshalResult(trail, format)
+	if err != nil {
+		message := fmt.Sprintf("unable to marshal the result: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.getAccruals exited successfully")
+	return shim.Success(result)
+}
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/core/chaincode/shim/ext/cid"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+const (
+	accessObjType = reservedObjTypePrefix + "access"
+
+	// anyObjType is the object type whose access policy applies to the
+	// types that have none of their own.
+	anyObjType = "*"
+
+	accessWrite  = "write"
+	accessDelete = "delete"
+)
+
+// attributesOID is the certificate extension the Fabric CA puts the
+// attributes of an identity in, as {"attrs": {name: value}}.
+var attributesOID = asn1.ObjectIdentifier{1, 2, 3, 4, 5, 6, 7, 8, 1}
+
+// accessRule admits the callers of any of MSPIDs whose certificates carry all
+// of Attributes; an empty list or set leaves out the corresponding check.
+type accessRule struct {
+	MSPIDs     []string          `json:"mspIds,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// accessPolicy restricts who writes and who deletes the records of an object
+// type. An operation without a rule is open to anyone.
+type accessPolicy struct {
+	Write  *accessRule `json:"write,omitempty"`
+	Delete *accessRule `json:"delete,omitempty"`
+}
+
+func (p *accessPolicy) rule(operation string) *accessRule {
+	if operation == accessDelete {
+		return p.Delete
+	}
+
+	return p.Write
+}
+
+// identity is the caller as whoami describes it.
+type identity struct {
+	MSPID      string            `json:"mspId"`
+	ID         string            `json:"id"`
+	Subject    string            `json:"subject"`
+	Issuer     string            `json:"issuer"`
+	Attributes map[string]string `json:"attributes"`
+}
+
+// certificateAttributes returns the attributes the Fabric CA issued cert
+// with, if any.
+func certificateAttributes(cert *x509.Certificate) (map[string]string, error) {
+	attributes := map[string]string{}
+	for _, extension := range cert.Extensions {
+		if !extension.Id.Equal(attributesOID) {
+			continue
+		}
+
+		var attrs struct {
+			Attrs map[string]string `json:"attrs"`
+		}
+		if err := json.Unmarshal(extension.Value, &attrs); err != nil {
+			return nil, fmt.Errorf("unable to parse the attributes of the certificate: %s", err.Error())
+		}
+
+		for name, value := range attrs.Attrs {
+			attributes[name] = value
+		}
+	}
+
+	return attributes, nil
+}
+
+func readAccessPolicy(stub shim.ChaincodeStubInterface, objType string) (*accessPolicy, error) {
+	policyKey, err := stub.CreateCompositeKey(accessObjType, []string{objType})
+	if err != nil {
+		return nil, err
+	}
+
+	var policy accessPolicy
+	found, err := getJSON(stub, policyKey, &policy)
+	if err != nil || !found {
+		return nil, err
+	}
+
+	return &policy, nil
+}
+
+// admits reports whether the caller satisfies rule, and if not, why.
+func (rule *accessRule) admits(stub shim.ChaincodeStubInterface) (bool, string, error) {
+	if len(rule.MSPIDs) > 0 {
+		mspID, err := callerMSPID(stub)
+		if err != nil {
+			return false, "", err
+		}
+
+		member := false
+		for _, id := range rule.MSPIDs {
+			member = member || id == mspID
+		}
+		if !member {
+			return false, fmt.Sprintf("the MSP %s isn't one of {%s}", mspID, strings.Join(rule.MSPIDs, ", ")), nil
+		}
+	}
+
+	names := make([]string, 0, len(rule.Attributes))
+	for name := range rule.Attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		value, found, err := cid.GetAttributeValue(stub, name)
+		if err != nil {
+			return false, "", fmt.Errorf("unable to get the attribute %s of the caller: %s", name, err.Error())
+		}
+
+		if !found || value != rule.Attributes[name] {
+			return false, fmt.Sprintf("the certificate doesn't carry %s=%s", name, rule.Attributes[name]), nil
+		}
+	}
+
+	return true, "", nil
+}
+
+// accessDenied checks the caller against the access policy of objType, or the
+// default one, for operation. If the caller isn't allowed, or it can't be
+// told, it returns the response to fail with.
+func accessDenied(stub shim.ChaincodeStubInterface, operation, objType string) (pb.Response, bool) {
+	policy, err := readAccessPolicy(stub, objType)
+	if err == nil && policy == nil {
+		policy, err = readAccessPolicy(stub, anyObjType)
+	}
+	if err != nil {
+		message := fmt.Sprintf("unable to get the access policy of the type \"%s\": %s", objType, err.Error())
+		logger.Error(message)
+		return shim.Error(message), true
+	}
+
+	if policy == nil || policy.rule(operation) == nil {
+		return pb.Response{}, false
+	}
+
+	ok, reason, err := policy.rule(operation).admits(stub)
+	if err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return shim.Error(message), true
+	}
+
+	if !ok {
+		message := fmt.Sprintf("the caller isn't allowed to %s records of the type \"%s\": %s",
+			operation, objType, reason)
+		logger.Error(message)
+		return pb.Response{Status: 403, Message: message}, true
+	}
+
+	return pb.Response{}, false
+}
+
+// setAccessPolicy sets the access policy of an object type, or with
+// anyObjType, the default one. An empty policy, {}, lifts the restrictions.
+func (cc *SimpleChaincode) setAccessPolicy(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.setAccessPolicy")
+
+	if len(args) != 2 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d", len(args), 2)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	objType, policyArg := args[0], args[1]
+	logger.Debugf("type: %s, policy: %s", objType, policyArg)
+
+	if err := requireAdmin(stub); err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 403, Message: message}
+	}
+
+	if strings.HasPrefix(objType, reservedObjTypePrefix) {
+		message := fmt.Sprintf("an access policy can't be set for the object type \"%s\"", objType)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	var policy accessPolicy
+	if err := json.Unmarshal([]byte(policyArg), &policy); err != nil {
+		message := fmt.Sprintf("policy must be a JSON object of {write, delete} rules: %s", err.Error())
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	policyKey, err := stub.CreateCompositeKey(accessObjType, []string{objType})
+	if err != nil {
+		message := fmt.Sprintf("unable to create a composite key: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if policy.Write == nil && policy.Delete == nil {
+		err = stub.DelState(policyKey)
+	} else {
+		err = putJSON(stub, policyKey, policy)
+	}
+	if err != nil {
+		message := fmt.Sprintf("unable to put the access policy: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.setAccessPolicy exited successfully")
+	return shim.Success(nil)
+}
+
+// getAccessPolicy returns the access policy of an object type, {} if it has
+// none of its own.
+func (cc *SimpleChaincode) getAccessPolicy(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.getAccessPolicy")
+
+	if len(args) != 1 && len(args) != 2 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d or %d", len(args), 1, 2)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	objType, format := args[0], formatJSON
+	if len(args) == 2 {
+		format = args[1]
+	}
+	logger.Debugf("type: %s, format: %s", objType, format)
+
+	if err := checkFormat(format); err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	policy, err := readAccessPolicy(stub, objType)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the access policy: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if policy == nil {
+		policy = &accessPolicy{}
+	}
+
+	result, err := marshalResult(policy, format)
+	if err != nil {
+		message := fmt.Sprintf("unable to marshal the result: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.getAccessPolicy exited successfully")
+	return shim.Success(result)
+}
+
+// whoami returns the caller's identity as access policies see it.
+func (cc *SimpleChaincode) whoami(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.whoami")
+
+	if len(args) > 1 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d or %d", len(args), 0, 1)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	format := formatJSON
+	if len(args) == 1 {
+		format = args[0]
+	}
+	logger.Debugf("format: %s", format)
+
+	if err := checkFormat(format); err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	mspID, err := callerMSPID(stub)
+	if err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	id, err := callerID(stub)
+	if err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	cert, err := cid.GetX509Certificate(stub)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the caller's certificate: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	attributes, err := certificateAttributes(cert)
+	if err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	caller := identity{
+		MSPID:      mspID,
+		ID:         id,
+		Subject:    cert.Subject.String(),
+		Issuer:     cert.Issuer.String(),
+		Attributes: attributes,
+	}
+
+	result, err := marshalResult(caller, format)
+	if err != nil {
+		message := fmt.Sprintf("unable to marshal the result: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.whoami exited successfully")
+	return shim.Success(result)
+}
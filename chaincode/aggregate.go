@@ -0,0 +1,268 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// The aggregate functions compute a single number over the records of a range
+// of simple keys, as getByRange returns them, so that clients don't have to
+// fetch them all to do it themselves.
+
+// avgExtraScale is how many more decimal places the mean has than the values
+// it's taken of, up to maxScale.
+const avgExtraScale = 6
+
+type rangeCount struct {
+	Count int `json:"count"`
+}
+
+// fieldAggregate is the result of sumField, minField, maxField and avgField.
+// Count is the number of records whose field has a numeric value, Skipped the
+// number of the others, e.g. without the field or locked. Value is null when
+// there's nothing to aggregate.
+type fieldAggregate struct {
+	Field    string   `json:"field"`
+	Function string   `json:"function"`
+	Count    int      `json:"count"`
+	Skipped  int      `json:"skipped"`
+	Value    *decimal `json:"value"`
+}
+
+// fieldTokens parses field, a JSON pointer, or the name of a top-level field
+// for short.
+func fieldTokens(field string) ([]string, error) {
+	if field == "" {
+		return nil, fmt.Errorf("field must be a non-empty string")
+	}
+
+	if !strings.HasPrefix(field, "/") {
+		return []string{field}, nil
+	}
+
+	return parsePointer(field)
+}
+
+// numericField returns the value tokens point to within the JSON value raw,
+// if it's a number, or a string of a decimal, as decimals are stored.
+func numericField(raw []byte, tokens []string) (*decimal, bool) {
+	doc, err := decodeJSON(raw)
+	if err != nil {
+		return nil, false
+	}
+
+	target, err := resolvePointer(doc, tokens)
+	if err != nil {
+		return nil, false
+	}
+
+	var s string
+	switch v := target.(type) {
+	case json.Number:
+		s = v.String()
+	case string:
+		s = v
+	default:
+		return nil, false
+	}
+
+	d, err := decimalOf(s)
+	return d, err == nil
+}
+
+// countRange returns the number of simple keys in [keyFrom, keyTo).
+func countRange(stub shim.ChaincodeStubInterface, keyFrom, keyTo string) (int, error) {
+	it, err := stub.GetStateByRange(keyFrom, keyTo)
+	if err != nil {
+		return 0, err
+	}
+	defer it.Close()
+
+	count := 0
+	for it.HasNext() {
+		response, err := it.Next()
+		if err != nil {
+			return 0, err
+		}
+
+		if !isCompositeKey(response.Key) {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+func (cc *SimpleChaincode) countByRange(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.countByRange")
+
+	if len(args) != 2 && len(args) != 3 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d or %d", len(args), 2, 3)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	keyFrom, keyTo, format := args[0], args[1], formatJSON
+	if len(args) == 3 {
+		format = args[2]
+	}
+	logger.Debugf("range: [\"%s\", \"%s\"), format: %s", keyFrom, keyTo, format)
+
+	if err := checkFormat(format); err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	count, err := countRange(stub, keyFrom, keyTo)
+	if err != nil {
+		message := fmt.Sprintf("unable to count the keys in the range [\"%s\", \"%s\"): %s",
+			keyFrom, keyTo, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	result, err := marshalResult(rangeCount{count}, format)
+	if err != nil {
+		message := fmt.Sprintf("unable to marshal the result: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.countByRange exited successfully")
+	return shim.Success(result)
+}
+
+// sumField returns the sum of a numeric field of the JSON records of a range.
+func (cc *SimpleChaincode) sumField(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.sumField")
+	return cc.aggregateField(stub, args, "sum")
+}
+
+func (cc *SimpleChaincode) minField(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.minField")
+	return cc.aggregateField(stub, args, "min")
+}
+
+func (cc *SimpleChaincode) maxField(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.maxField")
+	return cc.aggregateField(stub, args, "max")
+}
+
+// avgField returns the mean of a numeric field of the JSON records of a
+// range, rounded half to even to avgExtraScale more decimal places than the
+// values have.
+func (cc *SimpleChaincode) avgField(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.avgField")
+	return cc.aggregateField(stub, args, "avg")
+}
+
+func (cc *SimpleChaincode) aggregateField(stub shim.ChaincodeStubInterface, args []string, function string) pb.Response {
+	if len(args) != 3 && len(args) != 4 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d or %d", len(args), 3, 4)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	keyFrom, keyTo, field, format := args[0], args[1], args[2], formatJSON
+	if len(args) == 4 {
+		format = args[3]
+	}
+	logger.Debugf("range: [\"%s\", \"%s\"), field: %s, format: %s", keyFrom, keyTo, field, format)
+
+	if err := checkFormat(format); err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	tokens, err := fieldTokens(field)
+	if err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	now, err := txTime(stub)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the transaction timestamp: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	it, err := stub.GetStateByRange(keyFrom, keyTo)
+	if err != nil {
+		message := fmt.Sprintf("unable to get an iterator over the range [\"%s\", \"%s\"): %s",
+			keyFrom, keyTo, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+	defer it.Close()
+
+	aggregate := fieldAggregate{Field: field, Function: function}
+	for it.HasNext() {
+		response, err := it.Next()
+		if err != nil {
+			message := fmt.Sprintf("unable to get the next element: %s", err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		if isCompositeKey(response.Key) {
+			continue
+		}
+
+		r := decodeRecord(response.Value)
+		if err := r.verify(); err != nil {
+			message := fmt.Sprintf("unable to get a value for the key %s: %s", response.Key, err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		if r.lockedAt(now) || r.expiredAt(now) {
+			aggregate.Skipped++
+			continue
+		}
+
+		raw, err := r.rawValue()
+		value, ok := numericField(raw, tokens)
+		if err != nil || !ok {
+			aggregate.Skipped++
+			continue
+		}
+
+		aggregate.Count++
+		switch {
+		case aggregate.Value == nil:
+			aggregate.Value = value
+		case function == "sum" || function == "avg":
+			aggregate.Value.add(value)
+		case function == "min" && value.cmp(aggregate.Value) < 0:
+			aggregate.Value = value
+		case function == "max" && value.cmp(aggregate.Value) > 0:
+			aggregate.Value = value
+		}
+	}
+
+	if function == "avg" && aggregate.Value != nil {
+		scale := aggregate.Value.scale + avgExtraScale
+		if scale > maxScale {
+			scale = maxScale
+		}
+		aggregate.Value = aggregate.Value.quo(newDecimal(int64(aggregate.Count), 0), scale)
+	}
+
+	result, err := marshalResult(aggregate, format)
+	if err != nil {
+		message := fmt.Sprintf("unable to marshal the result: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.aggregateField exited successfully")
+	return shim.Success(result)
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"math/big"
+)
+
+// amount is an arbitrary-precision integer, so that sums never overflow. It
+// is the unscaled value of decimals.
+type amount struct {
+	big.Int
+}
+
+func (a *amount) cmp(b *amount) int {
+	return a.Int.Cmp(&b.Int)
+}
+
+func (a *amount) add(b *amount) {
+	a.Int.Add(&a.Int, &b.Int)
+}
+
+func (a *amount) sub(b *amount) {
+	a.Int.Sub(&a.Int, &b.Int)
+}
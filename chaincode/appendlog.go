@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+const (
+	logObjType     = reservedObjTypePrefix + "log"
+	logHeadObjType = reservedObjTypePrefix + "loghead"
+)
+
+// logEntry is an immutable element of a per-key append-only log. Sequence
+// numbers start at 1 and have no gaps.
+type logEntry struct {
+	Seq       uint64    `json:"seq"`
+	Entry     string    `json:"entry"`
+	TxID      string    `json:"txId"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+type logPage struct {
+	Entries []logEntry `json:"entries"`
+	HeadSeq uint64     `json:"headSeq"`
+}
+
+func (page logPage) ndjsonLines() []interface{} {
+	lines := make([]interface{}, 0, len(page.Entries)+1)
+	for _, entry := range page.Entries {
+		lines = append(lines, entry)
+	}
+
+	cursor := struct {
+		HeadSeq uint64 `json:"headSeq"`
+	}{page.HeadSeq}
+
+	return append(lines, ndjsonCursor{cursor})
+}
+
+func logEntryKey(stub shim.ChaincodeStubInterface, objType, key string, seq uint64) (string, error) {
+	return stub.CreateCompositeKey(logObjType, []string{objType, key, fmt.Sprintf("%020d", seq)})
+}
+
+func logHead(stub shim.ChaincodeStubInterface, objType, key string) (string, uint64, error) {
+	headKey, err := stub.CreateCompositeKey(logHeadObjType, []string{objType, key})
+	if err != nil {
+		return "", 0, err
+	}
+
+	headBytes, err := stub.GetState(headKey)
+	if err != nil {
+		return "", 0, err
+	}
+
+	if headBytes == nil {
+		return headKey, 0, nil
+	}
+
+	seq, err := strconv.ParseUint(string(headBytes), 10, 64)
+	return headKey, seq, err
+}
+
+func (cc *SimpleChaincode) append(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.append")
+
+	if len(args) != 3 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d", len(args), 3)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	objType, key, entry := args[0], args[1], args[2]
+	logger.Debugf("type: %s, key: %s, entry: %s", objType, key, entry)
+
+	if key == "" {
+		message := "key must be a non-empty string"
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	headKey, seq, err := logHead(stub, objType, key)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the head of the log %s: %s", key, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+	seq++
+
+	now, err := txTime(stub)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the transaction timestamp: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	entryKey, err := logEntryKey(stub, objType, key, seq)
+	if err != nil {
+		message := fmt.Sprintf("unable to create a composite key: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	entryBytes, err := json.Marshal(logEntry{Seq: seq, Entry: entry, TxID: stub.GetTxID(), Timestamp: now})
+	if err != nil {
+		message := fmt.Sprintf("unable to marshal the log entry: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if err := stub.PutState(entryKey, entryBytes); err != nil {
+		message := fmt.Sprintf("unable to put the log entry: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	seqBytes := []byte(strconv.FormatUint(seq, 10))
+	if err := stub.PutState(headKey, seqBytes); err != nil {
+		message := fmt.Sprintf("unable to update the head of the log %s: %s", key, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.append exited successfully")
+	return shim.Success(seqBytes)
+}
+
+func (cc *SimpleChaincode) readLog(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.readLog")
+
+	if len(args) != 4 && len(args) != 5 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d or %d", len(args), 4, 5)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	objType, key, format := args[0], args[1], formatJSON
+	if len(args) == 5 {
+		format = args[4]
+	}
+	logger.Debugf("type: %s, key: %s, fromSeq: %s, limit: %s, format: %s", objType, key, args[2], args[3], format)
+
+	if err := checkFormat(format); err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	fromSeq, err := strconv.ParseUint(args[2], 10, 64)
+	if err != nil {
+		message := fmt.Sprintf("fromSeq must be a non-negative integer, got \"%s\"", args[2])
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+	if fromSeq == 0 {
+		fromSeq = 1
+	}
+
+	limit, err := strconv.Atoi(args[3])
+	if err != nil || limit < 1 || limit > maxPageSize {
+		message := fmt.Sprintf("limit must be an integer in [1, %d], got \"%s\"", maxPageSize, args[3])
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	_, head, err := logHead(stub, objType, key)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the head of the log %s: %s", key, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	// the sequence numbers are contiguous, so the entries are read directly
+	// instead of scanning the log from the start
+	page := logPage{Entries: []logEntry{}, HeadSeq: head}
+	for seq := fromSeq; seq <= head && len(page.Entries) < limit; seq++ {
+		entryKey, err := logEntryKey(stub, objType, key, seq)
+		if err != nil {
+			message := fmt.Sprintf("unable to create a composite key: %s", err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		entryBytes, err := stub.GetState(entryKey)
+		if err != nil {
+			message := fmt.Sprintf("unable to get the log entry %d: %s", seq, err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		var entry logEntry
+		if err := json.Unmarshal(entryBytes, &entry); err != nil {
+			message := fmt.Sprintf("unable to unmarshal the log entry %d: %s", seq, err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		page.Entries = append(page.Entries, entry)
+	}
+
+	result, err := marshalResult(page, format)
+	if err != nil {
+		message := fmt.Sprintf("unable to marshal the result: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.readLog exited successfully")
+	return shim.Success(result)
+}
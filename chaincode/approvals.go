@@ -0,0 +1,426 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// A change of a record proposed with proposeChange is applied once members of
+// Threshold distinct organizations have approved it, the proposer's included.
+// Organizations are told apart by the MSP of the transaction creators, so a
+// single organization can't approve twice with different identities. Unlike
+// propose, which collects signatures of named certificates, the approvers
+// are whoever is allowed to write the object type.
+const (
+	changeRequestObjType     = reservedObjTypePrefix + "changerequest"
+	approvalThresholdObjType = reservedObjTypePrefix + "approvals"
+
+	// defaultApprovalThreshold is the threshold of the object types that
+	// have none set
+	defaultApprovalThreshold = 2
+
+	changeStatusPending = "pending"
+	changeStatusApplied = "applied"
+	// a stale change was approved after the record had changed since it was
+	// proposed, and isn't applied
+	changeStatusStale = "stale"
+
+	changeProposedEvent = "ChangeProposed"
+	changeApprovedEvent = "ChangeApproved"
+	changeAppliedEvent  = "ChangeApplied"
+)
+
+// changeApproval is the approval of a change by a member of an organization.
+type changeApproval struct {
+	MSPID      string    `json:"mspId"`
+	Subject    string    `json:"subject,omitempty"`
+	ApprovedAt time.Time `json:"approvedAt"`
+	TxID       string    `json:"txId"`
+}
+
+// changeRequest is a pending write of Value under ObjType/Key. BaseVersion is the
+// version of the record when the change was proposed, 0 if it had none.
+type changeRequest struct {
+	ID          string           `json:"id"`
+	ObjType     string           `json:"objType"`
+	Key         string           `json:"key"`
+	Value       string           `json:"value"`
+	BaseVersion uint64           `json:"baseVersion"`
+	Threshold   int              `json:"threshold"`
+	Approvals   []changeApproval `json:"approvals"`
+	Status      string           `json:"status"`
+	ProposedAt  time.Time        `json:"proposedAt"`
+	// AppliedAt and AppliedTxID are set once the threshold is met
+	AppliedAt   *time.Time `json:"appliedAt,omitempty"`
+	AppliedTxID string     `json:"appliedTxId,omitempty"`
+}
+
+func changeRequestKey(stub shim.ChaincodeStubInterface, id string) (string, error) {
+	return stub.CreateCompositeKey(changeRequestObjType, []string{id})
+}
+
+// approvalThreshold returns the number of organizations that approve the
+// changes of objType.
+func approvalThreshold(stub shim.ChaincodeStubInterface, objType string) (int, error) {
+	thresholdKey, err := stub.CreateCompositeKey(approvalThresholdObjType, []string{objType})
+	if err != nil {
+		return 0, err
+	}
+
+	threshold := defaultApprovalThreshold
+	if _, err := getJSON(stub, thresholdKey, &threshold); err != nil {
+		return 0, err
+	}
+
+	return threshold, nil
+}
+
+// approveChange adds the approval of the caller's organization to c and
+// applies c if that meets its threshold. It returns the status to fail with
+// if the caller can't approve.
+func approveChange(stub shim.ChaincodeStubInterface, c *changeRequest) (int32, error) {
+	now, err := txTime(stub)
+	if err != nil {
+		return 500, fmt.Errorf("unable to get the transaction timestamp: %s", err.Error())
+	}
+
+	approver, err := txCreator(stub)
+	if err != nil {
+		return 500, err
+	}
+
+	for _, a := range c.Approvals {
+		if a.MSPID == approver.MSPID {
+			return 409, fmt.Errorf("the change %s is already approved by %s", c.ID, approver.MSPID)
+		}
+	}
+
+	c.Approvals = append(c.Approvals, changeApproval{MSPID: approver.MSPID, Subject: approver.Subject,
+		ApprovedAt: now, TxID: stub.GetTxID()})
+	if len(c.Approvals) < c.Threshold {
+		return 0, nil
+	}
+
+	compositeKey, err := createCompositeKey(stub, c.ObjType, c.Key)
+	if err != nil {
+		return 500, fmt.Errorf("unable to create a composite key: %s", err.Error())
+	}
+
+	old, err := readRecord(stub, compositeKey)
+	if err != nil {
+		return 500, fmt.Errorf("unable to get a value for the key %s: %s", c.Key, err.Error())
+	}
+
+	var version uint64
+	if old != nil {
+		version = old.Version
+	}
+
+	if version != c.BaseVersion {
+		c.Status = changeStatusStale
+		return 0, nil
+	}
+
+	r, err := putRecord(stub, compositeKey, c.Value)
+	if err != nil {
+		status := int32(500)
+		if _, ok := err.(*invalidValueError); ok {
+			status = 400
+		}
+		return status, fmt.Errorf("unable to put a key-value pair: %s", err.Error())
+	}
+
+	if err := appendAudit(stub, "approvedChange", c.ObjType, c.Key, r); err != nil {
+		return 500, fmt.Errorf("unable to append to the audit log: %s", err.Error())
+	}
+
+	c.Status, c.AppliedAt, c.AppliedTxID = changeStatusApplied, &now, stub.GetTxID()
+	return 0, nil
+}
+
+// putChangeRequest stores c and emits its event, the change itself, which replaces
+// the event of the mutation of a change applied.
+func putChangeRequest(stub shim.ChaincodeStubInterface, c *changeRequest, event string) error {
+	key, err := changeRequestKey(stub, c.ID)
+	if err != nil {
+		return err
+	}
+
+	if err := putJSON(stub, key, c); err != nil {
+		return err
+	}
+
+	changeBytes, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	return stub.SetEvent(event, changeBytes)
+}
+
+// setApprovalThreshold sets the number of organizations that must approve
+// the changes of an object type, the simple keys for an empty one. Only
+// admins set it; it applies to the changes proposed from then on.
+func (cc *SimpleChaincode) setApprovalThreshold(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.setApprovalThreshold")
+
+	if len(args) != 2 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d", len(args), 2)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	objType, thresholdArg := args[0], args[1]
+	logger.Debugf("type: %s, threshold: %s", objType, thresholdArg)
+
+	if err := requireAdmin(stub); err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 403, Message: message}
+	}
+
+	if strings.HasPrefix(objType, reservedObjTypePrefix) {
+		message := fmt.Sprintf("an approval threshold can't be set for the object type \"%s\"", objType)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	threshold, err := strconv.Atoi(thresholdArg)
+	if err != nil || threshold < 1 {
+		message := fmt.Sprintf("threshold must be a positive integer, got \"%s\"", thresholdArg)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	thresholdKey, err := stub.CreateCompositeKey(approvalThresholdObjType, []string{objType})
+	if err != nil {
+		message := fmt.Sprintf("unable to create a composite key: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if err := putJSON(stub, thresholdKey, threshold); err != nil {
+		message := fmt.Sprintf("unable to put the approval threshold: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.setApprovalThreshold exited successfully")
+	return shim.Success(nil)
+}
+
+// proposeChange holds a write of newValue under objType/key until enough
+// organizations approve it, see approve, and returns the change. The proposal
+// is the approval of the proposer's organization.
+func (cc *SimpleChaincode) proposeChange(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.proposeChange")
+
+	if len(args) != 3 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d", len(args), 3)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	objType, key, value := args[0], args[1], args[2]
+	logger.Debugf("type: %s, key: %s, value: %s", objType, key, value)
+
+	if response, denied := accessDenied(stub, accessWrite, objType); denied {
+		return response
+	}
+
+	compositeKey, err := createCompositeKey(stub, objType, key)
+	if err != nil {
+		message := fmt.Sprintf("unable to create a composite key: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	old, err := readRecord(stub, compositeKey)
+	if err != nil {
+		message := fmt.Sprintf("unable to get a value for the key %s: %s", key, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	threshold, err := approvalThreshold(stub, objType)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the approval threshold of the object type %s: %s", objType, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	now, err := txTime(stub)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the transaction timestamp: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	c := changeRequest{ID: newUUID(stub), ObjType: objType, Key: key, Value: value, Threshold: threshold,
+		Approvals: []changeApproval{}, Status: changeStatusPending, ProposedAt: now}
+	if old != nil {
+		c.BaseVersion = old.Version
+	}
+
+	status, err := approveChange(stub, &c)
+	if err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: status, Message: message}
+	}
+
+	event := changeProposedEvent
+	if c.Status == changeStatusApplied {
+		event = changeAppliedEvent
+	}
+	if err := putChangeRequest(stub, &c, event); err != nil {
+		message := fmt.Sprintf("unable to put the change: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	result, err := json.Marshal(c)
+	if err != nil {
+		message := fmt.Sprintf("unable to marshal the result: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.proposeChange exited successfully")
+	return shim.Success(result)
+}
+
+// approve adds the approval of the caller's organization to a pending change.
+// The approval that meets the threshold of the change applies it in the same
+// transaction, unless the record changed since the change was proposed: the
+// change is then stale and the record left alone. It returns the change.
+func (cc *SimpleChaincode) approve(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.approve")
+
+	if len(args) != 1 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d", len(args), 1)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	id := args[0]
+	logger.Debugf("change: %s", id)
+
+	key, err := changeRequestKey(stub, id)
+	if err != nil {
+		message := fmt.Sprintf("unable to create a composite key: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	var c changeRequest
+	found, err := getJSON(stub, key, &c)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the change %s: %s", id, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if !found {
+		message := fmt.Sprintf("the change %s not found", id)
+		logger.Error(message)
+		return pb.Response{Status: 404, Message: message}
+	}
+
+	if response, denied := accessDenied(stub, accessWrite, c.ObjType); denied {
+		return response
+	}
+
+	if c.Status != changeStatusPending {
+		message := fmt.Sprintf("the change %s is already %s", id, c.Status)
+		logger.Error(message)
+		return pb.Response{Status: 409, Message: message}
+	}
+
+	status, err := approveChange(stub, &c)
+	if err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: status, Message: message}
+	}
+
+	event := changeApprovedEvent
+	if c.Status == changeStatusApplied {
+		event = changeAppliedEvent
+	}
+	if err := putChangeRequest(stub, &c, event); err != nil {
+		message := fmt.Sprintf("unable to put the change: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	result, err := json.Marshal(c)
+	if err != nil {
+		message := fmt.Sprintf("unable to marshal the result: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.approve exited successfully")
+	return shim.Success(result)
+}
+
+// getChange returns a change and its approvals.
+func (cc *SimpleChaincode) getChange(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.getChange")
+
+	if len(args) != 1 && len(args) != 2 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d or %d", len(args), 1, 2)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	id, format := args[0], formatJSON
+	if len(args) == 2 {
+		format = args[1]
+	}
+	logger.Debugf("id: %s, format: %s", id, format)
+
+	if err := checkFormat(format); err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	key, err := changeRequestKey(stub, id)
+	if err != nil {
+		message := fmt.Sprintf("unable to create a composite key: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	var c changeRequest
+	found, err := getJSON(stub, key, &c)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the change %s: %s", id, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if !found {
+		message := fmt.Sprintf("the change %s not found", id)
+		logger.Error(message)
+		return pb.Response{Status: 404, Message: message}
+	}
+
+	result, err := marshalResult(c, format)
+	if err != nil {
+		message := fmt.Sprintf("unable to marshal the result: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.getChange exited successfully")
+	return shim.Success(result)
+}
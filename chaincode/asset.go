@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// assetObjType is the object type of assets. Unlike other values, which are
+// stored as they come, assets are checked field by field on every write and
+// stored in canonical form.
+const assetObjType = "asset"
+
+// asset is the model of the values of assets. The timestamps and the version
+// are those of the record, whatever a client passes for them.
+type asset struct {
+	ID        string                 `json:"id"`
+	Owner     string                 `json:"owner"`
+	DocType   string                 `json:"docType"`
+	Quantity  int64                  `json:"quantity"`
+	Metadata  map[string]interface{} `json:"metadata,omitempty"`
+	CreatedAt time.Time              `json:"createdAt"`
+	UpdatedAt time.Time              `json:"updatedAt"`
+	Version   uint64                 `json:"version"`
+}
+
+type fieldError struct {
+	Field string `json:"field"`
+	Error string `json:"error"`
+}
+
+// invalidValueError is what's wrong with a value that doesn't fit the model
+// of its object type, field by field.
+type invalidValueError struct {
+	objType string
+	fields  []fieldError
+}
+
+func (e *invalidValueError) Error() string {
+	problems := make([]string, len(e.fields))
+	for i, f := range e.fields {
+		problems[i] = fmt.Sprintf("%s %s", f.Field, f.Error)
+	}
+
+	return fmt.Sprintf("invalid %s: %s", e.objType, strings.Join(problems, "; "))
+}
+
+// invalidValueResponse returns the response to a write that failed with err
+// when the value doesn't fit its model, with the field errors as details.
+func invalidValueResponse(err error) (pb.Response, bool) {
+	invalid, ok := err.(*invalidValueError)
+	if !ok {
+		return pb.Response{}, false
+	}
+
+	message := invalid.Error()
+	logger.Error(message)
+	return errorResponse(errInvalidValue, message, invalid.fields), true
+}
+
+func nonEmptyString(raw json.RawMessage) (string, string) {
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil || s == "" {
+		return "", "must be a non-empty string"
+	}
+
+	return s, ""
+}
+
+// parseAsset checks the value of the asset key against the model, reporting
+// every field that doesn't fit it.
+func parseAsset(key string, raw []byte) (*asset, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil || fields == nil {
+		return nil, &invalidValueError{assetObjType, []fieldError{{"value", "must be a JSON object"}}}
+	}
+
+	var (
+		a        asset
+		problems []fieldError
+	)
+	check := func(field string, parse func(json.RawMessage) string) {
+		raw, ok := fields[field]
+		if !ok {
+			problems = append(problems, fieldError{field, "is required"})
+			return
+		}
+
+		if problem := parse(raw); problem != "" {
+			problems = append(problems, fieldError{field, problem})
+		}
+	}
+
+	check("id", func(raw json.RawMessage) string {
+		id, problem := nonEmptyString(raw)
+		if problem == "" && id != key {
+			return fmt.Sprintf("must match the key %s", key)
+		}
+
+		a.ID = id
+		return problem
+	})
+	check("owner", func(raw json.RawMessage) (problem string) {
+		a.Owner, problem = nonEmptyString(raw)
+		return problem
+	})
+	check("docType", func(raw json.RawMessage) (problem string) {
+		a.DocType, problem = nonEmptyString(raw)
+		return problem
+	})
+	check("quantity", func(raw json.RawMessage) string {
+		if err := json.Unmarshal(raw, &a.Quantity); err != nil || a.Quantity < 0 {
+			return "must be a non-negative integer"
+		}
+
+		return ""
+	})
+	if _, ok := fields["metadata"]; ok {
+		check("metadata", func(raw json.RawMessage) string {
+			if err := json.Unmarshal(raw, &a.Metadata); err != nil {
+				return "must be a JSON object"
+			}
+
+			return ""
+		})
+	}
+
+	var unknown []string
+	for field := range fields {
+		switch field {
+		case "id", "owner", "docType", "quantity", "metadata", "createdAt", "updatedAt", "version":
+		default:
+			unknown = append(unknown, field)
+		}
+	}
+	sort.Strings(unknown)
+	for _, field := range unknown {
+		problems = append(problems, fieldError{field, "is not a field of an asset"})
+	}
+
+	if len(problems) > 0 {
+		return nil, &invalidValueError{assetObjType, problems}
+	}
+
+	return &a, nil
+}
+
+// applyModel fits r, about to be stored under compositeKey, to the model of
+// its object type, if the type has one.
+func applyModel(stub shim.ChaincodeStubInterface, compositeKey string, r *record) error {
+	if !isCompositeKey(compositeKey) {
+		return nil
+	}
+
+	objType, attributes, err := stub.SplitCompositeKey(compositeKey)
+	if err != nil || objType != assetObjType || len(attributes) == 0 {
+		return nil
+	}
+
+	raw, err := r.rawValue()
+	if err != nil {
+		return err
+	}
+
+	a, err := parseAsset(attributes[len(attributes)-1], raw)
+	if err != nil {
+		return err
+	}
+	a.CreatedAt, a.UpdatedAt, a.Version = r.CreatedAt, r.UpdatedAt, r.Version
+
+	assetBytes, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+
+	r.Value, r.Encoding, r.ContentType = string(assetBytes), "", jsonContentType
+	return nil
+}
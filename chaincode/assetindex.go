@@ -0,0 +1,386 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// Assets are indexed by owner and by docType and creation time, under
+// composite keys that partial key queries resolve without a rich query, so
+// the lookups work with LevelDB as well as CouchDB. The indexes are kept up to
+// date by storeRecord and deleteRecord.
+//
+// GetStateByRange doesn't take composite keys, so the creation time index is
+// bucketed by month, like the change feed: listByTypeSince queries the
+// buckets from the month of since on.
+const (
+	ownerIndexObjType = reservedObjTypePrefix + "owner~id"
+	typeIndexObjType  = reservedObjTypePrefix + "docType~createdAt~id"
+
+	indexBucketLayout = "2006-01"
+	// indexTimeLayout has a fixed width, so that times sort as strings
+	indexTimeLayout = "2006-01-02T15:04:05.000000000Z"
+)
+
+// assetIndexKeys returns the index entries of r, stored under compositeKey,
+// none if it isn't an asset, doesn't fit the model or is marked deleted.
+func assetIndexKeys(stub shim.ChaincodeStubInterface, compositeKey string, r *record) ([]string, error) {
+	if r == nil || r.DeletedAt != nil || !isCompositeKey(compositeKey) {
+		return nil, nil
+	}
+
+	objType, attributes, err := stub.SplitCompositeKey(compositeKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if objType != assetObjType || len(attributes) == 0 {
+		return nil, nil
+	}
+
+	raw, err := r.rawValue()
+	if err != nil {
+		return nil, err
+	}
+
+	var a asset
+	if err := json.Unmarshal(raw, &a); err != nil || a.Owner == "" || a.DocType == "" {
+		return nil, nil
+	}
+
+	ownerKey, err := stub.CreateCompositeKey(ownerIndexObjType, append([]string{a.Owner}, attributes...))
+	if err != nil {
+		return nil, err
+	}
+
+	createdAt := r.CreatedAt.UTC()
+	typeKey, err := stub.CreateCompositeKey(typeIndexObjType, append([]string{
+		a.DocType, createdAt.Format(indexBucketLayout), createdAt.Format(indexTimeLayout),
+	}, attributes...))
+	if err != nil {
+		return nil, err
+	}
+
+	return []string{ownerKey, typeKey}, nil
+}
+
+// indexAsset updates the index entries of the asset stored under
+// compositeKey for r replacing it, nil for a deletion.
+func indexAsset(stub shim.ChaincodeStubInterface, compositeKey string, r *record) error {
+	old, err := readRecord(stub, compositeKey)
+	if err != nil {
+		return err
+	}
+
+	oldKeys, err := assetIndexKeys(stub, compositeKey, old)
+	if err != nil {
+		return err
+	}
+
+	newKeys, err := assetIndexKeys(stub, compositeKey, r)
+	if err != nil {
+		return err
+	}
+
+	kept := map[string]bool{}
+	for _, k := range newKeys {
+		kept[k] = true
+	}
+
+	for _, k := range oldKeys {
+		if kept[k] {
+			delete(kept, k)
+			continue
+		}
+
+		if err := stub.DelState(k); err != nil {
+			return err
+		}
+	}
+
+	for _, k := range newKeys {
+		if !kept[k] {
+			continue
+		}
+
+		if err := stub.PutState(k, presenceMarker); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// indexAssets puts the index entries of the assets stored before the
+// indexes were introduced.
+func indexAssets(stub shim.ChaincodeStubInterface, bookmark string) (string, error) {
+	return forEachKey(stub, assetObjType, bookmark, func(key string, value []byte) error {
+		keys, err := assetIndexKeys(stub, key, decodeRecord(value))
+		if err != nil {
+			return err
+		}
+
+		for _, k := range keys {
+			if err := stub.PutState(k, presenceMarker); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// resolveAsset returns the asset that an index entry with the given key
+// parts, the asset's key last, points at.
+func resolveAsset(stub shim.ChaincodeStubInterface, parts []string, now time.Time) (*queryResult, error) {
+	compositeKey, err := stub.CreateCompositeKey(assetObjType, parts)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := getRecord(stub, compositeKey)
+	if err != nil || r == nil {
+		return nil, err
+	}
+
+	return &queryResult{Key: formatKey(parts), record: r.readableAt(now)}, nil
+}
+
+// listByOwner returns the assets of an owner a page at a time.
+func (cc *SimpleChaincode) listByOwner(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.listByOwner")
+
+	if len(args) != 3 && len(args) != 4 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d or %d", len(args), 3, 4)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	owner, pageSizeArg, bookmark, format := args[0], args[1], args[2], formatJSON
+	if len(args) == 4 {
+		format = args[3]
+	}
+	logger.Debugf("owner: %s, pageSize: %s, bookmark: %s, format: %s", owner, pageSizeArg, bookmark, format)
+
+	if err := checkFormat(format); err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	if owner == "" {
+		message := "owner must be a non-empty string"
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	pageSize, err := parsePageSize(pageSizeArg)
+	if err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	now, err := txTime(stub)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the transaction timestamp: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	it, metadata, err := stub.GetStateByPartialCompositeKeyWithPagination(ownerIndexObjType, []string{owner},
+		pageSize, bookmark)
+	if err == nil && it == nil {
+		err = errPaginationUnsupported
+	}
+	if err != nil {
+		message := fmt.Sprintf("unable to get an iterator over the assets of %s: %s", owner, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+	defer it.Close()
+
+	page := queryPage{Records: queryResults{}}
+	if metadata != nil {
+		page.Bookmark, page.FetchedRecordsCount = metadata.Bookmark, metadata.FetchedRecordsCount
+	}
+	for it.HasNext() {
+		response, err := it.Next()
+		if err != nil {
+			message := fmt.Sprintf("unable to get the next element: %s", err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		_, attributes, err := stub.SplitCompositeKey(response.Key)
+		if err != nil {
+			message := fmt.Sprintf("unable to split the composite key %s: %s", response.Key, err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		entry, err := resolveAsset(stub, attributes[1:], now)
+		if err != nil {
+			message := fmt.Sprintf("unable to get the asset %s: %s", formatKey(attributes[1:]), err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		if entry != nil {
+			page.Records = append(page.Records, *entry)
+		}
+	}
+
+	result, err := marshalResult(page, format)
+	if err != nil {
+		message := fmt.Sprintf("unable to marshal the result: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.listByOwner exited successfully")
+	return shim.Success(result)
+}
+
+// listByTypeSince returns the assets of a docType created at or after since,
+// an RFC 3339 time, oldest first, up to pageSize of them. The bookmark of a
+// page resumes after its last asset; it's empty after the last page.
+func (cc *SimpleChaincode) listByTypeSince(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.listByTypeSince")
+
+	if len(args) != 4 && len(args) != 5 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d or %d", len(args), 4, 5)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	docType, sinceArg, pageSizeArg, bookmark, format := args[0], args[1], args[2], args[3], formatJSON
+	if len(args) == 5 {
+		format = args[4]
+	}
+	logger.Debugf("docType: %s, since: %s, pageSize: %s, bookmark: %s, format: %s",
+		docType, sinceArg, pageSizeArg, bookmark, format)
+
+	if err := checkFormat(format); err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	if docType == "" {
+		message := "docType must be a non-empty string"
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	since, err := time.Parse(time.RFC3339Nano, sinceArg)
+	if err != nil {
+		message := fmt.Sprintf("since must be an RFC 3339 time, got \"%s\"", sinceArg)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	pageSize, err := parsePageSize(pageSizeArg)
+	if err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	afterBytes, err := base64.RawURLEncoding.DecodeString(bookmark)
+	if err != nil {
+		message := fmt.Sprintf("invalid bookmark: %s", err.Error())
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+	after := string(afterBytes)
+
+	now, err := txTime(stub)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the transaction timestamp: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	sinceKey, from := since.UTC().Format(indexTimeLayout), since.UTC()
+	if after != "" {
+		_, attributes, err := stub.SplitCompositeKey(after)
+		if err == nil && len(attributes) > 1 {
+			from, err = time.Parse(indexBucketLayout, attributes[1])
+		}
+		if err != nil {
+			message := "invalid bookmark"
+			logger.Error(message)
+			return pb.Response{Status: 400, Message: message}
+		}
+	}
+
+	bucket := time.Date(from.Year(), from.Month(), 1, 0, 0, 0, 0, time.UTC)
+	page, lastKey := queryPage{Records: queryResults{}}, ""
+	for ; !bucket.After(now) && page.Bookmark == ""; bucket = bucket.AddDate(0, 1, 0) {
+		it, err := stub.GetStateByPartialCompositeKey(typeIndexObjType,
+			[]string{docType, bucket.Format(indexBucketLayout)})
+		if err != nil {
+			message := fmt.Sprintf("unable to get an iterator over the assets of the docType %s: %s",
+				docType, err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		for it.HasNext() {
+			response, err := it.Next()
+			if err != nil {
+				it.Close()
+				message := fmt.Sprintf("unable to get the next element: %s", err.Error())
+				logger.Error(message)
+				return shim.Error(message)
+			}
+
+			_, attributes, err := stub.SplitCompositeKey(response.Key)
+			if err != nil {
+				it.Close()
+				message := fmt.Sprintf("unable to split the composite key %s: %s", response.Key, err.Error())
+				logger.Error(message)
+				return shim.Error(message)
+			}
+
+			if attributes[2] < sinceKey || response.Key <= after {
+				continue
+			}
+
+			if int32(len(page.Records)) == pageSize {
+				page.Bookmark = base64.RawURLEncoding.EncodeToString([]byte(lastKey))
+				break
+			}
+
+			entry, err := resolveAsset(stub, attributes[3:], now)
+			if err != nil {
+				it.Close()
+				message := fmt.Sprintf("unable to get the asset %s: %s", formatKey(attributes[3:]), err.Error())
+				logger.Error(message)
+				return shim.Error(message)
+			}
+
+			if entry != nil {
+				page.Records, lastKey = append(page.Records, *entry), response.Key
+			}
+		}
+		it.Close()
+	}
+	page.FetchedRecordsCount = int32(len(page.Records))
+
+	result, err := marshalResult(page, format)
+	if err != nil {
+		message := fmt.Sprintf("unable to marshal the result: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.listByTypeSince exited successfully")
+	return shim.Success(result)
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+const (
+	auditObjType = reservedObjTypePrefix + "audit"
+
+	// auditTimeLayout is fixed-width so that audit keys sort chronologically
+	auditTimeLayout = "2006-01-02T15:04:05.000000000Z"
+
+	auditFormatCSV    = "csv"
+	auditFormatNDJSON = "ndjson"
+)
+
+// auditEntry is a single mutation of a record. The field order defines the
+// column order of the exports and must not change; new fields go last.
+type auditEntry struct {
+	Timestamp string `json:"timestamp"`
+	TxID      string `json:"txId"`
+	Op        string `json:"op"`
+	ObjType   string `json:"objType"`
+	Key       string `json:"key"`
+	Seq       uint64 `json:"seq"`
+	ValueHash string `json:"valueHash"`
+	PrevHash  string `json:"prevHash"`
+	Hash      string `json:"hash"`
+	// Actor is the id of the identity the mutation is attributed to: the
+	// signer of a relayed call rather than its relayer. It's empty for
+	// identities without one and for entries that predate it.
+	Actor string `json:"actor,omitempty"`
+}
+
+var auditColumns = []string{"timestamp", "txId", "op", "objType", "key", "seq", "valueHash", "prevHash", "hash", "actor"}
+
+func (e *auditEntry) columns() []string {
+	return []string{e.Timestamp, e.TxID, e.Op, e.ObjType, e.Key,
+		strconv.FormatUint(e.Seq, 10), e.ValueHash, e.PrevHash, e.Hash, e.Actor}
+}
+
+// appendAudit records that op was applied to the record objType/key in the
+// current transaction, and emits the event of the mutation. r is the record
+// as stored after the mutation, nil if it was deleted.
+func appendAudit(stub shim.ChaincodeStubInterface, op, objType, key string, r *record) error {
+	now, err := txTime(stub)
+	if err != nil {
+		return err
+	}
+
+	valueHash, err := recordHash(r)
+	if err != nil {
+		return err
+	}
+
+	// an identity without an id, e.g. an idemix one, leaves the actor empty
+	actor, _ := callerID(stub)
+
+	entry := auditEntry{
+		Timestamp: now.Format(auditTimeLayout),
+		TxID:      stub.GetTxID(),
+		Op:        op,
+		ObjType:   objType,
+		Key:       key,
+		ValueHash: valueHash,
+		Actor:     actor,
+	}
+
+	auditKey, err := stub.CreateCompositeKey(auditObjType, []string{entry.Timestamp, entry.TxID, objType, key})
+	if err != nil {
+		return err
+	}
+
+	if err := advanceChain(stub, &entry, auditKey); err != nil {
+		return err
+	}
+
+	if err := appendChange(stub, &entry); err != nil {
+		return err
+	}
+
+	if err := emitMutation(stub, &entry); err != nil {
+		return err
+	}
+
+	entryBytes, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	return stub.PutState(auditKey, entryBytes)
+}
+
+// exportAudit returns the audit entries of a time range as CSV or NDJSON. The
+// entries come in the order of the log, so a client that stopped processing
+// an export midway resumes it from the timestamp of the last entry it
+// processed, skipping the entries up to that one, which it knows by its hash.
+func (cc *SimpleChaincode) exportAudit(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.exportAudit")
+
+	if len(args) != 3 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d", len(args), 3)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	fromArg, toArg, format := args[0], args[1], args[2]
+	logger.Debugf("range: [\"%s\", \"%s\"), format: %s", fromArg, toArg, format)
+
+	from, err := time.Parse(time.RFC3339Nano, fromArg)
+	if err != nil {
+		message := fmt.Sprintf("from must be in RFC 3339 format: %s", err.Error())
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	to, err := time.Parse(time.RFC3339Nano, toArg)
+	if err != nil {
+		message := fmt.Sprintf("to must be in RFC 3339 format: %s", err.Error())
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	if format != auditFormatCSV && format != auditFormatNDJSON {
+		message := fmt.Sprintf("unknown format: %s, expected one of {%s, %s}", format, auditFormatCSV, auditFormatNDJSON)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	fromTs, toTs := from.UTC().Format(auditTimeLayout), to.UTC().Format(auditTimeLayout)
+
+	it, err := stub.GetStateByPartialCompositeKey(auditObjType, []string{})
+	if err != nil {
+		message := fmt.Sprintf("unable to get an iterator over the audit log: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+	defer it.Close()
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if format == auditFormatCSV {
+		w.Write(auditColumns)
+	}
+
+	for it.HasNext() {
+		response, err := it.Next()
+		if err != nil {
+			message := fmt.Sprintf("unable to get the next element: %s", err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		var entry auditEntry
+		if err := json.Unmarshal(response.Value, &entry); err != nil {
+			message := fmt.Sprintf("unable to unmarshal the audit entry: %s", err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		// the log is ordered by time, so nothing past the end of the range is needed
+		if entry.Timestamp < fromTs {
+			continue
+		}
+		if entry.Timestamp >= toTs {
+			break
+		}
+
+		if format == auditFormatCSV {
+			w.Write(entry.columns())
+		} else {
+			buf.Write(response.Value)
+			buf.WriteByte('\n')
+		}
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		message := fmt.Sprintf("unable to write the CSV: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.exportAudit exited successfully")
+	return shim.Success(buf.Bytes())
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// batchEntry is an element of the batch a putBatch, getBatchRecords or
+// delBatch is passed; only putBatch takes values.
+type batchEntry struct {
+	Type  string  `json:"type"`
+	Key   string  `json:"key"`
+	Value *string `json:"value,omitempty"`
+
+	compositeKey string
+}
+
+// batchResult is the record of a batch entry, or none when it's not found.
+type batchResult struct {
+	Type string `json:"type"`
+	Key  string `json:"key"`
+	*record
+}
+
+// parseBatch parses a batch passed either as a JSON array of {type, key,
+// value} or as a protobuf-encoded BatchRequest, for clients that already
+// speak the proto format. A batch starting with "[" is a JSON array, as an
+// encoded BatchRequest starts with the tag of its entries; anything else is
+// decoded as a BatchRequest.
+func parseBatch(stub shim.ChaincodeStubInterface, batchArg string) ([]batchEntry, error) {
+	var entries []batchEntry
+	if strings.HasPrefix(strings.TrimLeft(batchArg, " \t\r\n"), "[") {
+		if err := json.Unmarshal([]byte(batchArg), &entries); err != nil {
+			return nil, fmt.Errorf("entries must be a JSON array of {type, key, value}: %s", err.Error())
+		}
+	} else {
+		var request BatchRequest
+		if err := proto.Unmarshal([]byte(batchArg), &request); err != nil {
+			return nil, fmt.Errorf("entries must be a JSON array or a BatchRequest: %s", err.Error())
+		}
+
+		for _, e := range request.Entries {
+			value := e.Value
+			entries = append(entries, batchEntry{Type: e.ObjType, Key: e.Key, Value: &value})
+		}
+	}
+
+	if len(entries) == 0 || len(entries) > maxPageSize {
+		return nil, fmt.Errorf("the number of entries must be in [1, %d], got %d", maxPageSize, len(entries))
+	}
+
+	for i := range entries {
+		compositeKey, err := createCompositeKey(stub, entries[i].Type, entries[i].Key)
+		if err != nil {
+			return nil, fmt.Errorf("the entry %d is invalid: %s", i, err.Error())
+		}
+		entries[i].compositeKey = compositeKey
+	}
+
+	return entries, nil
+}
+
+// putBatch is put for every entry of a batch, in a single transaction: either
+// all of them are written or none is.
+func (cc *SimpleChaincode) putBatch(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.putBatch")
+
+	if len(args) != 1 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d", len(args), 1)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	entries, err := parseBatch(stub, args[0])
+	if err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+	logger.Debugf("entries: %d", len(entries))
+
+	for i, e := range entries {
+		if e.Value == nil {
+			message := fmt.Sprintf("the entry %d has no value", i)
+			logger.Error(message)
+			return pb.Response{Status: 400, Message: message}
+		}
+	}
+
+	for _, e := range entries {
+		if response, denied := accessDenied(stub, accessWrite, e.Type); denied {
+			return response
+		}
+	}
+
+	for _, e := range entries {
+		r, err := putRecord(stub, e.compositeKey, *e.Value)
+		if response, ok := invalidValueResponse(err); ok {
+			return response
+		}
+		if err != nil {
+			message := fmt.Sprintf("unable to put a value for the key %s: %s", e.Key, err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		if err := appendAudit(stub, "put", e.Type, e.Key, r); err != nil {
+			message := fmt.Sprintf("unable to append to the audit log: %s", err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+	}
+
+	logger.Info("SimpleChaincode.putBatch exited successfully")
+	return shim.Success(nil)
+}
+
+// getBatchRecords is get for every entry of a batch, in the order of the
+// batch; entries not found or marked deleted come back without a record. (getBatch returns
+// settlement batches.)
+func (cc *SimpleChaincode) getBatchRecords(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.getBatchRecords")
+
+	if len(args) != 1 && len(args) != 2 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d or %d", len(args), 1, 2)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	format := formatJSON
+	if len(args) == 2 {
+		format = args[1]
+	}
+
+	if err := checkFormat(format); err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	entries, err := parseBatch(stub, args[0])
+	if err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+	logger.Debugf("entries: %d, format: %s", len(entries), format)
+
+	now, err := txTime(stub)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the transaction timestamp: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	results := make([]batchResult, len(entries))
+	for i, e := range entries {
+		r, err := getRecord(stub, e.compositeKey)
+		if err != nil {
+			message := fmt.Sprintf("unable to get a value for the key %s: %s", e.Key, err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		results[i] = batchResult{Type: e.Type, Key: e.Key}
+		if r != nil && r.DeletedAt == nil {
+			results[i].record = r.readableAt(now)
+		}
+	}
+
+	result, err := marshalResult(results, format)
+	if err != nil {
+		message := fmt.Sprintf("unable to marshal the result: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.getBatchRecords exited successfully")
+	return shim.Success(result)
+}
+
+// delBatch is del for every entry of a batch, in a single transaction.
+func (cc *SimpleChaincode) delBatch(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.delBatch")
+
+	if len(args) != 1 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d", len(args), 1)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	entries, err := parseBatch(stub, args[0])
+	if err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+	logger.Debugf("entries: %d", len(entries))
+
+	for _, e := range entries {
+		if response, denied := accessDenied(stub, accessDelete, e.Type); denied {
+			return response
+		}
+	}
+
+	for _, e := range entries {
+		if err := removeRecord(stub, e.Type, e.Key, e.compositeKey); err != nil {
+			message := err.Error()
+			logger.Error(message)
+			return shim.Error(message)
+		}
+	}
+
+	logger.Info("SimpleChaincode.delBatch exited successfully")
+	return shim.Success(nil)
+}
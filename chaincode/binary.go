@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"mime"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+const octetStreamContentType = "application/octet-stream"
+
+// putBinary stores a base64-encoded binary value along with its content type,
+// application/octet-stream if none is given. The value keeps its base64 form
+// in the record and comes back as such from get in JSON, and as a byte string
+// from get in CBOR or MessagePack.
+func (cc *SimpleChaincode) putBinary(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.putBinary")
+
+	if len(args) != 4 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d", len(args), 4)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	objType, key, contentType, value := args[0], args[1], args[2], args[3]
+	logger.Debugf("type: %s, key: %s, contentType: %s, value: %d base64 characters",
+		objType, key, contentType, len(value))
+
+	if response, denied := accessDenied(stub, accessWrite, objType); denied {
+		return response
+	}
+
+	if contentType == "" {
+		contentType = octetStreamContentType
+	}
+
+	if _, _, err := mime.ParseMediaType(contentType); err != nil {
+		message := fmt.Sprintf("invalid content type %s: %s", contentType, err.Error())
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		message := fmt.Sprintf("the value is not valid base64: %s", err.Error())
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	compositeKey, err := createCompositeKey(stub, objType, key)
+	if err != nil {
+		message := fmt.Sprintf("unable to create a composite key: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	// re-encoding drops any variation in padding so equal bytes are stored equally
+	r, err := newRecordVersion(stub, compositeKey, base64.StdEncoding.EncodeToString(raw))
+	if err != nil {
+		message := fmt.Sprintf("unable to put a key-value pair: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+	r.ContentType, r.Encoding = contentType, base64Encoding
+
+	if err := storeRecord(stub, compositeKey, r); err != nil {
+		message := fmt.Sprintf("unable to put a key-value pair: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if err := appendAudit(stub, "putBinary", objType, key, r); err != nil {
+		message := fmt.Sprintf("unable to append to the audit log: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.putBinary exited successfully")
+	return shim.Success(nil)
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// hashAlgorithm names the digest of every hash the chaincode computes.
+const hashAlgorithm = "sha256"
+
+// documentDigest is the result of hashOf. Canonical tells whether the value
+// was hashed in its canonical JSON form or as its raw bytes.
+type documentDigest struct {
+	ObjType   string `json:"objType"`
+	Key       string `json:"key"`
+	Algorithm string `json:"algorithm"`
+	Canonical bool   `json:"canonical"`
+	Hash      string `json:"hash"`
+}
+
+// canonicalJSON re-encodes a JSON text in the canonical form of RFC 8785:
+// no insignificant whitespace, object members sorted by the UTF-16 code units
+// of their names, minimal string escaping and numbers formatted as
+// ECMAScript does. Like in ECMAScript, numbers are IEEE 754 doubles, so
+// integers beyond 2^53 lose precision.
+func canonicalJSON(data []byte) ([]byte, error) {
+	doc, err := decodeJSON(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := writeCanonical(&buf, doc); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func writeCanonical(buf *bytes.Buffer, doc interface{}) error {
+	switch v := doc.(type) {
+	case nil:
+		buf.WriteString("null")
+	case bool:
+		buf.WriteString(strconv.FormatBool(v))
+	case string:
+		writeCanonicalString(buf, v)
+	case json.Number:
+		f, err := v.Float64()
+		if err != nil {
+			return err
+		}
+		buf.WriteString(canonicalNumber(f))
+	case []interface{}:
+		buf.WriteByte('[')
+		for i, element := range v {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeCanonical(buf, element); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case map[string]interface{}:
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Slice(names, func(i, j int) bool {
+			return lessUTF16(names[i], names[j])
+		})
+
+		buf.WriteByte('{')
+		for i, name := range names {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeCanonicalString(buf, name)
+			buf.WriteByte(':')
+			if err := writeCanonical(buf, v[name]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	default:
+		return fmt.Errorf("unsupported type %T", doc)
+	}
+
+	return nil
+}
+
+func writeCanonicalString(buf *bytes.Buffer, s string) {
+	buf.WriteByte('"')
+	for _, c := range s {
+		switch c {
+		case '"':
+			buf.WriteString(`\"`)
+		case '\\':
+			buf.WriteString(`\\`)
+		case '\b':
+			buf.WriteString(`\b`)
+		case '\f':
+			buf.WriteString(`\f`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		default:
+			if c < 0x20 {
+				fmt.Fprintf(buf, `\u%04x`, c)
+			} else {
+				buf.WriteRune(c)
+			}
+		}
+	}
+	buf.WriteByte('"')
+}
+
+// canonicalNumber formats f like ECMAScript's Number.prototype.toString.
+func canonicalNumber(f float64) string {
+	if f == 0 {
+		return "0"
+	}
+
+	if abs := math.Abs(f); abs >= 1e-6 && abs < 1e21 {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+
+	// ECMAScript writes exponents without leading zeros, e.g. 1e-7
+	s := strconv.FormatFloat(f, 'e', -1, 64)
+	i := strings.IndexByte(s, 'e')
+	mantissa, sign, exponent := s[:i], s[i+1], strings.TrimLeft(s[i+2:], "0")
+	return mantissa + "e" + string(sign) + exponent
+}
+
+func lessUTF16(a, b string) bool {
+	ua, ub := utf16.Encode([]rune(a)), utf16.Encode([]rune(b))
+	for i := 0; i < len(ua) && i < len(ub); i++ {
+		if ua[i] != ub[i] {
+			return ua[i] < ub[i]
+		}
+	}
+
+	return len(ua) < len(ub)
+}
+
+// canonicalHash returns the hex SHA-256 of v in canonical JSON.
+func canonicalHash(v interface{}) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	canonical, err := canonicalJSON(data)
+	if err != nil {
+		return "", err
+	}
+
+	return bytesHash(canonical), nil
+}
+
+// isJSONContentType reports whether contentType is application/json or one
+// of its +json subtypes.
+func isJSONContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	return mediaType == jsonContentType || strings.HasSuffix(mediaType, "+json")
+}
+
+// documentHash returns the hash of a value: the hash of its canonical JSON
+// if it's of a JSON content type and parses as such, of its bytes otherwise.
+func documentHash(raw []byte, contentType string) (string, bool) {
+	if isJSONContentType(contentType) {
+		if canonical, err := canonicalJSON(raw); err == nil {
+			return bytesHash(canonical), true
+		}
+	}
+
+	return bytesHash(raw), false
+}
+
+// hashOf returns the hash of a stored value as off-chain verifiers compute it
+// from the document they hold, see documentHash.
+func (cc *SimpleChaincode) hashOf(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.hashOf")
+
+	if len(args) != 2 && len(args) != 3 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d or %d", len(args), 2, 3)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	objType, key, format := args[0], args[1], formatJSON
+	if len(args) == 3 {
+		format = args[2]
+	}
+	logger.Debugf("type: %s, key: %s, format: %s", objType, key, format)
+
+	if err := checkFormat(format); err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	compositeKey, err := createCompositeKey(stub, objType, key)
+	if err != nil {
+		message := fmt.Sprintf("unable to create a composite key: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	r, err := getRecord(stub, compositeKey)
+	if err != nil {
+		message := fmt.Sprintf("unable to get a value for the key %s: %s", key, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if r == nil {
+		message := fmt.Sprintf("a value for the key %s not found", key)
+		logger.Error(message)
+		return pb.Response{Status: 404, Message: message}
+	}
+
+	now, err := txTime(stub)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the transaction timestamp: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	// the hash would let short locked or expired values be guessed, as in sealed
+	if response, ok := unreadableResponse(key, r, now); ok {
+		return response
+	}
+
+	raw, err := r.rawValue()
+	if err != nil {
+		message := fmt.Sprintf("unable to decode the value for the key %s: %s", key, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	contentType := r.ContentType
+	if contentType == "" && json.Valid(raw) {
+		contentType = jsonContentType
+	}
+
+	digest := documentDigest{ObjType: objType, Key: key, Algorithm: hashAlgorithm}
+	digest.Hash, digest.Canonical = documentHash(raw, contentType)
+
+	result, err := marshalResult(digest, format)
+	if err != nil {
+		message := fmt.Sprintf("unable to marshal the result: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.hashOf exited successfully")
+	return shim.Success(result)
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+const (
+	cborContentType = "application/cbor"
+	base64Encoding  = "base64"
+)
+
+// cborRaw is an already encoded CBOR data item that is embedded as is.
+type cborRaw []byte
+
+// marshalCBOR encodes values built of nil, bool, string, []byte, numbers,
+// json.Number, []interface{}, map[string]interface{} and cborRaw. Map keys are
+// sorted by their encoding (RFC 8949 section 4.2.1), so equal values always
+// encode to the same bytes.
+func marshalCBOR(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := writeCBOR(&buf, v); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func writeCBORHead(buf *bytes.Buffer, major byte, n uint64) {
+	switch {
+	case n < 24:
+		buf.WriteByte(major<<5 | byte(n))
+	case n <= math.MaxUint8:
+		buf.WriteByte(major<<5 | 24)
+		buf.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		buf.WriteByte(major<<5 | 25)
+		binary.Write(buf, binary.BigEndian, uint16(n))
+	case n <= math.MaxUint32:
+		buf.WriteByte(major<<5 | 26)
+		binary.Write(buf, binary.BigEndian, uint32(n))
+	default:
+		buf.WriteByte(major<<5 | 27)
+		binary.Write(buf, binary.BigEndian, n)
+	}
+}
+
+func writeCBOR(buf *bytes.Buffer, v interface{}) error {
+	switch value := v.(type) {
+	case nil:
+		buf.WriteByte(0xf6)
+	case bool:
+		if value {
+			buf.WriteByte(0xf5)
+		} else {
+			buf.WriteByte(0xf4)
+		}
+	case string:
+		writeCBORHead(buf, 3, uint64(len(value)))
+		buf.WriteString(value)
+	case []byte:
+		writeCBORHead(buf, 2, uint64(len(value)))
+		buf.Write(value)
+	case cborRaw:
+		buf.Write(value)
+	case int:
+		writeCBORInt(buf, int64(value))
+	case int32:
+		writeCBORInt(buf, int64(value))
+	case int64:
+		writeCBORInt(buf, value)
+	case uint64:
+		writeCBORHead(buf, 0, value)
+	case float64:
+		buf.WriteByte(0xfb)
+		binary.Write(buf, binary.BigEndian, math.Float64bits(value))
+	case json.Number:
+		if i, err := value.Int64(); err == nil {
+			writeCBORInt(buf, i)
+		} else if u, err := strconv.ParseUint(string(value), 10, 64); err == nil {
+			writeCBORHead(buf, 0, u)
+		} else if f, err := value.Float64(); err == nil {
+			return writeCBOR(buf, f)
+		} else {
+			return err
+		}
+	case []interface{}:
+		writeCBORHead(buf, 4, uint64(len(value)))
+		for _, item := range value {
+			if err := writeCBOR(buf, item); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		type pair struct{ key, value []byte }
+		pairs := make([]pair, 0, len(value))
+		for k, item := range value {
+			var kb, vb bytes.Buffer
+			writeCBORHead(&kb, 3, uint64(len(k)))
+			kb.WriteString(k)
+			if err := writeCBOR(&vb, item); err != nil {
+				return err
+			}
+			pairs = append(pairs, pair{kb.Bytes(), vb.Bytes()})
+		}
+		sort.Slice(pairs, func(i, j int) bool { return bytes.Compare(pairs[i].key, pairs[j].key) < 0 })
+
+		writeCBORHead(buf, 5, uint64(len(pairs)))
+		for _, p := range pairs {
+			buf.Write(p.key)
+			buf.Write(p.value)
+		}
+	default:
+		return fmt.Errorf("unable to encode %T as CBOR", v)
+	}
+
+	return nil
+}
+
+func writeCBORInt(buf *bytes.Buffer, i int64) {
+	if i >= 0 {
+		writeCBORHead(buf, 0, uint64(i))
+	} else {
+		writeCBORHead(buf, 1, uint64(-1-i))
+	}
+}
+
+// validateCBOR checks that data is exactly one well-formed CBOR data item.
+func validateCBOR(data []byte) error {
+	rest, err := skipCBORItem(data, 0)
+	if err != nil {
+		return err
+	}
+
+	if len(rest) != 0 {
+		return errors.New("unexpected data after the CBOR data item")
+	}
+
+	return nil
+}
+
+const maxCBORNesting = 64
+
+var errCBORTruncated = errors.New("truncated CBOR data item")
+
+// skipCBORItem returns what follows the data item at the start of data.
+func skipCBORItem(data []byte, depth int) ([]byte, error) {
+	if depth > maxCBORNesting {
+		return nil, errors.New("CBOR data item nested too deeply")
+	}
+
+	if len(data) == 0 {
+		return nil, errCBORTruncated
+	}
+
+	major, info := data[0]>>5, data[0]&0x1f
+	data = data[1:]
+
+	var n uint64
+	indefinite := false
+	switch {
+	case info < 24:
+		n = uint64(info)
+	case info <= 27:
+		size := 1 << (info - 24)
+		if len(data) < size {
+			return nil, errCBORTruncated
+		}
+		for _, b := range data[:size] {
+			n = n<<8 | uint64(b)
+		}
+		data = data[size:]
+	case info == 31 && major >= 2 && major <= 5:
+		indefinite = true
+	default:
+		return nil, fmt.Errorf("invalid CBOR additional information %d for the major type %d", info, major)
+	}
+
+	if indefinite {
+		for {
+			if len(data) == 0 {
+				return nil, errCBORTruncated
+			}
+			if data[0] == 0xff {
+				return data[1:], nil
+			}
+
+			var err error
+			if data, err = skipCBORItem(data, depth+1); err != nil {
+				return nil, err
+			}
+			if major == 5 {
+				if data, err = skipCBORItem(data, depth+1); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	switch major {
+	case 2, 3:
+		if uint64(len(data)) < n {
+			return nil, errCBORTruncated
+		}
+		return data[n:], nil
+	case 4, 5:
+		items := n
+		if major == 5 {
+			items *= 2
+		}
+		for i := uint64(0); i < items; i++ {
+			var err error
+			if data, err = skipCBORItem(data, depth+1); err != nil {
+				return nil, err
+			}
+		}
+		return data, nil
+	case 6:
+		return skipCBORItem(data, depth+1)
+	default:
+		return data, nil
+	}
+}
+
+// recordDocument converts r into a generic document for encoders other than
+// encoding/json, with the key added unless it's empty. Binary values are
+// decoded from their base64 text, and CBOR ones are embedded as CBOR items.
+func recordDocument(key string, r *record) (map[string]interface{}, error) {
+	recordBytes, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := decodeJSON(recordBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	m := doc.(map[string]interface{})
+	if key != "" {
+		m["key"] = key
+	}
+
+	if r.Encoding == base64Encoding && r.Value != "" {
+		raw, err := base64.StdEncoding.DecodeString(r.Value)
+		if err != nil {
+			return nil, err
+		}
+
+		if r.ContentType == cborContentType {
+			m["value"] = cborRaw(raw)
+		} else {
+			m["value"] = raw
+		}
+	}
+
+	return m, nil
+}
+
+// putCBOR stores a CBOR-encoded value, passed as raw bytes. It is returned
+// base64-encoded by get in JSON and embedded as is by get in CBOR.
+func (cc *SimpleChaincode) putCBOR(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.putCBOR")
+
+	if len(args) != 3 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d", len(args), 3)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	objType, key, value := args[0], args[1], args[2]
+	logger.Debugf("type: %s, key: %s, value: %d bytes", objType, key, len(value))
+
+	if response, denied := accessDenied(stub, accessWrite, objType); denied {
+		return response
+	}
+
+	if err := validateCBOR([]byte(value)); err != nil {
+		message := fmt.Sprintf("the value is not well-formed CBOR: %s", err.Error())
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	compositeKey, err := createCompositeKey(stub, objType, key)
+	if err != nil {
+		message := fmt.Sprintf("unable to create a composite key: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	r, err := newRecordVersion(stub, compositeKey, base64.StdEncoding.EncodeToString([]byte(value)))
+	if err != nil {
+		message := fmt.Sprintf("unable to put a key-value pair: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+	r.ContentType, r.Encoding = cborContentType, base64Encoding
+
+	if err := storeRecord(stub, compositeKey, r); err != nil {
+		message := fmt.Sprintf("unable to put a key-value pair: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if err := appendAudit(stub, "putCBOR", objType, key, r); err != nil {
+		message := fmt.Sprintf("unable to append to the audit log: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.putCBOR exited successfully")
+	return shim.Success(nil)
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+const (
+	chainObjType     = reservedObjTypePrefix + "chain"
+	chainHeadObjType = reservedObjTypePrefix + "chainhead"
+)
+
+// chainHead is the latest audit entry of an object type's hash chain.
+type chainHead struct {
+	Seq  uint64 `json:"seq"`
+	Hash string `json:"hash"`
+}
+
+// chainReport is the outcome of verifyChain. Break describes the first
+// inconsistency found, if any.
+type chainReport struct {
+	ObjType string      `json:"objType"`
+	Valid   bool        `json:"valid"`
+	Entries uint64      `json:"entries"`
+	Break   *chainBreak `json:"break,omitempty"`
+}
+
+type chainBreak struct {
+	Seq    uint64 `json:"seq"`
+	Key    string `json:"key,omitempty"`
+	Reason string `json:"reason"`
+}
+
+// recordHash returns the canonical hash of r, or an empty string for a
+// deleted record.
+func recordHash(r *record) (string, error) {
+	if r == nil {
+		return "", nil
+	}
+
+	return canonicalHash(r)
+}
+
+// storedHash returns the canonical hash of a stored record as it is in the
+// state database, so that any change to it shows, or an empty string if
+// there is none. The doc copy of a JSON value isn't part of the record the
+// chain audits: it's left out of the hash, and must match the value instead.
+func storedHash(valueBytes []byte) (string, error) {
+	if valueBytes == nil {
+		return "", nil
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(valueBytes, &fields); err != nil {
+		return "", err
+	}
+
+	if doc, ok := fields["doc"]; ok {
+		delete(fields, "doc")
+		if err := checkStoredDoc(valueBytes, doc); err != nil {
+			return "", err
+		}
+	}
+
+	recordBytes, err := json.Marshal(fields)
+	if err != nil {
+		return "", err
+	}
+
+	canonical, err := canonicalJSON(recordBytes)
+	if err != nil {
+		return "", err
+	}
+
+	return bytesHash(canonical), nil
+}
+
+// checkStoredDoc fails unless doc is the value of the stored record.
+func checkStoredDoc(valueBytes []byte, doc json.RawMessage) error {
+	raw, err := decodeRecord(valueBytes).rawValue()
+	if err != nil {
+		return err
+	}
+
+	canonicalValue, err := canonicalJSON(raw)
+	if err != nil {
+		return err
+	}
+
+	canonicalDoc, err := canonicalJSON(doc)
+	if err != nil {
+		return err
+	}
+
+	if !bytes.Equal(canonicalValue, canonicalDoc) {
+		return errors.New("the document doesn't match the value")
+	}
+
+	return nil
+}
+
+func bytesHash(b []byte) string {
+	if b == nil {
+		return ""
+	}
+
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// entryHash returns the hash of e with its Hash field left out.
+func entryHash(e auditEntry) (string, error) {
+	e.Hash = ""
+	return canonicalHash(e)
+}
+
+func chainKey(stub shim.ChaincodeStubInterface, objType string, seq uint64) (string, error) {
+	return stub.CreateCompositeKey(chainObjType, []string{objType, fmt.Sprintf("%020d", seq)})
+}
+
+// advanceChain links entry to the head of its object type's chain, fills in
+// its sequence number and hashes, and makes it the new head.
+func advanceChain(stub shim.ChaincodeStubInterface, entry *auditEntry, auditKey string) error {
+	headKey, err := stub.CreateCompositeKey(chainHeadObjType, []string{entry.ObjType})
+	if err != nil {
+		return err
+	}
+
+	headBytes, err := stub.GetState(headKey)
+	if err != nil {
+		return err
+	}
+
+	var head chainHead
+	if headBytes != nil {
+		if err := json.Unmarshal(headBytes, &head); err != nil {
+			return err
+		}
+	}
+
+	entry.Seq, entry.PrevHash = head.Seq+1, head.Hash
+	if entry.Hash, err = entryHash(*entry); err != nil {
+		return err
+	}
+
+	linkKey, err := chainKey(stub, entry.ObjType, entry.Seq)
+	if err != nil {
+		return err
+	}
+
+	if err := stub.PutState(linkKey, []byte(auditKey)); err != nil {
+		return err
+	}
+
+	headBytes, err = json.Marshal(chainHead{Seq: entry.Seq, Hash: entry.Hash})
+	if err != nil {
+		return err
+	}
+
+	return stub.PutState(headKey, headBytes)
+}
+
+func (cc *SimpleChaincode) verifyChain(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.verifyChain")
+
+	if len(args) != 1 && len(args) != 2 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d or %d", len(args), 1, 2)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	objType, format := args[0], formatJSON
+	if len(args) == 2 {
+		format = args[1]
+	}
+	logger.Debugf("type: %s, format: %s", objType, format)
+
+	if err := checkFormat(format); err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	report, err := walkChain(stub, objType)
+	if err != nil {
+		message := fmt.Sprintf("unable to verify the chain of the type %s: %s", objType, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	result, err := marshalResult(report, format)
+	if err != nil {
+		message := fmt.Sprintf("unable to marshal the result: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.verifyChain exited successfully")
+	return shim.Success(result)
+}
+
+// walkChain re-validates the links and hashes of the chain of objType, then
+// checks that every record still matches the value hash of its latest entry.
+func walkChain(stub shim.ChaincodeStubInterface, objType string) (*chainReport, error) {
+	report := &chainReport{ObjType: objType}
+
+	it, err := stub.GetStateByPartialCompositeKey(chainObjType, []string{objType})
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+
+	var prevHash string
+	valueHashes := map[string]string{}
+	for it.HasNext() {
+		response, err := it.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		seq := report.Entries + 1
+		entryBytes, err := stub.GetState(string(response.Value))
+		if err != nil {
+			return nil, err
+		}
+
+		if entryBytes == nil {
+			report.Break = &chainBreak{Seq: seq, Reason: "the audit entry is missing"}
+			return report, nil
+		}
+
+		var entry auditEntry
+		if err := json.Unmarshal(entryBytes, &entry); err != nil {
+			report.Break = &chainBreak{Seq: seq, Reason: "the audit entry is malformed"}
+			return report, nil
+		}
+
+		hash, err := entryHash(entry)
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case entry.Seq != seq:
+			report.Break = &chainBreak{Seq: seq, Key: entry.Key,
+				Reason: fmt.Sprintf("the audit entry has the sequence number %d", entry.Seq)}
+		case entry.PrevHash != prevHash:
+			report.Break = &chainBreak{Seq: seq, Key: entry.Key, Reason: "the previous hash doesn't match"}
+		case entry.Hash != hash:
+			report.Break = &chainBreak{Seq: seq, Key: entry.Key, Reason: "the entry hash doesn't match"}
+		}
+		if report.Break != nil {
+			return report, nil
+		}
+
+		report.Entries, prevHash = seq, entry.Hash
+		valueHashes[entry.Key] = entry.ValueHash
+	}
+
+	headKey, err := stub.CreateCompositeKey(chainHeadObjType, []string{objType})
+	if err != nil {
+		return nil, err
+	}
+
+	headBytes, err := stub.GetState(headKey)
+	if err != nil {
+		return nil, err
+	}
+
+	var head chainHead
+	if headBytes != nil {
+		if err := json.Unmarshal(headBytes, &head); err != nil {
+			return nil, err
+		}
+	}
+
+	if head.Seq != report.Entries || head.Hash != prevHash {
+		report.Break = &chainBreak{Seq: report.Entries + 1, Reason: "the chain head doesn't match the last entry"}
+		return report, nil
+	}
+
+	keys := make([]string, 0, len(valueHashes))
+	for key := range valueHashes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		compositeKey, err := createCompositeKey(stub, objType, key)
+		if err != nil {
+			return nil, err
+		}
+
+		valueBytes, err := stub.GetState(compositeKey)
+		if err != nil {
+			return nil, err
+		}
+
+		// a value that isn't JSON can't be one the chain audited
+		hash, err := storedHash(valueBytes)
+		if err != nil || hash != valueHashes[key] {
+			report.Break = &chainBreak{Seq: report.Entries, Key: key,
+				Reason: "the record doesn't match its last audited value"}
+			return report, nil
+		}
+	}
+
+	report.Valid = true
+	return report, nil
+}
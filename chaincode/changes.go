@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+const (
+	changeObjType     = reservedObjTypePrefix + "change"
+	changeHeadObjType = reservedObjTypePrefix + "changehead"
+
+	// changes are grouped into buckets so that changesSince can start in the
+	// middle of the log using partial composite key queries only
+	changeBucketSize = 1000
+
+	maxChangesLimit = 1000
+)
+
+// change is an entry of the change feed. Every mutation takes the next
+// sequence number, so concurrent mutations conflict on the feed head and
+// only one of them is committed per block; clients are expected to retry.
+type change struct {
+	Seq     uint64 `json:"seq"`
+	ObjType string `json:"objType"`
+	Key     string `json:"key"`
+	Op      string `json:"op"`
+	TxID    string `json:"txId"`
+}
+
+type changesPage struct {
+	Changes []change `json:"changes"`
+	LastSeq uint64   `json:"lastSeq"`
+	HeadSeq uint64   `json:"headSeq"`
+}
+
+func (page changesPage) ndjsonLines() []interface{} {
+	lines := make([]interface{}, 0, len(page.Changes)+1)
+	for _, c := range page.Changes {
+		lines = append(lines, c)
+	}
+
+	cursor := struct {
+		LastSeq uint64 `json:"lastSeq"`
+		HeadSeq uint64 `json:"headSeq"`
+	}{page.LastSeq, page.HeadSeq}
+
+	return append(lines, ndjsonCursor{cursor})
+}
+
+func changeKey(stub shim.ChaincodeStubInterface, seq uint64) (string, error) {
+	return stub.CreateCompositeKey(changeObjType,
+		[]string{fmt.Sprintf("%020d", seq/changeBucketSize), fmt.Sprintf("%020d", seq)})
+}
+
+func changeHead(stub shim.ChaincodeStubInterface) (string, uint64, error) {
+	headKey, err := stub.CreateCompositeKey(changeHeadObjType, []string{})
+	if err != nil {
+		return "", 0, err
+	}
+
+	headBytes, err := stub.GetState(headKey)
+	if err != nil {
+		return "", 0, err
+	}
+
+	if headBytes == nil {
+		return headKey, 0, nil
+	}
+
+	seq, err := strconv.ParseUint(string(headBytes), 10, 64)
+	return headKey, seq, err
+}
+
+// appendChange adds the mutation described by entry to the change feed.
+func appendChange(stub shim.ChaincodeStubInterface, entry *auditEntry) error {
+	headKey, seq, err := changeHead(stub)
+	if err != nil {
+		return err
+	}
+	seq++
+
+	key, err := changeKey(stub, seq)
+	if err != nil {
+		return err
+	}
+
+	changeBytes, err := json.Marshal(change{
+		Seq:     seq,
+		ObjType: entry.ObjType,
+		Key:     entry.Key,
+		Op:      entry.Op,
+		TxID:    entry.TxID,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := stub.PutState(key, changeBytes); err != nil {
+		return err
+	}
+
+	return stub.PutState(headKey, []byte(strconv.FormatUint(seq, 10)))
+}
+
+func (cc *SimpleChaincode) changesSince(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.changesSince")
+
+	if len(args) != 2 && len(args) != 3 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d or %d", len(args), 2, 3)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	format := formatJSON
+	if len(args) == 3 {
+		format = args[2]
+	}
+	logger.Debugf("seq: %s, limit: %s, format: %s", args[0], args[1], format)
+
+	if err := checkFormat(format); err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	since, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		message := fmt.Sprintf("seq must be a non-negative integer, got \"%s\"", args[0])
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	limit, err := strconv.Atoi(args[1])
+	if err != nil || limit < 1 || limit > maxChangesLimit {
+		message := fmt.Sprintf("limit must be an integer in [1, %d], got \"%s\"", maxChangesLimit, args[1])
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	_, head, err := changeHead(stub)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the head of the change feed: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	page := changesPage{Changes: []change{}, LastSeq: since, HeadSeq: head}
+	for bucket := (since + 1) / changeBucketSize; bucket <= head/changeBucketSize && len(page.Changes) < limit; bucket++ {
+		changes, err := changesInBucket(stub, bucket, since, limit-len(page.Changes))
+		if err != nil {
+			message := fmt.Sprintf("unable to read the change feed: %s", err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		page.Changes = append(page.Changes, changes...)
+	}
+
+	if n := len(page.Changes); n > 0 {
+		page.LastSeq = page.Changes[n-1].Seq
+	}
+
+	result, err := marshalResult(page, format)
+	if err != nil {
+		message := fmt.Sprintf("unable to marshal the result: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.changesSince exited successfully")
+	return shim.Success(result)
+}
+
+// changesInBucket returns up to limit changes of the bucket with sequence
+// numbers greater than since.
+func changesInBucket(stub shim.ChaincodeStubInterface, bucket, since uint64, limit int) ([]change, error) {
+	it, err := stub.GetStateByPartialCompositeKey(changeObjType, []string{fmt.Sprintf("%020d", bucket)})
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+
+	var changes []change
+	for it.HasNext() && len(changes) < limit {
+		response, err := it.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var c change
+		if err := json.Unmarshal(response.Value, &c); err != nil {
+			return nil, err
+		}
+
+		if c.Seq > since {
+			changes = append(changes, c)
+		}
+	}
+
+	return changes, nil
+}
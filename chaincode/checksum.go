@@ -0,0 +1,98 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// stateDigest is a checksum of every key and value under a prefix.
+type stateDigest struct {
+	Prefix    string `json:"prefix"`
+	Count     int    `json:"count"`
+	Algorithm string `json:"algorithm"`
+	Checksum  string `json:"checksum"`
+}
+
+// rollingHash folds entries, in key order, into a hash: each step hashes the
+// hash so far with the hashes of the key and value, so that two states have
+// the same checksum only if they have the same entries in the same order.
+type rollingHash [sha256.Size]byte
+
+func (h *rollingHash) add(key string, value []byte) {
+	keyHash, valueHash := sha256.Sum256([]byte(key)), sha256.Sum256(value)
+
+	step := make([]byte, 0, 3*sha256.Size)
+	step = append(step, h[:]...)
+	step = append(step, keyHash[:]...)
+	step = append(step, valueHash[:]...)
+	*h = sha256.Sum256(step)
+}
+
+// stateChecksum returns the count and a rolling hash of the state entries of
+// an object type, including the reserved ones, or of the simple keys if the
+// prefix is empty. Two peers, or a state before and after a migration, are
+// the same if they give the same checksum.
+func (cc *SimpleChaincode) stateChecksum(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.stateChecksum")
+
+	if len(args) != 1 && len(args) != 2 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d or %d", len(args), 1, 2)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	prefix, format := args[0], formatJSON
+	if len(args) == 2 {
+		format = args[1]
+	}
+	logger.Debugf("prefix: %s, format: %s", prefix, format)
+
+	if err := checkFormat(format); err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	var it shim.StateQueryIteratorInterface
+	var err error
+	if prefix == "" {
+		it, err = stub.GetStateByRange("", "")
+	} else {
+		it, err = stub.GetStateByPartialCompositeKey(prefix, []string{})
+	}
+	if err != nil {
+		message := fmt.Sprintf("unable to get an iterator over %s: %s", prefix, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+	defer it.Close()
+
+	var h rollingHash
+	digest := stateDigest{Prefix: prefix, Algorithm: hashAlgorithm}
+	for it.HasNext() {
+		response, err := it.Next()
+		if err != nil {
+			message := fmt.Sprintf("unable to get the next element: %s", err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		h.add(response.Key, response.Value)
+		digest.Count++
+	}
+	digest.Checksum = hex.EncodeToString(h[:])
+
+	result, err := marshalResult(digest, format)
+	if err != nil {
+		message := fmt.Sprintf("unable to marshal the result: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.stateChecksum exited successfully")
+	return shim.Success(result)
+}
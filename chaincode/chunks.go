@@ -0,0 +1,229 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// A range too large for a single response, e.g. of large values, is read in
+// chunks of a fixed number of keys: getByRangeMeta tells how many chunks
+// there are and getByRangeChunk returns one of them by its index. Chunks are
+// positions in the sorted keys, so every endorser returns the same chunk,
+// and clients can fetch them in any order, or in parallel. Writes to the
+// range between the calls shift the keys across chunks; clients comparing the
+// count before and after tell.
+
+// rangeMeta is what a client needs to pull a range in chunks.
+type rangeMeta struct {
+	Count     int `json:"count"`
+	ChunkSize int `json:"chunkSize"`
+	Chunks    int `json:"chunks"`
+}
+
+// rangeChunk is a chunk of a range. More tells that chunks follow.
+type rangeChunk struct {
+	Records    queryResults `json:"records"`
+	ChunkIndex int          `json:"chunkIndex"`
+	ChunkSize  int          `json:"chunkSize"`
+	More       bool         `json:"more"`
+}
+
+func (chunk rangeChunk) ndjsonLines() []interface{} {
+	lines := make([]interface{}, 0, len(chunk.Records)+1)
+	for _, entry := range chunk.Records {
+		lines = append(lines, entry)
+	}
+
+	cursor := struct {
+		ChunkIndex int  `json:"chunkIndex"`
+		ChunkSize  int  `json:"chunkSize"`
+		More       bool `json:"more"`
+	}{chunk.ChunkIndex, chunk.ChunkSize, chunk.More}
+
+	return append(lines, ndjsonCursor{cursor})
+}
+
+func (chunk rangeChunk) document() (interface{}, error) {
+	records, err := chunk.Records.document()
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"records":    records,
+		"chunkIndex": chunk.ChunkIndex,
+		"chunkSize":  chunk.ChunkSize,
+		"more":       chunk.More,
+	}, nil
+}
+
+func parseChunkSize(chunkSizeArg string) (int, error) {
+	chunkSize, err := strconv.Atoi(chunkSizeArg)
+	if err != nil || chunkSize < 1 || chunkSize > maxPageSize {
+		return 0, fmt.Errorf("chunk size must be an integer in [1, %d], got \"%s\"", maxPageSize, chunkSizeArg)
+	}
+
+	return chunkSize, nil
+}
+
+func parseChunkIndex(chunkIndexArg string) (int, error) {
+	chunkIndex, err := strconv.ParseInt(chunkIndexArg, 10, 32)
+	if err != nil || chunkIndex < 0 {
+		return 0, fmt.Errorf("chunk index must be a non-negative 32-bit integer, got \"%s\"", chunkIndexArg)
+	}
+
+	return int(chunkIndex), nil
+}
+
+// getByRangeMeta returns the number of simple keys in [keyFrom, keyTo) and of
+// the chunks of chunkSize keys they make.
+func (cc *SimpleChaincode) getByRangeMeta(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.getByRangeMeta")
+
+	if len(args) != 3 && len(args) != 4 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d or %d", len(args), 3, 4)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	keyFrom, keyTo, chunkSizeArg, format := args[0], args[1], args[2], formatJSON
+	if len(args) == 4 {
+		format = args[3]
+	}
+	logger.Debugf("range: [\"%s\", \"%s\"), chunkSize: %s, format: %s", keyFrom, keyTo, chunkSizeArg, format)
+
+	if err := checkFormat(format); err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	chunkSize, err := parseChunkSize(chunkSizeArg)
+	if err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	count, err := countRange(stub, keyFrom, keyTo)
+	if err != nil {
+		message := fmt.Sprintf("unable to count the keys in the range [\"%s\", \"%s\"): %s",
+			keyFrom, keyTo, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	meta := rangeMeta{Count: count, ChunkSize: chunkSize, Chunks: (count + chunkSize - 1) / chunkSize}
+	result, err := marshalResult(meta, format)
+	if err != nil {
+		message := fmt.Sprintf("unable to marshal the result: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.getByRangeMeta exited successfully")
+	return shim.Success(result)
+}
+
+// getByRangeChunk returns the records of the simple keys of [keyFrom, keyTo)
+// from the chunkIndex * chunkSize-th on, up to chunkSize of them. A chunk past
+// the end of the range is empty.
+func (cc *SimpleChaincode) getByRangeChunk(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.getByRangeChunk")
+
+	if len(args) != 4 && len(args) != 5 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d or %d", len(args), 4, 5)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	keyFrom, keyTo, chunkIndexArg, chunkSizeArg, format := args[0], args[1], args[2], args[3], formatJSON
+	if len(args) == 5 {
+		format = args[4]
+	}
+	logger.Debugf("range: [\"%s\", \"%s\"), chunkIndex: %s, chunkSize: %s, format: %s",
+		keyFrom, keyTo, chunkIndexArg, chunkSizeArg, format)
+
+	if err := checkFormat(format); err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	chunkIndex, err := parseChunkIndex(chunkIndexArg)
+	if err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	chunkSize, err := parseChunkSize(chunkSizeArg)
+	if err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	now, err := txTime(stub)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the transaction timestamp: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	it, err := stub.GetStateByRange(keyFrom, keyTo)
+	if err != nil {
+		message := fmt.Sprintf("unable to get an iterator over the range [\"%s\", \"%s\"): %s",
+			keyFrom, keyTo, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+	defer it.Close()
+
+	chunk := rangeChunk{Records: queryResults{}, ChunkIndex: chunkIndex, ChunkSize: chunkSize}
+	skip := chunkIndex * chunkSize
+	for it.HasNext() {
+		response, err := it.Next()
+		if err != nil {
+			message := fmt.Sprintf("unable to get the next element: %s", err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		if isCompositeKey(response.Key) {
+			continue
+		}
+
+		if skip > 0 {
+			skip--
+			continue
+		}
+
+		if len(chunk.Records) == chunkSize {
+			chunk.More = true
+			break
+		}
+
+		r := decodeRecord(response.Value)
+		if err := r.verify(); err != nil {
+			message := fmt.Sprintf("unable to get a value for the key %s: %s", response.Key, err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		chunk.Records = append(chunk.Records, queryResult{Key: response.Key, record: r.readableAt(now)})
+	}
+
+	result, err := marshalResult(chunk, format)
+	if err != nil {
+		message := fmt.Sprintf("unable to marshal the result: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.getByRangeChunk exited successfully")
+	return shim.Success(result)
+}
@@ -0,0 +1,413 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+const (
+	counterObjType     = reservedObjTypePrefix + "counter"
+	reservationObjType = reservedObjTypePrefix + "reservation"
+)
+
+// counter is an amount of units, e.g. items in stock or funds, that can be
+// put on hold before being consumed. Available excludes the units held by
+// reservations. Amounts have Scale decimal places, 0 for whole units.
+//
+// Every reservation updates the counter, so concurrent reservations against
+// one counter conflict and all but one per block fail with an MVCC conflict;
+// clients are expected to retry, and hot counters should be split (e.g. per
+// warehouse) to spread the contention.
+type counter struct {
+	Available *decimal `json:"available"`
+	Reserved  *decimal `json:"reserved"`
+	Scale     int32    `json:"scale,omitempty"`
+}
+
+// reservation holds Amount units of a counter until ExpiresAt, after which
+// they go back to the counter instead of being confirmed.
+type reservation struct {
+	ID        string    `json:"id"`
+	Counter   string    `json:"counter"`
+	Amount    *decimal  `json:"amount"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+func getCounter(stub shim.ChaincodeStubInterface, name string) (string, *counter, error) {
+	counterKey, err := stub.CreateCompositeKey(counterObjType, []string{name})
+	if err != nil {
+		return "", nil, err
+	}
+
+	counterBytes, err := stub.GetState(counterKey)
+	if err != nil || counterBytes == nil {
+		return counterKey, nil, err
+	}
+
+	var c counter
+	if err := json.Unmarshal(counterBytes, &c); err != nil {
+		return "", nil, err
+	}
+
+	return counterKey, &c, nil
+}
+
+// getJSON reads the value under key into v, reporting whether there is one.
+func getJSON(stub shim.ChaincodeStubInterface, key string, v interface{}) (bool, error) {
+	valueBytes, err := stub.GetState(key)
+	if err != nil || valueBytes == nil {
+		return false, err
+	}
+
+	return true, json.Unmarshal(valueBytes, v)
+}
+
+func putJSON(stub shim.ChaincodeStubInterface, key string, v interface{}) error {
+	valueBytes, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return stub.PutState(key, valueBytes)
+}
+
+func getReservation(stub shim.ChaincodeStubInterface, name, id string) (string, *reservation, error) {
+	reservationKey, err := stub.CreateCompositeKey(reservationObjType, []string{name, id})
+	if err != nil {
+		return "", nil, err
+	}
+
+	reservationBytes, err := stub.GetState(reservationKey)
+	if err != nil || reservationBytes == nil {
+		return reservationKey, nil, err
+	}
+
+	var r reservation
+	if err := json.Unmarshal(reservationBytes, &r); err != nil {
+		return "", nil, err
+	}
+
+	return reservationKey, &r, nil
+}
+
+func (cc *SimpleChaincode) initCounter(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.initCounter")
+
+	if len(args) != 2 && len(args) != 3 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d or %d", len(args), 2, 3)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	name, scaleArg := args[0], "0"
+	if len(args) == 3 {
+		scaleArg = args[2]
+	}
+	logger.Debugf("counter: %s, value: %s, scale: %s", name, args[1], scaleArg)
+
+	scale, err := strconv.ParseInt(scaleArg, 10, 32)
+	if err != nil || scale < 0 || scale > maxScale {
+		message := fmt.Sprintf("scale must be an integer in [0, %d], got \"%s\"", maxScale, scaleArg)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	value, err := parseDecimal(args[1], int32(scale))
+	if err != nil || value.Sign() < 0 {
+		message := fmt.Sprintf("value must be a non-negative decimal with at most %d decimal places, got \"%s\"",
+			scale, args[1])
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	counterKey, c, err := getCounter(stub, name)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the counter %s: %s", name, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if c != nil {
+		message := fmt.Sprintf("the counter %s already exists", name)
+		logger.Error(message)
+		return pb.Response{Status: 409, Message: message}
+	}
+
+	if err := putJSON(stub, counterKey, counter{Available: value, Reserved: newDecimal(0, value.scale), Scale: value.scale}); err != nil {
+		message := fmt.Sprintf("unable to put the counter %s: %s", name, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.initCounter exited successfully")
+	return shim.Success(nil)
+}
+
+func (cc *SimpleChaincode) getCounter(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.getCounter")
+
+	if len(args) != 1 && len(args) != 2 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d or %d", len(args), 1, 2)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	name, format := args[0], formatJSON
+	if len(args) == 2 {
+		format = args[1]
+	}
+	logger.Debugf("counter: %s, format: %s", name, format)
+
+	if err := checkFormat(format); err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	_, c, err := getCounter(stub, name)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the counter %s: %s", name, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if c == nil {
+		message := fmt.Sprintf("the counter %s not found", name)
+		logger.Error(message)
+		return pb.Response{Status: 404, Message: message}
+	}
+
+	result, err := marshalResult(c, format)
+	if err != nil {
+		message := fmt.Sprintf("unable to marshal the result: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.getCounter exited successfully")
+	return shim.Success(result)
+}
+
+func (cc *SimpleChaincode) reserve(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.reserve")
+
+	if len(args) != 3 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d", len(args), 3)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	name := args[0]
+	logger.Debugf("counter: %s, amount: %s, ttl: %s", name, args[1], args[2])
+
+	ttl, err := time.ParseDuration(args[2])
+	if err != nil || ttl <= 0 {
+		message := fmt.Sprintf("ttl must be a positive duration, e.g. \"15m\", got \"%s\"", args[2])
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	counterKey, c, err := getCounter(stub, name)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the counter %s: %s", name, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if c == nil {
+		message := fmt.Sprintf("the counter %s not found", name)
+		logger.Error(message)
+		return pb.Response{Status: 404, Message: message}
+	}
+
+	requested, err := parseDecimal(args[1], c.Scale)
+	if err != nil || requested.Sign() <= 0 {
+		message := fmt.Sprintf("amount must be a positive decimal with at most %d decimal places, got \"%s\"",
+			c.Scale, args[1])
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	now, err := txTime(stub)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the transaction timestamp: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	// expired reservations are only given back when their units are needed
+	if c.Available.cmp(requested) < 0 {
+		if err := releaseExpired(stub, name, c, now); err != nil {
+			message := fmt.Sprintf("unable to release the expired reservations of %s: %s", name, err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+	}
+
+	if c.Available.cmp(requested) < 0 {
+		message := fmt.Sprintf("the counter %s has %s units available, %s requested", name, c.Available, requested)
+		logger.Error(message)
+		return pb.Response{Status: 409, Message: message}
+	}
+
+	r := reservation{
+		ID:        deriveID(stub, name),
+		Counter:   name,
+		Amount:    requested,
+		ExpiresAt: now.Add(ttl),
+	}
+	c.Available.sub(requested)
+	c.Reserved.add(requested)
+
+	reservationKey, err := stub.CreateCompositeKey(reservationObjType, []string{name, r.ID})
+	if err != nil {
+		message := fmt.Sprintf("unable to create a composite key: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if err := putJSON(stub, reservationKey, r); err != nil {
+		message := fmt.Sprintf("unable to put the reservation: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if err := putJSON(stub, counterKey, c); err != nil {
+		message := fmt.Sprintf("unable to update the counter %s: %s", name, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	result, err := json.Marshal(r)
+	if err != nil {
+		message := fmt.Sprintf("unable to marshal the result: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.reserve exited successfully")
+	return shim.Success(result)
+}
+
+func (cc *SimpleChaincode) confirm(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.confirm")
+	return cc.settleReservation(stub, args, true)
+}
+
+func (cc *SimpleChaincode) release(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.release")
+	return cc.settleReservation(stub, args, false)
+}
+
+// settleReservation ends a reservation, either consuming its units or giving
+// them back to the counter. An expired reservation can only be released.
+func (cc *SimpleChaincode) settleReservation(stub shim.ChaincodeStubInterface, args []string, consume bool) pb.Response {
+	if len(args) != 2 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d", len(args), 2)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	name, id := args[0], args[1]
+	logger.Debugf("counter: %s, reservation: %s, consume: %t", name, id, consume)
+
+	reservationKey, r, err := getReservation(stub, name, id)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the reservation %s: %s", id, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if r == nil {
+		message := fmt.Sprintf("the reservation %s of the counter %s not found", id, name)
+		logger.Error(message)
+		return pb.Response{Status: 404, Message: message}
+	}
+
+	now, err := txTime(stub)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the transaction timestamp: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	// a failed proposal has its writes discarded, so an expired reservation is
+	// left for release or for the next reserve to give back
+	if consume && !now.Before(r.ExpiresAt) {
+		message := fmt.Sprintf("the reservation %s expired at %s", id, r.ExpiresAt.Format(time.RFC3339))
+		logger.Error(message)
+		return pb.Response{Status: 410, Message: message}
+	}
+
+	counterKey, c, err := getCounter(stub, name)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the counter %s: %s", name, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if c == nil {
+		message := fmt.Sprintf("the counter %s not found", name)
+		logger.Error(message)
+		return pb.Response{Status: 404, Message: message}
+	}
+
+	c.Reserved.sub(r.Amount)
+	if !consume {
+		c.Available.add(r.Amount)
+	}
+
+	if err := stub.DelState(reservationKey); err != nil {
+		message := fmt.Sprintf("unable to delete the reservation %s: %s", id, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if err := putJSON(stub, counterKey, c); err != nil {
+		message := fmt.Sprintf("unable to update the counter %s: %s", name, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.settleReservation exited successfully")
+	return shim.Success(nil)
+}
+
+// releaseExpired deletes the expired reservations of a counter and gives their
+// units back to c. The caller stores c.
+func releaseExpired(stub shim.ChaincodeStubInterface, name string, c *counter, now time.Time) error {
+	it, err := stub.GetStateByPartialCompositeKey(reservationObjType, []string{name})
+	if err != nil {
+		return err
+	}
+	defer it.Close()
+
+	for it.HasNext() {
+		response, err := it.Next()
+		if err != nil {
+			return err
+		}
+
+		var r reservation
+		if err := json.Unmarshal(response.Value, &r); err != nil {
+			return err
+		}
+
+		if now.Before(r.ExpiresAt) {
+			continue
+		}
+
+		if err := stub.DelState(response.Key); err != nil {
+			return err
+		}
+		c.Reserved.sub(r.Amount)
+		c.Available.add(r.Amount)
+	}
+
+	return nil
+}
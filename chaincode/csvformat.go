@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// csvResult is implemented by results with columns of their own, e.g.
+// records, whose optional fields still get a column. Other results are
+// flattened from their JSON: an object is a row, an array of objects a row
+// per element under the union of their fields, and nested values are written
+// as JSON in their cell.
+type csvResult interface {
+	csvRows() ([][]string, error)
+}
+
+// recordCSVHeader are the columns of a record. Binary values are written
+// base64-encoded, as the encoding column tells, like in JSON.
+var recordCSVHeader = []string{
+	"value", "contentType", "encoding", "checksum", "size", "version",
+	"createdAt", "updatedAt", "archivedAt", "unlockAt", "txId", "creatorMspId", "creatorSubject",
+	"deletedAt", "deletedByMspId", "deletedBySubject", "expiresAt",
+}
+
+func csvTime(t *time.Time) string {
+	if t == nil || t.IsZero() {
+		return ""
+	}
+
+	return t.Format(time.RFC3339Nano)
+}
+
+// recordCSVRow returns the cells of r under recordCSVHeader, empty ones for
+// no record, e.g. for a deletion in a history.
+func recordCSVRow(r *record) []string {
+	if r == nil {
+		return make([]string, len(recordCSVHeader))
+	}
+
+	c, d := r.Creator, r.DeletedBy
+	if c == nil {
+		c = &creator{}
+	}
+	if d == nil {
+		d = &creator{}
+	}
+
+	return []string{
+		r.Value, r.ContentType, r.Encoding, r.Checksum, strconv.Itoa(r.Size), strconv.FormatUint(r.Version, 10),
+		csvTime(&r.CreatedAt), csvTime(&r.UpdatedAt), csvTime(r.ArchivedAt), csvTime(r.UnlockAt),
+		r.TxID, c.MSPID, c.Subject, csvTime(r.DeletedAt), d.MSPID, d.Subject, csvTime(r.ExpiresAt),
+	}
+}
+
+func (r *record) csvRows() ([][]string, error) {
+	return [][]string{recordCSVHeader, recordCSVRow(r)}, nil
+}
+
+func (entries queryResults) csvRows() ([][]string, error) {
+	rows := [][]string{append([]string{"key"}, recordCSVHeader...)}
+	for _, entry := range entries {
+		rows = append(rows, append([]string{entry.Key}, recordCSVRow(entry.record)...))
+	}
+
+	return rows, nil
+}
+
+// marshalCSV encodes v as CSV with a header row.
+func marshalCSV(v interface{}) ([]byte, error) {
+	var rows [][]string
+	if c, ok := v.(csvResult); ok {
+		var err error
+		if rows, err = c.csvRows(); err != nil {
+			return nil, err
+		}
+	} else {
+		resultBytes, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+
+		doc, err := decodeJSON(resultBytes)
+		if err != nil {
+			return nil, err
+		}
+
+		if rows, err = flattenCSV(doc); err != nil {
+			return nil, err
+		}
+	}
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := w.WriteAll(rows); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// flattenCSV returns the rows of a document decoded by decodeJSON, with
+// columns sorted by name.
+func flattenCSV(doc interface{}) ([][]string, error) {
+	var objects []map[string]interface{}
+	switch v := doc.(type) {
+	case map[string]interface{}:
+		objects = append(objects, v)
+	case []interface{}:
+		for _, element := range v {
+			object, ok := element.(map[string]interface{})
+			if !ok {
+				object = map[string]interface{}{"value": element}
+			}
+			objects = append(objects, object)
+		}
+	default:
+		objects = append(objects, map[string]interface{}{"value": v})
+	}
+
+	columns := map[string]bool{}
+	var header []string
+	for _, object := range objects {
+		for name := range object {
+			if !columns[name] {
+				columns[name] = true
+				header = append(header, name)
+			}
+		}
+	}
+	sort.Strings(header)
+
+	rows := [][]string{header}
+	for _, object := range objects {
+		row := make([]string, len(header))
+		for i, name := range header {
+			cell, err := csvCell(object[name])
+			if err != nil {
+				return nil, err
+			}
+			row[i] = cell
+		}
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+func csvCell(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	}
+
+	cellBytes, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	return string(cellBytes), nil
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// csvKeyField is the mapping target of the column that holds record keys.
+const csvKeyField = "@key"
+
+type csvRowError struct {
+	Row   int    `json:"row"`
+	Error string `json:"error"`
+}
+
+type csvImportResult struct {
+	Imported int           `json:"imported"`
+	Errors   []csvRowError `json:"errors"`
+}
+
+// importCSV stores the rows of a CSV chunk as JSON documents. The first row of
+// the chunk is the header; headerMapping maps column names to document fields
+// and one column to csvKeyField. Columns without a mapping are skipped. Rows
+// that can't be imported are reported by their 1-based position after the
+// header, the others are stored regardless. Larger files are imported chunk by
+// chunk, each chunk repeating the header.
+func (cc *SimpleChaincode) importCSV(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.importCSV")
+
+	if len(args) != 3 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d", len(args), 3)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	objType, mappingJSON, chunk := args[0], args[1], args[2]
+	logger.Debugf("type: %s, mapping: %s, chunk size: %d", objType, mappingJSON, len(chunk))
+
+	if response, denied := accessDenied(stub, accessWrite, objType); denied {
+		return response
+	}
+
+	var mapping map[string]string
+	if err := json.Unmarshal([]byte(mappingJSON), &mapping); err != nil {
+		message := fmt.Sprintf("unable to parse the header mapping: %s", err.Error())
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	reader := csv.NewReader(strings.NewReader(chunk))
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		message := fmt.Sprintf("unable to read the CSV header: %s", err.Error())
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	keyColumn := -1
+	fields := make([]string, len(header))
+	for i, column := range header {
+		fields[i] = mapping[column]
+		if fields[i] == csvKeyField {
+			keyColumn = i
+		}
+	}
+
+	if keyColumn < 0 {
+		message := fmt.Sprintf("the header mapping must map a column to %s", csvKeyField)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	result := csvImportResult{Errors: []csvRowError{}}
+	seen := make(map[string]int)
+	for row := 1; ; row++ {
+		cells, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+
+		if row > maxPageSize {
+			message := fmt.Sprintf("a chunk must have at most %d rows", maxPageSize)
+			logger.Error(message)
+			return pb.Response{Status: 400, Message: message}
+		}
+
+		if err != nil {
+			result.Errors = append(result.Errors, csvRowError{Row: row, Error: err.Error()})
+			continue
+		}
+
+		key, doc, err := csvDocument(fields, keyColumn, cells)
+		if err == nil {
+			if first, ok := seen[key]; ok {
+				err = fmt.Errorf("the key %s is repeated from row %d", key, first)
+			}
+		}
+		if err != nil {
+			result.Errors = append(result.Errors, csvRowError{Row: row, Error: err.Error()})
+			continue
+		}
+		seen[key] = row
+
+		compositeKey, err := createCompositeKey(stub, objType, key)
+		if err != nil {
+			result.Errors = append(result.Errors, csvRowError{Row: row, Error: err.Error()})
+			continue
+		}
+
+		r, err := putRecord(stub, compositeKey, doc)
+		if invalid, ok := err.(*invalidValueError); ok {
+			result.Errors = append(result.Errors, csvRowError{Row: row, Error: invalid.Error()})
+			continue
+		}
+		if err != nil {
+			message := fmt.Sprintf("unable to put a key-value pair: %s", err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		if err := appendAudit(stub, "importCSV", objType, key, r); err != nil {
+			message := fmt.Sprintf("unable to append to the audit log: %s", err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		result.Imported++
+	}
+
+	resultBytes, err := json.Marshal(result)
+	if err != nil {
+		message := fmt.Sprintf("unable to marshal the import result: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.importCSV exited successfully")
+	return shim.Success(resultBytes)
+}
+
+// csvDocument builds the JSON document of a row, returning it with the key.
+func csvDocument(fields []string, keyColumn int, cells []string) (string, string, error) {
+	if len(cells) != len(fields) {
+		return "", "", fmt.Errorf("expected %d fields, got %d", len(fields), len(cells))
+	}
+
+	key := cells[keyColumn]
+	if key == "" {
+		return "", "", fmt.Errorf("the key column is empty")
+	}
+
+	doc := make(map[string]string)
+	for i, field := range fields {
+		if field != "" && i != keyColumn {
+			doc[field] = cells[i]
+		}
+	}
+
+	docBytes, err := json.Marshal(doc)
+	if err != nil {
+		return "", "", err
+	}
+
+	return key, string(docBytes), nil
+}
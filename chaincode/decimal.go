@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+)
+
+// maxScale bounds the number of decimal places of decimals.
+const maxScale = 18
+
+var decimalPattern = regexp.MustCompile(`^[+-]?[0-9]+(\.[0-9]+)?$`)
+
+// decimal is a fixed-point number, an unscaled integer divided by 10^scale,
+// for amounts of money and the like; floats would round differently across
+// peers. Sums and differences are exact. Products and quotients are rounded
+// to the scale asked for, half to even (banker's rounding), so all endorsers
+// get the same digits. In JSON a decimal is a string with exactly scale
+// decimal places, e.g. "12.50".
+type decimal struct {
+	unscaled amount
+	scale    int32
+}
+
+func newDecimal(unscaled int64, scale int32) *decimal {
+	d := &decimal{scale: scale}
+	d.unscaled.SetInt64(unscaled)
+	return d
+}
+
+// parseDecimal parses s into a decimal of the given scale. It fails rather
+// than rounds when s has more decimal places than that.
+func parseDecimal(s string, scale int32) (*decimal, error) {
+	if scale < 0 || scale > maxScale {
+		return nil, fmt.Errorf("scale must be in [0, %d], got %d", maxScale, scale)
+	}
+
+	if !decimalPattern.MatchString(s) {
+		return nil, fmt.Errorf("invalid decimal \"%s\"", s)
+	}
+
+	digits, fraction := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		digits, fraction = s[:i], s[i+1:]
+	}
+
+	if len(fraction) > int(scale) {
+		return nil, fmt.Errorf("the decimal \"%s\" has more than %d decimal places", s, scale)
+	}
+
+	d := &decimal{scale: scale}
+	d.unscaled.SetString(digits+fraction+strings.Repeat("0", int(scale)-len(fraction)), 10)
+	return d, nil
+}
+
+// decimalOf parses s into a decimal with as many decimal places as written.
+func decimalOf(s string) (*decimal, error) {
+	var scale int32
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		scale = int32(len(s) - i - 1)
+	}
+
+	return parseDecimal(s, scale)
+}
+
+func (d *decimal) String() string {
+	digits := new(big.Int).Abs(&d.unscaled.Int).String()
+	if d.scale > 0 {
+		if pad := int(d.scale) + 1 - len(digits); pad > 0 {
+			digits = strings.Repeat("0", pad) + digits
+		}
+		digits = digits[:len(digits)-int(d.scale)] + "." + digits[len(digits)-int(d.scale):]
+	}
+
+	if d.unscaled.Sign() < 0 {
+		return "-" + digits
+	}
+	return digits
+}
+
+func (d *decimal) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// UnmarshalJSON takes the scale from the decimal places written, and accepts
+// plain integers, as amounts were stored before.
+func (d *decimal) UnmarshalJSON(data []byte) error {
+	parsed, err := decimalOf(string(bytes.Trim(data, `"`)))
+	if err != nil {
+		return err
+	}
+
+	*d = *parsed
+	return nil
+}
+
+func (d *decimal) Sign() int {
+	return d.unscaled.Sign()
+}
+
+// rescale returns d with the given scale, rounded half to even if it has to
+// lose decimal places.
+func (d *decimal) rescale(scale int32) *decimal {
+	if scale >= d.scale {
+		r := &decimal{scale: scale}
+		r.unscaled.Mul(&d.unscaled.Int, pow10(scale-d.scale))
+		return r
+	}
+
+	r := &decimal{scale: scale}
+	r.unscaled.Set(roundQuo(&d.unscaled.Int, pow10(d.scale-scale)))
+	return r
+}
+
+// aligned returns d and e at the larger of their scales.
+func aligned(d, e *decimal) (*decimal, *decimal) {
+	if d.scale < e.scale {
+		return d.rescale(e.scale), e
+	}
+
+	return d, e.rescale(d.scale)
+}
+
+func (d *decimal) cmp(e *decimal) int {
+	a, b := aligned(d, e)
+	return a.unscaled.cmp(&b.unscaled)
+}
+
+// add adds e to d in place; d takes the larger scale of both.
+func (d *decimal) add(e *decimal) {
+	a, b := aligned(d, e)
+	a.unscaled.add(&b.unscaled)
+	*d = *a
+}
+
+// sub subtracts e from d in place; d takes the larger scale of both.
+func (d *decimal) sub(e *decimal) {
+	a, b := aligned(d, e)
+	a.unscaled.sub(&b.unscaled)
+	*d = *a
+}
+
+// mul returns d * e rounded to scale.
+func (d *decimal) mul(e *decimal, scale int32) *decimal {
+	product := &decimal{scale: d.scale + e.scale}
+	product.unscaled.Mul(&d.unscaled.Int, &e.unscaled.Int)
+	return product.rescale(scale)
+}
+
+// quo returns d / e rounded to scale. e must not be zero.
+func (d *decimal) quo(e *decimal, scale int32) *decimal {
+	// d / e = (d.unscaled * 10^(e.scale + scale - d.scale) / e.unscaled) / 10^scale
+	num, den := new(big.Int).Set(&d.unscaled.Int), new(big.Int).Set(&e.unscaled.Int)
+	if exp := e.scale + scale - d.scale; exp >= 0 {
+		num.Mul(num, pow10(exp))
+	} else {
+		den.Mul(den, pow10(-exp))
+	}
+
+	r := &decimal{scale: scale}
+	r.unscaled.Set(roundQuo(num, den))
+	return r
+}
+
+func pow10(n int32) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+// roundQuo returns num / den rounded half to even.
+func roundQuo(num, den *big.Int) *big.Int {
+	q, r := new(big.Int).QuoRem(num, den, new(big.Int))
+	if r.Sign() == 0 {
+		return q
+	}
+
+	// compare the remainder with half the divisor, in absolute values
+	twice := new(big.Int).Abs(r)
+	twice.Lsh(twice, 1)
+	c := twice.Cmp(new(big.Int).Abs(den))
+	if c > 0 || (c == 0 && q.Bit(0) == 1) {
+		if (num.Sign() < 0) != (den.Sign() < 0) {
+			q.Sub(q, big.NewInt(1))
+		} else {
+			q.Add(q, big.NewInt(1))
+		}
+	}
+
+	return q
+}
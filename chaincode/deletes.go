@@ -0,0 +1,210 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// deletion is the result of a bulk delete: the keys deleted, or with DryRun,
+// those that would have been. A transaction deletes at most maxPageSize keys;
+// More tells that some are left, for another call to delete.
+type deletion struct {
+	Keys   []string `json:"keys"`
+	DryRun bool     `json:"dryRun"`
+	More   bool     `json:"more"`
+}
+
+func parseDryRun(args []string, i int) (bool, error) {
+	if len(args) <= i {
+		return false, nil
+	}
+
+	dryRun, err := strconv.ParseBool(args[i])
+	if err != nil {
+		return false, fmt.Errorf("dryRun must be true or false, got \"%s\"", args[i])
+	}
+
+	return dryRun, nil
+}
+
+// deleteKeys deletes the keys of objType listed in compositeKeys, keys being
+// the same as clients know them, as del does.
+func deleteKeys(stub shim.ChaincodeStubInterface, objType string, compositeKeys, keys []string) error {
+	for i, compositeKey := range compositeKeys {
+		if err := removeRecord(stub, objType, keys[i], compositeKey); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// delByRange deletes the simple keys in [keyFrom, keyTo), e.g. a test
+// dataset, up to maxPageSize of them. The keys of object types, composite
+// keys, are out of any range of simple keys.
+func (cc *SimpleChaincode) delByRange(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.delByRange")
+
+	if len(args) != 2 && len(args) != 3 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d or %d", len(args), 2, 3)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	keyFrom, keyTo := args[0], args[1]
+	dryRun, err := parseDryRun(args, 2)
+	if err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+	logger.Debugf("range: [\"%s\", \"%s\"), dryRun: %t", keyFrom, keyTo, dryRun)
+
+	if response, denied := accessDenied(stub, accessDelete, ""); denied {
+		return response
+	}
+
+	it, err := stub.GetStateByRange(keyFrom, keyTo)
+	if err != nil {
+		message := fmt.Sprintf("unable to get an iterator over the range [\"%s\", \"%s\"): %s",
+			keyFrom, keyTo, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+	defer it.Close()
+
+	d := deletion{Keys: []string{}, DryRun: dryRun}
+	for it.HasNext() {
+		response, err := it.Next()
+		if err != nil {
+			message := fmt.Sprintf("unable to get the next element: %s", err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		if isCompositeKey(response.Key) {
+			continue
+		}
+
+		if len(d.Keys) == maxPageSize {
+			d.More = true
+			break
+		}
+		d.Keys = append(d.Keys, response.Key)
+	}
+
+	if !dryRun {
+		if err := deleteKeys(stub, "", d.Keys, d.Keys); err != nil {
+			message := err.Error()
+			logger.Error(message)
+			return shim.Error(message)
+		}
+	}
+
+	result, err := marshalResult(d, formatJSON)
+	if err != nil {
+		message := fmt.Sprintf("unable to marshal the result: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.delByRange exited successfully")
+	return shim.Success(result)
+}
+
+// delByPartialCompositeKey deletes the keys of an object type that start with
+// the given parts, as getByPartialCompositeKey lists them, up to maxPageSize
+// of them.
+func (cc *SimpleChaincode) delByPartialCompositeKey(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.delByPartialCompositeKey")
+
+	if len(args) != 2 && len(args) != 3 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d or %d", len(args), 2, 3)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	objType, partialKey := args[0], args[1]
+	dryRun, err := parseDryRun(args, 2)
+	if err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+	logger.Debugf("type: %s, partial key: %s, dryRun: %t", objType, partialKey, dryRun)
+
+	if objType == "" || strings.HasPrefix(objType, reservedObjTypePrefix) {
+		message := fmt.Sprintf("the object type \"%s\" has no composite keys to delete", objType)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	if response, denied := accessDenied(stub, accessDelete, objType); denied {
+		return response
+	}
+
+	var parts []string
+	if partialKey != "" {
+		if parts, err = keyParts(partialKey); err != nil {
+			message := err.Error()
+			logger.Error(message)
+			return pb.Response{Status: 400, Message: message}
+		}
+	}
+
+	it, err := stub.GetStateByPartialCompositeKey(objType, parts)
+	if err != nil {
+		message := fmt.Sprintf("unable to get an iterator over the partial key %s: %s", partialKey, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+	defer it.Close()
+
+	d := deletion{Keys: []string{}, DryRun: dryRun}
+	var compositeKeys []string
+	for it.HasNext() {
+		response, err := it.Next()
+		if err != nil {
+			message := fmt.Sprintf("unable to get the next element: %s", err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		if len(d.Keys) == maxPageSize {
+			d.More = true
+			break
+		}
+
+		_, attributes, err := stub.SplitCompositeKey(response.Key)
+		if err != nil {
+			message := fmt.Sprintf("unable to split the composite key %s: %s", response.Key, err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		compositeKeys = append(compositeKeys, response.Key)
+		d.Keys = append(d.Keys, formatKey(attributes))
+	}
+
+	if !dryRun {
+		if err := deleteKeys(stub, objType, compositeKeys, d.Keys); err != nil {
+			message := err.Error()
+			logger.Error(message)
+			return shim.Error(message)
+		}
+	}
+
+	result, err := marshalResult(d, formatJSON)
+	if err != nil {
+		message := fmt.Sprintf("unable to marshal the result: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.delByPartialCompositeKey exited successfully")
+	return shim.Success(result)
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// Documents are kept off-chain; the ledger only anchors their hashes, so
+// that anyone holding a copy can later prove it's the one anchored, and when.
+const docObjType = reservedObjTypePrefix + "doc"
+
+// docAnchor is the anchored hash of a document, the hex SHA-256 of its bytes,
+// along with what tells where to get it and what to expect. Anchors can't be
+// replaced: a new revision of a document is anchored under a new id.
+type docAnchor struct {
+	ID         string    `json:"id"`
+	Hash       string    `json:"hash"`
+	Size       int64     `json:"size"`
+	MimeType   string    `json:"mimeType"`
+	URI        string    `json:"uri,omitempty"`
+	AnchoredAt time.Time `json:"anchoredAt"`
+	TxID       string    `json:"txId"`
+	Creator    *creator  `json:"creator"`
+}
+
+// docVerification is the result of verifyDoc. Hash and Size are those of the
+// supplied document.
+type docVerification struct {
+	Verified bool       `json:"verified"`
+	Hash     string     `json:"hash"`
+	Size     int64      `json:"size"`
+	Anchor   *docAnchor `json:"anchor"`
+}
+
+func getDocAnchor(stub shim.ChaincodeStubInterface, id string) (string, *docAnchor, error) {
+	anchorKey, err := stub.CreateCompositeKey(docObjType, []string{id})
+	if err != nil {
+		return "", nil, err
+	}
+
+	var a docAnchor
+	found, err := getJSON(stub, anchorKey, &a)
+	if err != nil || !found {
+		return anchorKey, nil, err
+	}
+
+	return anchorKey, &a, nil
+}
+
+func parseDocHash(hash string) (string, error) {
+	hashBytes, err := hex.DecodeString(hash)
+	if err != nil || len(hashBytes) != sha256.Size {
+		return "", fmt.Errorf("hash must be a hex SHA-256, got \"%s\"", hash)
+	}
+
+	return strings.ToLower(hash), nil
+}
+
+// putDocHash anchors the hash of an off-chain document under id, for
+// verifyDoc to check copies of the document against.
+func (cc *SimpleChaincode) putDocHash(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.putDocHash")
+
+	if len(args) != 4 && len(args) != 5 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d or %d", len(args), 4, 5)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	id, hashArg, sizeArg, mimeType, uri := args[0], args[1], args[2], args[3], ""
+	if len(args) == 5 {
+		uri = args[4]
+	}
+	logger.Debugf("id: %s, hash: %s, size: %s, mimeType: %s, uri: %s", id, hashArg, sizeArg, mimeType, uri)
+
+	if id == "" || mimeType == "" {
+		message := "id and mimeType must be non-empty strings"
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	hash, err := parseDocHash(hashArg)
+	if err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	size, err := strconv.ParseInt(sizeArg, 10, 64)
+	if err != nil || size < 0 {
+		message := fmt.Sprintf("size must be a non-negative integer, got \"%s\"", sizeArg)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	anchorKey, anchor, err := getDocAnchor(stub, id)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the anchor of the document %s: %s", id, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if anchor != nil {
+		message := fmt.Sprintf("the document %s is already anchored", id)
+		logger.Error(message)
+		return pb.Response{Status: 409, Message: message}
+	}
+
+	now, err := txTime(stub)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the transaction timestamp: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	c, err := txCreator(stub)
+	if err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	anchor = &docAnchor{ID: id, Hash: hash, Size: size, MimeType: mimeType, URI: uri, AnchoredAt: now,
+		TxID: stub.GetTxID(), Creator: c}
+	if err := putJSON(stub, anchorKey, anchor); err != nil {
+		message := fmt.Sprintf("unable to put the anchor of the document %s: %s", id, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.putDocHash exited successfully")
+	return shim.Success(nil)
+}
+
+func (cc *SimpleChaincode) getDocHash(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.getDocHash")
+
+	if len(args) != 1 && len(args) != 2 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d or %d", len(args), 1, 2)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	id, format := args[0], formatJSON
+	if len(args) == 2 {
+		format = args[1]
+	}
+	logger.Debugf("id: %s, format: %s", id, format)
+
+	if err := checkFormat(format); err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	_, anchor, err := getDocAnchor(stub, id)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the anchor of the document %s: %s", id, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if anchor == nil {
+		message := fmt.Sprintf("the document %s not found", id)
+		logger.Error(message)
+		return pb.Response{Status: 404, Message: message}
+	}
+
+	result, err := marshalResult(anchor, format)
+	if err != nil {
+		message := fmt.Sprintf("unable to marshal the result: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.getDocHash exited successfully")
+	return shim.Success(result)
+}
+
+// verifyDoc checks a copy of a document, passed as raw bytes, against the hash
+// anchored under id. A copy that doesn't match isn't an error: the result
+// tells it isn't verified.
+func (cc *SimpleChaincode) verifyDoc(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.verifyDoc")
+
+	if len(args) != 2 && len(args) != 3 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d or %d", len(args), 2, 3)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	id, document, format := args[0], args[1], formatJSON
+	if len(args) == 3 {
+		format = args[2]
+	}
+	logger.Debugf("id: %s, document: %d bytes, format: %s", id, len(document), format)
+
+	if err := checkFormat(format); err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	_, anchor, err := getDocAnchor(stub, id)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the anchor of the document %s: %s", id, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if anchor == nil {
+		message := fmt.Sprintf("the document %s not found", id)
+		logger.Error(message)
+		return pb.Response{Status: 404, Message: message}
+	}
+
+	hash := sha256.Sum256([]byte(document))
+	v := docVerification{Hash: hex.EncodeToString(hash[:]), Size: int64(len(document)), Anchor: anchor}
+	v.Verified = v.Hash == anchor.Hash && v.Size == anchor.Size
+
+	result, err := marshalResult(v, format)
+	if err != nil {
+		message := fmt.Sprintf("unable to marshal the result: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.verifyDoc exited successfully")
+	return shim.Success(result)
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// Encrypted values keep a value confidential on a shared channel without a
+// private data collection: the client passes the value and an AES key in the
+// transient map, which the peer doesn't record in the transaction, and only
+// the ciphertext reaches the ledger. Whoever holds the key reads the value
+// back with getEncrypted, which should only be evaluated, never submitted, or
+// the plaintext ends up in the block as its response.
+const (
+	encryptionKeyField  = "ENCKEY"
+	encryptedValueField = "VALUE"
+
+	encryptedContentType = "application/x-aes-gcm"
+)
+
+// transientField returns the field called name of the transient map of the
+// transaction, failing if it's missing.
+func transientField(stub shim.ChaincodeStubInterface, name string) ([]byte, error) {
+	transient, err := stub.GetTransient()
+	if err != nil {
+		return nil, fmt.Errorf("unable to get the transient map: %s", err.Error())
+	}
+
+	field, ok := transient[name]
+	if !ok || len(field) == 0 {
+		return nil, fmt.Errorf("the transient map has no %s", name)
+	}
+
+	return field, nil
+}
+
+// valueCipher returns the AES-GCM cipher of key, a 16, 24 or 32 byte key of
+// AES-128, AES-192 or AES-256.
+func valueCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be an AES key of 16, 24 or 32 bytes", encryptionKeyField)
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// encryptValue seals value under compositeKey. The nonce is a MAC of the
+// transaction, compositeKey and value, SIV-style, rather than drawn at random,
+// so that all endorsers compute the same ciphertext. A transaction simulated
+// again with another value gets another nonce: a nonce is only used again for
+// the same plaintext, which then only tells that it's the same. compositeKey
+// is authenticated along, so the ciphertext can't be copied under another key.
+func encryptValue(stub shim.ChaincodeStubInterface, key []byte, compositeKey string, value []byte) ([]byte, error) {
+	aead, err := valueCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	// the MAC has a key of its own, derived from the AES key
+	derivation := hmac.New(sha256.New, key)
+	derivation.Write([]byte("nonce"))
+	mac := hmac.New(sha256.New, derivation.Sum(nil))
+	for _, field := range [][]byte{[]byte(stub.GetTxID()), []byte(compositeKey), value} {
+		// fields are length-prefixed, composite keys holding U+0000
+		var length [8]byte
+		binary.BigEndian.PutUint64(length[:], uint64(len(field)))
+		mac.Write(length[:])
+		mac.Write(field)
+	}
+	nonce := mac.Sum(nil)[:aead.NonceSize()]
+
+	return aead.Seal(nonce, nonce, value, []byte(compositeKey)), nil
+}
+
+func decryptValue(key []byte, compositeKey string, sealed []byte) ([]byte, error) {
+	aead, err := valueCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("the ciphertext is truncated")
+	}
+
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, []byte(compositeKey))
+}
+
+// putEncrypted stores the VALUE of the transient map encrypted with its
+// ENCKEY.
+func (cc *SimpleChaincode) putEncrypted(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.putEncrypted")
+
+	if len(args) != 2 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d", len(args), 2)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	objType, key := args[0], args[1]
+	logger.Debugf("type: %s, key: %s", objType, key)
+
+	if response, denied := accessDenied(stub, accessWrite, objType); denied {
+		return response
+	}
+
+	encryptionKey, err := transientField(stub, encryptionKeyField)
+	if err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	value, err := transientField(stub, encryptedValueField)
+	if err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	compositeKey, err := createCompositeKey(stub, objType, key)
+	if err != nil {
+		message := fmt.Sprintf("unable to create a composite key: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	sealed, err := encryptValue(stub, encryptionKey, compositeKey, value)
+	if err != nil {
+		message := fmt.Sprintf("unable to encrypt the value: %s", err.Error())
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	r, err := newRecordVersion(stub, compositeKey, base64.StdEncoding.EncodeToString(sealed))
+	if err != nil {
+		message := fmt.Sprintf("unable to put a key-value pair: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+	r.ContentType, r.Encoding = encryptedContentType, base64Encoding
+
+	err = storeRecord(stub, compositeKey, r)
+	if response, ok := invalidValueResponse(err); ok {
+		return response
+	}
+	if err != nil {
+		message := fmt.Sprintf("unable to put a key-value pair: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if err := appendAudit(stub, "putEncrypted", objType, key, r); err != nil {
+		message := fmt.Sprintf("unable to append to the audit log: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.putEncrypted exited successfully")
+	return shim.Success(nil)
+}
+
+// getEncrypted returns the record of an encrypted value with the value
+// decrypted with the ENCKEY of the transient map.
+func (cc *SimpleChaincode) getEncrypted(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.getEncrypted")
+
+	if len(args) != 2 && len(args) != 3 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d or %d", len(args), 2, 3)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	objType, key, format := args[0], args[1], formatJSON
+	if len(args) == 3 {
+		format = args[2]
+	}
+	logger.Debugf("type: %s, key: %s, format: %s", objType, key, format)
+
+	if err := checkFormat(format); err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	encryptionKey, err := transientField(stub, encryptionKeyField)
+	if err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	if _, err := valueCipher(encryptionKey); err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	compositeKey, err := createCompositeKey(stub, objType, key)
+	if err != nil {
+		message := fmt.Sprintf("unable to create a composite key: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	r, err := getRecord(stub, compositeKey)
+	if err != nil {
+		message := fmt.Sprintf("unable to get a value for the key %s: %s", key, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if r == nil {
+		message := fmt.Sprintf("a value for the key %s not found", key)
+		logger.Error(message)
+		return pb.Response{Status: 404, Message: message}
+	}
+
+	now, err := txTime(stub)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the transaction timestamp: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if response, ok := unreadableResponse(key, r, now); ok {
+		return response
+	}
+
+	if r.ContentType != encryptedContentType {
+		message := fmt.Sprintf("the value for the key %s is not encrypted", key)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	sealed, err := r.rawValue()
+	if err != nil {
+		message := fmt.Sprintf("unable to decode the value for the key %s: %s", key, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	value, err := decryptValue(encryptionKey, compositeKey, sealed)
+	if err != nil {
+		message := fmt.Sprintf("unable to decrypt the value for the key %s with the given key", key)
+		logger.Error(message)
+		return pb.Response{Status: 403, Message: message}
+	}
+
+	decrypted := *r
+	decrypted.Value, decrypted.ContentType, decrypted.Encoding = string(value), "", ""
+	if err := decrypted.describe(); err != nil {
+		message := fmt.Sprintf("unable to describe the value for the key %s: %s", key, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	result, err := marshalResult(&decrypted, format)
+	if err != nil {
+		message := fmt.Sprintf("unable to marshal the result: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.getEncrypted exited successfully")
+	return shim.Success(result)
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/core/chaincode/shim/ext/statebased"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// keyEndorsementPolicy is the endorsement policy of a key as
+// getKeyEndorsementPolicy returns it: a peer of each of Orgs must endorse the
+// transactions that write the key. Without orgs, the chaincode's endorsement
+// policy applies, as it does to any other key.
+type keyEndorsementPolicy struct {
+	Orgs []string `json:"orgs"`
+}
+
+// setKeyEndorsementPolicy requires the endorsement of a peer of each of the
+// given MSPs, e.g. the org owning an asset, for the writes of a key, instead
+// of the chaincode's endorsement policy. No MSPs restores the latter. The
+// change is a write of the key itself, so it needs the endorsements the
+// current policy requires.
+func (cc *SimpleChaincode) setKeyEndorsementPolicy(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.setKeyEndorsementPolicy")
+
+	if len(args) < 2 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected at least %d", len(args), 2)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	objType, key, orgs := args[0], args[1], args[2:]
+	logger.Debugf("type: %s, key: %s, orgs: %v", objType, key, orgs)
+
+	if response, denied := accessDenied(stub, accessWrite, objType); denied {
+		return response
+	}
+
+	for _, org := range orgs {
+		if org == "" {
+			message := "orgs must be non-empty MSP ids"
+			logger.Error(message)
+			return pb.Response{Status: 400, Message: message}
+		}
+	}
+
+	compositeKey, err := createCompositeKey(stub, objType, key)
+	if err != nil {
+		message := fmt.Sprintf("unable to create a composite key: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	valueBytes, err := stub.GetState(compositeKey)
+	if err != nil {
+		message := fmt.Sprintf("unable to get a value for the key %s: %s", key, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if valueBytes == nil {
+		message := fmt.Sprintf("a value for the key %s not found", key)
+		logger.Error(message)
+		return pb.Response{Status: 404, Message: message}
+	}
+
+	var policy []byte
+	if len(orgs) > 0 {
+		ep, err := statebased.NewStateEP(nil)
+		if err != nil {
+			message := fmt.Sprintf("unable to create an endorsement policy: %s", err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		if err := ep.AddOrgs(statebased.RoleTypePeer, orgs...); err != nil {
+			message := fmt.Sprintf("unable to add the orgs to the endorsement policy: %s", err.Error())
+			logger.Error(message)
+			return pb.Response{Status: 400, Message: message}
+		}
+
+		if policy, err = ep.Policy(); err != nil {
+			message := fmt.Sprintf("unable to marshal the endorsement policy: %s", err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+	}
+
+	if err := stub.SetStateValidationParameter(compositeKey, policy); err != nil {
+		message := fmt.Sprintf("unable to set the endorsement policy of the key %s: %s", key, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.setKeyEndorsementPolicy exited successfully")
+	return shim.Success(nil)
+}
+
+// getKeyEndorsementPolicy returns the MSPs whose peers must endorse the
+// writes of a key.
+func (cc *SimpleChaincode) getKeyEndorsementPolicy(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.getKeyEndorsementPolicy")
+
+	if len(args) != 2 && len(args) != 3 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d or %d", len(args), 2, 3)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	objType, key, format := args[0], args[1], formatJSON
+	if len(args) == 3 {
+		format = args[2]
+	}
+	logger.Debugf("type: %s, key: %s, format: %s", objType, key, format)
+
+	if err := checkFormat(format); err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	compositeKey, err := createCompositeKey(stub, objType, key)
+	if err != nil {
+		message := fmt.Sprintf("unable to create a composite key: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	valueBytes, err := stub.GetState(compositeKey)
+	if err != nil {
+		message := fmt.Sprintf("unable to get a value for the key %s: %s", key, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if valueBytes == nil {
+		message := fmt.Sprintf("a value for the key %s not found", key)
+		logger.Error(message)
+		return pb.Response{Status: 404, Message: message}
+	}
+
+	parameter, err := stub.GetStateValidationParameter(compositeKey)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the endorsement policy of the key %s: %s", key, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	policy := keyEndorsementPolicy{Orgs: []string{}}
+	if len(parameter) > 0 {
+		ep, err := statebased.NewStateEP(parameter)
+		if err != nil {
+			message := fmt.Sprintf("unable to parse the endorsement policy of the key %s: %s", key, err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+		policy.Orgs = append(policy.Orgs, ep.ListOrgs()...)
+		sort.Strings(policy.Orgs)
+	}
+
+	result, err := marshalResult(policy, format)
+	if err != nil {
+		message := fmt.Sprintf("unable to marshal the result: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.getKeyEndorsementPolicy exited successfully")
+	return shim.Success(result)
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// A failed call answers a chaincodeError, encoded as JSON, as its message,
+// which is all the SDKs hand back of a failed proposal, and as its payload.
+// Its code tells clients what went wrong without matching the wording of the
+// message, which isn't part of the API.
+type chaincodeError struct {
+	Code    string          `json:"code"`
+	Message string          `json:"message"`
+	Details json.RawMessage `json:"details,omitempty"`
+}
+
+// The error codes. Most are the code of their status, see statusCodes;
+// the others narrow one down.
+const (
+	errBadArgument        = "ERR_BAD_ARGUMENT"
+	errUnknownFunction    = "ERR_UNKNOWN_FUNCTION"
+	errWrongArgumentCount = "ERR_WRONG_ARGUMENT_COUNT"
+	errInvalidValue       = "ERR_INVALID_VALUE"
+	errForbidden          = "ERR_FORBIDDEN"
+	errKeyNotFound        = "ERR_KEY_NOT_FOUND"
+	errConflict           = "ERR_CONFLICT"
+	errDuplicateRequest   = "ERR_DUPLICATE_REQUEST"
+	errGone               = "ERR_GONE"
+	errLocked             = "ERR_LOCKED"
+	errInternal           = "ERR_INTERNAL"
+)
+
+// errorStatuses is the registry of the error codes and their statuses.
+var errorStatuses = map[string]int32{
+	errBadArgument:        400,
+	errUnknownFunction:    400,
+	errWrongArgumentCount: 400,
+	errInvalidValue:       400,
+	errForbidden:          403,
+	errKeyNotFound:        404,
+	errConflict:           409,
+	errDuplicateRequest:   409,
+	errGone:               410,
+	errLocked:             423,
+	errInternal:           shim.ERROR,
+}
+
+// statusCodes are the codes of the errors the handlers answer by status.
+var statusCodes = map[int32]string{
+	400:        errBadArgument,
+	403:        errForbidden,
+	404:        errKeyNotFound,
+	409:        errConflict,
+	410:        errGone,
+	423:        errLocked,
+	shim.ERROR: errInternal,
+}
+
+// errorResponse returns the response of an error with the given code, with
+// details as JSON unless they're nil.
+func errorResponse(code, message string, details interface{}) pb.Response {
+	e := chaincodeError{Code: code, Message: message}
+	if details != nil {
+		detailsBytes, err := json.Marshal(details)
+		if err != nil {
+			logger.Errorf("unable to marshal the details of an error: %s", err.Error())
+		}
+		e.Details = detailsBytes
+	}
+
+	errorBytes, _ := json.Marshal(e)
+	return pb.Response{Status: errorStatuses[code], Message: string(errorBytes), Payload: errorBytes}
+}
+
+// parseError returns the error answered by response, nil if it isn't a
+// chaincodeError, e.g. it comes from another chaincode.
+func parseError(response pb.Response) *chaincodeError {
+	var e chaincodeError
+	if json.Unmarshal([]byte(response.Message), &e) != nil || e.Code == "" {
+		return nil
+	}
+
+	return &e
+}
+
+// errorMessage returns the message of the error answered by response,
+// whether it's a chaincodeError or not.
+func errorMessage(response pb.Response) string {
+	if e := parseError(response); e != nil {
+		return e.Message
+	}
+
+	return response.Message
+}
+
+// structuredError turns the response of a handler that failed into a
+// chaincodeError, if it isn't one already. A payload, e.g. the metadata of a
+// locked record, makes its details.
+func structuredError(response pb.Response) pb.Response {
+	if response.Status < shim.ERRORTHRESHOLD || parseError(response) != nil {
+		return response
+	}
+
+	code, ok := statusCodes[response.Status]
+	if !ok {
+		code = errInternal
+		if response.Status < shim.ERROR {
+			code = errBadArgument
+		}
+	}
+
+	var details interface{}
+	if len(response.Payload) > 0 {
+		if json.Valid(response.Payload) {
+			details = json.RawMessage(response.Payload)
+		} else {
+			details = string(response.Payload)
+		}
+	}
+
+	structured := errorResponse(code, response.Message, details)
+	structured.Status = response.Status
+	return structured
+}
+
+// checkArgumentCount checks args against the parameters of r, the way the
+// handlers do, so that a wrong count has a code of its own.
+func checkArgumentCount(r route, args []string) (pb.Response, bool) {
+	required, variadic := 0, false
+	for _, param := range r.params {
+		p := parseParam(param)
+		switch {
+		case p.Variadic:
+			variadic = true
+		case !p.Optional:
+			required++
+		}
+	}
+
+	if len(args) >= required && (variadic || len(args) <= len(r.params)) {
+		return pb.Response{}, true
+	}
+
+	var expected string
+	switch {
+	case variadic:
+		expected = fmt.Sprintf("at least %d", required)
+	case required == len(r.params):
+		expected = fmt.Sprintf("%d", required)
+	default:
+		expected = fmt.Sprintf("%d to %d", required, len(r.params))
+	}
+
+	message := fmt.Sprintf("wrong number of arguments: passed %d, expected %s", len(args), expected)
+	logger.Error(message)
+	return errorResponse(errWrongArgumentCount, message, nil), false
+}
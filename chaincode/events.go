@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+const (
+	eventNameObjType = reservedObjTypePrefix + "eventname"
+
+	// mutationEvent is the name of the events of the object types that have
+	// none of their own.
+	mutationEvent = "stateChanged"
+)
+
+// mutation is the payload of the event of a mutation of a record.
+type mutation struct {
+	Operation string    `json:"operation"`
+	ObjType   string    `json:"objType"`
+	Key       string    `json:"key"`
+	TxID      string    `json:"txId"`
+	Timestamp time.Time `json:"timestamp"`
+
+	event string
+}
+
+func mutationEventName(stub shim.ChaincodeStubInterface, objType string) (string, error) {
+	nameKey, err := stub.CreateCompositeKey(eventNameObjType, []string{objType})
+	if err != nil {
+		return "", err
+	}
+
+	name, err := stub.GetState(nameKey)
+	if err != nil || name == nil {
+		return mutationEvent, err
+	}
+
+	return string(name), nil
+}
+
+// emitMutation sets the event of the mutations of the transaction so far,
+// the one of entry included. A transaction carries a single event, so one
+// that mutates several records emits the array of their payloads, under the
+// name their types share, mutationEvent otherwise. A function that sets an
+// event of its own after its mutations, e.g. applyRetention, replaces it.
+func emitMutation(stub shim.ChaincodeStubInterface, entry *auditEntry) error {
+	now, err := txTime(stub)
+	if err != nil {
+		return err
+	}
+
+	event, err := mutationEventName(stub, entry.ObjType)
+	if err != nil {
+		return err
+	}
+
+	m := mutation{
+		Operation: entry.Op,
+		ObjType:   entry.ObjType,
+		Key:       entry.Key,
+		TxID:      entry.TxID,
+		Timestamp: now,
+		event:     event,
+	}
+
+	mutations := []mutation{m}
+	if s := findTxStub(stub); s != nil {
+		s.mutations = append(s.mutations, m)
+		mutations = s.mutations
+	}
+
+	var payload interface{} = m
+	if len(mutations) > 1 {
+		for _, other := range mutations {
+			if other.event != event {
+				event = mutationEvent
+			}
+		}
+		payload = mutations
+	}
+
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	return stub.SetEvent(event, payloadBytes)
+}
+
+// setEventName sets the name of the events of the mutations of an object
+// type, so that applications subscribe to the types they're interested in.
+// An empty name restores the default one.
+func (cc *SimpleChaincode) setEventName(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.setEventName")
+
+	if len(args) != 2 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d", len(args), 2)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	objType, name := args[0], args[1]
+	logger.Debugf("type: %s, name: %s", objType, name)
+
+	if err := requireAdmin(stub); err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 403, Message: message}
+	}
+
+	if strings.HasPrefix(objType, reservedObjTypePrefix) {
+		message := fmt.Sprintf("an event name can't be set for the object type \"%s\"", objType)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	nameKey, err := stub.CreateCompositeKey(eventNameObjType, []string{objType})
+	if err != nil {
+		message := fmt.Sprintf("unable to create a composite key: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if name == "" || name == mutationEvent {
+		err = stub.DelState(nameKey)
+	} else {
+		err = stub.PutState(nameKey, []byte(name))
+	}
+	if err != nil {
+		message := fmt.Sprintf("unable to put the event name: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.setEventName exited successfully")
+	return shim.Success(nil)
+}
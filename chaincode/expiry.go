@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// putOptions are the options of put, as a JSON object. NotBefore time-locks
+// the value, as putTimeLocked does; TTL, a duration such as "72h", or
+// ExpiresAt, an RFC 3339 time, makes it expire. Times are compared with the
+// transaction timestamp, so that all endorsers agree on them.
+type putOptions struct {
+	NotBefore string `json:"notBefore,omitempty"`
+	TTL       string `json:"ttl,omitempty"`
+	ExpiresAt string `json:"expiresAt,omitempty"`
+}
+
+// expirySweep is the result of sweepExpired. More tells that the range holds
+// more expired keys than a single sweep deletes.
+type expirySweep struct {
+	Swept []string `json:"swept"`
+	More  bool     `json:"more"`
+}
+
+// expiredAt reports whether the value of r can't be read anymore at now.
+func (r *record) expiredAt(now time.Time) bool {
+	return r.ExpiresAt != nil && !now.Before(*r.ExpiresAt)
+}
+
+// applyPutOptions sets the unlock and expiry times of r, a record put at now,
+// from optionsArg.
+func applyPutOptions(r *record, optionsArg string, now time.Time) error {
+	var options putOptions
+	if err := json.Unmarshal([]byte(optionsArg), &options); err != nil {
+		return fmt.Errorf("unable to parse the options: %s", err.Error())
+	}
+
+	if options.NotBefore != "" {
+		notBefore, err := time.Parse(time.RFC3339Nano, options.NotBefore)
+		if err != nil {
+			return fmt.Errorf("notBefore must be in RFC 3339 format: %s", err.Error())
+		}
+		notBefore = notBefore.UTC()
+		r.UnlockAt = &notBefore
+	}
+
+	var expiresAt time.Time
+	switch {
+	case options.TTL != "" && options.ExpiresAt != "":
+		return fmt.Errorf("ttl and expiresAt are exclusive")
+	case options.TTL != "":
+		ttl, err := time.ParseDuration(options.TTL)
+		if err != nil || ttl <= 0 {
+			return fmt.Errorf("ttl must be a positive duration, got \"%s\"", options.TTL)
+		}
+		expiresAt = now.Add(ttl)
+	case options.ExpiresAt != "":
+		var err error
+		if expiresAt, err = time.Parse(time.RFC3339Nano, options.ExpiresAt); err != nil {
+			return fmt.Errorf("expiresAt must be in RFC 3339 format: %s", err.Error())
+		}
+		expiresAt = expiresAt.UTC()
+	default:
+		return nil
+	}
+
+	if r.UnlockAt != nil && !expiresAt.After(*r.UnlockAt) {
+		return fmt.Errorf("the value would expire before it's unlocked")
+	}
+	r.ExpiresAt = &expiresAt
+	return nil
+}
+
+// unreadableResponse returns the response to a read of the value of r, which
+// can't be read at now if it's locked, 423, or expired, 410, with its
+// metadata as payload.
+func unreadableResponse(key string, r *record, now time.Time) (pb.Response, bool) {
+	var status int32
+	var message string
+	switch {
+	case r.lockedAt(now):
+		status, message = 423, fmt.Sprintf("the value for the key %s is locked until %s",
+			key, r.UnlockAt.Format(time.RFC3339))
+	case r.expiredAt(now):
+		status, message = 410, fmt.Sprintf("the value for the key %s expired at %s",
+			key, r.ExpiresAt.Format(time.RFC3339))
+	default:
+		return pb.Response{}, false
+	}
+
+	logger.Error(message)
+	metadata, _ := json.Marshal(r.sealed())
+	return pb.Response{Status: status, Message: message, Payload: metadata}, true
+}
+
+// sweepExpired deletes the expired records of the simple keys in the range
+// [keyFrom, keyTo), up to maxPageSize of them, for good whatever the delete
+// mode. Expired records read as gone already; sweeping them frees the state.
+// Only admins sweep.
+func (cc *SimpleChaincode) sweepExpired(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.sweepExpired")
+
+	if len(args) != 2 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d", len(args), 2)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	keyFrom, keyTo := args[0], args[1]
+	logger.Debugf("range: [\"%s\", \"%s\")", keyFrom, keyTo)
+
+	if err := requireAdmin(stub); err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 403, Message: message}
+	}
+
+	now, err := txTime(stub)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the transaction timestamp: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	it, err := stub.GetStateByRange(keyFrom, keyTo)
+	if err != nil {
+		message := fmt.Sprintf("unable to get an iterator over the range [\"%s\", \"%s\"): %s",
+			keyFrom, keyTo, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+	defer it.Close()
+
+	sweep := expirySweep{Swept: []string{}}
+	for it.HasNext() {
+		response, err := it.Next()
+		if err != nil {
+			message := fmt.Sprintf("unable to get the next element: %s", err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		if !decodeRecord(response.Value).expiredAt(now) {
+			continue
+		}
+
+		if len(sweep.Swept) == maxPageSize {
+			sweep.More = true
+			break
+		}
+
+		if err := purgeRecord(stub, "", response.Key, response.Key, "expire"); err != nil {
+			message := err.Error()
+			logger.Error(message)
+			return shim.Error(message)
+		}
+		sweep.Swept = append(sweep.Swept, response.Key)
+	}
+
+	result, err := json.Marshal(sweep)
+	if err != nil {
+		message := fmt.Sprintf("unable to marshal the result: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.sweepExpired exited successfully")
+	return shim.Success(result)
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+)
+
+const (
+	formatJSON    = "json"
+	formatNDJSON  = "ndjson"
+	formatCBOR    = "cbor"
+	formatMsgpack = "msgpack"
+	formatProto   = "proto"
+	formatCSV     = "csv"
+)
+
+var resultFormats = []string{formatJSON, formatNDJSON, formatCBOR, formatMsgpack, formatProto, formatCSV}
+
+// documentResult is implemented by results whose CBOR and MessagePack
+// encodings aren't derived from their JSON one, e.g. to embed binary values
+// as byte strings.
+type documentResult interface {
+	document() (interface{}, error)
+}
+
+// protoResult is implemented by results that have a message of their own in
+// simple_chaincode.proto. Other results are encoded as a google.protobuf.Value.
+type protoResult interface {
+	protoMessage() (proto.Message, error)
+}
+
+// checkFormat fails unless format is one of the result formats.
+func checkFormat(format string) error {
+	for _, f := range resultFormats {
+		if f == format {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unknown format: %s, expected one of {%s}", format, strings.Join(resultFormats, ", "))
+}
+
+// ndjsonResult is implemented by paged results. In NDJSON they are written
+// as their items, one per line, and a last ndjsonCursor line to resume from.
+type ndjsonResult interface {
+	ndjsonLines() []interface{}
+}
+
+// ndjsonCursor wraps the paging state of a result, so clients tell it from
+// the items.
+type ndjsonCursor struct {
+	Cursor interface{} `json:"cursor"`
+}
+
+type bookmarkCursor struct {
+	Bookmark            string `json:"bookmark"`
+	FetchedRecordsCount int32  `json:"fetchedRecordsCount"`
+}
+
+// marshalResult encodes the result of a query function in the format chosen
+// by the client. Query functions take the format as their optional last
+// argument and leave the encoding of their results to it.
+func marshalResult(v interface{}, format string) ([]byte, error) {
+	switch format {
+	case formatJSON:
+		return json.Marshal(v)
+	case formatNDJSON:
+		return marshalNDJSON(v)
+	case formatCBOR, formatMsgpack:
+		doc, err := resultDocument(v)
+		if err != nil {
+			return nil, err
+		}
+
+		if format == formatMsgpack {
+			return marshalMsgpack(doc)
+		}
+		return marshalCBOR(doc)
+	case formatProto:
+		m, err := resultMessage(v)
+		if err != nil {
+			return nil, err
+		}
+
+		return marshalProto(m)
+	case formatCSV:
+		return marshalCSV(v)
+	}
+
+	return nil, checkFormat(format)
+}
+
+// marshalNDJSON writes the lines of a paged result or the elements of a list
+// result one per line, and any other result as a single line. Clients resume
+// a range they stopped processing midway from the key following the last
+// one they processed, i.e. that key with "\x00" appended.
+func marshalNDJSON(v interface{}) ([]byte, error) {
+	if n, ok := v.(ndjsonResult); ok {
+		v = n.ndjsonLines()
+	}
+
+	resultBytes, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	if !bytes.HasPrefix(resultBytes, []byte("[")) {
+		return append(resultBytes, '\n'), nil
+	}
+
+	var elements []json.RawMessage
+	if err := json.Unmarshal(resultBytes, &elements); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	for _, element := range elements {
+		buf.Write(element)
+		buf.WriteByte('\n')
+	}
+
+	return buf.Bytes(), nil
+}
+
+// resultDocument returns the generic document of v, as encoded in CBOR and
+// MessagePack.
+func resultDocument(v interface{}) (interface{}, error) {
+	if d, ok := v.(documentResult); ok {
+		return d.document()
+	}
+
+	resultBytes, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeJSON(resultBytes)
+}
+
+// resultMessage returns the protobuf message of v.
+func resultMessage(v interface{}) (proto.Message, error) {
+	if p, ok := v.(protoResult); ok {
+		return p.protoMessage()
+	}
+
+	resultBytes, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := decodeJSON(resultBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	return valueMessage(doc)
+}
+
+// marshalProto encodes m deterministically, so that all endorsers return the
+// same payload for messages with maps.
+func marshalProto(m proto.Message) ([]byte, error) {
+	buf := proto.NewBuffer(nil)
+	buf.SetDeterministic(true)
+	if err := buf.Marshal(m); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (r *record) document() (interface{}, error) {
+	return recordDocument("", r)
+}
+
+func (r *record) protoMessage() (proto.Message, error) {
+	return recordMessage("", r)
+}
+
+func (entries queryResults) document() (interface{}, error) {
+	docs := make([]interface{}, len(entries))
+	for i, entry := range entries {
+		doc, err := recordDocument(entry.Key, entry.record)
+		if err != nil {
+			return nil, err
+		}
+		docs[i] = doc
+	}
+
+	return docs, nil
+}
+
+func (entries queryResults) protoMessage() (proto.Message, error) {
+	results := &QueryResults{Records: make([]*Record, len(entries))}
+	for i, entry := range entries {
+		m, err := recordMessage(entry.Key, entry.record)
+		if err != nil {
+			return nil, err
+		}
+		results.Records[i] = m
+	}
+
+	return results, nil
+}
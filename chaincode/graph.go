@@ -0,0 +1,254 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+const (
+	// every edge is stored twice so that both directions can be listed with
+	// a partial composite key query
+	edgeOutObjType = reservedObjTypePrefix + "edgeout"
+	edgeInObjType  = reservedObjTypePrefix + "edgein"
+
+	directionOut  = "out"
+	directionIn   = "in"
+	directionBoth = "both"
+
+	maxPathDepth = 16
+)
+
+type edge struct {
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Label string `json:"label"`
+}
+
+func (cc *SimpleChaincode) addEdge(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.addEdge")
+
+	if len(args) != 3 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d", len(args), 3)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	from, to, label := args[0], args[1], args[2]
+	logger.Debugf("from: %s, to: %s, label: %s", from, to, label)
+
+	if from == "" || to == "" || label == "" {
+		message := "nodes and label must be non-empty strings"
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	outKey, err := stub.CreateCompositeKey(edgeOutObjType, []string{from, label, to})
+	if err != nil {
+		message := fmt.Sprintf("unable to create a composite key: %s", err.Error())
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	inKey, err := stub.CreateCompositeKey(edgeInObjType, []string{to, label, from})
+	if err != nil {
+		message := fmt.Sprintf("unable to create a composite key: %s", err.Error())
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	for _, k := range []string{outKey, inKey} {
+		if err := stub.PutState(k, presenceMarker); err != nil {
+			message := fmt.Sprintf("unable to put the edge: %s", err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+	}
+
+	logger.Info("SimpleChaincode.addEdge exited successfully")
+	return shim.Success(nil)
+}
+
+func (cc *SimpleChaincode) neighbors(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.neighbors")
+
+	if len(args) != 3 && len(args) != 4 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d or %d", len(args), 3, 4)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	node, label, direction, format := args[0], args[1], args[2], formatJSON
+	if len(args) == 4 {
+		format = args[3]
+	}
+	logger.Debugf("node: %s, label: %s, direction: %s, format: %s", node, label, direction, format)
+
+	if err := checkFormat(format); err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	if direction != directionOut && direction != directionIn && direction != directionBoth {
+		message := fmt.Sprintf("unknown direction: %s, expected one of {%s, %s, %s}",
+			direction, directionOut, directionIn, directionBoth)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	var edges = []edge{}
+	if direction != directionIn {
+		out, err := edgesOf(stub, edgeOutObjType, node, label)
+		if err != nil {
+			message := fmt.Sprintf("unable to get the outgoing edges of %s: %s", node, err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+		edges = append(edges, out...)
+	}
+	if direction != directionOut {
+		in, err := edgesOf(stub, edgeInObjType, node, label)
+		if err != nil {
+			message := fmt.Sprintf("unable to get the incoming edges of %s: %s", node, err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+		edges = append(edges, in...)
+	}
+
+	result, err := marshalResult(edges, format)
+	if err != nil {
+		message := fmt.Sprintf("unable to marshal the result: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.neighbors exited successfully")
+	return shim.Success(result)
+}
+
+func (cc *SimpleChaincode) path(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.path")
+
+	if len(args) != 3 && len(args) != 4 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d or %d", len(args), 3, 4)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	from, to, maxDepthArg, format := args[0], args[1], args[2], formatJSON
+	if len(args) == 4 {
+		format = args[3]
+	}
+	logger.Debugf("from: %s, to: %s, maxDepth: %s, format: %s", from, to, maxDepthArg, format)
+
+	if err := checkFormat(format); err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	maxDepth, err := strconv.Atoi(maxDepthArg)
+	if err != nil || maxDepth < 1 || maxDepth > maxPathDepth {
+		message := fmt.Sprintf("max depth must be an integer in [1, %d], got \"%s\"", maxPathDepth, maxDepthArg)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	if from == to {
+		result, err := marshalResult([]edge{}, format)
+		if err != nil {
+			message := fmt.Sprintf("unable to marshal the result: %s", err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		logger.Info("SimpleChaincode.path exited successfully")
+		return shim.Success(result)
+	}
+
+	// breadth-first search along the outgoing edges, so the path found is
+	// one of the shortest
+	via := map[string]edge{from: {}}
+	level := []string{from}
+	for depth := 0; depth < maxDepth && len(level) > 0; depth++ {
+		var next []string
+		for _, node := range level {
+			out, err := edgesOf(stub, edgeOutObjType, node, "")
+			if err != nil {
+				message := fmt.Sprintf("unable to get the outgoing edges of %s: %s", node, err.Error())
+				logger.Error(message)
+				return shim.Error(message)
+			}
+
+			for _, e := range out {
+				if _, seen := via[e.To]; seen {
+					continue
+				}
+				via[e.To] = e
+				next = append(next, e.To)
+
+				if e.To == to {
+					var edges []edge
+					for n := to; n != from; n = via[n].From {
+						edges = append([]edge{via[n]}, edges...)
+					}
+
+					result, err := marshalResult(edges, format)
+					if err != nil {
+						message := fmt.Sprintf("unable to marshal the result: %s", err.Error())
+						logger.Error(message)
+						return shim.Error(message)
+					}
+
+					logger.Info("SimpleChaincode.path exited successfully")
+					return shim.Success(result)
+				}
+			}
+		}
+		level = next
+	}
+
+	message := fmt.Sprintf("no path from %s to %s within %d edges", from, to, maxDepth)
+	logger.Error(message)
+	return pb.Response{Status: 404, Message: message}
+}
+
+// edgesOf lists the edges of node stored under the given direction, limited
+// to label unless it's empty.
+func edgesOf(stub shim.ChaincodeStubInterface, objType, node, label string) ([]edge, error) {
+	attributes := []string{node}
+	if label != "" {
+		attributes = append(attributes, label)
+	}
+
+	it, err := stub.GetStateByPartialCompositeKey(objType, attributes)
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+
+	var edges []edge
+	for it.HasNext() {
+		response, err := it.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		_, attributes, err := stub.SplitCompositeKey(response.Key)
+		if err != nil {
+			return nil, err
+		}
+
+		if objType == edgeOutObjType {
+			edges = append(edges, edge{From: attributes[0], To: attributes[2], Label: attributes[1]})
+		} else {
+			edges = append(edges, edge{From: attributes[2], To: attributes[0], Label: attributes[1]})
+		}
+	}
+
+	return edges, nil
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// historyEntry is a modification of a key: the record it set, or none for a
+// deletion.
+type historyEntry struct {
+	TxID      string    `json:"txId"`
+	Timestamp time.Time `json:"timestamp"`
+	IsDelete  bool      `json:"isDelete"`
+	*record
+}
+
+type historyEntries []historyEntry
+
+var historyCSVHeader = []string{"txId", "timestamp", "isDelete"}
+
+func (entries historyEntries) csvRows() ([][]string, error) {
+	rows := [][]string{append(append([]string{}, historyCSVHeader...), recordCSVHeader...)}
+	for _, entry := range entries {
+		row := []string{entry.TxID, csvTime(&entry.Timestamp), strconv.FormatBool(entry.IsDelete)}
+		rows = append(rows, append(row, recordCSVRow(entry.record)...))
+	}
+
+	return rows, nil
+}
+
+func (entries historyEntries) protoMessage() (proto.Message, error) {
+	history := &History{Entries: make([]*HistoryEntry, len(entries))}
+	for i, entry := range entries {
+		m := &HistoryEntry{TxId: entry.TxID, IsDelete: entry.IsDelete}
+
+		var err error
+		if m.Timestamp, err = timestampProto(&entry.Timestamp); err != nil {
+			return nil, err
+		}
+		if entry.record != nil {
+			if m.Record, err = recordMessage("", entry.record); err != nil {
+				return nil, err
+			}
+		}
+		history.Entries[i] = m
+	}
+
+	return history, nil
+}
+
+func (cc *SimpleChaincode) getAsOf(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.getAsOf")
+
+	if len(args) != 3 && len(args) != 4 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d or %d", len(args), 3, 4)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	objType, key, timestamp, format := args[0], args[1], args[2], formatJSON
+	if len(args) == 4 {
+		format = args[3]
+	}
+	logger.Debugf("type: %s, key: %s, timestamp: %s, format: %s", objType, key, timestamp, format)
+
+	if err := checkFormat(format); err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	asOf, err := time.Parse(time.RFC3339Nano, timestamp)
+	if err != nil {
+		message := fmt.Sprintf("timestamp must be in RFC 3339 format: %s", err.Error())
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	compositeKey, err := createCompositeKey(stub, objType, key)
+	if err != nil {
+		message := fmt.Sprintf("unable to create a composite key: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	it, err := stub.GetHistoryForKey(compositeKey)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the history for the key %s: %s", key, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+	defer it.Close()
+
+	// the history iterator doesn't guarantee any particular order, so the
+	// whole history is scanned for the latest modification not after asOf
+	var (
+		found     bool
+		isDelete  bool
+		value     []byte
+		latestMod time.Time
+	)
+	for it.HasNext() {
+		modification, err := it.Next()
+		if err != nil {
+			message := fmt.Sprintf("unable to get the next modification: %s", err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		modifiedAt, err := ptypes.Timestamp(modification.Timestamp)
+		if err != nil {
+			message := fmt.Sprintf("unable to convert the timestamp of the transaction %s: %s",
+				modification.TxId, err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+		logger.Debugf("modification: (%s, %s, %t)", modification.TxId, modifiedAt, modification.IsDelete)
+
+		if modifiedAt.After(asOf) || (found && modifiedAt.Before(latestMod)) {
+			continue
+		}
+
+		found, isDelete, value, latestMod = true, modification.IsDelete, modification.Value, modifiedAt
+	}
+
+	if !found || isDelete {
+		message := fmt.Sprintf("a value for the key %s as of %s not found", key, timestamp)
+		logger.Error(message)
+		return pb.Response{Status: 404, Message: message}
+	}
+
+	now, err := txTime(stub)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the transaction timestamp: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	r := decodeRecord(value)
+	if r.DeletedAt != nil {
+		return deletedResponse(key, r)
+	}
+
+	result, err := marshalResult(r.readableAt(now), format)
+	if err != nil {
+		message := fmt.Sprintf("unable to marshal the result: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.getAsOf exited successfully")
+	return shim.Success(result)
+}
+
+// getHistory returns every modification of a key, oldest first, along with the
+// transaction that made it. Values that are still time-locked stay sealed.
+func (cc *SimpleChaincode) getHistory(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.getHistory")
+
+	if len(args) != 2 && len(args) != 3 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d or %d", len(args), 2, 3)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	objType, key, format := args[0], args[1], formatJSON
+	if len(args) == 3 {
+		format = args[2]
+	}
+	logger.Debugf("type: %s, key: %s, format: %s", objType, key, format)
+
+	if err := checkFormat(format); err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	compositeKey, err := createCompositeKey(stub, objType, key)
+	if err != nil {
+		message := fmt.Sprintf("unable to create a composite key: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	now, err := txTime(stub)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the transaction timestamp: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	it, err := stub.GetHistoryForKey(compositeKey)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the history for the key %s: %s", key, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+	defer it.Close()
+
+	var entries = historyEntries{}
+	for it.HasNext() {
+		modification, err := it.Next()
+		if err != nil {
+			message := fmt.Sprintf("unable to get the next modification: %s", err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		modifiedAt, err := ptypes.Timestamp(modification.Timestamp)
+		if err != nil {
+			message := fmt.Sprintf("unable to convert the timestamp of the transaction %s: %s",
+				modification.TxId, err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		entry := historyEntry{TxID: modification.TxId, Timestamp: modifiedAt, IsDelete: modification.IsDelete}
+		if !modification.IsDelete {
+			entry.record = decodeRecord(modification.Value).readableAt(now)
+		}
+		entries = append(entries, entry)
+	}
+
+	// the history iterator doesn't guarantee any particular order
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Timestamp.Before(entries[j].Timestamp)
+	})
+
+	result, err := marshalResult(entries, format)
+	if err != nil {
+		message := fmt.Sprintf("unable to marshal the result: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.getHistory exited successfully")
+	return shim.Success(result)
+}
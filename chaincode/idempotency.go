@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// A client that retries a submission it doesn't know the outcome of passes
+// the same idempotency token in the transient map of every attempt: once an
+// attempt succeeded, the others fail with ERR_DUPLICATE_REQUEST and the
+// reference of the first one, instead of writing again. Tokens are scoped to
+// the caller's organization and remembered for idempotencyTTL; failed calls
+// don't use them up.
+const (
+	idempotencyTokenField = "IDEMPOTENCY_TOKEN"
+	idempotencyObjType    = reservedObjTypePrefix + "idempotency"
+
+	idempotencyTTL = 24 * time.Hour
+)
+
+// processedToken is the reference of the call that used an idempotency
+// token: its transaction and the hash of its result.
+type processedToken struct {
+	Token       string    `json:"token"`
+	MSPID       string    `json:"mspId"`
+	Function    string    `json:"function"`
+	TxID        string    `json:"txId"`
+	ResultHash  string    `json:"resultHash,omitempty"`
+	ProcessedAt time.Time `json:"processedAt"`
+	ExpiresAt   time.Time `json:"expiresAt"`
+}
+
+// tokenPrune is the result of pruneIdempotencyTokens.
+type tokenPrune struct {
+	Pruned int  `json:"pruned"`
+	More   bool `json:"more"`
+}
+
+// idempotencyToken returns the idempotency token of the transaction, empty if
+// it has none.
+func idempotencyToken(stub shim.ChaincodeStubInterface) (string, error) {
+	transient, err := stub.GetTransient()
+	if err != nil {
+		return "", fmt.Errorf("unable to get the transient map: %s", err.Error())
+	}
+
+	return string(transient[idempotencyTokenField]), nil
+}
+
+// idempotent runs a call to a function that isn't read-only at most once per
+// idempotency token.
+func idempotent(r route, next handler) handler {
+	return func(cc *SimpleChaincode, stub shim.ChaincodeStubInterface, args []string) pb.Response {
+		if r.readOnly {
+			return next(cc, stub, args)
+		}
+
+		token, err := idempotencyToken(stub)
+		if err != nil {
+			message := err.Error()
+			logger.Error(message)
+			return shim.Error(message)
+		}
+		if token == "" {
+			return next(cc, stub, args)
+		}
+		logger.Debugf("idempotency token: %s", token)
+
+		mspID, err := callerMSPID(stub)
+		if err != nil {
+			message := err.Error()
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		now, err := txTime(stub)
+		if err != nil {
+			message := fmt.Sprintf("unable to get the transaction timestamp: %s", err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		key, err := stub.CreateCompositeKey(idempotencyObjType, []string{mspID, token})
+		if err != nil {
+			message := fmt.Sprintf("unable to create a composite key: %s", err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		var processed processedToken
+		found, err := getJSON(stub, key, &processed)
+		if err != nil {
+			message := fmt.Sprintf("unable to get the idempotency token %s: %s", token, err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		if found && now.Before(processed.ExpiresAt) {
+			message := fmt.Sprintf("the idempotency token %s was already used by the transaction %s",
+				token, processed.TxID)
+			logger.Error(message)
+			return errorResponse(errDuplicateRequest, message, processed)
+		}
+
+		response := next(cc, stub, args)
+		if response.Status >= shim.ERRORTHRESHOLD {
+			return response
+		}
+
+		processed = processedToken{Token: token, MSPID: mspID, Function: r.name, TxID: stub.GetTxID(),
+			ResultHash: bytesHash(response.Payload), ProcessedAt: now, ExpiresAt: now.Add(idempotencyTTL)}
+		if err := putJSON(stub, key, processed); err != nil {
+			message := fmt.Sprintf("unable to put the idempotency token %s: %s", token, err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		return response
+	}
+}
+
+// pruneIdempotencyTokens deletes the idempotency tokens remembered for longer
+// than idempotencyTTL, up to maxPageSize of them. Expired tokens can be used
+// again already; pruning them frees the state. Only admins prune.
+func (cc *SimpleChaincode) pruneIdempotencyTokens(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.pruneIdempotencyTokens")
+
+	if len(args) != 0 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d", len(args), 0)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	if err := requireAdmin(stub); err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 403, Message: message}
+	}
+
+	now, err := txTime(stub)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the transaction timestamp: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	it, err := stub.GetStateByPartialCompositeKey(idempotencyObjType, []string{})
+	if err != nil {
+		message := fmt.Sprintf("unable to get an iterator over the idempotency tokens: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+	defer it.Close()
+
+	var prune tokenPrune
+	for it.HasNext() {
+		response, err := it.Next()
+		if err != nil {
+			message := fmt.Sprintf("unable to get the next element: %s", err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		var processed processedToken
+		if err := json.Unmarshal(response.Value, &processed); err != nil {
+			message := fmt.Sprintf("unable to parse the idempotency token %s: %s", response.Key, err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		if now.Before(processed.ExpiresAt) {
+			continue
+		}
+
+		if prune.Pruned == maxPageSize {
+			prune.More = true
+			break
+		}
+
+		if err := stub.DelState(response.Key); err != nil {
+			message := fmt.Sprintf("unable to delete the idempotency token %s: %s", processed.Token, err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+		prune.Pruned++
+	}
+
+	result, err := json.Marshal(prune)
+	if err != nil {
+		message := fmt.Sprintf("unable to marshal the result: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.pruneIdempotencyTokens exited successfully")
+	return shim.Success(result)
+}
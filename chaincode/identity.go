@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/core/chaincode/shim/ext/cid"
+)
+
+const (
+	roleAttribute = "role"
+	adminRole     = "admin"
+)
+
+// requireAdmin fails unless the caller's certificate carries the role=admin
+// attribute.
+func requireAdmin(stub shim.ChaincodeStubInterface) error {
+	if err := cid.AssertAttributeValue(stub, roleAttribute, adminRole); err != nil {
+		return fmt.Errorf("the caller is not an admin: %s", err.Error())
+	}
+
+	return nil
+}
+
+// callerID returns the unique id of the caller's certificate within its MSP.
+func callerID(stub shim.ChaincodeStubInterface) (string, error) {
+	id, err := cid.GetID(stub)
+	if err != nil {
+		return "", fmt.Errorf("unable to get the caller's identity: %s", err.Error())
+	}
+
+	return id, nil
+}
+
+// callerMSPID returns the id of the MSP, i.e. the organization, of the caller.
+func callerMSPID(stub shim.ChaincodeStubInterface) (string, error) {
+	mspID, err := cid.GetMSPID(stub)
+	if err != nil {
+		return "", fmt.Errorf("unable to get the caller's MSP id: %s", err.Error())
+	}
+
+	return mspID, nil
+}
+
+// creator identifies the client that submitted a transaction: its MSP and the
+// subject of its certificate, empty for identities without one.
+type creator struct {
+	MSPID   string `json:"mspId"`
+	Subject string `json:"subject,omitempty"`
+}
+
+// txCreator returns the creator of the current transaction.
+func txCreator(stub shim.ChaincodeStubInterface) (*creator, error) {
+	mspID, err := callerMSPID(stub)
+	if err != nil {
+		return nil, err
+	}
+
+	cert, err := cid.GetX509Certificate(stub)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get the caller's certificate: %s", err.Error())
+	}
+
+	c := &creator{MSPID: mspID}
+	if cert != nil {
+		c.Subject = cert.Subject.String()
+	}
+
+	return c, nil
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+const (
+	indexProblemMissingRecord = "missingRecord"
+	indexProblemMissingMirror = "missingMirror"
+)
+
+// indexDiscrepancy is an entry of the tag index that points at a record that
+// doesn't exist, or whose mirror entry in the other half of the index is
+// missing.
+type indexDiscrepancy struct {
+	Index    string `json:"index"`
+	Key      string `json:"key"`
+	Tag      string `json:"tag"`
+	Problem  string `json:"problem"`
+	Repaired bool   `json:"repaired,omitempty"`
+}
+
+type indexReport struct {
+	ObjType       string             `json:"objType"`
+	Checked       int                `json:"checked"`
+	Discrepancies []indexDiscrepancy `json:"discrepancies"`
+	// Bookmark resumes a repair that stopped after a batch, empty when done
+	Bookmark string `json:"bookmark"`
+}
+
+// scanTagIndexes checks the tag index entries of the records of objType: the
+// taggedObjType entries first, then the tagObjType ones, which are keyed by
+// tag and have to be scanned in full. It stops after limit entries, if
+// limit is positive, with a bookmark to resume after the last one, and fixes
+// the discrepancies if repair is set: entries of missing records are
+// dropped, missing mirrors are put back.
+func scanTagIndexes(stub shim.ChaincodeStubInterface, objType, bookmark string, limit int, repair bool) (*indexReport, error) {
+	afterBytes, err := base64.RawURLEncoding.DecodeString(bookmark)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bookmark: %s", err.Error())
+	}
+	after := string(afterBytes)
+
+	afterIndex := ""
+	if after != "" {
+		if afterIndex, _, err = stub.SplitCompositeKey(after); err != nil {
+			return nil, fmt.Errorf("invalid bookmark: %s", err.Error())
+		}
+	}
+
+	report := &indexReport{ObjType: objType, Discrepancies: []indexDiscrepancy{}}
+	// the tagObjType entries fixed along with their taggedObjType mirrors,
+	// which the scan of the tagObjType entries would report again
+	fixed := map[string]bool{}
+
+	for _, index := range []string{taggedObjType, tagObjType} {
+		if index == taggedObjType && afterIndex == tagObjType {
+			continue
+		}
+
+		attributes := []string{}
+		if index == taggedObjType {
+			attributes = []string{objType}
+		}
+
+		done, err := func() (bool, error) {
+			it, err := stub.GetStateByPartialCompositeKey(index, attributes)
+			if err != nil {
+				return false, err
+			}
+			defer it.Close()
+
+			for it.HasNext() {
+				response, err := it.Next()
+				if err != nil {
+					return false, err
+				}
+
+				if index == afterIndex && response.Key <= after {
+					continue
+				}
+
+				_, parts, err := stub.SplitCompositeKey(response.Key)
+				if err != nil {
+					return false, err
+				}
+
+				key, tag := parts[1], parts[2]
+				if index == tagObjType {
+					if parts[1] != objType || fixed[response.Key] {
+						continue
+					}
+					key, tag = parts[2], parts[0]
+				}
+
+				if limit > 0 && report.Checked == limit {
+					report.Bookmark = base64.RawURLEncoding.EncodeToString([]byte(after))
+					return true, nil
+				}
+				report.Checked++
+				after = response.Key
+
+				d, err := checkTagEntry(stub, index, objType, key, tag)
+				if err != nil {
+					return false, err
+				}
+
+				if d == nil {
+					continue
+				}
+
+				if repair {
+					if err := setTag(stub, objType, key, tag, d.Problem == indexProblemMissingMirror); err != nil {
+						return false, err
+					}
+					d.Repaired = true
+
+					tagKey, err := stub.CreateCompositeKey(tagObjType, []string{tag, objType, key})
+					if err != nil {
+						return false, err
+					}
+					fixed[tagKey] = true
+				}
+				report.Discrepancies = append(report.Discrepancies, *d)
+			}
+
+			return false, nil
+		}()
+		if err != nil || done {
+			return report, err
+		}
+		afterIndex = index
+	}
+
+	return report, nil
+}
+
+// checkTagEntry checks the entry of index tagging objType/key with tag.
+func checkTagEntry(stub shim.ChaincodeStubInterface, index, objType, key, tag string) (*indexDiscrepancy, error) {
+	compositeKey, err := createCompositeKey(stub, objType, key)
+	if err != nil {
+		return nil, err
+	}
+
+	valueBytes, err := stub.GetState(compositeKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if valueBytes == nil {
+		return &indexDiscrepancy{Index: index, Key: key, Tag: tag, Problem: indexProblemMissingRecord}, nil
+	}
+
+	mirrorKey, err := stub.CreateCompositeKey(tagObjType, []string{tag, objType, key})
+	if index == tagObjType {
+		mirrorKey, err = stub.CreateCompositeKey(taggedObjType, []string{objType, key, tag})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	mirror, err := stub.GetState(mirrorKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if mirror == nil {
+		return &indexDiscrepancy{Index: index, Key: key, Tag: tag, Problem: indexProblemMissingMirror}, nil
+	}
+
+	return nil, nil
+}
+
+// checkIndexes reports the discrepancies of the tag index of the records of a
+// type.
+func (cc *SimpleChaincode) checkIndexes(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.checkIndexes")
+
+	if len(args) != 1 && len(args) != 2 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d or %d", len(args), 1, 2)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	objType, format := args[0], formatJSON
+	if len(args) == 2 {
+		format = args[1]
+	}
+	logger.Debugf("type: %s, format: %s", objType, format)
+
+	if err := requireAdmin(stub); err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 403, Message: message}
+	}
+
+	if err := checkFormat(format); err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	report, err := scanTagIndexes(stub, objType, "", 0, false)
+	if err != nil {
+		message := fmt.Sprintf("unable to check the indexes of the type %s: %s", objType, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	result, err := marshalResult(report, format)
+	if err != nil {
+		message := fmt.Sprintf("unable to marshal the result: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.checkIndexes exited successfully")
+	return shim.Success(result)
+}
+
+// repairIndexes fixes the discrepancies of the tag index of the records of a
+// type, checking batchSize entries per call, maxPageSize at most. Each call
+// returns the bookmark to pass to the next one until it is empty.
+func (cc *SimpleChaincode) repairIndexes(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.repairIndexes")
+
+	if len(args) != 2 && len(args) != 3 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d or %d", len(args), 2, 3)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	objType, bookmark, batchSizeArg := args[0], args[1], strconv.Itoa(maxPageSize)
+	if len(args) == 3 {
+		batchSizeArg = args[2]
+	}
+	logger.Debugf("type: %s, bookmark: %s, batch size: %s", objType, bookmark, batchSizeArg)
+
+	if err := requireAdmin(stub); err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 403, Message: message}
+	}
+
+	batchSize, err := strconv.Atoi(batchSizeArg)
+	if err != nil || batchSize < 1 || batchSize > maxPageSize {
+		message := fmt.Sprintf("batch size must be an integer in [1, %d], got \"%s\"", maxPageSize, batchSizeArg)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	report, err := scanTagIndexes(stub, objType, bookmark, batchSize, true)
+	if err != nil {
+		message := fmt.Sprintf("unable to repair the indexes of the type %s: %s", objType, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	result, err := marshalResult(report, formatJSON)
+	if err != nil {
+		message := fmt.Sprintf("unable to marshal the result: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.repairIndexes exited successfully")
+	return shim.Success(result)
+}
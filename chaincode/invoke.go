@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// invokeOther calls a function of another chaincode, e.g. a token chaincode
+// putting an asset in escrow, and returns its response as its own: payload,
+// status and all. The called chaincode runs within the same transaction, as
+// the same caller, so its writes are committed or dropped together with ours.
+// On another channel, it can only read: the peer discards whatever it writes
+// there.
+func (cc *SimpleChaincode) invokeOther(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.invokeOther")
+
+	if len(args) < 3 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected at least %d", len(args), 3)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	chaincode, channel, function, functionArgs := args[0], args[1], args[2], args[3:]
+	logger.Debugf("chaincode: %s, channel: %s, function: %s, args: %v", chaincode, channel, function, functionArgs)
+
+	if chaincode == "" || function == "" {
+		message := "chaincode and function must be non-empty strings"
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	invokeArgs := make([][]byte, 0, len(args)-2)
+	invokeArgs = append(invokeArgs, []byte(function))
+	for _, arg := range functionArgs {
+		invokeArgs = append(invokeArgs, []byte(arg))
+	}
+
+	// an empty channel is the channel of the current transaction
+	response := stub.InvokeChaincode(chaincode, invokeArgs, channel)
+	if response.Status >= shim.ERRORTHRESHOLD {
+		message := fmt.Sprintf("%s.%s failed with %d: %s", chaincode, function, response.Status, errorMessage(response))
+		logger.Error(message)
+		return pb.Response{Status: response.Status, Message: message, Payload: response.Payload}
+	}
+
+	logger.Info("SimpleChaincode.invokeOther exited successfully")
+	return response
+}
+
+// channelRead is the result of getFromChannel: the record the other
+// chaincode returned, along with where it was read. CrossChannel tells it was
+// read on another channel, where nothing the call might write is committed.
+type channelRead struct {
+	Channel         string          `json:"channel"`
+	Chaincode       string          `json:"chaincode"`
+	CrossChannel    bool            `json:"crossChannel"`
+	WritesCommitted bool            `json:"writesCommitted"`
+	Result          json.RawMessage `json:"result"`
+}
+
+// getFromChannel reads a key with the get function of a chaincode, e.g. this
+// one, deployed on another channel, the current one if channel is empty. Only
+// the peers that endorse the transaction need to have joined that channel.
+func (cc *SimpleChaincode) getFromChannel(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.getFromChannel")
+
+	if len(args) != 4 && len(args) != 5 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d or %d", len(args), 4, 5)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	channel, chaincode, objType, key, format := args[0], args[1], args[2], args[3], formatJSON
+	if len(args) == 5 {
+		format = args[4]
+	}
+	logger.Debugf("channel: %s, chaincode: %s, type: %s, key: %s, format: %s", channel, chaincode, objType, key, format)
+
+	if err := checkFormat(format); err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	if chaincode == "" {
+		message := "chaincode must be a non-empty string"
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	read := channelRead{Channel: channel, Chaincode: chaincode}
+	if channel == "" || channel == stub.GetChannelID() {
+		read.Channel, read.WritesCommitted = stub.GetChannelID(), true
+	} else {
+		read.CrossChannel = true
+	}
+
+	response := stub.InvokeChaincode(chaincode, [][]byte{[]byte("get"), []byte(objType), []byte(key)}, channel)
+	if response.Status >= shim.ERRORTHRESHOLD {
+		message := fmt.Sprintf("%s.get on the channel %s failed with %d: %s",
+			chaincode, read.Channel, response.Status, errorMessage(response))
+		logger.Error(message)
+		return pb.Response{Status: response.Status, Message: message, Payload: response.Payload}
+	}
+
+	read.Result = response.Payload
+	if !json.Valid(read.Result) {
+		read.Result, _ = json.Marshal(string(response.Payload))
+	}
+
+	result, err := marshalResult(read, format)
+	if err != nil {
+		message := fmt.Sprintf("unable to marshal the result: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.getFromChannel exited successfully")
+	return shim.Success(result)
+}
@@ -0,0 +1,440 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+const (
+	journalObjType = reservedObjTypePrefix + "journal"
+	postingObjType = reservedObjTypePrefix + "posting"
+
+	// systemAccountPrefix marks the accounts of the ledger itself, the other
+	// side of the movements from and to the outside world; they have journal
+	// lines but no balances
+	systemAccountPrefix = "@"
+	// externalAccount balances deposits and withdrawals
+	externalAccount = systemAccountPrefix + "external"
+	// exchangeAccount balances each currency of a conversion
+	exchangeAccount = systemAccountPrefix + "exchange"
+)
+
+// journalLine is one side of a journal entry. Amounts are signed: a debit is
+// positive and a credit negative, so the lines of an entry sum to zero in each
+// currency. Accounts are assets of their holders, so a line adds its amount to
+// the balance of its account.
+type journalLine struct {
+	Account  string   `json:"account"`
+	Currency string   `json:"currency"`
+	Amount   *decimal `json:"amount"`
+}
+
+// journalEntry records a movement of value in the double-entry journal.
+type journalEntry struct {
+	ID          string        `json:"id"`
+	TxID        string        `json:"txId"`
+	Timestamp   time.Time     `json:"timestamp"`
+	Description string        `json:"description"`
+	Lines       []journalLine `json:"lines"`
+}
+
+// posting is a journal line kept under its account, by time, for statements.
+type posting struct {
+	EntryID     string    `json:"entryId"`
+	TxID        string    `json:"txId"`
+	Timestamp   time.Time `json:"timestamp"`
+	Description string    `json:"description"`
+	Currency    string    `json:"currency"`
+	Amount      *decimal  `json:"amount"`
+}
+
+// transferLines debits to and credits from with m.
+func transferLines(from, to string, m money) []journalLine {
+	credit := &decimal{}
+	credit.sub(m.Amount)
+
+	return []journalLine{
+		{Account: to, Currency: m.Currency, Amount: m.Amount},
+		{Account: from, Currency: m.Currency, Amount: credit},
+	}
+}
+
+// postEntry records a balanced journal entry and its postings.
+func postEntry(stub shim.ChaincodeStubInterface, description string, lines ...journalLine) error {
+	sums := map[string]*decimal{}
+	for _, line := range lines {
+		if sums[line.Currency] == nil {
+			sums[line.Currency] = newDecimal(0, currencyScale(line.Currency))
+		}
+		sums[line.Currency].add(line.Amount)
+	}
+
+	for currency, sum := range sums {
+		if sum.Sign() != 0 {
+			return fmt.Errorf("the journal entry \"%s\" is off by %s %s", description, sum, currency)
+		}
+	}
+
+	now, err := txTime(stub)
+	if err != nil {
+		return err
+	}
+
+	entry := journalEntry{
+		ID:          newUUID(stub),
+		TxID:        stub.GetTxID(),
+		Timestamp:   now,
+		Description: description,
+		Lines:       lines,
+	}
+
+	entryKey, err := stub.CreateCompositeKey(journalObjType, []string{entry.TxID, entry.ID})
+	if err != nil {
+		return err
+	}
+
+	if err := putJSON(stub, entryKey, entry); err != nil {
+		return err
+	}
+
+	for i, line := range lines {
+		postingKey, err := stub.CreateCompositeKey(postingObjType,
+			[]string{line.Account, now.Format(auditTimeLayout), entry.ID, strconv.Itoa(i)})
+		if err != nil {
+			return err
+		}
+
+		p := posting{
+			EntryID:     entry.ID,
+			TxID:        entry.TxID,
+			Timestamp:   now,
+			Description: description,
+			Currency:    line.Currency,
+			Amount:      line.Amount,
+		}
+		if err := putJSON(stub, postingKey, p); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// parsePeriod parses an ISO 8601 time interval of two RFC 3339 timestamps,
+// e.g. "2019-01-01T00:00:00Z/2019-02-01T00:00:00Z", as the half-open range
+// [from, to).
+func parsePeriod(period string) (time.Time, time.Time, error) {
+	parts := strings.Split(period, "/")
+	if len(parts) != 2 {
+		return time.Time{}, time.Time{}, fmt.Errorf("a period must be two RFC 3339 timestamps separated by \"/\", got \"%s\"", period)
+	}
+
+	from, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("the start of the period must be in RFC 3339 format: %s", err.Error())
+	}
+
+	to, err := time.Parse(time.RFC3339Nano, parts[1])
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("the end of the period must be in RFC 3339 format: %s", err.Error())
+	}
+
+	if !from.Before(to) {
+		return time.Time{}, time.Time{}, fmt.Errorf("the period %s is empty", period)
+	}
+
+	return from, to, nil
+}
+
+// ledgerTotals sums the debits and credits of an account in a currency.
+// Credits are negative, so Debits + Credits is the balance.
+type ledgerTotals struct {
+	Account  string   `json:"account,omitempty"`
+	Currency string   `json:"currency"`
+	Debits   *decimal `json:"debits"`
+	Credits  *decimal `json:"credits"`
+	Balance  *decimal `json:"balance"`
+}
+
+func newLedgerTotals(account, currency string) *ledgerTotals {
+	scale := currencyScale(currency)
+	return &ledgerTotals{
+		Account:  account,
+		Currency: currency,
+		Debits:   newDecimal(0, scale),
+		Credits:  newDecimal(0, scale),
+		Balance:  newDecimal(0, scale),
+	}
+}
+
+func (t *ledgerTotals) post(amount *decimal) {
+	if amount.Sign() > 0 {
+		t.Debits.add(amount)
+	} else {
+		t.Credits.add(amount)
+	}
+	t.Balance.add(amount)
+}
+
+type trialBalance struct {
+	Accounts []*ledgerTotals `json:"accounts"`
+	// Totals has the sums of all accounts per currency, whose balances are
+	// zero unless the journal is corrupted
+	Totals   []*ledgerTotals `json:"totals"`
+	Balanced bool            `json:"balanced"`
+}
+
+// trialBalance sums the journal per account and currency.
+func (cc *SimpleChaincode) trialBalance(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.trialBalance")
+
+	if len(args) > 1 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d or %d", len(args), 0, 1)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	format := formatJSON
+	if len(args) == 1 {
+		format = args[0]
+	}
+	logger.Debugf("format: %s", format)
+
+	if err := checkFormat(format); err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	it, err := stub.GetStateByPartialCompositeKey(postingObjType, []string{})
+	if err != nil {
+		message := fmt.Sprintf("unable to get an iterator over the journal: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+	defer it.Close()
+
+	accounts, totals := map[string]*ledgerTotals{}, map[string]*ledgerTotals{}
+	for it.HasNext() {
+		response, err := it.Next()
+		if err != nil {
+			message := fmt.Sprintf("unable to get the next element: %s", err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		_, attributes, err := stub.SplitCompositeKey(response.Key)
+		if err != nil {
+			message := fmt.Sprintf("unable to split the composite key %s: %s", response.Key, err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		var p posting
+		if err := json.Unmarshal(response.Value, &p); err != nil {
+			message := fmt.Sprintf("unable to unmarshal the posting: %s", err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		account := attributes[0]
+		key := account + "\x00" + p.Currency
+		if accounts[key] == nil {
+			accounts[key] = newLedgerTotals(account, p.Currency)
+		}
+		if totals[p.Currency] == nil {
+			totals[p.Currency] = newLedgerTotals("", p.Currency)
+		}
+		accounts[key].post(p.Amount)
+		totals[p.Currency].post(p.Amount)
+	}
+
+	result := trialBalance{Accounts: sortedTotals(accounts), Totals: sortedTotals(totals), Balanced: true}
+	for _, t := range result.Totals {
+		if t.Balance.Sign() != 0 {
+			result.Balanced = false
+		}
+	}
+
+	resultBytes, err := marshalResult(result, format)
+	if err != nil {
+		message := fmt.Sprintf("unable to marshal the result: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.trialBalance exited successfully")
+	return shim.Success(resultBytes)
+}
+
+func sortedTotals(m map[string]*ledgerTotals) []*ledgerTotals {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	totals := make([]*ledgerTotals, 0, len(keys))
+	for _, key := range keys {
+		totals = append(totals, m[key])
+	}
+	return totals
+}
+
+// statementLine is a posting with the balance of its currency after it.
+type statementLine struct {
+	posting
+	Balance *decimal `json:"balance"`
+}
+
+// currencyStatement sums up a currency of a statement: Opening + Debits +
+// Credits - Closing is always zero.
+type currencyStatement struct {
+	Currency string   `json:"currency"`
+	Opening  *decimal `json:"opening"`
+	Debits   *decimal `json:"debits"`
+	Credits  *decimal `json:"credits"`
+	Closing  *decimal `json:"closing"`
+}
+
+type accountStatement struct {
+	Account    string               `json:"account"`
+	From       time.Time            `json:"from"`
+	To         time.Time            `json:"to"`
+	Lines      []statementLine      `json:"lines"`
+	Currencies []*currencyStatement `json:"currencies"`
+}
+
+// accountStatement returns the postings of an account over a period, with
+// the opening and closing balances of each currency.
+func (cc *SimpleChaincode) accountStatement(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.accountStatement")
+
+	if len(args) != 2 && len(args) != 3 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d or %d", len(args), 2, 3)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	id, period, format := args[0], args[1], formatJSON
+	if len(args) == 3 {
+		format = args[2]
+	}
+	logger.Debugf("account: %s, period: %s, format: %s", id, period, format)
+
+	from, to, err := parsePeriod(period)
+	if err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	if err := checkFormat(format); err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	if !strings.HasPrefix(id, systemAccountPrefix) {
+		a, err := getAccount(stub, id)
+		if err != nil {
+			message := fmt.Sprintf("unable to get the account %s: %s", id, err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		if a == nil {
+			message := fmt.Sprintf("the account %s not found", id)
+			logger.Error(message)
+			return pb.Response{Status: 404, Message: message}
+		}
+	}
+
+	it, err := stub.GetStateByPartialCompositeKey(postingObjType, []string{id})
+	if err != nil {
+		message := fmt.Sprintf("unable to get an iterator over the postings of %s: %s", id, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+	defer it.Close()
+
+	statement := accountStatement{Account: id, From: from, To: to, Lines: []statementLine{}}
+	currencies := map[string]*currencyStatement{}
+	for it.HasNext() {
+		response, err := it.Next()
+		if err != nil {
+			message := fmt.Sprintf("unable to get the next element: %s", err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		var p posting
+		if err := json.Unmarshal(response.Value, &p); err != nil {
+			message := fmt.Sprintf("unable to unmarshal the posting: %s", err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		// the postings are ordered by time, so nothing past the period is needed
+		if !p.Timestamp.Before(to) {
+			break
+		}
+
+		c := currencies[p.Currency]
+		if c == nil {
+			scale := currencyScale(p.Currency)
+			c = &currencyStatement{
+				Currency: p.Currency,
+				Opening:  newDecimal(0, scale),
+				Debits:   newDecimal(0, scale),
+				Credits:  newDecimal(0, scale),
+				Closing:  newDecimal(0, scale),
+			}
+			currencies[p.Currency] = c
+		}
+
+		c.Closing.add(p.Amount)
+		if p.Timestamp.Before(from) {
+			c.Opening.add(p.Amount)
+			continue
+		}
+
+		if p.Amount.Sign() > 0 {
+			c.Debits.add(p.Amount)
+		} else {
+			c.Credits.add(p.Amount)
+		}
+
+		balance := &decimal{}
+		balance.add(c.Closing)
+		statement.Lines = append(statement.Lines, statementLine{posting: p, Balance: balance})
+	}
+
+	codes := make([]string, 0, len(currencies))
+	for code := range currencies {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+
+	statement.Currencies = []*currencyStatement{}
+	for _, code := range codes {
+		statement.Currencies = append(statement.Currencies, currencies[code])
+	}
+
+	result, err := marshalResult(statement, format)
+	if err != nil {
+		message := fmt.Sprintf("unable to marshal the result: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.accountStatement exited successfully")
+	return shim.Success(result)
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// parsePointer splits an RFC 6901 JSON pointer into unescaped reference tokens.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("a JSON pointer must be empty or start with \"/\", got \"%s\"", pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+	}
+
+	return tokens, nil
+}
+
+// decodeJSON unmarshals a document keeping numbers as they were written.
+func decodeJSON(data []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var doc interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	if decoder.More() {
+		return nil, errors.New("unexpected data after the top-level value")
+	}
+
+	return doc, nil
+}
+
+func arrayIndex(token string, length int) (int, error) {
+	index, err := strconv.Atoi(token)
+	if err != nil || index < 0 || index >= length || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("invalid array index \"%s\"", token)
+	}
+
+	return index, nil
+}
+
+// resolvePointer returns the value the tokens point to within doc.
+func resolvePointer(doc interface{}, tokens []string) (interface{}, error) {
+	for i, token := range tokens {
+		switch node := doc.(type) {
+		case map[string]interface{}:
+			child, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("member \"%s\" not found at /%s", token, strings.Join(tokens[:i], "/"))
+			}
+			doc = child
+		case []interface{}:
+			index, err := arrayIndex(token, len(node))
+			if err != nil {
+				return nil, err
+			}
+			doc = node[index]
+		default:
+			return nil, fmt.Errorf("/%s is neither an object nor an array", strings.Join(tokens[:i], "/"))
+		}
+	}
+
+	return doc, nil
+}
+
+// setPointer replaces or adds the value the tokens point to and returns the
+// updated document. The parent of the target must exist; "-" appends to an
+// array.
+func setPointer(doc interface{}, tokens []string, value interface{}) (interface{}, error) {
+	if len(tokens) == 0 {
+		return value, nil
+	}
+
+	parent, err := resolvePointer(doc, tokens[:len(tokens)-1])
+	if err != nil {
+		return nil, err
+	}
+
+	last := tokens[len(tokens)-1]
+	switch node := parent.(type) {
+	case map[string]interface{}:
+		node[last] = value
+	case []interface{}:
+		if last == "-" {
+			node = append(node, value)
+			return setPointer(doc, tokens[:len(tokens)-1], node)
+		}
+
+		index, err := arrayIndex(last, len(node))
+		if err != nil {
+			return nil, err
+		}
+		node[index] = value
+	default:
+		return nil, fmt.Errorf("/%s is neither an object nor an array", strings.Join(tokens[:len(tokens)-1], "/"))
+	}
+
+	return doc, nil
+}
+
+func (cc *SimpleChaincode) getField(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.getField")
+
+	if len(args) != 3 && len(args) != 4 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d or %d", len(args), 3, 4)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	objType, key, pointer, format := args[0], args[1], args[2], formatJSON
+	if len(args) == 4 {
+		format = args[3]
+	}
+	logger.Debugf("type: %s, key: %s, pointer: %s, format: %s", objType, key, pointer, format)
+
+	if err := checkFormat(format); err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	tokens, err := parsePointer(pointer)
+	if err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	doc, response := readDocument(stub, objType, key)
+	if doc == nil {
+		return response
+	}
+
+	field, err := resolvePointer(doc, tokens)
+	if err != nil {
+		message := fmt.Sprintf("unable to resolve %s in the value of the key %s: %s", pointer, key, err.Error())
+		logger.Error(message)
+		return pb.Response{Status: 404, Message: message}
+	}
+
+	result, err := marshalResult(field, format)
+	if err != nil {
+		message := fmt.Sprintf("unable to marshal the result: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.getField exited successfully")
+	return shim.Success(result)
+}
+
+func (cc *SimpleChaincode) setField(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.setField")
+
+	if len(args) != 4 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d", len(args), 4)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	objType, key, pointer, valueArg := args[0], args[1], args[2], args[3]
+	logger.Debugf("type: %s, key: %s, pointer: %s, value: %s", objType, key, pointer, valueArg)
+
+	if response, denied := accessDenied(stub, accessWrite, objType); denied {
+		return response
+	}
+
+	tokens, err := parsePointer(pointer)
+	if err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	value, err := decodeJSON([]byte(valueArg))
+	if err != nil {
+		message := fmt.Sprintf("the value must be a JSON document: %s", err.Error())
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	doc, response := readDocument(stub, objType, key)
+	if doc == nil {
+		return response
+	}
+
+	if doc, err = setPointer(doc, tokens, value); err != nil {
+		message := fmt.Sprintf("unable to set %s in the value of the key %s: %s", pointer, key, err.Error())
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	docBytes, err := json.Marshal(doc)
+	if err != nil {
+		message := fmt.Sprintf("unable to marshal the document: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	compositeKey, err := createCompositeKey(stub, objType, key)
+	if err != nil {
+		message := fmt.Sprintf("unable to create a composite key: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	r, err := putRecord(stub, compositeKey, string(docBytes))
+	if response, ok := invalidValueResponse(err); ok {
+		return response
+	}
+	if err != nil {
+		message := fmt.Sprintf("unable to put a key-value pair: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if err := appendAudit(stub, "setField", objType, key, r); err != nil {
+		message := fmt.Sprintf("unable to append to the audit log: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.setField exited successfully")
+	return shim.Success(nil)
+}
+
+// readDocument returns the parsed value of the record objType/key. If it
+// can't, the document is nil and the response explains why.
+func readDocument(stub shim.ChaincodeStubInterface, objType, key string) (interface{}, pb.Response) {
+	compositeKey, err := createCompositeKey(stub, objType, key)
+	if err != nil {
+		message := fmt.Sprintf("unable to create a composite key: %s", err.Error())
+		logger.Error(message)
+		return nil, shim.Error(message)
+	}
+
+	r, err := getRecord(stub, compositeKey)
+	if err != nil {
+		message := fmt.Sprintf("unable to get a value for the key %s: %s", key, err.Error())
+		logger.Error(message)
+		return nil, shim.Error(message)
+	}
+
+	if r == nil {
+		message := fmt.Sprintf("a value for the key %s not found", key)
+		logger.Error(message)
+		return nil, pb.Response{Status: 404, Message: message}
+	}
+
+	now, err := txTime(stub)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the transaction timestamp: %s", err.Error())
+		logger.Error(message)
+		return nil, shim.Error(message)
+	}
+
+	if response, ok := unreadableResponse(key, r, now); ok {
+		return nil, response
+	}
+
+	doc, err := decodeJSON([]byte(r.Value))
+	if err != nil {
+		message := fmt.Sprintf("the value for the key %s is not a JSON document: %s", key, err.Error())
+		logger.Error(message)
+		return nil, pb.Response{Status: 400, Message: message}
+	}
+
+	return doc, shim.Success(nil)
+}
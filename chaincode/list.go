@@ -0,0 +1,287 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+const (
+	listObjType     = reservedObjTypePrefix + "list"
+	listMetaObjType = reservedObjTypePrefix + "listmeta"
+
+	maxListRange = 1000
+)
+
+// listMeta holds the pointers of a list; its elements occupy the indexes
+// [Head, Tail). Pushing to the left moves Head below zero, so indexes are
+// offset before being used in keys.
+type listMeta struct {
+	Head int64 `json:"head"`
+	Tail int64 `json:"tail"`
+}
+
+func (m *listMeta) length() int64 {
+	return m.Tail - m.Head
+}
+
+func listElementKey(stub shim.ChaincodeStubInterface, name string, index int64) (string, error) {
+	return stub.CreateCompositeKey(listObjType, []string{name, fmt.Sprintf("%020d", uint64(index)+1<<63)})
+}
+
+func getListMeta(stub shim.ChaincodeStubInterface, name string) (string, *listMeta, error) {
+	metaKey, err := stub.CreateCompositeKey(listMetaObjType, []string{name})
+	if err != nil {
+		return "", nil, err
+	}
+
+	metaBytes, err := stub.GetState(metaKey)
+	if err != nil {
+		return "", nil, err
+	}
+
+	meta := &listMeta{}
+	if metaBytes != nil {
+		if err := json.Unmarshal(metaBytes, meta); err != nil {
+			return "", nil, err
+		}
+	}
+
+	return metaKey, meta, nil
+}
+
+func putListMeta(stub shim.ChaincodeStubInterface, metaKey string, meta *listMeta) error {
+	if meta.length() == 0 {
+		return stub.DelState(metaKey)
+	}
+
+	metaBytes, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+
+	return stub.PutState(metaKey, metaBytes)
+}
+
+func (cc *SimpleChaincode) lpush(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.lpush")
+	return cc.push(stub, args, true)
+}
+
+func (cc *SimpleChaincode) rpush(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.rpush")
+	return cc.push(stub, args, false)
+}
+
+// push adds the values to the left or to the right end of a list in the order
+// they are passed and returns the new length of the list.
+func (cc *SimpleChaincode) push(stub shim.ChaincodeStubInterface, args []string, left bool) pb.Response {
+	if len(args) < 2 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected at least %d", len(args), 2)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	name, values := args[0], args[1:]
+	logger.Debugf("list: %s, values: %v, left: %t", name, values, left)
+
+	if name == "" {
+		message := "list name must be a non-empty string"
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	metaKey, meta, err := getListMeta(stub, name)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the list %s: %s", name, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	for _, value := range values {
+		var index int64
+		if left {
+			meta.Head--
+			index = meta.Head
+		} else {
+			index = meta.Tail
+			meta.Tail++
+		}
+
+		elementKey, err := listElementKey(stub, name, index)
+		if err != nil {
+			message := fmt.Sprintf("unable to create a composite key: %s", err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		if err := stub.PutState(elementKey, []byte(value)); err != nil {
+			message := fmt.Sprintf("unable to put a list element: %s", err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+	}
+
+	if err := putListMeta(stub, metaKey, meta); err != nil {
+		message := fmt.Sprintf("unable to update the list %s: %s", name, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.push exited successfully")
+	return shim.Success([]byte(strconv.FormatInt(meta.length(), 10)))
+}
+
+func (cc *SimpleChaincode) lpop(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.lpop")
+
+	if len(args) != 1 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d", len(args), 1)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	name := args[0]
+	logger.Debugf("list: %s", name)
+
+	metaKey, meta, err := getListMeta(stub, name)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the list %s: %s", name, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if meta.length() == 0 {
+		message := fmt.Sprintf("the list %s is empty", name)
+		logger.Error(message)
+		return pb.Response{Status: 404, Message: message}
+	}
+
+	elementKey, err := listElementKey(stub, name, meta.Head)
+	if err != nil {
+		message := fmt.Sprintf("unable to create a composite key: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	value, err := stub.GetState(elementKey)
+	if err != nil {
+		message := fmt.Sprintf("unable to get a list element: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if err := stub.DelState(elementKey); err != nil {
+		message := fmt.Sprintf("unable to delete a list element: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	meta.Head++
+	if err := putListMeta(stub, metaKey, meta); err != nil {
+		message := fmt.Sprintf("unable to update the list %s: %s", name, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.lpop exited successfully")
+	return shim.Success(value)
+}
+
+func (cc *SimpleChaincode) lrange(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.lrange")
+
+	if len(args) != 3 && len(args) != 4 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d or %d", len(args), 3, 4)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	name, format := args[0], formatJSON
+	if len(args) == 4 {
+		format = args[3]
+	}
+	logger.Debugf("list: %s, range: [%s, %s], format: %s", name, args[1], args[2], format)
+
+	if err := checkFormat(format); err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	start, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		message := fmt.Sprintf("start must be an integer, got \"%s\"", args[1])
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	stop, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		message := fmt.Sprintf("stop must be an integer, got \"%s\"", args[2])
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	_, meta, err := getListMeta(stub, name)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the list %s: %s", name, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	// start and stop are inclusive positions from the left, negative ones
+	// count from the right
+	length := meta.length()
+	if start < 0 {
+		start += length
+	}
+	if stop < 0 {
+		stop += length
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= length {
+		stop = length - 1
+	}
+
+	if stop-start+1 > maxListRange {
+		message := fmt.Sprintf("the range is too wide: %d elements requested, at most %d allowed",
+			stop-start+1, maxListRange)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	var values = []string{}
+	for i := start; i <= stop; i++ {
+		elementKey, err := listElementKey(stub, name, meta.Head+i)
+		if err != nil {
+			message := fmt.Sprintf("unable to create a composite key: %s", err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		value, err := stub.GetState(elementKey)
+		if err != nil {
+			message := fmt.Sprintf("unable to get a list element: %s", err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		values = append(values, string(value))
+	}
+
+	result, err := marshalResult(values, format)
+	if err != nil {
+		message := fmt.Sprintf("unable to marshal the result: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.lrange exited successfully")
+	return shim.Success(result)
+}
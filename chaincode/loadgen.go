@@ -0,0 +1,193 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// putMany and readMany generate load from within the chaincode, to measure
+// the endorsement throughput of a key layout and a value size: the keys
+// prefix00000000, prefix00000001... for the flat layout, or the keys
+// 00000000, 00000001... of the object type prefix for the composite one.
+// Values are derived from their keys, so that every endorser writes the same.
+const (
+	loadLayoutFlat      = "flat"
+	loadLayoutComposite = "composite"
+
+	maxLoadValueSize = 1 << 20
+)
+
+// loadResult is the result of putMany and readMany: the number of keys
+// written or read, of those found for a read, and the bytes of their values.
+type loadResult struct {
+	Layout string `json:"layout"`
+	Count  int    `json:"count"`
+	Found  int    `json:"found"`
+	Bytes  int    `json:"bytes"`
+}
+
+// parseLoad parses the arguments common to putMany and readMany, from
+// the count on.
+func parseLoad(prefix, countArg string, layoutArgs []string) (int, string, error) {
+	layout := loadLayoutFlat
+	if len(layoutArgs) > 0 {
+		layout = layoutArgs[0]
+	}
+
+	if layout != loadLayoutFlat && layout != loadLayoutComposite {
+		return 0, "", fmt.Errorf("unknown layout: %s, expected one of {%s, %s}", layout, loadLayoutFlat, loadLayoutComposite)
+	}
+
+	if prefix == "" || strings.HasPrefix(prefix, reservedObjTypePrefix) {
+		return 0, "", fmt.Errorf("prefix must be a non-empty string not starting with \"%s\"", reservedObjTypePrefix)
+	}
+
+	count, err := strconv.Atoi(countArg)
+	if err != nil || count < 1 || count > maxPageSize {
+		return 0, "", fmt.Errorf("count must be an integer in [1, %d], got \"%s\"", maxPageSize, countArg)
+	}
+
+	return count, layout, nil
+}
+
+func loadKey(stub shim.ChaincodeStubInterface, prefix, layout string, i int) (string, error) {
+	if layout == loadLayoutFlat {
+		return fmt.Sprintf("%s%08d", prefix, i), nil
+	}
+
+	return stub.CreateCompositeKey(prefix, []string{fmt.Sprintf("%08d", i)})
+}
+
+// loadValue returns size hex digits derived from key.
+func loadValue(key string, size int) string {
+	var b strings.Builder
+	b.Grow(size + sha256.Size*2)
+	for digest := sha256.Sum256([]byte(key)); b.Len() < size; digest = sha256.Sum256(digest[:]) {
+		b.WriteString(hex.EncodeToString(digest[:]))
+	}
+
+	return b.String()[:size]
+}
+
+// putMany writes count keys with values of valueSize bytes. The keys aren't
+// audited, nor tagged or indexed: it's load, not data. Only admins generate
+// load.
+func (cc *SimpleChaincode) putMany(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.putMany")
+
+	if len(args) != 3 && len(args) != 4 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d or %d", len(args), 3, 4)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	prefix, countArg, valueSizeArg := args[0], args[1], args[2]
+	logger.Debugf("prefix: %s, count: %s, valueSize: %s, layout: %v", prefix, countArg, valueSizeArg, args[3:])
+
+	if err := requireAdmin(stub); err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 403, Message: message}
+	}
+
+	count, layout, err := parseLoad(prefix, countArg, args[3:])
+	if err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	valueSize, err := strconv.Atoi(valueSizeArg)
+	if err != nil || valueSize < 1 || valueSize > maxLoadValueSize {
+		message := fmt.Sprintf("value size must be an integer in [1, %d], got \"%s\"", maxLoadValueSize, valueSizeArg)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	result := loadResult{Layout: layout}
+	for i := 0; i < count; i++ {
+		key, err := loadKey(stub, prefix, layout, i)
+		if err != nil {
+			message := fmt.Sprintf("unable to create the key %d: %s", i, err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		if _, err := putRecord(stub, key, loadValue(key, valueSize)); err != nil {
+			message := fmt.Sprintf("unable to put the key %d: %s", i, err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+		result.Count, result.Bytes = result.Count+1, result.Bytes+valueSize
+	}
+
+	payload, err := marshalResult(result, formatJSON)
+	if err != nil {
+		message := fmt.Sprintf("unable to marshal the result: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.putMany exited successfully")
+	return shim.Success(payload)
+}
+
+// readMany reads count keys as putMany writes them, checking their
+// integrity as get does, and returns how many it found.
+func (cc *SimpleChaincode) readMany(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.readMany")
+
+	if len(args) != 2 && len(args) != 3 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d or %d", len(args), 2, 3)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	prefix, countArg := args[0], args[1]
+	logger.Debugf("prefix: %s, count: %s, layout: %v", prefix, countArg, args[2:])
+
+	count, layout, err := parseLoad(prefix, countArg, args[2:])
+	if err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	result := loadResult{Layout: layout}
+	for i := 0; i < count; i++ {
+		key, err := loadKey(stub, prefix, layout, i)
+		if err != nil {
+			message := fmt.Sprintf("unable to create the key %d: %s", i, err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		r, err := getRecord(stub, key)
+		if err != nil {
+			message := fmt.Sprintf("unable to get the key %d: %s", i, err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		result.Count++
+		if r != nil {
+			result.Found, result.Bytes = result.Found+1, result.Bytes+r.Size
+		}
+	}
+
+	payload, err := marshalResult(result, formatJSON)
+	if err != nil {
+		message := fmt.Sprintf("unable to marshal the result: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.readMany exited successfully")
+	return shim.Success(payload)
+}
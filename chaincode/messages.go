@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	structpb "github.com/golang/protobuf/ptypes/struct"
+	"github.com/golang/protobuf/ptypes/timestamp"
+)
+
+// The message types of simple_chaincode.proto are generated into
+// simple_chaincode.pb.go; regenerate it after changing the .proto.
+//go:generate protoc --go_out=. simple_chaincode.proto
+
+// timestampProto converts t, leaving zero and missing times unset.
+func timestampProto(t *time.Time) (*timestamp.Timestamp, error) {
+	if t == nil || t.IsZero() {
+		return nil, nil
+	}
+
+	return ptypes.TimestampProto(*t)
+}
+
+// recordMessage converts r into its protobuf message, with binary values
+// decoded from their base64 text.
+func recordMessage(key string, r *record) (*Record, error) {
+	raw, err := r.rawValue()
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Record{Key: key, Value: raw, ContentType: r.ContentType, Checksum: r.Checksum, Size: int64(r.Size),
+		Version: r.Version, TxId: r.TxID}
+	if r.Creator != nil {
+		m.CreatorMspId, m.CreatorSubject = r.Creator.MSPID, r.Creator.Subject
+	}
+	if r.DeletedBy != nil {
+		m.DeletedByMspId, m.DeletedBySubject = r.DeletedBy.MSPID, r.DeletedBy.Subject
+	}
+	if m.CreatedAt, err = timestampProto(&r.CreatedAt); err != nil {
+		return nil, err
+	}
+	if m.UpdatedAt, err = timestampProto(&r.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if m.ArchivedAt, err = timestampProto(r.ArchivedAt); err != nil {
+		return nil, err
+	}
+	if m.UnlockAt, err = timestampProto(r.UnlockAt); err != nil {
+		return nil, err
+	}
+	if m.DeletedAt, err = timestampProto(r.DeletedAt); err != nil {
+		return nil, err
+	}
+	if m.ExpiresAt, err = timestampProto(r.ExpiresAt); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// valueMessage converts a document decoded by decodeJSON into a
+// google.protobuf.Value. Numbers become doubles, like in JSON.
+func valueMessage(doc interface{}) (*structpb.Value, error) {
+	switch v := doc.(type) {
+	case nil:
+		return &structpb.Value{Kind: &structpb.Value_NullValue{}}, nil
+	case bool:
+		return &structpb.Value{Kind: &structpb.Value_BoolValue{BoolValue: v}}, nil
+	case string:
+		return &structpb.Value{Kind: &structpb.Value_StringValue{StringValue: v}}, nil
+	case json.Number:
+		f, err := v.Float64()
+		if err != nil {
+			return nil, err
+		}
+		return &structpb.Value{Kind: &structpb.Value_NumberValue{NumberValue: f}}, nil
+	case []interface{}:
+		list := &structpb.ListValue{Values: make([]*structpb.Value, len(v))}
+		for i, element := range v {
+			m, err := valueMessage(element)
+			if err != nil {
+				return nil, err
+			}
+			list.Values[i] = m
+		}
+		return &structpb.Value{Kind: &structpb.Value_ListValue{ListValue: list}}, nil
+	case map[string]interface{}:
+		fields := &structpb.Struct{Fields: make(map[string]*structpb.Value, len(v))}
+		for name, field := range v {
+			m, err := valueMessage(field)
+			if err != nil {
+				return nil, err
+			}
+			fields.Fields[name] = m
+		}
+		return &structpb.Value{Kind: &structpb.Value_StructValue{StructValue: fields}}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported type %T", doc)
+}
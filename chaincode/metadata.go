@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+const contractName = "SimpleChaincode"
+
+type paramMetadata struct {
+	Name     string `json:"name"`
+	Optional bool   `json:"optional,omitempty"`
+	Variadic bool   `json:"variadic,omitempty"`
+}
+
+// functionMetadata describes a function of the chaincode. A read-only
+// function is meant to be evaluated, any other one to be submitted.
+type functionMetadata struct {
+	Name     string          `json:"name"`
+	ReadOnly bool            `json:"readOnly"`
+	Params   []paramMetadata `json:"params"`
+}
+
+type contractMetadata struct {
+	Name      string             `json:"name"`
+	Functions []functionMetadata `json:"functions"`
+}
+
+func parseParam(param string) paramMetadata {
+	switch {
+	case strings.HasSuffix(param, "?"):
+		return paramMetadata{Name: strings.TrimSuffix(param, "?"), Optional: true}
+	case strings.HasSuffix(param, "..."):
+		return paramMetadata{Name: strings.TrimSuffix(param, "..."), Variadic: true}
+	default:
+		return paramMetadata{Name: param}
+	}
+}
+
+// contract is described once the routes are known, metadata being one of
+// them.
+var contract contractMetadata
+
+func describeContract(routes []route) contractMetadata {
+	m := contractMetadata{Name: contractName, Functions: make([]functionMetadata, 0, len(routes))}
+	for _, r := range routes {
+		f := functionMetadata{Name: r.name, ReadOnly: r.readOnly, Params: make([]paramMetadata, 0, len(r.params))}
+		for _, param := range r.params {
+			f.Params = append(f.Params, parseParam(param))
+		}
+		m.Functions = append(m.Functions, f)
+	}
+
+	return m
+}
+
+// metadata describes the functions of the chaincode and their arguments, in
+// the order the router knows them. cmd/genclient builds clients from it.
+func (cc *SimpleChaincode) metadata(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.metadata")
+
+	if len(args) > 1 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d or %d", len(args), 0, 1)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	format := formatJSON
+	if len(args) == 1 {
+		format = args[0]
+	}
+	logger.Debugf("format: %s", format)
+
+	if err := checkFormat(format); err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	result, err := marshalResult(contract, format)
+	if err != nil {
+		message := fmt.Sprintf("unable to marshal the result: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.metadata exited successfully")
+	return shim.Success(result)
+}
@@ -0,0 +1,380 @@
+package main
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/msp"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+const (
+	signerCAObjType = reservedObjTypePrefix + "signerca"
+	nonceObjType    = reservedObjTypePrefix + "nonce"
+	relayedObjType  = reservedObjTypePrefix + "relayed"
+)
+
+// delegatedStub presents the signer of a relayed call as the creator of the
+// transaction, so that everything that identifies the caller, ownership and
+// role checks as well as the audit log, attributes the call to the signer.
+type delegatedStub struct {
+	shim.ChaincodeStubInterface
+	creator []byte
+}
+
+func (s *delegatedStub) unwrap() shim.ChaincodeStubInterface {
+	return s.ChaincodeStubInterface
+}
+
+func (s *delegatedStub) GetCreator() ([]byte, error) {
+	return s.creator, nil
+}
+
+func newDelegatedStub(stub shim.ChaincodeStubInterface, mspID, certPEM string) (*delegatedStub, error) {
+	creator, err := proto.Marshal(&msp.SerializedIdentity{Mspid: mspID, IdBytes: []byte(certPEM)})
+	if err != nil {
+		return nil, err
+	}
+
+	return &delegatedStub{ChaincodeStubInterface: stub, creator: creator}, nil
+}
+
+// relayedCall records a call relayed on behalf of its signer.
+type relayedCall struct {
+	Signer    string    `json:"signer"`
+	MSPID     string    `json:"mspId"`
+	Nonce     uint64    `json:"nonce"`
+	Function  string    `json:"function"`
+	Args      []string  `json:"args"`
+	Relayer   string    `json:"relayer"`
+	TxID      string    `json:"txId"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+type nonceState struct {
+	Signer string `json:"signer"`
+	// Nonce is the nonce of the last call relayed, 0 if none was
+	Nonce uint64 `json:"nonce"`
+}
+
+// relayDigest is what the signer of a relayed call signs: the hex SHA-256 of
+// the canonical JSON of the channel, the signer's MSP id, the nonce, the
+// function and its arguments. The channel keeps a signature from being
+// replayed on another channel, the nonce on this one.
+func relayDigest(channelID, mspID string, nonce uint64, function string, args []string) (string, error) {
+	return canonicalHash(struct {
+		Channel  string   `json:"channel"`
+		MSPID    string   `json:"mspId"`
+		Nonce    uint64   `json:"nonce"`
+		Function string   `json:"function"`
+		Args     []string `json:"args"`
+	}{channelID, mspID, nonce, function, args})
+}
+
+func signerCAs(stub shim.ChaincodeStubInterface, mspID string) (*x509.CertPool, error) {
+	key, err := stub.CreateCompositeKey(signerCAObjType, []string{mspID})
+	if err != nil {
+		return nil, err
+	}
+
+	bundle, err := stub.GetState(key)
+	if err != nil || bundle == nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(bundle)
+	return pool, nil
+}
+
+func getNonce(stub shim.ChaincodeStubInterface, signer string) (string, *nonceState, error) {
+	key, err := stub.CreateCompositeKey(nonceObjType, []string{signer})
+	if err != nil {
+		return "", nil, err
+	}
+
+	n := nonceState{Signer: signer}
+	if _, err := getJSON(stub, key, &n); err != nil {
+		return "", nil, err
+	}
+
+	return key, &n, nil
+}
+
+// setSignerCA sets the PEM bundle of the CA certificates that issue the
+// certificates of an MSP's members, against which relay verifies the
+// certificate of a signer. The chaincode can't see the channel's MSP
+// configuration, so an admin mirrors it here.
+func (cc *SimpleChaincode) setSignerCA(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.setSignerCA")
+
+	if len(args) != 2 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d", len(args), 2)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	mspID, bundle := args[0], args[1]
+	logger.Debugf("MSP id: %s, bundle: %s", mspID, bundle)
+
+	if err := requireAdmin(stub); err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 403, Message: message}
+	}
+
+	if mspID == "" {
+		message := "MSP id must be a non-empty string"
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	if !x509.NewCertPool().AppendCertsFromPEM([]byte(bundle)) {
+		message := "bundle must hold at least one PEM-encoded certificate"
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	key, err := stub.CreateCompositeKey(signerCAObjType, []string{mspID})
+	if err != nil {
+		message := fmt.Sprintf("unable to create a composite key: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if err := stub.PutState(key, []byte(bundle)); err != nil {
+		message := fmt.Sprintf("unable to put the CA certificates of %s: %s", mspID, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.setSignerCA exited successfully")
+	return shim.Success(nil)
+}
+
+// relay executes a function on behalf of the holder of certificate, who
+// signed the call off-chain, submitted by another identity, the relayer. The
+// signature is the base64 ASN.1 ECDSA signature of relayDigest, and nonce must
+// be the signer's next one, so that every signed call executes at most once
+// and in order. The function runs as the signer; if it fails, so does the
+// relay, and the nonce stays unused.
+func (cc *SimpleChaincode) relay(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.relay")
+
+	if len(args) < 5 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected at least %d", len(args), 5)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	mspID, certPEM, nonceArg, signatureArg, function, functionArgs := args[0], args[1], args[2], args[3], args[4], args[5:]
+	logger.Debugf("MSP id: %s, nonce: %s, function: %s, args: %v", mspID, nonceArg, function, functionArgs)
+
+	r, ok := routesByName[function]
+	if !ok {
+		message := fmt.Sprintf("unknown function name: %s", function)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	if r.readOnly || function == "relay" {
+		message := fmt.Sprintf("%s can't be relayed", function)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	nonce, err := strconv.ParseUint(nonceArg, 10, 64)
+	if err != nil {
+		message := fmt.Sprintf("nonce must be a non-negative integer: %s", err.Error())
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(signatureArg)
+	if err != nil {
+		message := fmt.Sprintf("signature must be base64-encoded: %s", err.Error())
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	cert, err := parseCertificate(certPEM)
+	if err != nil {
+		message := fmt.Sprintf("unable to parse the certificate: %s", err.Error())
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	roots, err := signerCAs(stub, mspID)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the CA certificates of %s: %s", mspID, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if roots == nil {
+		message := fmt.Sprintf("no CA certificates set for %s", mspID)
+		logger.Error(message)
+		return pb.Response{Status: 403, Message: message}
+	}
+
+	now, err := txTime(stub)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the transaction timestamp: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	opts := x509.VerifyOptions{Roots: roots, CurrentTime: now, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}}
+	if _, err := cert.Verify(opts); err != nil {
+		message := fmt.Sprintf("the certificate of %s isn't issued by %s: %s", cert.Subject.String(), mspID, err.Error())
+		logger.Error(message)
+		return pb.Response{Status: 403, Message: message}
+	}
+
+	digestHex, err := relayDigest(stub.GetChannelID(), mspID, nonce, function, functionArgs)
+	if err != nil {
+		message := fmt.Sprintf("unable to compute the digest of the call: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	digest, _ := hex.DecodeString(digestHex)
+	if err := verifySignature(cert, digest, signature); err != nil {
+		message := fmt.Sprintf("unable to verify the signature of %s: %s", cert.Subject.String(), err.Error())
+		logger.Error(message)
+		return pb.Response{Status: 403, Message: message}
+	}
+
+	delegated, err := newDelegatedStub(stub, mspID, certPEM)
+	if err != nil {
+		message := fmt.Sprintf("unable to serialize the identity of %s: %s", cert.Subject.String(), err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	signer, err := callerID(delegated)
+	if err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	relayer, err := callerID(stub)
+	if err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	nonceKey, n, err := getNonce(stub, signer)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the nonce of %s: %s", cert.Subject.String(), err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if nonce != n.Nonce+1 {
+		message := fmt.Sprintf("nonce %d is out of order, the next nonce of %s is %d", nonce, cert.Subject.String(), n.Nonce+1)
+		logger.Error(message)
+		return pb.Response{Status: 409, Message: message}
+	}
+
+	response := r.handlerFor(functionArgs)(cc, newTxStub(delegated), functionArgs)
+	if response.Status >= shim.ERRORTHRESHOLD {
+		return response
+	}
+
+	n.Nonce = nonce
+	if err := putJSON(stub, nonceKey, n); err != nil {
+		message := fmt.Sprintf("unable to put the nonce of %s: %s", cert.Subject.String(), err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	relayedKey, err := stub.CreateCompositeKey(relayedObjType, []string{signer, fmt.Sprintf("%020d", nonce)})
+	if err != nil {
+		message := fmt.Sprintf("unable to create a composite key: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	call := relayedCall{
+		Signer:    signer,
+		MSPID:     mspID,
+		Nonce:     nonce,
+		Function:  function,
+		Args:      functionArgs,
+		Relayer:   relayer,
+		TxID:      stub.GetTxID(),
+		Timestamp: now,
+	}
+	if err := putJSON(stub, relayedKey, call); err != nil {
+		message := fmt.Sprintf("unable to record the relayed call: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.relay exited successfully")
+	return response
+}
+
+// nonceOf returns the last nonce used by the holder of a certificate, so that
+// a client knows which one to sign next.
+func (cc *SimpleChaincode) nonceOf(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.nonceOf")
+
+	if len(args) != 2 && len(args) != 3 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d or %d", len(args), 2, 3)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	mspID, certPEM, format := args[0], args[1], formatJSON
+	if len(args) == 3 {
+		format = args[2]
+	}
+	logger.Debugf("MSP id: %s, format: %s", mspID, format)
+
+	if err := checkFormat(format); err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	delegated, err := newDelegatedStub(stub, mspID, certPEM)
+	if err != nil {
+		message := fmt.Sprintf("unable to serialize the identity: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	signer, err := callerID(delegated)
+	if err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	_, n, err := getNonce(stub, signer)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the nonce of %s: %s", signer, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	result, err := marshalResult(n, format)
+	if err != nil {
+		message := fmt.Sprintf("unable to marshal the result: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.nonceOf exited successfully")
+	return shim.Success(result)
+}
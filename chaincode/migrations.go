@@ -0,0 +1,261 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// The schema version is the number of migrations the state has gone through.
+// A change to the format of the values appends a migration, which Init runs
+// on upgrade, so that data written by earlier versions of the chaincode
+// keeps being read. A transaction migrates at most maxPageSize keys; when
+// there are more, migrate resumes where the last one stopped.
+const schemaObjType = reservedObjTypePrefix + "schema"
+
+// migration is a step from one schema version to the next. step migrates the
+// keys after bookmark, up to maxPageSize of them, and returns the bookmark to
+// resume from, or "" when it's done. Steps are idempotent: running one again
+// over migrated keys changes nothing.
+type migration struct {
+	description string
+	step        func(stub shim.ChaincodeStubInterface, bookmark string) (string, error)
+}
+
+var migrations = []migration{
+	{"wrap the values of simple keys stored before the record envelope", wrapLegacyValues},
+	{"store assets in the canonical form of the asset model", canonicalizeAssets},
+	{"index assets by owner and by docType and creation time", indexAssets},
+}
+
+// schemaState is the schema version of the state, with the bookmark of the
+// migration to the next one when it's under way.
+type schemaState struct {
+	Version  int    `json:"version"`
+	Bookmark string `json:"bookmark,omitempty"`
+}
+
+// schemaStatus is schemaState as getSchemaVersion returns it.
+type schemaStatus struct {
+	schemaState
+	Latest  int  `json:"latest"`
+	Pending bool `json:"pending"`
+}
+
+func schemaKey(stub shim.ChaincodeStubInterface) (string, error) {
+	return stub.CreateCompositeKey(schemaObjType, []string{"state"})
+}
+
+func getSchemaState(stub shim.ChaincodeStubInterface) (*schemaState, error) {
+	stateKey, err := schemaKey(stub)
+	if err != nil {
+		return nil, err
+	}
+
+	var state schemaState
+	if _, err := getJSON(stub, stateKey, &state); err != nil {
+		return nil, err
+	}
+
+	return &state, nil
+}
+
+// migrate runs the pending migrations, as far as a transaction goes, and
+// returns the schema state it leaves.
+func migrate(stub shim.ChaincodeStubInterface) (*schemaState, error) {
+	state, err := getSchemaState(stub)
+	if err != nil {
+		return nil, err
+	}
+
+	for state.Version < len(migrations) {
+		m := migrations[state.Version]
+		logger.Infof("migrating to the schema version %d: %s", state.Version+1, m.description)
+
+		next, err := m.step(stub, state.Bookmark)
+		if err != nil {
+			return nil, fmt.Errorf("unable to migrate to the schema version %d: %s", state.Version+1, err.Error())
+		}
+
+		if next != "" {
+			state.Bookmark = next
+			break
+		}
+		state.Version, state.Bookmark = state.Version+1, ""
+	}
+
+	stateKey, err := schemaKey(stub)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := putJSON(stub, stateKey, state); err != nil {
+		return nil, err
+	}
+
+	return state, nil
+}
+
+// forEachKey calls fn with the keys of objType after bookmark and their
+// values, the simple keys for an empty objType, up to maxPageSize of them. It
+// returns the last key it passed to fn if there may be more, "" otherwise.
+func forEachKey(stub shim.ChaincodeStubInterface, objType, bookmark string, fn func(key string, value []byte) error) (string, error) {
+	var (
+		it  shim.StateQueryIteratorInterface
+		err error
+	)
+	if objType == "" {
+		it, err = stub.GetStateByRange(bookmark, "")
+	} else {
+		it, err = stub.GetStateByPartialCompositeKey(objType, []string{})
+	}
+	if err != nil {
+		return "", err
+	}
+	defer it.Close()
+
+	count := 0
+	for it.HasNext() {
+		response, err := it.Next()
+		if err != nil {
+			return "", err
+		}
+
+		if response.Key <= bookmark || (objType == "" && isCompositeKey(response.Key)) {
+			continue
+		}
+
+		if count == maxPageSize {
+			return bookmark, nil
+		}
+
+		if err := fn(response.Key, response.Value); err != nil {
+			return "", err
+		}
+		bookmark = response.Key
+		count++
+	}
+
+	return "", nil
+}
+
+func wrapLegacyValues(stub shim.ChaincodeStubInterface, bookmark string) (string, error) {
+	now, err := txTime(stub)
+	if err != nil {
+		return "", err
+	}
+
+	return forEachKey(stub, "", bookmark, func(key string, value []byte) error {
+		r := decodeRecord(value)
+		if !r.UpdatedAt.IsZero() {
+			return nil
+		}
+
+		r.CreatedAt, r.UpdatedAt, r.Version = now, now, 1
+		return storeRecord(stub, key, r)
+	})
+}
+
+// canonicalizeAssets stores the assets written before the asset model in
+// its canonical form. Those that don't fit the model are left as they are,
+// for their owners to fix with an update.
+func canonicalizeAssets(stub shim.ChaincodeStubInterface, bookmark string) (string, error) {
+	now, err := txTime(stub)
+	if err != nil {
+		return "", err
+	}
+
+	return forEachKey(stub, assetObjType, bookmark, func(key string, value []byte) error {
+		r := decodeRecord(value)
+		if r.UpdatedAt.IsZero() {
+			r.CreatedAt, r.UpdatedAt, r.Version = now, now, 1
+		}
+
+		err := storeRecord(stub, key, r)
+		if _, ok := err.(*invalidValueError); ok {
+			logger.Warningf("the asset %s doesn't fit the model and was left as is: %s", key, err.Error())
+			return nil
+		}
+
+		return err
+	})
+}
+
+// migrate runs the pending migrations, for when Init couldn't run them all in
+// the transaction of the upgrade. It returns the schema version it leaves,
+// as getSchemaVersion does. Only admins migrate.
+func (cc *SimpleChaincode) migrate(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.migrate")
+
+	if len(args) != 0 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d", len(args), 0)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	if err := requireAdmin(stub); err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 403, Message: message}
+	}
+
+	state, err := migrate(stub)
+	if err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	result, err := json.Marshal(schemaStatus{*state, len(migrations), state.Version < len(migrations)})
+	if err != nil {
+		message := fmt.Sprintf("unable to marshal the result: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.migrate exited successfully")
+	return shim.Success(result)
+}
+
+// getSchemaVersion returns the schema version of the state and the latest
+// one, which differ while migrations are pending.
+func (cc *SimpleChaincode) getSchemaVersion(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.getSchemaVersion")
+
+	if len(args) > 1 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d or %d", len(args), 0, 1)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	format := formatJSON
+	if len(args) == 1 {
+		format = args[0]
+	}
+	logger.Debugf("format: %s", format)
+
+	if err := checkFormat(format); err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	state, err := getSchemaState(stub)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the schema version: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	result, err := marshalResult(schemaStatus{*state, len(migrations), state.Version < len(migrations)}, format)
+	if err != nil {
+		message := fmt.Sprintf("unable to marshal the result: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.getSchemaVersion exited successfully")
+	return shim.Success(result)
+}
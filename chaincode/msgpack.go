@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// marshalMsgpack encodes the same kind of values as marshalCBOR. Map keys are
+// sorted so that equal values always encode to the same bytes; CBOR values
+// are embedded as bin.
+func marshalMsgpack(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := writeMsgpack(&buf, v); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// writeMsgpackHead writes the shortest header for a str, bin, array or map of
+// length n; fix is the fixed-size format marker or 0 if there is none.
+func writeMsgpackHead(buf *bytes.Buffer, fix byte, fixMax int, m8, m16, m32 byte, n int) {
+	switch {
+	case fix != 0 && n <= fixMax:
+		buf.WriteByte(fix | byte(n))
+	case m8 != 0 && n <= math.MaxUint8:
+		buf.WriteByte(m8)
+		buf.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		buf.WriteByte(m16)
+		binary.Write(buf, binary.BigEndian, uint16(n))
+	default:
+		buf.WriteByte(m32)
+		binary.Write(buf, binary.BigEndian, uint32(n))
+	}
+}
+
+func writeMsgpack(buf *bytes.Buffer, v interface{}) error {
+	switch value := v.(type) {
+	case nil:
+		buf.WriteByte(0xc0)
+	case bool:
+		if value {
+			buf.WriteByte(0xc3)
+		} else {
+			buf.WriteByte(0xc2)
+		}
+	case string:
+		writeMsgpackHead(buf, 0xa0, 31, 0xd9, 0xda, 0xdb, len(value))
+		buf.WriteString(value)
+	case []byte:
+		writeMsgpackHead(buf, 0, 0, 0xc4, 0xc5, 0xc6, len(value))
+		buf.Write(value)
+	case cborRaw:
+		return writeMsgpack(buf, []byte(value))
+	case int:
+		writeMsgpackInt(buf, int64(value))
+	case int32:
+		writeMsgpackInt(buf, int64(value))
+	case int64:
+		writeMsgpackInt(buf, value)
+	case uint64:
+		writeMsgpackUint(buf, value)
+	case float64:
+		buf.WriteByte(0xcb)
+		binary.Write(buf, binary.BigEndian, math.Float64bits(value))
+	case json.Number:
+		if i, err := value.Int64(); err == nil {
+			writeMsgpackInt(buf, i)
+		} else if u, err := strconv.ParseUint(string(value), 10, 64); err == nil {
+			writeMsgpackUint(buf, u)
+		} else if f, err := value.Float64(); err == nil {
+			return writeMsgpack(buf, f)
+		} else {
+			return err
+		}
+	case []interface{}:
+		writeMsgpackHead(buf, 0x90, 15, 0, 0xdc, 0xdd, len(value))
+		for _, item := range value {
+			if err := writeMsgpack(buf, item); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(value))
+		for k := range value {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		writeMsgpackHead(buf, 0x80, 15, 0, 0xde, 0xdf, len(value))
+		for _, k := range keys {
+			writeMsgpack(buf, k)
+			if err := writeMsgpack(buf, value[k]); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("unable to encode %T as MessagePack", v)
+	}
+
+	return nil
+}
+
+func writeMsgpackUint(buf *bytes.Buffer, u uint64) {
+	switch {
+	case u <= 0x7f:
+		buf.WriteByte(byte(u))
+	case u <= math.MaxUint8:
+		buf.WriteByte(0xcc)
+		buf.WriteByte(byte(u))
+	case u <= math.MaxUint16:
+		buf.WriteByte(0xcd)
+		binary.Write(buf, binary.BigEndian, uint16(u))
+	case u <= math.MaxUint32:
+		buf.WriteByte(0xce)
+		binary.Write(buf, binary.BigEndian, uint32(u))
+	default:
+		buf.WriteByte(0xcf)
+		binary.Write(buf, binary.BigEndian, u)
+	}
+}
+
+func writeMsgpackInt(buf *bytes.Buffer, i int64) {
+	switch {
+	case i >= 0:
+		writeMsgpackUint(buf, uint64(i))
+	case i >= -32:
+		buf.WriteByte(byte(i))
+	case i >= math.MinInt8:
+		buf.WriteByte(0xd0)
+		buf.WriteByte(byte(i))
+	case i >= math.MinInt16:
+		buf.WriteByte(0xd1)
+		binary.Write(buf, binary.BigEndian, int16(i))
+	case i >= math.MinInt32:
+		buf.WriteByte(0xd2)
+		binary.Write(buf, binary.BigEndian, int32(i))
+	default:
+		buf.WriteByte(0xd3)
+		binary.Write(buf, binary.BigEndian, i)
+	}
+}
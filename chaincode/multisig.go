@@ -0,0 +1,534 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+const (
+	proposalObjType = reservedObjTypePrefix + "proposal"
+
+	proposalStatusPending  = "pending"
+	proposalStatusExecuted = "executed"
+	proposalStatusFailed   = "failed"
+)
+
+// multisigFunctions can't be proposed: a proposal must not sign or execute
+// another one.
+var multisigFunctions = map[string]bool{
+	"propose":      true,
+	"signProposal": true,
+}
+
+// proposalSigner is a certificate entitled to sign a proposal, known by the
+// SHA-256 of its DER encoding, and MSPID is the organization whose signer CAs
+// issued it.
+type proposalSigner struct {
+	Subject     string     `json:"subject"`
+	MSPID       string     `json:"mspId"`
+	Fingerprint string     `json:"fingerprint"`
+	SignedAt    *time.Time `json:"signedAt,omitempty"`
+}
+
+type proposalResponse struct {
+	Status  int32  `json:"status"`
+	Message string `json:"message,omitempty"`
+	Payload []byte `json:"payload,omitempty"`
+}
+
+// proposal is a function call held until Threshold of its Signers have
+// signed its Digest. The signature that meets the threshold executes it.
+type proposal struct {
+	ID         string           `json:"id"`
+	Function   string           `json:"function"`
+	Args       []string         `json:"args"`
+	Digest     string           `json:"digest"`
+	Threshold  int              `json:"threshold"`
+	Signers    []proposalSigner `json:"signers"`
+	Status     string           `json:"status"`
+	ProposedBy string           `json:"proposedBy"`
+	CreatedAt  time.Time        `json:"createdAt"`
+	// ExecutedAt, ExecutedTxID and Response are set once the threshold is met
+	ExecutedAt   *time.Time        `json:"executedAt,omitempty"`
+	ExecutedTxID string            `json:"executedTxId,omitempty"`
+	Response     *proposalResponse `json:"response,omitempty"`
+}
+
+// proposalDigest is what the signers of a proposal sign: the hex SHA-256 of
+// the canonical JSON of its id, function and arguments.
+func proposalDigest(p *proposal) (string, error) {
+	return canonicalHash(struct {
+		ID       string   `json:"id"`
+		Function string   `json:"function"`
+		Args     []string `json:"args"`
+	}{p.ID, p.Function, p.Args})
+}
+
+func (p *proposal) signatures() int {
+	n := 0
+	for _, s := range p.Signers {
+		if s.SignedAt != nil {
+			n++
+		}
+	}
+
+	return n
+}
+
+func proposalKey(stub shim.ChaincodeStubInterface, id string) (string, error) {
+	return stub.CreateCompositeKey(proposalObjType, []string{id})
+}
+
+func parseCertificate(certPEM string) (*x509.Certificate, error) {
+	block, _ := pem.Decode([]byte(certPEM))
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, errors.New("not a PEM-encoded certificate")
+	}
+
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// signerMSP returns the MSP whose signer CAs, set with setSignerCA, issued
+// cert, empty if none did.
+func signerMSP(stub shim.ChaincodeStubInterface, cert *x509.Certificate, now time.Time) (string, error) {
+	it, err := stub.GetStateByPartialCompositeKey(signerCAObjType, []string{})
+	if err != nil {
+		return "", err
+	}
+	defer it.Close()
+
+	for it.HasNext() {
+		response, err := it.Next()
+		if err != nil {
+			return "", err
+		}
+
+		_, attributes, err := stub.SplitCompositeKey(response.Key)
+		if err != nil {
+			return "", err
+		}
+
+		roots := x509.NewCertPool()
+		roots.AppendCertsFromPEM(response.Value)
+		opts := x509.VerifyOptions{Roots: roots, CurrentTime: now, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}}
+		if _, err := cert.Verify(opts); err == nil {
+			return attributes[0], nil
+		}
+	}
+
+	return "", nil
+}
+
+// verifySignature checks an ASN.1 ECDSA signature of digest, the way Fabric
+// identities sign, against the public key of cert.
+func verifySignature(cert *x509.Certificate, digest, signature []byte) error {
+	key, ok := cert.PublicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return fmt.Errorf("unsupported public key type %T", cert.PublicKey)
+	}
+
+	var sig struct {
+		R, S *big.Int
+	}
+	if rest, err := asn1.Unmarshal(signature, &sig); err != nil {
+		return fmt.Errorf("malformed signature: %s", err.Error())
+	} else if len(rest) != 0 {
+		return errors.New("malformed signature: trailing data")
+	}
+
+	if sig.R == nil || sig.S == nil || sig.R.Sign() <= 0 || sig.S.Sign() <= 0 {
+		return errors.New("malformed signature: non-positive values")
+	}
+
+	if !ecdsa.Verify(key, digest, sig.R, sig.S) {
+		return errors.New("the signature doesn't verify")
+	}
+
+	return nil
+}
+
+// propose holds a call to a function until threshold of the certificates in
+// signers, a JSON array of PEM certificates, have signed it with signProposal.
+// Each of them must be issued by the signer CAs of an MSP and hold a distinct
+// public key, so that one key can't count twice towards the threshold. It
+// returns the proposal, whose digest is what they sign.
+func (cc *SimpleChaincode) propose(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.propose")
+
+	if len(args) < 3 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected at least %d", len(args), 3)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	function, thresholdArg, signersArg, functionArgs := args[0], args[1], args[2], args[3:]
+	logger.Debugf("function: %s, threshold: %s, signers: %s, args: %v", function, thresholdArg, signersArg, functionArgs)
+
+	r, ok := routesByName[function]
+	if !ok {
+		message := fmt.Sprintf("unknown function name: %s", function)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	if r.readOnly || multisigFunctions[function] {
+		message := fmt.Sprintf("%s can't be proposed", function)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	var certs []string
+	if err := json.Unmarshal([]byte(signersArg), &certs); err != nil {
+		message := fmt.Sprintf("signers must be a JSON array of PEM certificates: %s", err.Error())
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	threshold, err := strconv.Atoi(thresholdArg)
+	if err != nil || threshold < 1 || threshold > len(certs) {
+		message := fmt.Sprintf("threshold must be an integer between 1 and the number of signers, %d", len(certs))
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	now, err := txTime(stub)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the transaction timestamp: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	proposedBy, err := callerID(stub)
+	if err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	p := proposal{
+		ID:         newUUID(stub),
+		Function:   function,
+		Args:       functionArgs,
+		Threshold:  threshold,
+		Signers:    make([]proposalSigner, 0, len(certs)),
+		Status:     proposalStatusPending,
+		ProposedBy: proposedBy,
+		CreatedAt:  now,
+	}
+
+	seen := map[string]bool{}
+	for i, certPEM := range certs {
+		cert, err := parseCertificate(certPEM)
+		if err != nil {
+			message := fmt.Sprintf("unable to parse the signer %d: %s", i, err.Error())
+			logger.Error(message)
+			return pb.Response{Status: 400, Message: message}
+		}
+
+		mspID, err := signerMSP(stub, cert, now)
+		if err != nil {
+			message := fmt.Sprintf("unable to verify the signer %d: %s", i, err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		if mspID == "" {
+			message := fmt.Sprintf("the certificate of the signer %d, %s, isn't issued by the signer CAs of any MSP",
+				i, cert.Subject.String())
+			logger.Error(message)
+			return pb.Response{Status: 403, Message: message}
+		}
+
+		publicKey := bytesHash(cert.RawSubjectPublicKeyInfo)
+		if seen[publicKey] {
+			message := fmt.Sprintf("the signer %d has the public key of another signer", i)
+			logger.Error(message)
+			return pb.Response{Status: 400, Message: message}
+		}
+		seen[publicKey] = true
+
+		p.Signers = append(p.Signers, proposalSigner{Subject: cert.Subject.String(), MSPID: mspID,
+			Fingerprint: bytesHash(cert.Raw)})
+	}
+
+	if p.Digest, err = proposalDigest(&p); err != nil {
+		message := fmt.Sprintf("unable to compute the digest of the proposal: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	key, err := proposalKey(stub, p.ID)
+	if err != nil {
+		message := fmt.Sprintf("unable to create a composite key: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if err := putJSON(stub, key, p); err != nil {
+		message := fmt.Sprintf("unable to put the proposal: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	result, err := json.Marshal(p)
+	if err != nil {
+		message := fmt.Sprintf("unable to marshal the result: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.propose exited successfully")
+	return shim.Success(result)
+}
+
+// signProposal adds the signature of one of the signers of a proposal: the
+// base64 ASN.1 ECDSA signature of its digest by the key of certificate. Any
+// client can submit it, the signature being the consent. The signature that
+// meets the threshold executes the proposed function in the same transaction,
+// as the identity that submits it; the function's writes are kept only if it
+// succeeds, and the proposal is marked executed or failed with its response.
+func (cc *SimpleChaincode) signProposal(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.signProposal")
+
+	if len(args) != 3 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d", len(args), 3)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	id, certPEM, signatureArg := args[0], args[1], args[2]
+	logger.Debugf("proposal: %s, signature: %s", id, signatureArg)
+
+	key, err := proposalKey(stub, id)
+	if err != nil {
+		message := fmt.Sprintf("unable to create a composite key: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	var p proposal
+	found, err := getJSON(stub, key, &p)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the proposal %s: %s", id, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if !found {
+		message := fmt.Sprintf("the proposal %s not found", id)
+		logger.Error(message)
+		return pb.Response{Status: 404, Message: message}
+	}
+
+	if p.Status != proposalStatusPending {
+		message := fmt.Sprintf("the proposal %s is already %s", id, p.Status)
+		logger.Error(message)
+		return pb.Response{Status: 409, Message: message}
+	}
+
+	cert, err := parseCertificate(certPEM)
+	if err != nil {
+		message := fmt.Sprintf("unable to parse the certificate: %s", err.Error())
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	signer := -1
+	fingerprint := bytesHash(cert.Raw)
+	for i, s := range p.Signers {
+		if s.Fingerprint == fingerprint {
+			signer = i
+			break
+		}
+	}
+
+	if signer < 0 {
+		message := fmt.Sprintf("%s is not a signer of the proposal %s", cert.Subject.String(), id)
+		logger.Error(message)
+		return pb.Response{Status: 403, Message: message}
+	}
+
+	if p.Signers[signer].SignedAt != nil {
+		message := fmt.Sprintf("%s has already signed the proposal %s", cert.Subject.String(), id)
+		logger.Error(message)
+		return pb.Response{Status: 409, Message: message}
+	}
+
+	now, err := txTime(stub)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the transaction timestamp: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+		message := fmt.Sprintf("the certificate of %s is not valid at %s", cert.Subject.String(), now.Format(time.RFC3339))
+		logger.Error(message)
+		return pb.Response{Status: 403, Message: message}
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(signatureArg)
+	if err != nil {
+		message := fmt.Sprintf("signature must be base64-encoded: %s", err.Error())
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	digest, err := hex.DecodeString(p.Digest)
+	if err != nil {
+		message := fmt.Sprintf("unable to decode the digest of the proposal %s: %s", id, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if err := verifySignature(cert, digest, signature); err != nil {
+		message := fmt.Sprintf("unable to verify the signature of %s: %s", cert.Subject.String(), err.Error())
+		logger.Error(message)
+		return pb.Response{Status: 403, Message: message}
+	}
+
+	p.Signers[signer].SignedAt = &now
+
+	if p.signatures() >= p.Threshold {
+		response, err := cc.executeProposal(stub, &p)
+		if err != nil {
+			message := fmt.Sprintf("unable to execute the proposal %s: %s", id, err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		p.Status = proposalStatusExecuted
+		if response.Status >= shim.ERRORTHRESHOLD {
+			p.Status = proposalStatusFailed
+		}
+		p.ExecutedAt, p.ExecutedTxID, response = &now, stub.GetTxID(), structuredError(response)
+		p.Response = &proposalResponse{Status: response.Status, Message: response.Message, Payload: response.Payload}
+	}
+
+	if err := putJSON(stub, key, p); err != nil {
+		message := fmt.Sprintf("unable to put the proposal: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	result, err := json.Marshal(p)
+	if err != nil {
+		message := fmt.Sprintf("unable to marshal the result: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.signProposal exited successfully")
+	return shim.Success(result)
+}
+
+// executeProposal runs the proposed function against an overlay, as simulate
+// does, and applies its writes and events only if it succeeds, so that a
+// failed function leaves nothing behind but the signatures.
+func (cc *SimpleChaincode) executeProposal(stub shim.ChaincodeStubInterface, p *proposal) (pb.Response, error) {
+	r, ok := routesByName[p.Function]
+	if !ok {
+		return pb.Response{}, fmt.Errorf("unknown function name: %s", p.Function)
+	}
+
+	overlay := &overlayStub{ChaincodeStubInterface: stub, writes: map[string][]byte{}, events: []simulatedEvent{}}
+	response := r.handlerFor(p.Args)(cc, newTxStub(overlay), p.Args)
+	if response.Status >= shim.ERRORTHRESHOLD {
+		return response, nil
+	}
+
+	keys := make([]string, 0, len(overlay.writes))
+	for key := range overlay.writes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		var err error
+		if value := overlay.writes[key]; value == nil {
+			err = stub.DelState(key)
+		} else {
+			err = stub.PutState(key, value)
+		}
+		if err != nil {
+			return pb.Response{}, err
+		}
+	}
+
+	for _, e := range overlay.events {
+		if err := stub.SetEvent(e.Name, e.Payload); err != nil {
+			return pb.Response{}, err
+		}
+	}
+
+	return response, nil
+}
+
+// getProposal returns a proposal, its signatures and, once executed, the
+// response of the proposed function.
+func (cc *SimpleChaincode) getProposal(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.getProposal")
+
+	if len(args) != 1 && len(args) != 2 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d or %d", len(args), 1, 2)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	id, format := args[0], formatJSON
+	if len(args) == 2 {
+		format = args[1]
+	}
+	logger.Debugf("id: %s, format: %s", id, format)
+
+	if err := checkFormat(format); err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	key, err := proposalKey(stub, id)
+	if err != nil {
+		message := fmt.Sprintf("unable to create a composite key: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	var p proposal
+	found, err := getJSON(stub, key, &p)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the proposal %s: %s", id, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if !found {
+		message := fmt.Sprintf("the proposal %s not found", id)
+		logger.Error(message)
+		return pb.Response{Status: 404, Message: message}
+	}
+
+	result, err := marshalResult(p, format)
+	if err != nil {
+		message := fmt.Sprintf("unable to marshal the result: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.getProposal exited successfully")
+	return shim.Success(result)
+}
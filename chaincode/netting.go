@@ -0,0 +1,298 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+const (
+	nettingObjType = reservedObjTypePrefix + "netting"
+
+	nettingStatusPending = "pending"
+)
+
+// payment is an amount one party owes another.
+type payment struct {
+	Payer    string   `json:"payer"`
+	Payee    string   `json:"payee"`
+	Currency string   `json:"currency"`
+	Amount   *decimal `json:"amount"`
+}
+
+// nettingSet is a set of obligations and the transfers that settle them all,
+// kept for the parties to execute.
+type nettingSet struct {
+	ID          string         `json:"id"`
+	TxID        string         `json:"txId"`
+	Timestamp   time.Time      `json:"timestamp"`
+	CreatedBy   string         `json:"createdBy"`
+	Status      string         `json:"status"`
+	Obligations []payment      `json:"obligations"`
+	Positions   []*netPosition `json:"positions"`
+	Transfers   []payment      `json:"transfers"`
+}
+
+// netPositions sums payments into what each party receives or pays per
+// currency, ordered by party and currency.
+func netPositions(payments []payment) []*netPosition {
+	positions := map[string]*netPosition{}
+	for _, p := range payments {
+		for _, party := range []string{p.Payer, p.Payee} {
+			key := party + "\x00" + p.Currency
+			if positions[key] == nil {
+				positions[key] = &netPosition{
+					Participant: party,
+					Currency:    p.Currency,
+					Net:         newDecimal(0, currencyScale(p.Currency)),
+				}
+			}
+
+			if party == p.Payer {
+				positions[key].Net.sub(p.Amount)
+			} else {
+				positions[key].Net.add(p.Amount)
+			}
+		}
+	}
+
+	keys := make([]string, 0, len(positions))
+	for key := range positions {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	sorted := make([]*netPosition, 0, len(keys))
+	for _, key := range keys {
+		sorted = append(sorted, positions[key])
+	}
+	return sorted
+}
+
+// netTransfers settles net positions with at most one transfer less than the
+// parties of each currency: it repeatedly has the largest payer pay the
+// largest payee, the smaller of the two amounts, with ties broken by party
+// so that every endorser comes up with the same transfers.
+func netTransfers(positions []*netPosition) []payment {
+	payers, payees := map[string][]*netPosition{}, map[string][]*netPosition{}
+	currencies := []string{}
+	for _, p := range positions {
+		if _, ok := payers[p.Currency]; !ok {
+			currencies = append(currencies, p.Currency)
+			payers[p.Currency], payees[p.Currency] = []*netPosition{}, []*netPosition{}
+		}
+
+		// work on copies, the positions are part of the result too
+		remaining := &netPosition{Participant: p.Participant, Currency: p.Currency, Net: &decimal{}}
+		switch p.Net.Sign() {
+		case -1:
+			remaining.Net.sub(p.Net)
+			payers[p.Currency] = append(payers[p.Currency], remaining)
+		case 1:
+			remaining.Net.add(p.Net)
+			payees[p.Currency] = append(payees[p.Currency], remaining)
+		}
+	}
+	sort.Strings(currencies)
+
+	largestFirst := func(parties []*netPosition) {
+		sort.Slice(parties, func(i, j int) bool {
+			if c := parties[i].Net.cmp(parties[j].Net); c != 0 {
+				return c > 0
+			}
+			return parties[i].Participant < parties[j].Participant
+		})
+	}
+
+	transfers := []payment{}
+	for _, currency := range currencies {
+		from, to := payers[currency], payees[currency]
+		for len(from) > 0 && len(to) > 0 {
+			largestFirst(from)
+			largestFirst(to)
+
+			amount := from[0].Net
+			if to[0].Net.cmp(amount) < 0 {
+				amount = to[0].Net
+			}
+
+			transferred := &decimal{}
+			transferred.add(amount)
+			transfers = append(transfers, payment{
+				Payer:    from[0].Participant,
+				Payee:    to[0].Participant,
+				Currency: currency,
+				Amount:   transferred,
+			})
+
+			from[0].Net.sub(transferred)
+			to[0].Net.sub(transferred)
+			if from[0].Net.Sign() == 0 {
+				from = from[1:]
+			}
+			if to[0].Net.Sign() == 0 {
+				to = to[1:]
+			}
+		}
+	}
+
+	return transfers
+}
+
+// netObligations computes the transfers that settle a set of obligations,
+// passed as a JSON array of payments, and records them as a pending netting
+// set.
+func (cc *SimpleChaincode) netObligations(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.netObligations")
+
+	if len(args) != 1 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d", len(args), 1)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	obligationsArg := args[0]
+	logger.Debugf("obligations: %s", obligationsArg)
+
+	var obligations []payment
+	if err := json.Unmarshal([]byte(obligationsArg), &obligations); err != nil {
+		message := fmt.Sprintf("obligations must be a JSON array of {payer, payee, currency, amount}: %s", err.Error())
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	if len(obligations) == 0 || len(obligations) > maxPageSize {
+		message := fmt.Sprintf("the number of obligations must be in [1, %d], got %d", maxPageSize, len(obligations))
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	for i, o := range obligations {
+		if o.Amount == nil {
+			message := fmt.Sprintf("the obligation %d has no amount", i)
+			logger.Error(message)
+			return pb.Response{Status: 400, Message: message}
+		}
+
+		m, err := parseMoney(o.Currency, o.Amount.String())
+		if err != nil {
+			message := fmt.Sprintf("the obligation %d is invalid: %s", i, err.Error())
+			logger.Error(message)
+			return pb.Response{Status: 400, Message: message}
+		}
+
+		if o.Payer == "" || o.Payee == "" || o.Payer == o.Payee {
+			message := fmt.Sprintf("the obligation %d must be between two different parties", i)
+			logger.Error(message)
+			return pb.Response{Status: 400, Message: message}
+		}
+		obligations[i].Amount = m.Amount
+	}
+
+	createdBy, err := callerMSPID(stub)
+	if err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	now, err := txTime(stub)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the transaction timestamp: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	positions := netPositions(obligations)
+	set := nettingSet{
+		ID:          newUUID(stub),
+		TxID:        stub.GetTxID(),
+		Timestamp:   now,
+		CreatedBy:   createdBy,
+		Status:      nettingStatusPending,
+		Obligations: obligations,
+		Positions:   positions,
+		Transfers:   netTransfers(positions),
+	}
+
+	nettingKey, err := stub.CreateCompositeKey(nettingObjType, []string{set.ID})
+	if err != nil {
+		message := fmt.Sprintf("unable to create a composite key: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if err := putJSON(stub, nettingKey, set); err != nil {
+		message := fmt.Sprintf("unable to put the netting set: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	result, err := json.Marshal(set)
+	if err != nil {
+		message := fmt.Sprintf("unable to marshal the result: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.netObligations exited successfully")
+	return shim.Success(result)
+}
+
+// getNetting returns a netting set.
+func (cc *SimpleChaincode) getNetting(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.getNetting")
+
+	if len(args) != 1 && len(args) != 2 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d or %d", len(args), 1, 2)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	id, format := args[0], formatJSON
+	if len(args) == 2 {
+		format = args[1]
+	}
+	logger.Debugf("id: %s, format: %s", id, format)
+
+	if err := checkFormat(format); err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	nettingKey, err := stub.CreateCompositeKey(nettingObjType, []string{id})
+	if err != nil {
+		message := fmt.Sprintf("unable to create a composite key: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	var set nettingSet
+	found, err := getJSON(stub, nettingKey, &set)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the netting set %s: %s", id, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if !found {
+		message := fmt.Sprintf("the netting set %s not found", id)
+		logger.Error(message)
+		return pb.Response{Status: 404, Message: message}
+	}
+
+	result, err := marshalResult(&set, format)
+	if err != nil {
+		message := fmt.Sprintf("unable to marshal the result: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.getNetting exited successfully")
+	return shim.Success(result)
+}
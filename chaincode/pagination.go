@@ -0,0 +1,239 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// errPaginationUnsupported is the error of a paginated query that got no
+// iterator and no error either, as from stubs without paginated queries, e.g.
+// the MockStub of Fabric 1.4.
+var errPaginationUnsupported = errors.New("paginated queries aren't supported")
+
+// queryPage is a page of records along with the bookmark to pass to get the
+// next one, empty after the last page.
+type queryPage struct {
+	Records             queryResults `json:"records"`
+	Bookmark            string       `json:"bookmark"`
+	FetchedRecordsCount int32        `json:"fetchedRecordsCount"`
+}
+
+func (page queryPage) ndjsonLines() []interface{} {
+	lines := make([]interface{}, 0, len(page.Records)+1)
+	for _, entry := range page.Records {
+		lines = append(lines, entry)
+	}
+
+	return append(lines, ndjsonCursor{bookmarkCursor{page.Bookmark, page.FetchedRecordsCount}})
+}
+
+func (page queryPage) document() (interface{}, error) {
+	records, err := page.Records.document()
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"records":             records,
+		"bookmark":            page.Bookmark,
+		"fetchedRecordsCount": page.FetchedRecordsCount,
+	}, nil
+}
+
+func (page queryPage) protoMessage() (proto.Message, error) {
+	m, err := page.Records.protoMessage()
+	if err != nil {
+		return nil, err
+	}
+
+	results := m.(*QueryResults)
+	results.Bookmark, results.FetchedRecordsCount = page.Bookmark, page.FetchedRecordsCount
+	return results, nil
+}
+
+func parsePageSize(pageSizeArg string) (int32, error) {
+	pageSize, err := strconv.ParseInt(pageSizeArg, 10, 32)
+	if err != nil || pageSize < 1 || pageSize > maxPageSize {
+		return 0, fmt.Errorf("page size must be an integer in [1, %d], got \"%s\"", maxPageSize, pageSizeArg)
+	}
+
+	return int32(pageSize), nil
+}
+
+// readPage reads the records of a page, leaving out the chaincode's
+// bookkeeping, which rich queries can match.
+func readPage(stub shim.ChaincodeStubInterface, it shim.StateQueryIteratorInterface, metadata *pb.QueryResponseMetadata,
+	now time.Time) (*queryPage, error) {
+	page := &queryPage{Records: queryResults{}}
+	if metadata != nil {
+		page.Bookmark, page.FetchedRecordsCount = metadata.Bookmark, metadata.FetchedRecordsCount
+	}
+
+	for it.HasNext() {
+		response, err := it.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		if isReservedKey(stub, response.Key) {
+			continue
+		}
+
+		r := decodeRecord(response.Value)
+		if err := r.verify(); err != nil {
+			return nil, fmt.Errorf("the value for the key %s: %s", response.Key, err.Error())
+		}
+
+		page.Records = append(page.Records, queryResult{Key: response.Key, record: r.readableAt(now)})
+	}
+
+	return page, nil
+}
+
+// getByRangeWithPagination is getByRange a page at a time, for ranges too
+// large for a single response.
+func (cc *SimpleChaincode) getByRangeWithPagination(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.getByRangeWithPagination")
+
+	if len(args) != 4 && len(args) != 5 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d or %d", len(args), 4, 5)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	keyFrom, keyTo, pageSizeArg, bookmark, format := args[0], args[1], args[2], args[3], formatJSON
+	if len(args) == 5 {
+		format = args[4]
+	}
+	logger.Debugf("range: [\"%s\", \"%s\"), pageSize: %s, bookmark: %s, format: %s",
+		keyFrom, keyTo, pageSizeArg, bookmark, format)
+
+	if err := checkFormat(format); err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	pageSize, err := parsePageSize(pageSizeArg)
+	if err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	now, err := txTime(stub)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the transaction timestamp: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	it, metadata, err := stub.GetStateByRangeWithPagination(keyFrom, keyTo, pageSize, bookmark)
+	if err == nil && it == nil {
+		err = errPaginationUnsupported
+	}
+	if err != nil {
+		message := fmt.Sprintf("unable to get an iterator over the range [\"%s\", \"%s\"): %s",
+			keyFrom, keyTo, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+	defer it.Close()
+
+	page, err := readPage(stub, it, metadata, now)
+	if err != nil {
+		message := fmt.Sprintf("unable to read the page: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	result, err := marshalResult(*page, format)
+	if err != nil {
+		message := fmt.Sprintf("unable to marshal the result: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.getByRangeWithPagination exited successfully")
+	return shim.Success(result)
+}
+
+// queryWithPagination is query a page at a time. Pages can come out shorter
+// than the page size, as the chaincode's bookkeeping is left out of them;
+// fetchedRecordsCount counts it in.
+func (cc *SimpleChaincode) queryWithPagination(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.queryWithPagination")
+
+	if len(args) != 3 && len(args) != 4 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d or %d", len(args), 3, 4)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	selectorArg, pageSizeArg, bookmark, format := args[0], args[1], args[2], formatJSON
+	if len(args) == 4 {
+		format = args[3]
+	}
+	logger.Debugf("selector: %s, pageSize: %s, bookmark: %s, format: %s", selectorArg, pageSizeArg, bookmark, format)
+
+	if err := checkFormat(format); err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	pageSize, err := parsePageSize(pageSizeArg)
+	if err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	q, err := richQuery(selectorArg)
+	if err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	now, err := txTime(stub)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the transaction timestamp: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	it, metadata, err := stub.GetQueryResultWithPagination(q, pageSize, bookmark)
+	if err == nil && it == nil {
+		err = errPaginationUnsupported
+	}
+	if err != nil {
+		message := fmt.Sprintf("unable to run the query %s: %s", q, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+	defer it.Close()
+
+	page, err := readPage(stub, it, metadata, now)
+	if err != nil {
+		message := fmt.Sprintf("unable to read the page: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	result, err := marshalResult(*page, format)
+	if err != nil {
+		message := fmt.Sprintf("unable to marshal the result: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.queryWithPagination exited successfully")
+	return shim.Success(result)
+}
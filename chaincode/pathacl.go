@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// pathACLObjType is the config namespace of the ACLs of the key tree, under
+// the segments of their prefix, the way treeObjType holds the nodes.
+const pathACLObjType = reservedObjTypePrefix + "pathacl"
+
+// pathACL restricts the writes under Prefix, the path itself included, to
+// the members of the organizations of MSPIDs. The ACL of the longest prefix
+// of a path applies to it, so a subtree can be opened to an organization its
+// parent is closed to, or the other way round; paths under no ACL are open.
+type pathACL struct {
+	Prefix string   `json:"prefix"`
+	MSPIDs []string `json:"mspIds"`
+}
+
+func (acl *pathACL) allows(mspID string) bool {
+	for _, allowed := range acl.MSPIDs {
+		if allowed == mspID {
+			return true
+		}
+	}
+
+	return false
+}
+
+func pathACLKey(stub shim.ChaincodeStubInterface, segments []string) (string, error) {
+	return stub.CreateCompositeKey(pathACLObjType, segments)
+}
+
+// effectivePathACL returns the ACL that applies to path, nil if none does.
+func effectivePathACL(stub shim.ChaincodeStubInterface, path string) (*pathACL, error) {
+	segments, err := splitPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := len(segments); i >= 0; i-- {
+		key, err := pathACLKey(stub, segments[:i])
+		if err != nil {
+			return nil, err
+		}
+
+		var acl pathACL
+		found, err := getJSON(stub, key, &acl)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			return &acl, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// pathWriteDenied checks the caller's organization against the ACL of path.
+// If it isn't allowed to write under it, or it can't be told, it returns the
+// response to fail with.
+func pathWriteDenied(stub shim.ChaincodeStubInterface, path string) (pb.Response, bool) {
+	acl, err := effectivePathACL(stub, path)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the ACL of the path %s: %s", path, err.Error())
+		logger.Error(message)
+		return shim.Error(message), true
+	}
+
+	if acl == nil {
+		return pb.Response{}, false
+	}
+
+	mspID, err := callerMSPID(stub)
+	if err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return shim.Error(message), true
+	}
+
+	if !acl.allows(mspID) {
+		message := fmt.Sprintf("the organization %s isn't allowed to write under \"%s\"", mspID, acl.Prefix)
+		logger.Error(message)
+		return pb.Response{Status: 403, Message: message}, true
+	}
+
+	return pb.Response{}, false
+}
+
+// setPathACL sets the organizations allowed to write under a prefix, the root
+// if it's empty, as a JSON array of MSP ids. An empty array lifts the ACL of
+// the prefix, so that the ACL of its parent applies. Only admins set ACLs.
+func (cc *SimpleChaincode) setPathACL(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.setPathACL")
+
+	if len(args) != 2 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d", len(args), 2)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	prefix, mspIDsArg := args[0], args[1]
+	logger.Debugf("prefix: %s, MSP ids: %s", prefix, mspIDsArg)
+
+	if err := requireAdmin(stub); err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 403, Message: message}
+	}
+
+	segments, err := splitPath(prefix)
+	if err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	var mspIDs []string
+	if err := json.Unmarshal([]byte(mspIDsArg), &mspIDs); err != nil {
+		message := fmt.Sprintf("mspIds must be a JSON array of strings: %s", err.Error())
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	for _, mspID := range mspIDs {
+		if strings.TrimSpace(mspID) == "" {
+			message := "MSP ids must be non-empty strings"
+			logger.Error(message)
+			return pb.Response{Status: 400, Message: message}
+		}
+	}
+
+	key, err := pathACLKey(stub, segments)
+	if err != nil {
+		message := fmt.Sprintf("unable to create a composite key: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if len(mspIDs) == 0 {
+		err = stub.DelState(key)
+	} else {
+		err = putJSON(stub, key, pathACL{Prefix: strings.Join(segments, pathSeparator), MSPIDs: mspIDs})
+	}
+	if err != nil {
+		message := fmt.Sprintf("unable to put the ACL of the prefix %s: %s", prefix, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.setPathACL exited successfully")
+	return shim.Success(nil)
+}
+
+// getPathACL returns the ACL that applies to a path.
+func (cc *SimpleChaincode) getPathACL(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.getPathACL")
+
+	if len(args) != 1 && len(args) != 2 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d or %d", len(args), 1, 2)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	path, format := args[0], formatJSON
+	if len(args) == 2 {
+		format = args[1]
+	}
+	logger.Debugf("path: %s, format: %s", path, format)
+
+	if err := checkFormat(format); err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	if _, err := splitPath(path); err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	acl, err := effectivePathACL(stub, path)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the ACL of the path %s: %s", path, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if acl == nil {
+		message := fmt.Sprintf("no ACL applies to the path %s", path)
+		logger.Error(message)
+		return pb.Response{Status: 404, Message: message}
+	}
+
+	result, err := marshalResult(acl, format)
+	if err != nil {
+		message := fmt.Sprintf("unable to marshal the result: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.getPathACL exited successfully")
+	return shim.Success(result)
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+const (
+	linkObjType        = reservedObjTypePrefix + "link"
+	reverseLinkObjType = reservedObjTypePrefix + "linkrev"
+
+	maxProvenanceDepth = 16
+)
+
+// provenanceGraph is the part of the link graph upstream of Root. Nodes are
+// keyed by record reference; a nil node is a link target that no longer exists.
+type provenanceGraph struct {
+	Root  string             `json:"root"`
+	Nodes map[string]*record `json:"nodes"`
+	Edges []provenanceEdge   `json:"edges"`
+}
+
+type provenanceEdge struct {
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Relation string `json:"relation"`
+}
+
+// recordRefKey turns a record reference of the form "objType:key" (or just
+// "key" for untyped records) into the record's state key.
+func recordRefKey(stub shim.ChaincodeStubInterface, ref string) (string, error) {
+	objType, key := "", ref
+	if i := strings.Index(ref, ":"); i >= 0 {
+		objType, key = ref[:i], ref[i+1:]
+	}
+
+	return createCompositeKey(stub, objType, key)
+}
+
+func (cc *SimpleChaincode) linkRecords(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.linkRecords")
+
+	if len(args) != 3 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d", len(args), 3)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	from, to, relation := args[0], args[1], args[2]
+	logger.Debugf("from: %s, to: %s, relation: %s", from, to, relation)
+
+	if relation == "" {
+		message := "relation must be a non-empty string"
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	for _, ref := range []string{from, to} {
+		refKey, err := recordRefKey(stub, ref)
+		if err != nil {
+			message := fmt.Sprintf("unable to create a composite key for %s: %s", ref, err.Error())
+			logger.Error(message)
+			return pb.Response{Status: 400, Message: message}
+		}
+
+		valueBytes, err := stub.GetState(refKey)
+		if err != nil {
+			message := fmt.Sprintf("unable to get a value for the key %s: %s", ref, err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		if valueBytes == nil {
+			message := fmt.Sprintf("a value for the key %s not found", ref)
+			logger.Error(message)
+			return pb.Response{Status: 404, Message: message}
+		}
+	}
+
+	linkKey, err := stub.CreateCompositeKey(linkObjType, []string{from, relation, to})
+	if err != nil {
+		message := fmt.Sprintf("unable to create a composite key: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	reverseLinkKey, err := stub.CreateCompositeKey(reverseLinkObjType, []string{to, relation, from})
+	if err != nil {
+		message := fmt.Sprintf("unable to create a composite key: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	for _, k := range []string{linkKey, reverseLinkKey} {
+		if err := stub.PutState(k, presenceMarker); err != nil {
+			message := fmt.Sprintf("unable to put the link: %s", err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+	}
+
+	logger.Info("SimpleChaincode.linkRecords exited successfully")
+	return shim.Success(nil)
+}
+
+func (cc *SimpleChaincode) provenance(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.provenance")
+
+	if len(args) != 2 && len(args) != 3 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d or %d", len(args), 2, 3)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	root, depthArg, format := args[0], args[1], formatJSON
+	if len(args) == 3 {
+		format = args[2]
+	}
+	logger.Debugf("key: %s, depth: %s, format: %s", root, depthArg, format)
+
+	if err := checkFormat(format); err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	depth, err := strconv.Atoi(depthArg)
+	if err != nil || depth < 1 || depth > maxProvenanceDepth {
+		message := fmt.Sprintf("depth must be an integer in [1, %d], got \"%s\"", maxProvenanceDepth, depthArg)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	graph := provenanceGraph{
+		Root:  root,
+		Nodes: map[string]*record{},
+		Edges: []provenanceEdge{},
+	}
+
+	now, err := txTime(stub)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the transaction timestamp: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	// breadth-first walk against the direction of the links, i.e. from a
+	// record to the records it was derived from
+	level := []string{root}
+	for d := 0; d <= depth && len(level) > 0; d++ {
+		var next []string
+		for _, ref := range level {
+			if _, visited := graph.Nodes[ref]; visited {
+				continue
+			}
+
+			refKey, err := recordRefKey(stub, ref)
+			if err != nil {
+				message := fmt.Sprintf("unable to create a composite key for %s: %s", ref, err.Error())
+				logger.Error(message)
+				return pb.Response{Status: 400, Message: message}
+			}
+
+			r, err := getRecord(stub, refKey)
+			if err != nil {
+				message := fmt.Sprintf("unable to get a value for the key %s: %s", ref, err.Error())
+				logger.Error(message)
+				return shim.Error(message)
+			}
+			if r != nil {
+				r = r.readableAt(now)
+			}
+			graph.Nodes[ref] = r
+
+			if d == depth {
+				continue
+			}
+
+			sources, err := linkedFrom(stub, ref)
+			if err != nil {
+				message := fmt.Sprintf("unable to get the links of %s: %s", ref, err.Error())
+				logger.Error(message)
+				return shim.Error(message)
+			}
+
+			graph.Edges = append(graph.Edges, sources...)
+			for _, edge := range sources {
+				next = append(next, edge.From)
+			}
+		}
+		level = next
+	}
+
+	if graph.Nodes[root] == nil {
+		message := fmt.Sprintf("a value for the key %s not found", root)
+		logger.Error(message)
+		return pb.Response{Status: 404, Message: message}
+	}
+
+	result, err := marshalResult(graph, format)
+	if err != nil {
+		message := fmt.Sprintf("unable to marshal the result: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.provenance exited successfully")
+	return shim.Success(result)
+}
+
+// linkedFrom returns the links pointing to the record referenced by ref.
+func linkedFrom(stub shim.ChaincodeStubInterface, ref string) ([]provenanceEdge, error) {
+	it, err := stub.GetStateByPartialCompositeKey(reverseLinkObjType, []string{ref})
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+
+	var edges []provenanceEdge
+	for it.HasNext() {
+		response, err := it.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		_, attributes, err := stub.SplitCompositeKey(response.Key)
+		if err != nil {
+			return nil, err
+		}
+
+		edges = append(edges, provenanceEdge{From: attributes[2], To: attributes[0], Relation: attributes[1]})
+	}
+
+	return edges, nil
+}
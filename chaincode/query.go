@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// compositeKeyNamespace starts every composite key, and no simple one.
+const compositeKeyNamespace = "\x00"
+
+func isCompositeKey(key string) bool {
+	return strings.HasPrefix(key, compositeKeyNamespace)
+}
+
+// isReservedKey reports whether key belongs to the chaincode's bookkeeping.
+func isReservedKey(stub shim.ChaincodeStubInterface, key string) bool {
+	if !isCompositeKey(key) {
+		return false
+	}
+
+	objType, _, err := stub.SplitCompositeKey(key)
+	return err != nil || strings.HasPrefix(objType, reservedObjTypePrefix)
+}
+
+// richQuery turns a selector into a CouchDB query, leaving a full query, one
+// with a selector field, as is.
+func richQuery(selectorArg string) (string, error) {
+	var selector map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(selectorArg), &selector); err != nil {
+		return "", fmt.Errorf("selector must be a JSON object: %s", err.Error())
+	}
+
+	if _, ok := selector["selector"]; ok {
+		return selectorArg, nil
+	}
+
+	query, err := json.Marshal(map[string]json.RawMessage{"selector": json.RawMessage(selectorArg)})
+	if err != nil {
+		return "", err
+	}
+
+	return string(query), nil
+}
+
+// query returns the records a CouchDB selector matches, in the shape of
+// getByRange. The fields of JSON values are under doc, e.g.
+// {"doc.owner": "alice"}; the other fields of a record, e.g. updatedAt, can be
+// selected on too. The chaincode's own bookkeeping is left out of the results.
+// It needs CouchDB as the state database.
+func (cc *SimpleChaincode) query(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.query")
+
+	if len(args) != 1 && len(args) != 2 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d or %d", len(args), 1, 2)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	selectorArg, format := args[0], formatJSON
+	if len(args) == 2 {
+		format = args[1]
+	}
+	logger.Debugf("selector: %s, format: %s", selectorArg, format)
+
+	if err := checkFormat(format); err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	q, err := richQuery(selectorArg)
+	if err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	now, err := txTime(stub)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the transaction timestamp: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	it, err := stub.GetQueryResult(q)
+	if err != nil {
+		message := fmt.Sprintf("unable to run the query %s: %s", q, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+	defer it.Close()
+
+	var entries = queryResults{}
+	for it.HasNext() {
+		response, err := it.Next()
+		if err != nil {
+			message := fmt.Sprintf("unable to get the next element: %s", err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		if isReservedKey(stub, response.Key) {
+			continue
+		}
+
+		r := decodeRecord(response.Value)
+		if err := r.verify(); err != nil {
+			message := fmt.Sprintf("unable to get a value for the key %s: %s", response.Key, err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		entries = append(entries, queryResult{Key: response.Key, record: r.readableAt(now)})
+	}
+
+	result, err := marshalResult(entries, format)
+	if err != nil {
+		message := fmt.Sprintf("unable to marshal the result: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.query exited successfully")
+	return shim.Success(result)
+}
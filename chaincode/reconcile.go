@@ -0,0 +1,207 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// obligation sums what two organizations owe each other in a currency. A
+// transfer from an account of one organization to an account of the other
+// makes the first owe the amount to the second, as its account holder was
+// paid out of the second's books.
+type obligation struct {
+	Currency  string   `json:"currency"`
+	AToB      *decimal `json:"aToB"`
+	BToA      *decimal `json:"bToA"`
+	Transfers int      `json:"transfers"`
+	// Net is AToB - BToA, which Payer pays Payee to settle; both are empty
+	// when the obligations cancel out
+	Net   *decimal `json:"net"`
+	Payer string   `json:"payer,omitempty"`
+	Payee string   `json:"payee,omitempty"`
+}
+
+type settlementSummary struct {
+	OrgA        string        `json:"orgA"`
+	OrgB        string        `json:"orgB"`
+	From        time.Time     `json:"from"`
+	To          time.Time     `json:"to"`
+	Obligations []*obligation `json:"obligations"`
+}
+
+// accountOrgs looks up the organizations of accounts, once per account.
+type accountOrgs map[string]string
+
+// orgOf returns the organization of an account, empty for the system
+// accounts, unknown accounts and the accounts opened before organizations
+// were recorded.
+func (orgs accountOrgs) orgOf(stub shim.ChaincodeStubInterface, id string) (string, error) {
+	if org, ok := orgs[id]; ok {
+		return org, nil
+	}
+
+	org := ""
+	if !strings.HasPrefix(id, systemAccountPrefix) {
+		a, err := getAccount(stub, id)
+		if err != nil {
+			return "", err
+		}
+		if a != nil {
+			org = a.Org
+		}
+	}
+
+	orgs[id] = org
+	return org, nil
+}
+
+// reconcile nets the transfers between the accounts of two organizations over
+// a period into what one has to pay the other in each currency.
+func (cc *SimpleChaincode) reconcile(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.reconcile")
+
+	if len(args) != 3 && len(args) != 4 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d or %d", len(args), 3, 4)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	orgA, orgB, period, format := args[0], args[1], args[2], formatJSON
+	if len(args) == 4 {
+		format = args[3]
+	}
+	logger.Debugf("orgA: %s, orgB: %s, period: %s, format: %s", orgA, orgB, period, format)
+
+	if orgA == "" || orgB == "" || orgA == orgB {
+		message := "reconcile takes two different organizations"
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	from, to, err := parsePeriod(period)
+	if err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	if err := checkFormat(format); err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	it, err := stub.GetStateByPartialCompositeKey(journalObjType, []string{})
+	if err != nil {
+		message := fmt.Sprintf("unable to get an iterator over the journal: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+	defer it.Close()
+
+	orgs := accountOrgs{}
+	obligations := map[string]*obligation{}
+	for it.HasNext() {
+		response, err := it.Next()
+		if err != nil {
+			message := fmt.Sprintf("unable to get the next element: %s", err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		var entry journalEntry
+		if err := json.Unmarshal(response.Value, &entry); err != nil {
+			message := fmt.Sprintf("unable to unmarshal the journal entry: %s", err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		// the journal is keyed by transaction, not by time
+		if entry.Timestamp.Before(from) || !entry.Timestamp.Before(to) {
+			continue
+		}
+
+		// only transfers, debiting the payee and crediting the payer, are
+		// between accounts
+		if len(entry.Lines) != 2 || entry.Lines[0].Currency != entry.Lines[1].Currency {
+			continue
+		}
+
+		payee, payer := entry.Lines[0], entry.Lines[1]
+		if payee.Amount.Sign() < 0 {
+			payee, payer = payer, payee
+		}
+
+		payerOrg, err := orgs.orgOf(stub, payer.Account)
+		if err != nil {
+			message := fmt.Sprintf("unable to get the account %s: %s", payer.Account, err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		payeeOrg, err := orgs.orgOf(stub, payee.Account)
+		if err != nil {
+			message := fmt.Sprintf("unable to get the account %s: %s", payee.Account, err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		aToB := payerOrg == orgA && payeeOrg == orgB
+		if !aToB && !(payerOrg == orgB && payeeOrg == orgA) {
+			continue
+		}
+
+		o := obligations[payee.Currency]
+		if o == nil {
+			scale := currencyScale(payee.Currency)
+			o = &obligation{Currency: payee.Currency, AToB: newDecimal(0, scale), BToA: newDecimal(0, scale)}
+			obligations[payee.Currency] = o
+		}
+
+		if aToB {
+			o.AToB.add(payee.Amount)
+		} else {
+			o.BToA.add(payee.Amount)
+		}
+		o.Transfers++
+	}
+
+	summary := settlementSummary{OrgA: orgA, OrgB: orgB, From: from, To: to, Obligations: []*obligation{}}
+
+	currencies := make([]string, 0, len(obligations))
+	for currency := range obligations {
+		currencies = append(currencies, currency)
+	}
+	sort.Strings(currencies)
+
+	for _, currency := range currencies {
+		o := obligations[currency]
+		o.Net = &decimal{}
+		o.Net.add(o.AToB)
+		o.Net.sub(o.BToA)
+
+		switch o.Net.Sign() {
+		case 1:
+			o.Payer, o.Payee = orgA, orgB
+		case -1:
+			o.Payer, o.Payee = orgB, orgA
+		}
+		summary.Obligations = append(summary.Obligations, o)
+	}
+
+	result, err := marshalResult(summary, format)
+	if err != nil {
+		message := fmt.Sprintf("unable to marshal the result: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.reconcile exited successfully")
+	return shim.Success(result)
+}
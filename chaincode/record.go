@@ -0,0 +1,257 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// record is the envelope every value is stored in. The timestamps come from
+// the transaction proposal rather than from the clients' local clocks, so all
+// endorsers compute the same envelope.
+type record struct {
+	Value      string     `json:"value"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	UpdatedAt  time.Time  `json:"updatedAt"`
+	ArchivedAt *time.Time `json:"archivedAt,omitempty"`
+
+	// UnlockAt and ExpiresAt bound when the value can be read, see lockedAt
+	// and expiredAt.
+	UnlockAt  *time.Time `json:"unlockAt,omitempty"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+
+	// Version counts the writes of the record, so that a client can make a
+	// write conditional on the version it read, see transferConditional.
+	Version uint64 `json:"version,omitempty"`
+
+	// TxID and Creator tell which transaction, submitted by whom, wrote the
+	// record; UpdatedAt is its timestamp. Records written before they were
+	// introduced have neither.
+	TxID    string   `json:"txId,omitempty"`
+	Creator *creator `json:"creator,omitempty"`
+
+	// DeletedAt and DeletedBy mark a record deleted in the tombstone delete
+	// mode of its object type, see removeRecord.
+	DeletedAt *time.Time `json:"deletedAt,omitempty"`
+	DeletedBy *creator   `json:"deletedBy,omitempty"`
+
+	// ContentType tells how to interpret the value, Encoding is set for
+	// values that aren't kept as is, e.g. binary values are kept
+	// base64-encoded. Checksum is the hash of the decoded value, see
+	// documentHash, and Size its length in bytes.
+	ContentType string `json:"contentType,omitempty"`
+	Encoding    string `json:"encoding,omitempty"`
+	Checksum    string `json:"checksum,omitempty"`
+	Size        int    `json:"size,omitempty"`
+}
+
+const (
+	jsonContentType = "application/json"
+	textContentType = "text/plain; charset=utf-8"
+)
+
+// rawValue returns the value of r with its encoding undone.
+func (r *record) rawValue() ([]byte, error) {
+	if r.Encoding == base64Encoding {
+		return base64.StdEncoding.DecodeString(r.Value)
+	}
+
+	return []byte(r.Value), nil
+}
+
+// describe fills in the metadata of r. Values stored without a content type
+// are JSON if they parse as such and text otherwise.
+func (r *record) describe() error {
+	raw, err := r.rawValue()
+	if err != nil {
+		return err
+	}
+
+	if r.ContentType == "" {
+		r.ContentType = textContentType
+		if json.Valid(raw) {
+			r.ContentType = jsonContentType
+		}
+	}
+
+	r.Checksum, _ = documentHash(raw, r.ContentType)
+	r.Size = len(raw)
+	return nil
+}
+
+// txTime returns the timestamp of the current transaction in UTC.
+func txTime(stub shim.ChaincodeStubInterface) (time.Time, error) {
+	ts, err := stub.GetTxTimestamp()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	t, err := ptypes.Timestamp(ts)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return t.UTC(), nil
+}
+
+// decodeRecord unwraps a stored value. Values written before the envelope was
+// introduced are returned as is with zero timestamps.
+func decodeRecord(valueBytes []byte) *record {
+	var r record
+	if err := json.Unmarshal(valueBytes, &r); err != nil || r.UpdatedAt.IsZero() {
+		return &record{Value: string(valueBytes)}
+	}
+
+	return &r
+}
+
+// verify checks r against its checksum and size, so values changed in the
+// state database behind the chaincode's back, e.g. edited in CouchDB, are
+// reported rather than returned. Records stored before checksums were
+// introduced pass as is.
+func (r *record) verify() error {
+	if r.Checksum == "" {
+		return nil
+	}
+
+	raw, err := r.rawValue()
+	if err != nil {
+		return fmt.Errorf("integrity check failed: %s", err.Error())
+	}
+
+	if checksum, _ := documentHash(raw, r.ContentType); checksum != r.Checksum || len(raw) != r.Size {
+		return errors.New("integrity check failed: the value doesn't match its checksum")
+	}
+
+	return nil
+}
+
+// getRecord returns the record stored under compositeKey or nil if there is
+// none. It fails if the record doesn't pass its integrity check.
+func getRecord(stub shim.ChaincodeStubInterface, compositeKey string) (*record, error) {
+	r, err := readRecord(stub, compositeKey)
+	if err != nil || r == nil {
+		return nil, err
+	}
+
+	if err := r.verify(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// readRecord is getRecord without the integrity check, for writes that
+// replace the record, which is how a corrupted one gets repaired.
+func readRecord(stub shim.ChaincodeStubInterface, compositeKey string) (*record, error) {
+	valueBytes, err := stub.GetState(compositeKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if valueBytes == nil {
+		return nil, nil
+	}
+
+	return decodeRecord(valueBytes), nil
+}
+
+// putRecord stores value under compositeKey, keeping the creation time of the
+// record it replaces.
+func putRecord(stub shim.ChaincodeStubInterface, compositeKey, value string) (*record, error) {
+	r, err := newRecordVersion(stub, compositeKey, value)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := storeRecord(stub, compositeKey, r); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// newRecordVersion returns the record that replaces the one stored under
+// compositeKey when value is put, without storing it.
+func newRecordVersion(stub shim.ChaincodeStubInterface, compositeKey, value string) (*record, error) {
+	now, err := txTime(stub)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := txCreator(stub)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := readRecord(stub, compositeKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if r == nil {
+		return &record{Value: value, CreatedAt: now, UpdatedAt: now, Version: 1, TxID: stub.GetTxID(), Creator: c}, nil
+	}
+
+	createdAt := r.CreatedAt
+	if createdAt.IsZero() {
+		createdAt = now
+	}
+
+	return &record{Value: value, CreatedAt: createdAt, UpdatedAt: now, Version: r.Version + 1, TxID: stub.GetTxID(),
+		Creator: c}, nil
+}
+
+// storedRecord is a record as stored. JSON values are also kept as documents
+// under doc, so that rich queries can select on their fields; clients only
+// ever get the record.
+type storedRecord struct {
+	*record
+	Doc json.RawMessage `json:"doc,omitempty"`
+}
+
+// storeRecord writes r under compositeKey after fitting it to the model of
+// its object type and filling in its metadata, without touching its
+// timestamps. The indexes of assets are updated along.
+func storeRecord(stub shim.ChaincodeStubInterface, compositeKey string, r *record) error {
+	if err := applyModel(stub, compositeKey, r); err != nil {
+		return err
+	}
+
+	if err := r.describe(); err != nil {
+		return err
+	}
+
+	if err := indexAsset(stub, compositeKey, r); err != nil {
+		return err
+	}
+
+	stored := storedRecord{record: r}
+	if isJSONContentType(r.ContentType) {
+		if raw, err := r.rawValue(); err == nil && json.Valid(raw) {
+			stored.Doc = raw
+		}
+	}
+
+	recordBytes, err := json.Marshal(stored)
+	if err != nil {
+		return err
+	}
+
+	return stub.PutState(compositeKey, recordBytes)
+}
+
+// deleteRecord deletes the record stored under compositeKey, along with its
+// index entries if it's an asset.
+func deleteRecord(stub shim.ChaincodeStubInterface, compositeKey string) error {
+	if err := indexAsset(stub, compositeKey, nil); err != nil {
+		return err
+	}
+
+	return stub.DelState(compositeKey)
+}
@@ -0,0 +1,463 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+const refRuleObjType = reservedObjTypePrefix + "refrule"
+
+// referenceRule declares that the records of ObjType reference a parent
+// record of ParentType by the key found at Pointer in their JSON value.
+type referenceRule struct {
+	ObjType    string `json:"objType"`
+	Pointer    string `json:"pointer"`
+	ParentType string `json:"parentType"`
+}
+
+// orphan is a record whose parent, per a reference rule, doesn't exist or is
+// archived or deleted, tombstones included.
+type orphan struct {
+	Key       string `json:"key"`
+	Pointer   string `json:"pointer"`
+	ParentKey string `json:"parentKey"`
+}
+
+type orphansReport struct {
+	ObjType string   `json:"objType"`
+	Orphans []orphan `json:"orphans"`
+	// More is set when a repair stopped after a batch, with orphans left
+	More bool `json:"more,omitempty"`
+}
+
+// retired reports whether r is archived or deleted, which neither a parent
+// nor a child of a reference is.
+func (r *record) retired() bool {
+	return r.ArchivedAt != nil || r.DeletedAt != nil
+}
+
+func checkTypedObjType(objType string) error {
+	if objType == "" || strings.HasPrefix(objType, reservedObjTypePrefix) {
+		return fmt.Errorf("object type must be a non-empty string not starting with %q", reservedObjTypePrefix)
+	}
+
+	return nil
+}
+
+// setReferenceRule declares that the records of a type reference a parent by
+// the key at a JSON pointer.
+func (cc *SimpleChaincode) setReferenceRule(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.setReferenceRule")
+
+	if len(args) != 3 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d", len(args), 3)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	objType, pointer, parentType := args[0], args[1], args[2]
+	logger.Debugf("type: %s, pointer: %s, parent type: %s", objType, pointer, parentType)
+
+	if err := requireAdmin(stub); err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 403, Message: message}
+	}
+
+	for _, t := range []string{objType, parentType} {
+		if err := checkTypedObjType(t); err != nil {
+			message := err.Error()
+			logger.Error(message)
+			return pb.Response{Status: 400, Message: message}
+		}
+	}
+
+	if tokens, err := parsePointer(pointer); err != nil || len(tokens) == 0 {
+		message := fmt.Sprintf("pointer must be a JSON pointer to a member, got \"%s\"", pointer)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	ruleKey, err := stub.CreateCompositeKey(refRuleObjType, []string{objType, pointer})
+	if err != nil {
+		message := fmt.Sprintf("unable to create a composite key: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if err := putJSON(stub, ruleKey, referenceRule{objType, pointer, parentType}); err != nil {
+		message := fmt.Sprintf("unable to put the reference rule: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.setReferenceRule exited successfully")
+	return shim.Success(nil)
+}
+
+func referenceRules(stub shim.ChaincodeStubInterface, objType string) ([]referenceRule, error) {
+	it, err := stub.GetStateByPartialCompositeKey(refRuleObjType, []string{objType})
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+
+	rules := []referenceRule{}
+	for it.HasNext() {
+		response, err := it.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var rule referenceRule
+		if err := json.Unmarshal(response.Value, &rule); err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+// orphanVisitor is called with the record of each orphan found, and can
+// update it.
+type orphanVisitor func(compositeKey string, r *record, o orphan) error
+
+// scanOrphans finds the orphans of objType per the rules, in key order,
+// stopping after limit of them if limit is positive. Records that are
+// archived, aren't JSON or have no string at a rule's pointer are skipped.
+func scanOrphans(stub shim.ChaincodeStubInterface, objType string, rules []referenceRule, limit int,
+	visit orphanVisitor) (*orphansReport, error) {
+	report := &orphansReport{ObjType: objType, Orphans: []orphan{}}
+
+	it, err := stub.GetStateByPartialCompositeKey(objType, []string{})
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+
+	parents := map[string]bool{}
+	for it.HasNext() {
+		response, err := it.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		r := decodeRecord(response.Value)
+		if r.retired() {
+			continue
+		}
+
+		doc, err := decodeJSON([]byte(r.Value))
+		if err != nil {
+			continue
+		}
+
+		_, attributes, err := stub.SplitCompositeKey(response.Key)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, rule := range rules {
+			tokens, _ := parsePointer(rule.Pointer)
+			value, err := resolvePointer(doc, tokens)
+			if err != nil {
+				continue
+			}
+
+			parentKey, ok := value.(string)
+			if !ok || parentKey == "" {
+				continue
+			}
+
+			parentRef := rule.ParentType + ":" + parentKey
+			exists, checked := parents[parentRef]
+			if !checked {
+				parentCompositeKey, err := createCompositeKey(stub, rule.ParentType, parentKey)
+				if err != nil {
+					return nil, err
+				}
+
+				parent, err := readRecord(stub, parentCompositeKey)
+				if err != nil {
+					return nil, err
+				}
+
+				exists = parent != nil && !parent.retired()
+				parents[parentRef] = exists
+			}
+
+			if exists {
+				continue
+			}
+
+			if limit > 0 && len(report.Orphans) == limit {
+				report.More = true
+				return report, nil
+			}
+
+			o := orphan{Key: formatKey(attributes), Pointer: rule.Pointer, ParentKey: parentKey}
+			if visit != nil {
+				if err := visit(response.Key, r, o); err != nil {
+					return nil, err
+				}
+			}
+			report.Orphans = append(report.Orphans, o)
+
+			// a record is repaired once, whatever other rule it breaks
+			break
+		}
+	}
+
+	return report, nil
+}
+
+// findOrphans reports the records of a type whose parents, per the reference
+// rules of the type, don't exist or are archived or deleted.
+func (cc *SimpleChaincode) findOrphans(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.findOrphans")
+
+	if len(args) != 1 && len(args) != 2 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d or %d", len(args), 1, 2)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	objType, format := args[0], formatJSON
+	if len(args) == 2 {
+		format = args[1]
+	}
+	logger.Debugf("type: %s, format: %s", objType, format)
+
+	if err := checkTypedObjType(objType); err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	if err := checkFormat(format); err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	rules, err := referenceRules(stub, objType)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the reference rules of the type %s: %s", objType, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	report, err := scanOrphans(stub, objType, rules, 0, nil)
+	if err != nil {
+		message := fmt.Sprintf("unable to find the orphans of the type %s: %s", objType, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	result, err := marshalResult(report, format)
+	if err != nil {
+		message := fmt.Sprintf("unable to marshal the result: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.findOrphans exited successfully")
+	return shim.Success(result)
+}
+
+// relinkOrphans points up to batchSize orphans of a type that break the rule
+// of a pointer at another, existing, parent. Relinked records aren't orphans
+// anymore, so repeated calls work through all of them.
+func (cc *SimpleChaincode) relinkOrphans(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.relinkOrphans")
+
+	if len(args) != 3 && len(args) != 4 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d or %d", len(args), 3, 4)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	objType, pointer, parentKey, batchSizeArg := args[0], args[1], args[2], strconv.Itoa(maxPageSize)
+	if len(args) == 4 {
+		batchSizeArg = args[3]
+	}
+	logger.Debugf("type: %s, pointer: %s, parent: %s, batch size: %s", objType, pointer, parentKey, batchSizeArg)
+
+	if err := requireAdmin(stub); err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 403, Message: message}
+	}
+
+	batchSize, err := strconv.Atoi(batchSizeArg)
+	if err != nil || batchSize < 1 || batchSize > maxPageSize {
+		message := fmt.Sprintf("batch size must be an integer in [1, %d], got \"%s\"", maxPageSize, batchSizeArg)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	ruleKey, err := stub.CreateCompositeKey(refRuleObjType, []string{objType, pointer})
+	if err != nil {
+		message := fmt.Sprintf("unable to create a composite key: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	var rule referenceRule
+	found, err := getJSON(stub, ruleKey, &rule)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the reference rule: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if !found {
+		message := fmt.Sprintf("a reference rule for %s at %s not found", objType, pointer)
+		logger.Error(message)
+		return pb.Response{Status: 404, Message: message}
+	}
+
+	parentCompositeKey, err := createCompositeKey(stub, rule.ParentType, parentKey)
+	if err != nil {
+		message := fmt.Sprintf("unable to create a composite key: %s", err.Error())
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	parent, err := readRecord(stub, parentCompositeKey)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the parent %s: %s", parentKey, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if parent == nil || parent.retired() {
+		message := fmt.Sprintf("the parent %s:%s not found", rule.ParentType, parentKey)
+		logger.Error(message)
+		return pb.Response{Status: 404, Message: message}
+	}
+
+	tokens, _ := parsePointer(pointer)
+	report, err := scanOrphans(stub, objType, []referenceRule{rule}, batchSize,
+		func(compositeKey string, r *record, o orphan) error {
+			doc, err := decodeJSON([]byte(r.Value))
+			if err != nil {
+				return err
+			}
+
+			if doc, err = setPointer(doc, tokens, parentKey); err != nil {
+				return err
+			}
+
+			docBytes, err := json.Marshal(doc)
+			if err != nil {
+				return err
+			}
+
+			relinked, err := putRecord(stub, compositeKey, string(docBytes))
+			if err != nil {
+				return err
+			}
+
+			return appendAudit(stub, "relinkOrphans", objType, o.Key, relinked)
+		})
+	if err != nil {
+		message := fmt.Sprintf("unable to relink the orphans of the type %s: %s", objType, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	result, err := json.Marshal(report)
+	if err != nil {
+		message := fmt.Sprintf("unable to marshal the result: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.relinkOrphans exited successfully")
+	return shim.Success(result)
+}
+
+// tombstoneOrphans archives up to batchSize orphans of a type, as the mark
+// action of retention policies does. Archived records aren't orphans
+// anymore, so repeated calls work through all of them; their own children
+// become orphans in turn.
+func (cc *SimpleChaincode) tombstoneOrphans(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.tombstoneOrphans")
+
+	if len(args) != 1 && len(args) != 2 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d or %d", len(args), 1, 2)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	objType, batchSizeArg := args[0], strconv.Itoa(maxPageSize)
+	if len(args) == 2 {
+		batchSizeArg = args[1]
+	}
+	logger.Debugf("type: %s, batch size: %s", objType, batchSizeArg)
+
+	if err := requireAdmin(stub); err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 403, Message: message}
+	}
+
+	if err := checkTypedObjType(objType); err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	batchSize, err := strconv.Atoi(batchSizeArg)
+	if err != nil || batchSize < 1 || batchSize > maxPageSize {
+		message := fmt.Sprintf("batch size must be an integer in [1, %d], got \"%s\"", maxPageSize, batchSizeArg)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	rules, err := referenceRules(stub, objType)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the reference rules of the type %s: %s", objType, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	now, err := txTime(stub)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the transaction timestamp: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	report, err := scanOrphans(stub, objType, rules, batchSize,
+		func(compositeKey string, r *record, o orphan) error {
+			r.ArchivedAt = &now
+			if err := storeRecord(stub, compositeKey, r); err != nil {
+				return err
+			}
+
+			return appendAudit(stub, "tombstoneOrphans", objType, o.Key, r)
+		})
+	if err != nil {
+		message := fmt.Sprintf("unable to tombstone the orphans of the type %s: %s", objType, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	result, err := json.Marshal(report)
+	if err != nil {
+		message := fmt.Sprintf("unable to marshal the result: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.tombstoneOrphans exited successfully")
+	return shim.Success(result)
+}
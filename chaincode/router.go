@@ -0,0 +1,369 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// route is a function of the chaincode. Read-only functions get a stub that
+// rejects writes, so that a client can trust the result of a call it only
+// evaluates, without submitting it for ordering: no write was lost.
+//
+// params names the arguments of the function in order. A name ending in "?"
+// is an optional argument, one ending in "..." takes the rest of them; both
+// only come last. metadata publishes them for client generators.
+type route struct {
+	name     string
+	handler  handler
+	readOnly bool
+	params   []string
+}
+
+// handler implements a function of the chaincode.
+type handler func(*SimpleChaincode, shim.ChaincodeStubInterface, []string) pb.Response
+
+// middleware wraps the handler of the route r with what every call to it
+// goes through, e.g. logging or an access check, and returns the wrapped
+// handler; it may answer without calling next.
+type middleware func(r route, next handler) handler
+
+// middlewares wrap the handler of every call to Invoke, the first one
+// outermost.
+var middlewares = []middleware{checkedArguments, idempotent, metered, decoratedStore}
+
+func chain(r route, h handler, mws ...middleware) handler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](r, h)
+	}
+
+	return h
+}
+
+var routes = []route{
+	{"put", (*SimpleChaincode).put, false, []string{"objType", "key", "value", "options?"}},
+	{"update", (*SimpleChaincode).update, false, []string{"objType", "key", "value"}},
+	{"transfer", (*SimpleChaincode).transfer, false, []string{"objType", "key", "newOwner"}},
+	{"transferConditional", (*SimpleChaincode).transferConditional, false,
+		[]string{"objType", "key", "newOwner", "expectedVersion"}},
+	{"get", (*SimpleChaincode).get, true, []string{"objType", "key", "format?"}},
+	{"del", (*SimpleChaincode).del, false, []string{"objType", "key"}},
+	{"purge", (*SimpleChaincode).purge, false, []string{"objType", "key"}},
+	{"restore", (*SimpleChaincode).restore, false, []string{"objType", "key"}},
+	{"setDeleteMode", (*SimpleChaincode).setDeleteMode, false, []string{"objType", "mode"}},
+	{"delByRange", (*SimpleChaincode).delByRange, false, []string{"keyFrom", "keyTo", "dryRun?"}},
+	{"delByPartialCompositeKey", (*SimpleChaincode).delByPartialCompositeKey, false,
+		[]string{"objType", "partialKey", "dryRun?"}},
+	{"putBatch", (*SimpleChaincode).putBatch, false, []string{"entries"}},
+	{"getBatchRecords", (*SimpleChaincode).getBatchRecords, true, []string{"entries", "format?"}},
+	{"delBatch", (*SimpleChaincode).delBatch, false, []string{"entries"}},
+	{"initLedger", (*SimpleChaincode).initLedger, false, []string{"entries"}},
+	{"migrate", (*SimpleChaincode).migrate, false, []string{}},
+	{"getSchemaVersion", (*SimpleChaincode).getSchemaVersion, true, []string{"format?"}},
+	{"setAccessPolicy", (*SimpleChaincode).setAccessPolicy, false, []string{"objType", "policy"}},
+	{"getAccessPolicy", (*SimpleChaincode).getAccessPolicy, true, []string{"objType", "format?"}},
+	{"setKeyEndorsementPolicy", (*SimpleChaincode).setKeyEndorsementPolicy, false, []string{"objType", "key", "orgs..."}},
+	{"getKeyEndorsementPolicy", (*SimpleChaincode).getKeyEndorsementPolicy, true, []string{"objType", "key", "format?"}},
+	{"whoami", (*SimpleChaincode).whoami, true, []string{"format?"}},
+	{"setEventName", (*SimpleChaincode).setEventName, false, []string{"objType", "name"}},
+	{"getByRange", (*SimpleChaincode).getByRange, true, []string{"keyFrom", "keyTo", "format?"}},
+	{"getByRangeMeta", (*SimpleChaincode).getByRangeMeta, true, []string{"keyFrom", "keyTo", "chunkSize", "format?"}},
+	{"getByRangeChunk", (*SimpleChaincode).getByRangeChunk, true,
+		[]string{"keyFrom", "keyTo", "chunkIndex", "chunkSize", "format?"}},
+	{"countByRange", (*SimpleChaincode).countByRange, true, []string{"keyFrom", "keyTo", "format?"}},
+	{"sumField", (*SimpleChaincode).sumField, true, []string{"keyFrom", "keyTo", "field", "format?"}},
+	{"minField", (*SimpleChaincode).minField, true, []string{"keyFrom", "keyTo", "field", "format?"}},
+	{"maxField", (*SimpleChaincode).maxField, true, []string{"keyFrom", "keyTo", "field", "format?"}},
+	{"avgField", (*SimpleChaincode).avgField, true, []string{"keyFrom", "keyTo", "field", "format?"}},
+	{"getByPartialCompositeKey", (*SimpleChaincode).getByPartialCompositeKey, true,
+		[]string{"objType", "partialKey", "format?"}},
+	{"query", (*SimpleChaincode).query, true, []string{"selector", "format?"}},
+	{"getByRangeWithPagination", (*SimpleChaincode).getByRangeWithPagination, true,
+		[]string{"keyFrom", "keyTo", "pageSize", "bookmark", "format?"}},
+	{"queryWithPagination", (*SimpleChaincode).queryWithPagination, true,
+		[]string{"selector", "pageSize", "bookmark", "format?"}},
+	{"getAsOf", (*SimpleChaincode).getAsOf, true, []string{"objType", "key", "timestamp", "format?"}},
+	{"getHistory", (*SimpleChaincode).getHistory, true, []string{"objType", "key", "format?"}},
+	{"setRetention", (*SimpleChaincode).setRetention, false, []string{"objType", "maxAge", "action"}},
+	{"applyRetention", (*SimpleChaincode).applyRetention, false, []string{"objType"}},
+	{"linkRecords", (*SimpleChaincode).linkRecords, false, []string{"from", "to", "relation"}},
+	{"provenance", (*SimpleChaincode).provenance, true, []string{"root", "depth", "format?"}},
+	{"exportAudit", (*SimpleChaincode).exportAudit, true, []string{"from", "to", "format"}},
+	{"verifyChain", (*SimpleChaincode).verifyChain, true, []string{"objType", "format?"}},
+	{"changesSince", (*SimpleChaincode).changesSince, true, []string{"seq", "limit", "format?"}},
+	{"putTimeLocked", (*SimpleChaincode).putTimeLocked, false, []string{"objType", "key", "value", "unlockAt"}},
+	{"sweepExpired", (*SimpleChaincode).sweepExpired, false, []string{"keyFrom", "keyTo"}},
+	{"lpush", (*SimpleChaincode).lpush, false, []string{"name", "values..."}},
+	{"rpush", (*SimpleChaincode).rpush, false, []string{"name", "values..."}},
+	{"lpop", (*SimpleChaincode).lpop, false, []string{"name"}},
+	{"lrange", (*SimpleChaincode).lrange, true, []string{"name", "start", "stop", "format?"}},
+	{"sadd", (*SimpleChaincode).sadd, false, []string{"name", "members..."}},
+	{"srem", (*SimpleChaincode).srem, false, []string{"name", "members..."}},
+	{"sismember", (*SimpleChaincode).sismember, true, []string{"name", "member"}},
+	{"smembers", (*SimpleChaincode).smembers, true, []string{"name", "pageSize", "bookmark", "format?"}},
+	{"zadd", (*SimpleChaincode).zadd, false, []string{"name", "score", "member"}},
+	{"zrangeByScore", (*SimpleChaincode).zrangeByScore, true, []string{"name", "min", "max", "format?"}},
+	{"zrank", (*SimpleChaincode).zrank, true, []string{"name", "member"}},
+	{"nextId", (*SimpleChaincode).nextId, false, []string{"name"}},
+	{"txId", (*SimpleChaincode).txId, true, []string{"name"}},
+	{"getField", (*SimpleChaincode).getField, true, []string{"objType", "key", "pointer", "format?"}},
+	{"setField", (*SimpleChaincode).setField, false, []string{"objType", "key", "pointer", "value"}},
+	{"addEdge", (*SimpleChaincode).addEdge, false, []string{"from", "to", "label"}},
+	{"neighbors", (*SimpleChaincode).neighbors, true, []string{"node", "label", "direction", "format?"}},
+	{"path", (*SimpleChaincode).path, true, []string{"from", "to", "maxDepth", "format?"}},
+	{"append", (*SimpleChaincode).append, false, []string{"objType", "key", "entry"}},
+	{"readLog", (*SimpleChaincode).readLog, true, []string{"objType", "key", "fromSeq", "limit", "format?"}},
+	{"tag", (*SimpleChaincode).tag, false, []string{"objType", "key", "tags..."}},
+	{"untag", (*SimpleChaincode).untag, false, []string{"objType", "key", "tags..."}},
+	{"findByTag", (*SimpleChaincode).findByTag, true, []string{"tag", "pageSize", "bookmark", "format?"}},
+	{"putNode", (*SimpleChaincode).putNode, false, []string{"path", "value"}},
+	{"getNode", (*SimpleChaincode).getNode, true, []string{"path", "format?"}},
+	{"listChildren", (*SimpleChaincode).listChildren, true, []string{"path", "format?"}},
+	{"subtree", (*SimpleChaincode).subtree, true, []string{"path", "depth", "pageSize", "bookmark", "format?"}},
+	{"list", (*SimpleChaincode).list, true, []string{"prefix", "recursive?", "format?"}},
+	{"setPathACL", (*SimpleChaincode).setPathACL, false, []string{"prefix", "mspIds"}},
+	{"getPathACL", (*SimpleChaincode).getPathACL, true, []string{"path", "format?"}},
+	{"initCounter", (*SimpleChaincode).initCounter, false, []string{"name", "value", "scale?"}},
+	{"getCounter", (*SimpleChaincode).getCounter, true, []string{"name", "format?"}},
+	{"reserve", (*SimpleChaincode).reserve, false, []string{"name", "amount", "ttl"}},
+	{"confirm", (*SimpleChaincode).confirm, false, []string{"name", "id"}},
+	{"release", (*SimpleChaincode).release, false, []string{"name", "id"}},
+	{"putCBOR", (*SimpleChaincode).putCBOR, false, []string{"objType", "key", "value"}},
+	{"putBinary", (*SimpleChaincode).putBinary, false, []string{"objType", "key", "contentType", "value"}},
+	{"putEncrypted", (*SimpleChaincode).putEncrypted, false, []string{"objType", "key"}},
+	{"getEncrypted", (*SimpleChaincode).getEncrypted, true, []string{"objType", "key", "format?"}},
+	{"importCSV", (*SimpleChaincode).importCSV, false, []string{"objType", "mapping", "chunk"}},
+	{"listByOwner", (*SimpleChaincode).listByOwner, true, []string{"owner", "pageSize", "bookmark", "format?"}},
+	{"listByTypeSince", (*SimpleChaincode).listByTypeSince, true,
+		[]string{"docType", "since", "pageSize", "bookmark", "format?"}},
+	{"hashOf", (*SimpleChaincode).hashOf, true, []string{"objType", "key", "format?"}},
+	{"putDocHash", (*SimpleChaincode).putDocHash, false, []string{"id", "hash", "size", "mimeType", "uri?"}},
+	{"getDocHash", (*SimpleChaincode).getDocHash, true, []string{"id", "format?"}},
+	{"verifyDoc", (*SimpleChaincode).verifyDoc, true, []string{"id", "document", "format?"}},
+	{"createWithGeneratedId", (*SimpleChaincode).createWithGeneratedId, false, []string{"objType", "values..."}},
+	{"openAccount", (*SimpleChaincode).openAccount, false, []string{"id"}},
+	{"deposit", (*SimpleChaincode).deposit, false, []string{"id", "currency", "amount"}},
+	{"withdraw", (*SimpleChaincode).withdraw, false, []string{"id", "currency", "amount"}},
+	{"transferFunds", (*SimpleChaincode).transferFunds, false, []string{"from", "to", "currency", "amount"}},
+	{"setRate", (*SimpleChaincode).setRate, false, []string{"base", "quote", "rate"}},
+	{"convert", (*SimpleChaincode).convert, false, []string{"id", "fromCurrency", "toCurrency", "amount"}},
+	{"getBalances", (*SimpleChaincode).getBalances, true, []string{"id", "format?"}},
+	{"getConversions", (*SimpleChaincode).getConversions, true, []string{"txId", "format?"}},
+	{"trialBalance", (*SimpleChaincode).trialBalance, true, []string{"format?"}},
+	{"accountStatement", (*SimpleChaincode).accountStatement, true, []string{"id", "period", "format?"}},
+	{"reconcile", (*SimpleChaincode).reconcile, true, []string{"orgA", "orgB", "period", "format?"}},
+	{"addSettlement", (*SimpleChaincode).addSettlement, false, []string{"payer", "payee", "currency", "amount"}},
+	{"closeBatch", (*SimpleChaincode).closeBatch, false, []string{}},
+	{"getBatch", (*SimpleChaincode).getBatch, true, []string{"seq", "format?"}},
+	{"netObligations", (*SimpleChaincode).netObligations, false, []string{"obligations"}},
+	{"getNetting", (*SimpleChaincode).getNetting, true, []string{"id", "format?"}},
+	{"setAccrual", (*SimpleChaincode).setAccrual, false, []string{"recordId", "currency", "principal", "rate", "dayCount"}},
+	{"accrue", (*SimpleChaincode).accrue, false, []string{"recordId"}},
+	{"getAccruals", (*SimpleChaincode).getAccruals, true, []string{"recordId", "format?"}},
+	{"schedulePayment", (*SimpleChaincode).schedulePayment, false, []string{"payer", "payee", "currency", "amount", "dueDate"}},
+	{"processDue", (*SimpleChaincode).processDue, false, []string{"asOf"}},
+	{"getScheduledPayment", (*SimpleChaincode).getScheduledPayment, true, []string{"id", "format?"}},
+	{"stateChecksum", (*SimpleChaincode).stateChecksum, true, []string{"prefix", "format?"}},
+	{"exportState", (*SimpleChaincode).exportState, true, []string{"keyFrom", "keyTo"}},
+	{"importState", (*SimpleChaincode).importState, false, []string{"snapshot"}},
+	{"checkIndexes", (*SimpleChaincode).checkIndexes, true, []string{"objType", "format?"}},
+	{"repairIndexes", (*SimpleChaincode).repairIndexes, false, []string{"objType", "bookmark", "batchSize?"}},
+	{"setReferenceRule", (*SimpleChaincode).setReferenceRule, false, []string{"objType", "pointer", "parentType"}},
+	{"findOrphans", (*SimpleChaincode).findOrphans, true, []string{"objType", "format?"}},
+	{"relinkOrphans", (*SimpleChaincode).relinkOrphans, false, []string{"objType", "pointer", "parentKey", "batchSize?"}},
+	{"tombstoneOrphans", (*SimpleChaincode).tombstoneOrphans, false, []string{"objType", "batchSize?"}},
+	{"simulate", (*SimpleChaincode).simulate, true, []string{"function", "args..."}},
+	{"metadata", (*SimpleChaincode).metadata, true, []string{"format?"}},
+	{"propose", (*SimpleChaincode).propose, false, []string{"function", "threshold", "signers", "args..."}},
+	{"signProposal", (*SimpleChaincode).signProposal, false, []string{"id", "certificate", "signature"}},
+	{"getProposal", (*SimpleChaincode).getProposal, true, []string{"id", "format?"}},
+	{"setApprovalThreshold", (*SimpleChaincode).setApprovalThreshold, false, []string{"objType", "threshold"}},
+	{"proposeChange", (*SimpleChaincode).proposeChange, false, []string{"objType", "key", "newValue"}},
+	{"approve", (*SimpleChaincode).approve, false, []string{"proposalId"}},
+	{"getChange", (*SimpleChaincode).getChange, true, []string{"proposalId", "format?"}},
+	{"setSignerCA", (*SimpleChaincode).setSignerCA, false, []string{"mspId", "bundle"}},
+	{"relay", (*SimpleChaincode).relay, false, []string{"mspId", "certificate", "nonce", "signature", "function", "args..."}},
+	{"nonceOf", (*SimpleChaincode).nonceOf, true, []string{"mspId", "certificate", "format?"}},
+	{"invokeOther", (*SimpleChaincode).invokeOther, false, []string{"chaincode", "channel", "function", "args..."}},
+	{"getFromChannel", (*SimpleChaincode).getFromChannel, true,
+		[]string{"channel", "chaincode", "objType", "key", "format?"}},
+	{"putMany", (*SimpleChaincode).putMany, false, []string{"prefix", "count", "valueSize", "layout?"}},
+	{"readMany", (*SimpleChaincode).readMany, true, []string{"prefix", "count", "layout?"}},
+	{"pruneIdempotencyTokens", (*SimpleChaincode).pruneIdempotencyTokens, false, []string{}},
+}
+
+var routesByName = map[string]route{}
+
+func init() {
+	indexRoutes()
+}
+
+// indexRoutes indexes routes by name and describes them. Registering routes
+// indexes them first, since the init functions of the files that register
+// them may run before this one.
+func indexRoutes() {
+	for _, r := range routes {
+		routesByName[r.name] = r
+	}
+	contract = describeContract(routes)
+}
+
+// register adds a route to those of the table above, with its handler wrapped
+// in mws, so that a module of the chaincode can bring its functions along in
+// its own file, from an init function:
+//
+//	func init() {
+//		register(route{"lab:open", (*SimpleChaincode).labOpen, false, []string{"id"}}, accessChecked(accessWrite))
+//	}
+func register(r route, mws ...middleware) {
+	indexRoutes()
+	if _, ok := routesByName[r.name]; ok {
+		panic(fmt.Sprintf("the function %s is already registered", r.name))
+	}
+
+	r.handler = chain(r, r.handler, mws...)
+	routes = append(routes, r)
+	indexRoutes()
+}
+
+// objTypeHandlers are the handlers of functions whose first argument is an
+// object type, by function and object type, see registerObjType.
+var objTypeHandlers = map[string]map[string]handler{}
+
+// registerObjType makes h, wrapped in mws, handle the calls to function for
+// objType in place of the handler of its route, so that a record type can
+// have, e.g., a put of its own without the generic one knowing about it.
+func registerObjType(function, objType string, h handler, mws ...middleware) {
+	indexRoutes()
+	r, ok := routesByName[function]
+	if !ok || len(r.params) == 0 || r.params[0] != "objType" {
+		panic(fmt.Sprintf("the function %s doesn't take an object type", function))
+	}
+
+	if objTypeHandlers[function] == nil {
+		objTypeHandlers[function] = map[string]handler{}
+	}
+	if _, ok := objTypeHandlers[function][objType]; ok {
+		panic(fmt.Sprintf("the function %s is already registered for the object type %s", function, objType))
+	}
+
+	objTypeHandlers[function][objType] = chain(r, h, mws...)
+}
+
+// handlerFor returns the handler of a call to r with args.
+func (r route) handlerFor(args []string) handler {
+	if len(args) > 0 {
+		if h, ok := objTypeHandlers[r.name][args[0]]; ok {
+			return h
+		}
+	}
+
+	return r.handler
+}
+
+// checkedArguments answers a call with the wrong number of arguments for the
+// parameters of its route.
+func checkedArguments(r route, next handler) handler {
+	return func(cc *SimpleChaincode, stub shim.ChaincodeStubInterface, args []string) pb.Response {
+		if response, ok := checkArgumentCount(r, args); !ok {
+			return response
+		}
+
+		return next(cc, stub, args)
+	}
+}
+
+// metered logs the state accesses of a call once it returns.
+func metered(r route, next handler) handler {
+	return func(cc *SimpleChaincode, stub shim.ChaincodeStubInterface, args []string) pb.Response {
+		metrics := &metricsStub{ChaincodeStubInterface: stub}
+		response := next(cc, metrics, args)
+		metrics.log(r.name)
+		return response
+	}
+}
+
+// decoratedStore gives a call the stub of a transaction, read-only for a
+// read-only function. A read-only function that tried to write fails even if
+// it ignored the error, lest a query evaluated by mistake look like it wrote.
+func decoratedStore(r route, next handler) handler {
+	return func(cc *SimpleChaincode, stub shim.ChaincodeStubInterface, args []string) pb.Response {
+		stub = decorate(stub, txStore)
+		if !r.readOnly {
+			return next(cc, stub, args)
+		}
+
+		guard := &readOnlyStub{ChaincodeStubInterface: stub, function: r.name}
+		response := next(cc, guard, args)
+		if guard.violation != nil {
+			message := guard.violation.Error()
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		return response
+	}
+}
+
+// accessChecked checks the caller against the access policy of the object
+// type a call is for, its first argument, for operation.
+func accessChecked(operation string) middleware {
+	return func(r route, next handler) handler {
+		return func(cc *SimpleChaincode, stub shim.ChaincodeStubInterface, args []string) pb.Response {
+			if response, denied := accessDenied(stub, operation, args[0]); denied {
+				return response
+			}
+
+			return next(cc, stub, args)
+		}
+	}
+}
+
+// readOnlyStub fails every write of a read-only function and remembers the
+// first one as its violation.
+type readOnlyStub struct {
+	shim.ChaincodeStubInterface
+	function  string
+	violation error
+}
+
+func (s *readOnlyStub) unwrap() shim.ChaincodeStubInterface {
+	return s.ChaincodeStubInterface
+}
+
+func (s *readOnlyStub) readOnlyError() error {
+	err := fmt.Errorf("%s is a read-only function and can't write to the ledger", s.function)
+	if s.violation == nil {
+		s.violation = err
+	}
+	return err
+}
+
+func (s *readOnlyStub) PutState(key string, value []byte) error {
+	return s.readOnlyError()
+}
+
+func (s *readOnlyStub) DelState(key string) error {
+	return s.readOnlyError()
+}
+
+func (s *readOnlyStub) SetStateValidationParameter(key string, ep []byte) error {
+	return s.readOnlyError()
+}
+
+func (s *readOnlyStub) PutPrivateData(collection, key string, value []byte) error {
+	return s.readOnlyError()
+}
+
+func (s *readOnlyStub) DelPrivateData(collection, key string) error {
+	return s.readOnlyError()
+}
+
+func (s *readOnlyStub) SetPrivateDataValidationParameter(collection, key string, ep []byte) error {
+	return s.readOnlyError()
+}
+
+func (s *readOnlyStub) SetEvent(name string, payload []byte) error {
+	return s.readOnlyError()
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+const (
+	scheduledObjType = reservedObjTypePrefix + "scheduled"
+	dueObjType       = reservedObjTypePrefix + "due"
+
+	paymentStatusPending = "pending"
+	paymentStatusSettled = "settled"
+	paymentStatusFailed  = "failed"
+)
+
+// scheduledPayment is a transfer between two accounts to be executed when
+// due. Pending payments are also indexed by due date, so that processDue
+// finds them in order.
+type scheduledPayment struct {
+	ID      string    `json:"id"`
+	Payer   string    `json:"payer"`
+	Payee   string    `json:"payee"`
+	Amount  money     `json:"amount"`
+	DueDate time.Time `json:"dueDate"`
+	Status  string    `json:"status"`
+	Reason  string    `json:"reason,omitempty"`
+	TxID    string    `json:"txId"`
+	// ProcessedAt and ProcessedBy, an MSP id, are set by processDue
+	ProcessedAt *time.Time `json:"processedAt,omitempty"`
+	ProcessedBy string     `json:"processedBy,omitempty"`
+}
+
+type dueResults struct {
+	Processed []scheduledPayment `json:"processed"`
+	// More is set when processDue stopped at maxPageSize payments, with more
+	// of them due
+	More bool `json:"more"`
+}
+
+func scheduledKey(stub shim.ChaincodeStubInterface, id string) (string, error) {
+	return stub.CreateCompositeKey(scheduledObjType, []string{id})
+}
+
+// schedulePayment schedules a transfer from an account of the caller to be
+// executed by processDue once it is due.
+func (cc *SimpleChaincode) schedulePayment(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.schedulePayment")
+
+	if len(args) != 5 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d", len(args), 5)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	payer, payee, currency, amountArg, dueDateArg := args[0], args[1], args[2], args[3], args[4]
+	logger.Debugf("payer: %s, payee: %s, currency: %s, amount: %s, due date: %s",
+		payer, payee, currency, amountArg, dueDateArg)
+
+	m, err := parseMoney(currency, amountArg)
+	if err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	dueDate, err := time.Parse(time.RFC3339Nano, dueDateArg)
+	if err != nil {
+		message := fmt.Sprintf("dueDate must be in RFC 3339 format: %s", err.Error())
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	if payer == payee {
+		message := "the accounts of a payment must differ"
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	for _, id := range []string{payer, payee} {
+		a, err := getAccount(stub, id)
+		if err != nil {
+			message := fmt.Sprintf("unable to get the account %s: %s", id, err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		if a == nil {
+			message := fmt.Sprintf("the account %s not found", id)
+			logger.Error(message)
+			return pb.Response{Status: 404, Message: message}
+		}
+
+		if id == payer {
+			if err := requireOwner(stub, a); err != nil {
+				message := err.Error()
+				logger.Error(message)
+				return pb.Response{Status: 403, Message: message}
+			}
+		}
+	}
+
+	p := scheduledPayment{
+		ID:      newUUID(stub),
+		Payer:   payer,
+		Payee:   payee,
+		Amount:  m,
+		DueDate: dueDate.UTC(),
+		Status:  paymentStatusPending,
+		TxID:    stub.GetTxID(),
+	}
+
+	key, err := scheduledKey(stub, p.ID)
+	if err != nil {
+		message := fmt.Sprintf("unable to create a composite key: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	dueKey, err := stub.CreateCompositeKey(dueObjType, []string{p.DueDate.Format(auditTimeLayout), p.ID})
+	if err != nil {
+		message := fmt.Sprintf("unable to create a composite key: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if err := putJSON(stub, key, p); err != nil {
+		message := fmt.Sprintf("unable to put the payment: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if err := stub.PutState(dueKey, []byte(p.ID)); err != nil {
+		message := fmt.Sprintf("unable to index the payment: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.schedulePayment exited successfully")
+	return shim.Success([]byte(p.ID))
+}
+
+// processDue executes the pending payments due by asOf, which can't be later
+// than the transaction timestamp, in the order of their due dates and ids. A
+// payment the payer can't fund is marked failed rather than left pending. It
+// is meant to be invoked by an off-chain scheduler with the admin role.
+func (cc *SimpleChaincode) processDue(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.processDue")
+
+	if len(args) != 1 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d", len(args), 1)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	asOfArg := args[0]
+	logger.Debugf("as of: %s", asOfArg)
+
+	if err := requireAdmin(stub); err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 403, Message: message}
+	}
+
+	asOf, err := time.Parse(time.RFC3339Nano, asOfArg)
+	if err != nil {
+		message := fmt.Sprintf("asOf must be in RFC 3339 format: %s", err.Error())
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	now, err := txTime(stub)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the transaction timestamp: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if asOf.After(now) {
+		message := fmt.Sprintf("asOf %s is later than the transaction timestamp %s",
+			asOf.Format(time.RFC3339), now.Format(time.RFC3339))
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	processedBy, err := callerMSPID(stub)
+	if err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	it, err := stub.GetStateByPartialCompositeKey(dueObjType, []string{})
+	if err != nil {
+		message := fmt.Sprintf("unable to get an iterator over the due payments: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+	defer it.Close()
+
+	asOfTs := asOf.UTC().Format(auditTimeLayout)
+	results := dueResults{Processed: []scheduledPayment{}}
+	for it.HasNext() {
+		response, err := it.Next()
+		if err != nil {
+			message := fmt.Sprintf("unable to get the next element: %s", err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		_, attributes, err := stub.SplitCompositeKey(response.Key)
+		if err != nil {
+			message := fmt.Sprintf("unable to split the composite key %s: %s", response.Key, err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		// the index is ordered by due date, so nothing past asOf is needed
+		if attributes[0] > asOfTs {
+			break
+		}
+
+		if len(results.Processed) == maxPageSize {
+			results.More = true
+			break
+		}
+
+		p, err := settlePayment(stub, attributes[1], now, processedBy)
+		if err != nil {
+			message := fmt.Sprintf("unable to settle the payment %s: %s", attributes[1], err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		if err := stub.DelState(response.Key); err != nil {
+			message := fmt.Sprintf("unable to unindex the payment %s: %s", p.ID, err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+		results.Processed = append(results.Processed, *p)
+	}
+
+	result, err := json.Marshal(results)
+	if err != nil {
+		message := fmt.Sprintf("unable to marshal the result: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.processDue exited successfully")
+	return shim.Success(result)
+}
+
+// settlePayment executes a scheduled payment, or marks it failed if the
+// payer is short of funds.
+func settlePayment(stub shim.ChaincodeStubInterface, id string, now time.Time, processedBy string) (*scheduledPayment, error) {
+	key, err := scheduledKey(stub, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var p scheduledPayment
+	if found, err := getJSON(stub, key, &p); err != nil {
+		return nil, err
+	} else if !found {
+		return nil, fmt.Errorf("the payment %s not found", id)
+	}
+
+	ok, err := takeFunds(stub, p.Payer, p.Amount)
+	if err != nil {
+		return nil, err
+	}
+
+	if ok {
+		if err := addFunds(stub, p.Payee, p.Amount); err != nil {
+			return nil, err
+		}
+
+		if err := postEntry(stub, "scheduled payment "+p.ID, transferLines(p.Payer, p.Payee, p.Amount)...); err != nil {
+			return nil, err
+		}
+		p.Status = paymentStatusSettled
+	} else {
+		p.Status = paymentStatusFailed
+		p.Reason = fmt.Sprintf("the account %s has insufficient %s funds", p.Payer, p.Amount.Currency)
+	}
+
+	p.ProcessedAt, p.ProcessedBy = &now, processedBy
+	return &p, putJSON(stub, key, p)
+}
+
+// getScheduledPayment returns a scheduled payment and its status.
+func (cc *SimpleChaincode) getScheduledPayment(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.getScheduledPayment")
+
+	if len(args) != 1 && len(args) != 2 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d or %d", len(args), 1, 2)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	id, format := args[0], formatJSON
+	if len(args) == 2 {
+		format = args[1]
+	}
+	logger.Debugf("id: %s, format: %s", id, format)
+
+	if err := checkFormat(format); err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	key, err := scheduledKey(stub, id)
+	if err != nil {
+		message := fmt.Sprintf("unable to create a composite key: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	var p scheduledPayment
+	found, err := getJSON(stub, key, &p)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the payment %s: %s", id, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if !found {
+		message := fmt.Sprintf("the payment %s not found", id)
+		logger.Error(message)
+		return pb.Response{Status: 404, Message: message}
+	}
+
+	result, err := marshalResult(&p, format)
+	if err != nil {
+		message := fmt.Sprintf("unable to marshal the result: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.getScheduledPayment exited successfully")
+	return shim.Success(result)
+}
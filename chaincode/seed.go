@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// seeding is the result of seeding the ledger: the number of entries written
+// and of those skipped because their keys already had a value.
+type seeding struct {
+	Created int `json:"created"`
+	Skipped int `json:"skipped"`
+}
+
+// seedLedger puts the entries of seedArg, a batch as putBatch takes it, whose
+// keys have no value yet. Seeding again, e.g. on an upgrade with the same
+// dataset, leaves what's on the ledger alone, whether seeded or written since.
+func (cc *SimpleChaincode) seedLedger(stub shim.ChaincodeStubInterface, seedArg string) pb.Response {
+	entries, err := parseBatch(stub, seedArg)
+	if err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+	logger.Debugf("entries: %d", len(entries))
+
+	for i, e := range entries {
+		if e.Value == nil {
+			message := fmt.Sprintf("the entry %d has no value", i)
+			logger.Error(message)
+			return pb.Response{Status: 400, Message: message}
+		}
+	}
+
+	for _, e := range entries {
+		if response, denied := accessDenied(stub, accessWrite, e.Type); denied {
+			return response
+		}
+	}
+
+	var s seeding
+	for _, e := range entries {
+		valueBytes, err := stub.GetState(e.compositeKey)
+		if err != nil {
+			message := fmt.Sprintf("unable to get a value for the key %s: %s", e.Key, err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		if valueBytes != nil {
+			logger.Debugf("skipped: (%s, %s)", e.Type, e.Key)
+			s.Skipped++
+			continue
+		}
+
+		r, err := putRecord(stub, e.compositeKey, *e.Value)
+		if response, ok := invalidValueResponse(err); ok {
+			return response
+		}
+		if err != nil {
+			message := fmt.Sprintf("unable to put a value for the key %s: %s", e.Key, err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		if err := appendAudit(stub, "seed", e.Type, e.Key, r); err != nil {
+			message := fmt.Sprintf("unable to append to the audit log: %s", err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+		s.Created++
+	}
+
+	result, err := json.Marshal(s)
+	if err != nil {
+		message := fmt.Sprintf("unable to marshal the result: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.seedLedger exited successfully")
+	return shim.Success(result)
+}
+
+// initLedger seeds the ledger with a batch of entries, as Init does when
+// it's passed one, e.g. to set up the dataset of a lab.
+func (cc *SimpleChaincode) initLedger(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.initLedger")
+
+	if len(args) != 1 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d", len(args), 1)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	return cc.seedLedger(stub, args[0])
+}
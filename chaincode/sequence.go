@@ -0,0 +1,188 @@
+package main
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+const sequenceObjType = reservedObjTypePrefix + "sequence"
+
+// uuidNamespace is the RFC 4122 namespace of the UUIDs newUUID generates.
+var uuidNamespace = [16]byte{
+	0x3f, 0x5d, 0x7a, 0x8c, 0x2e, 0x1b, 0x4c, 0x9d, 0x9a, 0x6f, 0x0b, 0x8e, 0x7c, 0x4d, 0x2a, 0x15,
+}
+
+// nextId returns the next value of a named sequence, starting at 1.
+//
+// Every call reads and writes the same key, so two transactions drawing from
+// one sequence in the same block conflict and the later one is invalidated
+// with an MVCC_READ_CONFLICT; the ids that are committed are gap-free and
+// strictly increasing. When many clients create records concurrently use
+// txId instead, which never conflicts but yields unordered ids.
+func (cc *SimpleChaincode) nextId(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.nextId")
+
+	if len(args) != 1 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d", len(args), 1)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	name := args[0]
+	logger.Debugf("sequence: %s", name)
+
+	if name == "" {
+		message := "sequence name must be a non-empty string"
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	sequenceKey, err := stub.CreateCompositeKey(sequenceObjType, []string{name})
+	if err != nil {
+		message := fmt.Sprintf("unable to create a composite key: %s", err.Error())
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	valueBytes, err := stub.GetState(sequenceKey)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the sequence %s: %s", name, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	var value uint64
+	if valueBytes != nil {
+		if value, err = strconv.ParseUint(string(valueBytes), 10, 64); err != nil {
+			message := fmt.Sprintf("unable to parse the sequence %s: %s", name, err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+	}
+	value++
+
+	id := []byte(strconv.FormatUint(value, 10))
+	if err := stub.PutState(sequenceKey, id); err != nil {
+		message := fmt.Sprintf("unable to update the sequence %s: %s", name, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.nextId exited successfully")
+	return shim.Success(id)
+}
+
+// txId returns an id derived from the transaction id and a caller-chosen
+// name, e.g. "order". It touches no state, so it never causes MVCC conflicts,
+// and every endorser computes the same value. The ids are unique per
+// transaction and name but carry no ordering.
+func (cc *SimpleChaincode) txId(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.txId")
+
+	if len(args) != 1 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d", len(args), 1)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	name := args[0]
+	logger.Debugf("name: %s", name)
+
+	logger.Info("SimpleChaincode.txId exited successfully")
+	return shim.Success([]byte(deriveID(stub, name)))
+}
+
+// deriveID hashes the transaction id and name into a 128-bit hex id.
+func deriveID(stub shim.ChaincodeStubInterface, name string) string {
+	sum := sha256.Sum256([]byte(stub.GetTxID() + "\x00" + name))
+	return hex.EncodeToString(sum[:16])
+}
+
+// newUUID returns a name-based UUID (RFC 4122 version 5) of the transaction id
+// and the number of UUIDs generated before in the transaction, so every
+// endorser generates the same ones; math/rand or random UUIDs would make the
+// endorsements differ. The count is kept by the txStub Invoke wraps the stub
+// in.
+func newUUID(stub shim.ChaincodeStubInterface) string {
+	var n uint64
+	if s := findTxStub(stub); s != nil {
+		n = s.generatedIDs
+		s.generatedIDs++
+	}
+
+	name := make([]byte, 8, 8+len(stub.GetTxID()))
+	binary.BigEndian.PutUint64(name, n)
+	name = append(name, stub.GetTxID()...)
+
+	h := sha1.New()
+	h.Write(uuidNamespace[:])
+	h.Write(name)
+	sum := h.Sum(nil)
+
+	sum[6] = sum[6]&0x0f | 0x50 // version 5
+	sum[8] = sum[8]&0x3f | 0x80 // RFC 4122 variant
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
+
+// createWithGeneratedId stores each value under a UUID from newUUID and
+// returns the UUIDs in the order of the values.
+func (cc *SimpleChaincode) createWithGeneratedId(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.createWithGeneratedId")
+
+	if len(args) < 2 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected at least %d", len(args), 2)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	objType, values := args[0], args[1:]
+	logger.Debugf("type: %s, values: %v", objType, values)
+
+	if response, denied := accessDenied(stub, accessWrite, objType); denied {
+		return response
+	}
+
+	ids := make([]string, len(values))
+	for i, value := range values {
+		ids[i] = newUUID(stub)
+
+		compositeKey, err := createCompositeKey(stub, objType, ids[i])
+		if err != nil {
+			message := fmt.Sprintf("unable to create a composite key: %s", err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		r, err := putRecord(stub, compositeKey, value)
+		if err != nil {
+			message := fmt.Sprintf("unable to put a key-value pair: %s", err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		if err := appendAudit(stub, "createWithGeneratedId", objType, ids[i], r); err != nil {
+			message := fmt.Sprintf("unable to append to the audit log: %s", err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+	}
+
+	result, err := json.Marshal(ids)
+	if err != nil {
+		message := fmt.Sprintf("unable to marshal the result: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.createWithGeneratedId exited successfully")
+	return shim.Success(result)
+}
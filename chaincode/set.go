@@ -0,0 +1,238 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+const (
+	setObjType = reservedObjTypePrefix + "set"
+
+	maxPageSize = 1000
+)
+
+// presenceMarker is stored under keys that carry no data, as an empty value
+// would be treated as a deletion.
+var presenceMarker = []byte{0}
+
+// membersPage is a page of set members along with the bookmark to pass to get
+// the next one.
+type membersPage struct {
+	Members             []string `json:"members"`
+	Bookmark            string   `json:"bookmark"`
+	FetchedRecordsCount int32    `json:"fetchedRecordsCount"`
+}
+
+func (page membersPage) ndjsonLines() []interface{} {
+	lines := make([]interface{}, 0, len(page.Members)+1)
+	for _, member := range page.Members {
+		lines = append(lines, member)
+	}
+
+	return append(lines, ndjsonCursor{bookmarkCursor{page.Bookmark, page.FetchedRecordsCount}})
+}
+
+func setMemberKey(stub shim.ChaincodeStubInterface, name, member string) (string, error) {
+	return stub.CreateCompositeKey(setObjType, []string{name, member})
+}
+
+func (cc *SimpleChaincode) sadd(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.sadd")
+
+	if len(args) < 2 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected at least %d", len(args), 2)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	name, members := args[0], args[1:]
+	logger.Debugf("set: %s, members: %v", name, members)
+
+	if name == "" {
+		message := "set name must be a non-empty string"
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	added := 0
+	for _, member := range members {
+		memberKey, err := setMemberKey(stub, name, member)
+		if err != nil {
+			message := fmt.Sprintf("unable to create a composite key: %s", err.Error())
+			logger.Error(message)
+			return pb.Response{Status: 400, Message: message}
+		}
+
+		marker, err := stub.GetState(memberKey)
+		if err != nil {
+			message := fmt.Sprintf("unable to get the member %s: %s", member, err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		if marker != nil {
+			continue
+		}
+
+		if err := stub.PutState(memberKey, presenceMarker); err != nil {
+			message := fmt.Sprintf("unable to put the member %s: %s", member, err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+		added++
+	}
+
+	logger.Info("SimpleChaincode.sadd exited successfully")
+	return shim.Success([]byte(strconv.Itoa(added)))
+}
+
+func (cc *SimpleChaincode) srem(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.srem")
+
+	if len(args) < 2 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected at least %d", len(args), 2)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	name, members := args[0], args[1:]
+	logger.Debugf("set: %s, members: %v", name, members)
+
+	removed := 0
+	for _, member := range members {
+		memberKey, err := setMemberKey(stub, name, member)
+		if err != nil {
+			message := fmt.Sprintf("unable to create a composite key: %s", err.Error())
+			logger.Error(message)
+			return pb.Response{Status: 400, Message: message}
+		}
+
+		marker, err := stub.GetState(memberKey)
+		if err != nil {
+			message := fmt.Sprintf("unable to get the member %s: %s", member, err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		if marker == nil {
+			continue
+		}
+
+		if err := stub.DelState(memberKey); err != nil {
+			message := fmt.Sprintf("unable to delete the member %s: %s", member, err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+		removed++
+	}
+
+	logger.Info("SimpleChaincode.srem exited successfully")
+	return shim.Success([]byte(strconv.Itoa(removed)))
+}
+
+func (cc *SimpleChaincode) sismember(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.sismember")
+
+	if len(args) != 2 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d", len(args), 2)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	name, member := args[0], args[1]
+	logger.Debugf("set: %s, member: %s", name, member)
+
+	memberKey, err := setMemberKey(stub, name, member)
+	if err != nil {
+		message := fmt.Sprintf("unable to create a composite key: %s", err.Error())
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	marker, err := stub.GetState(memberKey)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the member %s: %s", member, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.sismember exited successfully")
+	return shim.Success([]byte(strconv.FormatBool(marker != nil)))
+}
+
+func (cc *SimpleChaincode) smembers(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.smembers")
+
+	if len(args) != 3 && len(args) != 4 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d or %d", len(args), 3, 4)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	name, pageSizeArg, bookmark, format := args[0], args[1], args[2], formatJSON
+	if len(args) == 4 {
+		format = args[3]
+	}
+	logger.Debugf("set: %s, pageSize: %s, bookmark: %s, format: %s", name, pageSizeArg, bookmark, format)
+
+	if err := checkFormat(format); err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	pageSize, err := strconv.ParseInt(pageSizeArg, 10, 32)
+	if err != nil || pageSize < 1 || pageSize > maxPageSize {
+		message := fmt.Sprintf("page size must be an integer in [1, %d], got \"%s\"", maxPageSize, pageSizeArg)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	it, metadata, err := stub.GetStateByPartialCompositeKeyWithPagination(setObjType, []string{name},
+		int32(pageSize), bookmark)
+	if err == nil && it == nil {
+		err = errPaginationUnsupported
+	}
+	if err != nil {
+		message := fmt.Sprintf("unable to get an iterator over the set %s: %s", name, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+	defer it.Close()
+
+	page := membersPage{
+		Members:             []string{},
+		Bookmark:            metadata.Bookmark,
+		FetchedRecordsCount: metadata.FetchedRecordsCount,
+	}
+	for it.HasNext() {
+		response, err := it.Next()
+		if err != nil {
+			message := fmt.Sprintf("unable to get the next element: %s", err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		_, attributes, err := stub.SplitCompositeKey(response.Key)
+		if err != nil {
+			message := fmt.Sprintf("unable to split the composite key: %s", err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		page.Members = append(page.Members, attributes[1])
+	}
+
+	result, err := marshalResult(page, format)
+	if err != nil {
+		message := fmt.Sprintf("unable to marshal the result: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.smembers exited successfully")
+	return shim.Success(result)
+}
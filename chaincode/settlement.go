@@ -0,0 +1,355 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+const (
+	instructionObjType = reservedObjTypePrefix + "instruction"
+	batchObjType       = reservedObjTypePrefix + "batch"
+	batchHeadObjType   = reservedObjTypePrefix + "batchhead"
+
+	settlementBatchEvent = "settlementBatch"
+)
+
+// settlementInstruction is a payment between two participants, organizations
+// by their MSP ids, to be settled with the batch it was added to.
+type settlementInstruction struct {
+	ID    string `json:"id"`
+	Batch uint64 `json:"batch"`
+	payment
+	TxID      string    `json:"txId"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// batchHead is the open batch, which takes the instructions until an admin
+// closes it at the cut-off.
+type batchHead struct {
+	Seq      uint64    `json:"seq"`
+	OpenedAt time.Time `json:"openedAt"`
+}
+
+// netPosition is what a participant receives, if positive, or pays, if
+// negative, to settle a batch in a currency. The positions of a currency sum
+// to zero.
+type netPosition struct {
+	Participant string   `json:"participant"`
+	Currency    string   `json:"currency"`
+	Net         *decimal `json:"net"`
+}
+
+// batchManifest is a closed batch: its instructions and the net positions
+// that settle them.
+type batchManifest struct {
+	Seq          uint64         `json:"seq"`
+	OpenedAt     time.Time      `json:"openedAt"`
+	ClosedAt     time.Time      `json:"closedAt"`
+	ClosedBy     string         `json:"closedBy"`
+	TxID         string         `json:"txId"`
+	Instructions []string       `json:"instructions"`
+	Positions    []*netPosition `json:"positions"`
+}
+
+func batchSeqAttribute(seq uint64) string {
+	return fmt.Sprintf("%020d", seq)
+}
+
+// getBatchHead returns the open batch, and whether it is stored yet; before
+// the first instruction it is the first batch, opened now.
+func getBatchHead(stub shim.ChaincodeStubInterface) (string, *batchHead, bool, error) {
+	headKey, err := stub.CreateCompositeKey(batchHeadObjType, []string{})
+	if err != nil {
+		return "", nil, false, err
+	}
+
+	head := &batchHead{}
+	found, err := getJSON(stub, headKey, head)
+	if err != nil {
+		return "", nil, false, err
+	}
+
+	if !found {
+		now, err := txTime(stub)
+		if err != nil {
+			return "", nil, false, err
+		}
+		head = &batchHead{Seq: 1, OpenedAt: now}
+	}
+
+	return headKey, head, found, nil
+}
+
+// addSettlement adds an instruction to the open batch. The caller's
+// organization must be the payer.
+func (cc *SimpleChaincode) addSettlement(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.addSettlement")
+
+	if len(args) != 4 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d", len(args), 4)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	payer, payee, currency, amountArg := args[0], args[1], args[2], args[3]
+	logger.Debugf("payer: %s, payee: %s, currency: %s, amount: %s", payer, payee, currency, amountArg)
+
+	m, err := parseMoney(currency, amountArg)
+	if err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	if payer == "" || payee == "" || payer == payee {
+		message := "an instruction takes two different participants"
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	org, err := callerMSPID(stub)
+	if err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if org != payer {
+		message := fmt.Sprintf("only %s can instruct payments from %s", payer, payer)
+		logger.Error(message)
+		return pb.Response{Status: 403, Message: message}
+	}
+
+	headKey, head, found, err := getBatchHead(stub)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the open batch: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	now, err := txTime(stub)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the transaction timestamp: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	instruction := settlementInstruction{
+		ID:        newUUID(stub),
+		Batch:     head.Seq,
+		payment:   payment{Payer: payer, Payee: payee, Currency: m.Currency, Amount: m.Amount},
+		TxID:      stub.GetTxID(),
+		Timestamp: now,
+	}
+
+	instructionKey, err := stub.CreateCompositeKey(instructionObjType,
+		[]string{batchSeqAttribute(head.Seq), instruction.ID})
+	if err != nil {
+		message := fmt.Sprintf("unable to create a composite key: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if err := putJSON(stub, instructionKey, instruction); err != nil {
+		message := fmt.Sprintf("unable to put the instruction: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	// the head is only read once it is stored, so that instructions don't
+	// conflict with each other, only with the closeBatch that cuts them off
+	if !found {
+		if err := putJSON(stub, headKey, head); err != nil {
+			message := fmt.Sprintf("unable to put the open batch: %s", err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+	}
+
+	logger.Info("SimpleChaincode.addSettlement exited successfully")
+	return shim.Success([]byte(instruction.ID))
+}
+
+// closeBatch closes the open batch at the cut-off, nets its instructions per
+// participant and currency, and emits the manifest in a settlementBatch event.
+// Instructions added after the cut-off go to the next batch.
+func (cc *SimpleChaincode) closeBatch(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.closeBatch")
+
+	if len(args) != 0 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d", len(args), 0)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	if err := requireAdmin(stub); err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 403, Message: message}
+	}
+
+	headKey, head, _, err := getBatchHead(stub)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the open batch: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	it, err := stub.GetStateByPartialCompositeKey(instructionObjType, []string{batchSeqAttribute(head.Seq)})
+	if err != nil {
+		message := fmt.Sprintf("unable to get an iterator over the batch %d: %s", head.Seq, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+	defer it.Close()
+
+	instructions, payments := []string{}, []payment{}
+	for it.HasNext() {
+		response, err := it.Next()
+		if err != nil {
+			message := fmt.Sprintf("unable to get the next element: %s", err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		var instruction settlementInstruction
+		if err := json.Unmarshal(response.Value, &instruction); err != nil {
+			message := fmt.Sprintf("unable to unmarshal the instruction: %s", err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+		instructions = append(instructions, instruction.ID)
+		payments = append(payments, instruction.payment)
+	}
+
+	if len(instructions) == 0 {
+		message := fmt.Sprintf("the batch %d has no instructions", head.Seq)
+		logger.Error(message)
+		return pb.Response{Status: 409, Message: message}
+	}
+
+	now, err := txTime(stub)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the transaction timestamp: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	closedBy, err := callerMSPID(stub)
+	if err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	manifest := batchManifest{
+		Seq:          head.Seq,
+		OpenedAt:     head.OpenedAt,
+		ClosedAt:     now,
+		ClosedBy:     closedBy,
+		TxID:         stub.GetTxID(),
+		Instructions: instructions,
+		Positions:    netPositions(payments),
+	}
+
+	batchKey, err := stub.CreateCompositeKey(batchObjType, []string{batchSeqAttribute(head.Seq)})
+	if err != nil {
+		message := fmt.Sprintf("unable to create a composite key: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if err := putJSON(stub, batchKey, manifest); err != nil {
+		message := fmt.Sprintf("unable to put the batch %d: %s", head.Seq, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if err := putJSON(stub, headKey, batchHead{Seq: head.Seq + 1, OpenedAt: now}); err != nil {
+		message := fmt.Sprintf("unable to open the batch %d: %s", head.Seq+1, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	result, err := json.Marshal(manifest)
+	if err != nil {
+		message := fmt.Sprintf("unable to marshal the result: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if err := stub.SetEvent(settlementBatchEvent, result); err != nil {
+		message := fmt.Sprintf("unable to set the settlement batch event: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.closeBatch exited successfully")
+	return shim.Success(result)
+}
+
+// getBatch returns the manifest of a closed batch.
+func (cc *SimpleChaincode) getBatch(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.getBatch")
+
+	if len(args) != 1 && len(args) != 2 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d or %d", len(args), 1, 2)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	seqArg, format := args[0], formatJSON
+	if len(args) == 2 {
+		format = args[1]
+	}
+	logger.Debugf("batch: %s, format: %s", seqArg, format)
+
+	seq, err := strconv.ParseUint(seqArg, 10, 64)
+	if err != nil {
+		message := fmt.Sprintf("batch must be a positive integer: %s", err.Error())
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	if err := checkFormat(format); err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	batchKey, err := stub.CreateCompositeKey(batchObjType, []string{batchSeqAttribute(seq)})
+	if err != nil {
+		message := fmt.Sprintf("unable to create a composite key: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	var manifest batchManifest
+	found, err := getJSON(stub, batchKey, &manifest)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the batch %d: %s", seq, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if !found {
+		message := fmt.Sprintf("the batch %d not found or still open", seq)
+		logger.Error(message)
+		return pb.Response{Status: 404, Message: message}
+	}
+
+	result, err := marshalResult(&manifest, format)
+	if err != nil {
+		message := fmt.Sprintf("unable to marshal the result: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.getBatch exited successfully")
+	return shim.Success(result)
+}
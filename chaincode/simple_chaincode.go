@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 	pb "github.com/hyperledger/fabric/protos/peer"
@@ -11,13 +12,53 @@ import (
 
 var logger = shim.NewLogger("SimpleChaincode")
 
+// reservedObjTypePrefix marks the object types the chaincode keeps its own
+// bookkeeping under; clients can't read or write them directly.
+const reservedObjTypePrefix = "_"
+
 type SimpleChaincode struct {
 }
 
+type queryResult struct {
+	Key string `json:"key"`
+	*record
+}
+
+type queryResults []queryResult
+
+// Init migrates the state written by earlier versions of the chaincode, see
+// migrate, and seeds the ledger when it's passed a batch of entries, see
+// initLedger:
+//
+//	peer chaincode instantiate ... -c '{"Args":["init","[{\"key\":\"a\",\"value\":\"1\"}]"]}'
 func (cc *SimpleChaincode) Init(stub shim.ChaincodeStubInterface) pb.Response {
 	logger.SetLevel(shim.LogDebug)
 	logger.Info("SimpleChaincode.Init")
-	return shim.Success(nil)
+
+	_, args := stub.GetFunctionAndParameters()
+	if len(args) > 1 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d or %d", len(args), 0, 1)
+		logger.Error(message)
+		return errorResponse(errWrongArgumentCount, message, nil)
+	}
+
+	stub = decorate(stub, txStore)
+	state, err := migrate(stub)
+	if err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return errorResponse(errInternal, message, nil)
+	}
+
+	if state.Version < len(migrations) {
+		logger.Warningf("the state is migrated up to the key %s, invoke migrate to continue", state.Bookmark)
+	}
+
+	if len(args) == 0 {
+		return shim.Success(nil)
+	}
+
+	return structuredError(cc.seedLedger(stub, args[0]))
 }
 
 func (cc *SimpleChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
@@ -26,24 +67,89 @@ func (cc *SimpleChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Response
 	function, args := stub.GetFunctionAndParameters()
 	logger.Debugf("function: %s", function)
 
-	if function == "put" {
-		return cc.put(stub, args)
-	} else if function == "get" {
-		return cc.get(stub, args)
-	} else if function == "del" {
-		return cc.del(stub, args)
-	} else if function == "getByRange" {
-		return cc.getByRange(stub, args)
+	r, ok := routesByName[function]
+	if !ok {
+		names := make([]string, 0, len(routes))
+		for _, r := range routes {
+			names = append(names, r.name)
+		}
+
+		message := fmt.Sprintf("unknown function name: %s, expected one of {%s}", function, strings.Join(names, ", "))
+		logger.Error(message)
+		return errorResponse(errUnknownFunction, message, nil)
 	}
 
-	message := fmt.Sprintf("unknown function name: %s, expected one of {get, put, del, getByRange}", function)
-	logger.Error(message)
-	return pb.Response{Status: 400, Message: message}
+	h := chain(r, r.handlerFor(args), middlewares...)
+	return structuredError(h(cc, stub, args))
 }
 
+// put writes a value under a key, replacing its value if any. options, see
+// putOptions, time-lock the value or make it expire.
 func (cc *SimpleChaincode) put(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	logger.Info("SimpleChaincode.put")
 
+	if len(args) != 3 && len(args) != 4 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d or %d", len(args), 3, 4)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	objType, key, value, optionsArg := args[0], args[1], args[2], ""
+	if len(args) == 4 {
+		optionsArg = args[3]
+	}
+	logger.Debugf("type: %s, key: %s, value: %s, options: %s", objType, key, value, optionsArg)
+
+	if response, denied := accessDenied(stub, accessWrite, objType); denied {
+		return response
+	}
+
+	compositeKey, err := createCompositeKey(stub, objType, key)
+	if err != nil {
+		message := fmt.Sprintf("unable to create a composite key: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	r, err := newRecordVersion(stub, compositeKey, value)
+	if err != nil {
+		message := fmt.Sprintf("unable to put a key-value pair: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if optionsArg != "" {
+		if err := applyPutOptions(r, optionsArg, r.UpdatedAt); err != nil {
+			message := err.Error()
+			logger.Error(message)
+			return pb.Response{Status: 400, Message: message}
+		}
+	}
+
+	err = storeRecord(stub, compositeKey, r)
+	if response, ok := invalidValueResponse(err); ok {
+		return response
+	}
+	if err != nil {
+		message := fmt.Sprintf("unable to put a key-value pair: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if err := appendAudit(stub, "put", objType, key, r); err != nil {
+		message := fmt.Sprintf("unable to append to the audit log: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.put exited successfully")
+	return shim.Success(nil)
+}
+
+// update is put for a key that must already have a value.
+func (cc *SimpleChaincode) update(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.update")
+
 	if len(args) != 3 {
 		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d", len(args), 3)
 		logger.Error(message)
@@ -53,6 +159,10 @@ func (cc *SimpleChaincode) put(stub shim.ChaincodeStubInterface, args []string)
 	objType, key, value := args[0], args[1], args[2]
 	logger.Debugf("type: %s, key: %s, value: %s", objType, key, value)
 
+	if response, denied := accessDenied(stub, accessWrite, objType); denied {
+		return response
+	}
+
 	compositeKey, err := createCompositeKey(stub, objType, key)
 	if err != nil {
 		message := fmt.Sprintf("unable to create a composite key: %s", err.Error())
@@ -60,27 +170,78 @@ func (cc *SimpleChaincode) put(stub shim.ChaincodeStubInterface, args []string)
 		return shim.Error(message)
 	}
 
-	if err := stub.PutState(compositeKey, []byte(value)); err != nil {
+	valueBytes, err := stub.GetState(compositeKey)
+	if err != nil {
+		message := fmt.Sprintf("unable to get a value for the key %s: %s", key, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if valueBytes == nil {
+		message := fmt.Sprintf("a value for the key %s not found", key)
+		logger.Error(message)
+		return pb.Response{Status: 404, Message: message}
+	}
+
+	old := decodeRecord(valueBytes)
+	if old.DeletedAt != nil {
+		return deletedResponse(key, old)
+	}
+
+	now, err := txTime(stub)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the transaction timestamp: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if old.expiredAt(now) {
+		response, _ := unreadableResponse(key, old, now)
+		return response
+	}
+
+	r, err := putRecord(stub, compositeKey, value)
+	if response, ok := invalidValueResponse(err); ok {
+		return response
+	}
+	if err != nil {
 		message := fmt.Sprintf("unable to put a key-value pair: %s", err.Error())
 		logger.Error(message)
 		return shim.Error(message)
 	}
 
-	logger.Info("SimpleChaincode.put exited successfully")
+	if err := appendAudit(stub, "update", objType, key, r); err != nil {
+		message := fmt.Sprintf("unable to append to the audit log: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.update exited successfully")
 	return shim.Success(nil)
 }
 
+// get returns the record of a key: its value in the envelope of its metadata,
+// including the transaction that wrote it and that transaction's creator.
 func (cc *SimpleChaincode) get(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	logger.Info("SimpleChaincode.get")
 
-	if len(args) != 2 {
-		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d", len(args), 2)
+	if len(args) != 2 && len(args) != 3 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d or %d", len(args), 2, 3)
 		logger.Error(message)
 		return pb.Response{Status: 400, Message: message}
 	}
 
-	objType, key := args[0], args[1]
-	logger.Debugf("type: %s, key: %s", objType, key)
+	objType, key, format := args[0], args[1], formatJSON
+	if len(args) == 3 {
+		format = args[2]
+	}
+	logger.Debugf("type: %s, key: %s, format: %s", objType, key, format)
+
+	if err := checkFormat(format); err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
 
 	compositeKey, err := createCompositeKey(stub, objType, key)
 	if err != nil {
@@ -89,21 +250,43 @@ func (cc *SimpleChaincode) get(stub shim.ChaincodeStubInterface, args []string)
 		return shim.Error(message)
 	}
 
-	valueBytes, err := stub.GetState(compositeKey)
+	r, err := getRecord(stub, compositeKey)
 	if err != nil {
 		message := fmt.Sprintf("unable to get a value for the key %s: %s", key, err.Error())
 		logger.Error(message)
 		return shim.Error(message)
 	}
 
-	if valueBytes == nil {
+	if r == nil {
 		message := fmt.Sprintf("a value for the key %s not found", key)
 		logger.Error(message)
 		return pb.Response{Status: 404, Message: message}
 	}
 
+	if r.DeletedAt != nil {
+		return deletedResponse(key, r)
+	}
+
+	now, err := txTime(stub)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the transaction timestamp: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if response, ok := unreadableResponse(key, r, now); ok {
+		return response
+	}
+
+	result, err := marshalResult(r, format)
+	if err != nil {
+		message := fmt.Sprintf("unable to marshal the result: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
 	logger.Info("SimpleChaincode.get exited successfully")
-	return shim.Success(valueBytes)
+	return shim.Success(result)
 }
 
 func (cc *SimpleChaincode) del(stub shim.ChaincodeStubInterface, args []string) pb.Response {
@@ -118,6 +301,10 @@ func (cc *SimpleChaincode) del(stub shim.ChaincodeStubInterface, args []string)
 	objType, key := args[0], args[1]
 	logger.Debugf("type: %s, key: %s", objType, key)
 
+	if response, denied := accessDenied(stub, accessDelete, objType); denied {
+		return response
+	}
+
 	compositeKey, err := createCompositeKey(stub, objType, key)
 	if err != nil {
 		message := fmt.Sprintf("unable to create a composite key: %s", err.Error())
@@ -125,8 +312,8 @@ func (cc *SimpleChaincode) del(stub shim.ChaincodeStubInterface, args []string)
 		return shim.Error(message)
 	}
 
-	if err := stub.DelState(compositeKey); err != nil {
-		message := fmt.Sprintf("unable to delete a pair associated with the key %s: %s", key, err.Error())
+	if err := removeRecord(stub, objType, key, compositeKey); err != nil {
+		message := err.Error()
 		logger.Error(message)
 		return shim.Error(message)
 	}
@@ -138,14 +325,30 @@ func (cc *SimpleChaincode) del(stub shim.ChaincodeStubInterface, args []string)
 func (cc *SimpleChaincode) getByRange(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	logger.Info("SimpleChaincode.getByRange")
 
-	if len(args) != 2 {
-		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d", len(args), 2)
+	if len(args) != 2 && len(args) != 3 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d or %d", len(args), 2, 3)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	keyFrom, keyTo, format := args[0], args[1], formatJSON
+	if len(args) == 3 {
+		format = args[2]
+	}
+	logger.Debugf("range: [\"%s\", \"%s\"), format: %s", keyFrom, keyTo, format)
+
+	if err := checkFormat(format); err != nil {
+		message := err.Error()
 		logger.Error(message)
 		return pb.Response{Status: 400, Message: message}
 	}
 
-	keyFrom, keyTo := args[0], args[1]
-	logger.Debugf("range: [\"%s\", \"%s\")", keyFrom, keyTo)
+	now, err := txTime(stub)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the transaction timestamp: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
 
 	it, err := stub.GetStateByRange(keyFrom, keyTo)
 	if err != nil {
@@ -156,12 +359,99 @@ func (cc *SimpleChaincode) getByRange(stub shim.ChaincodeStubInterface, args []s
 	}
 	defer it.Close()
 
-	type queryResult struct {
-		Key   string `json:"key"`
-		Value string `json:"value"`
+	var entries = queryResults{}
+	for it.HasNext() {
+		response, err := it.Next()
+		if err != nil {
+			message := fmt.Sprintf("unable to get the next element: %s", err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		r := decodeRecord(response.Value)
+		if err := r.verify(); err != nil {
+			message := fmt.Sprintf("unable to get a value for the key %s: %s", response.Key, err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		entry := queryResult{
+			Key:    response.Key,
+			record: r.readableAt(now),
+		}
+		logger.Debugf("entry: (%s, %s)", entry.Key, entry.Value)
+
+		entries = append(entries, entry)
+	}
+
+	result, err := marshalResult(entries, format)
+	if err != nil {
+		message := fmt.Sprintf("unable to marshal the result: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.getByRange exited successfully")
+	return shim.Success(result)
+}
+
+// getByPartialCompositeKey returns the records of an object type whose keys
+// start with the given parts, e.g. all the assets of an owner under keys of
+// [owner, id], without a scan of the whole type. An empty partial key, or [],
+// matches every key of the type.
+func (cc *SimpleChaincode) getByPartialCompositeKey(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.getByPartialCompositeKey")
+
+	if len(args) != 2 && len(args) != 3 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d or %d", len(args), 2, 3)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	objType, partialKey, format := args[0], args[1], formatJSON
+	if len(args) == 3 {
+		format = args[2]
+	}
+	logger.Debugf("type: %s, partial key: %s, format: %s", objType, partialKey, format)
+
+	if err := checkFormat(format); err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	if objType == "" || strings.HasPrefix(objType, reservedObjTypePrefix) {
+		message := fmt.Sprintf("the object type \"%s\" has no composite keys to query", objType)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	var parts []string
+	if partialKey != "" {
+		var err error
+		if parts, err = keyParts(partialKey); err != nil {
+			message := err.Error()
+			logger.Error(message)
+			return pb.Response{Status: 400, Message: message}
+		}
+	}
+
+	now, err := txTime(stub)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the transaction timestamp: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	it, err := stub.GetStateByPartialCompositeKey(objType, parts)
+	if err != nil {
+		message := fmt.Sprintf("unable to get an iterator over the partial key %s: %s", partialKey, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
 	}
+	defer it.Close()
 
-	var entries = []queryResult{}
+	var entries = queryResults{}
 	for it.HasNext() {
 		response, err := it.Next()
 		if err != nil {
@@ -170,36 +460,98 @@ func (cc *SimpleChaincode) getByRange(stub shim.ChaincodeStubInterface, args []s
 			return shim.Error(message)
 		}
 
+		_, attributes, err := stub.SplitCompositeKey(response.Key)
+		if err != nil {
+			message := fmt.Sprintf("unable to split the composite key %s: %s", response.Key, err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		r := decodeRecord(response.Value)
+		if err := r.verify(); err != nil {
+			message := fmt.Sprintf("unable to get a value for the key %s: %s", response.Key, err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
 		entry := queryResult{
-			Key:   response.Key,
-			Value: string(response.Value),
+			Key:    formatKey(attributes),
+			record: r.readableAt(now),
 		}
 		logger.Debugf("entry: (%s, %s)", entry.Key, entry.Value)
 
 		entries = append(entries, entry)
 	}
 
-	result, err := json.Marshal(entries)
+	result, err := marshalResult(entries, format)
 	if err != nil {
 		message := fmt.Sprintf("unable to marshal the result: %s", err.Error())
 		logger.Error(message)
 		return shim.Error(message)
 	}
 
-	logger.Info("SimpleChaincode.getByRange exited successfully")
+	logger.Info("SimpleChaincode.getByPartialCompositeKey exited successfully")
 	return shim.Success(result)
 }
 
+// keyParts returns the attributes of key. A key of several parts, e.g. an
+// owner and an asset id, is passed as a JSON array of them, ["owner", "id"];
+// any other key is a single part.
+func keyParts(key string) ([]string, error) {
+	if !strings.HasPrefix(key, "[") {
+		return []string{key}, nil
+	}
+
+	var parts []string
+	if err := json.Unmarshal([]byte(key), &parts); err != nil {
+		return nil, fmt.Errorf("a key starting with \"[\" must be a JSON array of strings: %s", err.Error())
+	}
+
+	for _, part := range parts {
+		if part == "" {
+			return nil, errors.New("key parts must be non-empty strings")
+		}
+	}
+
+	return parts, nil
+}
+
+// formatKey is the inverse of keyParts.
+func formatKey(parts []string) string {
+	if len(parts) == 1 && !strings.HasPrefix(parts[0], "[") {
+		return parts[0]
+	}
+
+	keyBytes, _ := json.Marshal(parts)
+	return string(keyBytes)
+}
+
 func createCompositeKey(stub shim.ChaincodeStubInterface, objType, key string) (string, error) {
 	if key == "" {
 		return "", errors.New("key must be a non-empty string")
 	}
 
+	if strings.HasPrefix(objType, reservedObjTypePrefix) {
+		return "", fmt.Errorf("object types starting with %q are reserved", reservedObjTypePrefix)
+	}
+
+	parts, err := keyParts(key)
+	if err != nil {
+		return "", err
+	}
+
+	if len(parts) == 0 {
+		return "", errors.New("key must have at least one part")
+	}
+
 	if objType == "" {
-		return key, nil
+		if len(parts) > 1 {
+			return "", errors.New("a key of several parts needs an object type")
+		}
+		return parts[0], nil
 	}
 
-	return stub.CreateCompositeKey(objType, []string{key})
+	return stub.CreateCompositeKey(objType, parts)
 }
 
 func main() {
@@ -0,0 +1,712 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// source: simple_chaincode.proto
+
+package main
+
+import (
+	fmt "fmt"
+	proto "github.com/golang/protobuf/proto"
+	timestamp "github.com/golang/protobuf/ptypes/timestamp"
+	math "math"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
+
+// Record is a stored value with its envelope. Text values are UTF-8 encoded,
+// binary ones are the raw bytes.
+type Record struct {
+	Key         string               `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	Value       []byte               `protobuf:"bytes,2,opt,name=value,proto3" json:"value,omitempty"`
+	ContentType string               `protobuf:"bytes,3,opt,name=content_type,json=contentType,proto3" json:"content_type,omitempty"`
+	CreatedAt   *timestamp.Timestamp `protobuf:"bytes,4,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	UpdatedAt   *timestamp.Timestamp `protobuf:"bytes,5,opt,name=updated_at,json=updatedAt,proto3" json:"updated_at,omitempty"`
+	ArchivedAt  *timestamp.Timestamp `protobuf:"bytes,6,opt,name=archived_at,json=archivedAt,proto3" json:"archived_at,omitempty"`
+	UnlockAt    *timestamp.Timestamp `protobuf:"bytes,7,opt,name=unlock_at,json=unlockAt,proto3" json:"unlock_at,omitempty"`
+	// checksum is the hex SHA-256 of value
+	Checksum string `protobuf:"bytes,8,opt,name=checksum,proto3" json:"checksum,omitempty"`
+	Size     int64  `protobuf:"varint,9,opt,name=size,proto3" json:"size,omitempty"`
+	Version  uint64 `protobuf:"varint,10,opt,name=version,proto3" json:"version,omitempty"`
+	// the transaction that wrote the record and the MSP and certificate
+	// subject of its creator
+	TxId           string `protobuf:"bytes,11,opt,name=tx_id,json=txId,proto3" json:"tx_id,omitempty"`
+	CreatorMspId   string `protobuf:"bytes,12,opt,name=creator_msp_id,json=creatorMspId,proto3" json:"creator_msp_id,omitempty"`
+	CreatorSubject string `protobuf:"bytes,13,opt,name=creator_subject,json=creatorSubject,proto3" json:"creator_subject,omitempty"`
+	// set for a record marked deleted
+	DeletedAt            *timestamp.Timestamp `protobuf:"bytes,14,opt,name=deleted_at,json=deletedAt,proto3" json:"deleted_at,omitempty"`
+	DeletedByMspId       string               `protobuf:"bytes,15,opt,name=deleted_by_msp_id,json=deletedByMspId,proto3" json:"deleted_by_msp_id,omitempty"`
+	DeletedBySubject     string               `protobuf:"bytes,16,opt,name=deleted_by_subject,json=deletedBySubject,proto3" json:"deleted_by_subject,omitempty"`
+	ExpiresAt            *timestamp.Timestamp `protobuf:"bytes,17,opt,name=expires_at,json=expiresAt,proto3" json:"expires_at,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}             `json:"-"`
+	XXX_unrecognized     []byte               `json:"-"`
+	XXX_sizecache        int32                `json:"-"`
+}
+
+func (m *Record) Reset()         { *m = Record{} }
+func (m *Record) String() string { return proto.CompactTextString(m) }
+func (*Record) ProtoMessage()    {}
+func (*Record) Descriptor() ([]byte, []int) {
+	return fileDescriptor_c63d885ce4650c73, []int{0}
+}
+
+func (m *Record) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Record.Unmarshal(m, b)
+}
+func (m *Record) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Record.Marshal(b, m, deterministic)
+}
+func (m *Record) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Record.Merge(m, src)
+}
+func (m *Record) XXX_Size() int {
+	return xxx_messageInfo_Record.Size(m)
+}
+func (m *Record) XXX_DiscardUnknown() {
+	xxx_messageInfo_Record.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Record proto.InternalMessageInfo
+
+func (m *Record) GetKey() string {
+	if m != nil {
+		return m.Key
+	}
+	return ""
+}
+
+func (m *Record) GetValue() []byte {
+	if m != nil {
+		return m.Value
+	}
+	return nil
+}
+
+func (m *Record) GetContentType() string {
+	if m != nil {
+		return m.ContentType
+	}
+	return ""
+}
+
+func (m *Record) GetCreatedAt() *timestamp.Timestamp {
+	if m != nil {
+		return m.CreatedAt
+	}
+	return nil
+}
+
+func (m *Record) GetUpdatedAt() *timestamp.Timestamp {
+	if m != nil {
+		return m.UpdatedAt
+	}
+	return nil
+}
+
+func (m *Record) GetArchivedAt() *timestamp.Timestamp {
+	if m != nil {
+		return m.ArchivedAt
+	}
+	return nil
+}
+
+func (m *Record) GetUnlockAt() *timestamp.Timestamp {
+	if m != nil {
+		return m.UnlockAt
+	}
+	return nil
+}
+
+func (m *Record) GetChecksum() string {
+	if m != nil {
+		return m.Checksum
+	}
+	return ""
+}
+
+func (m *Record) GetSize() int64 {
+	if m != nil {
+		return m.Size
+	}
+	return 0
+}
+
+func (m *Record) GetVersion() uint64 {
+	if m != nil {
+		return m.Version
+	}
+	return 0
+}
+
+func (m *Record) GetTxId() string {
+	if m != nil {
+		return m.TxId
+	}
+	return ""
+}
+
+func (m *Record) GetCreatorMspId() string {
+	if m != nil {
+		return m.CreatorMspId
+	}
+	return ""
+}
+
+func (m *Record) GetCreatorSubject() string {
+	if m != nil {
+		return m.CreatorSubject
+	}
+	return ""
+}
+
+func (m *Record) GetDeletedAt() *timestamp.Timestamp {
+	if m != nil {
+		return m.DeletedAt
+	}
+	return nil
+}
+
+func (m *Record) GetDeletedByMspId() string {
+	if m != nil {
+		return m.DeletedByMspId
+	}
+	return ""
+}
+
+func (m *Record) GetDeletedBySubject() string {
+	if m != nil {
+		return m.DeletedBySubject
+	}
+	return ""
+}
+
+func (m *Record) GetExpiresAt() *timestamp.Timestamp {
+	if m != nil {
+		return m.ExpiresAt
+	}
+	return nil
+}
+
+// QueryResults is a page of records. The bookmark and the count are only set
+// by paginated queries.
+type QueryResults struct {
+	Records              []*Record `protobuf:"bytes,1,rep,name=records,proto3" json:"records,omitempty"`
+	Bookmark             string    `protobuf:"bytes,2,opt,name=bookmark,proto3" json:"bookmark,omitempty"`
+	FetchedRecordsCount  int32     `protobuf:"varint,3,opt,name=fetched_records_count,json=fetchedRecordsCount,proto3" json:"fetched_records_count,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}  `json:"-"`
+	XXX_unrecognized     []byte    `json:"-"`
+	XXX_sizecache        int32     `json:"-"`
+}
+
+func (m *QueryResults) Reset()         { *m = QueryResults{} }
+func (m *QueryResults) String() string { return proto.CompactTextString(m) }
+func (*QueryResults) ProtoMessage()    {}
+func (*QueryResults) Descriptor() ([]byte, []int) {
+	return fileDescriptor_c63d885ce4650c73, []int{1}
+}
+
+func (m *QueryResults) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_QueryResults.Unmarshal(m, b)
+}
+func (m *QueryResults) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_QueryResults.Marshal(b, m, deterministic)
+}
+func (m *QueryResults) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_QueryResults.Merge(m, src)
+}
+func (m *QueryResults) XXX_Size() int {
+	return xxx_messageInfo_QueryResults.Size(m)
+}
+func (m *QueryResults) XXX_DiscardUnknown() {
+	xxx_messageInfo_QueryResults.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_QueryResults proto.InternalMessageInfo
+
+func (m *QueryResults) GetRecords() []*Record {
+	if m != nil {
+		return m.Records
+	}
+	return nil
+}
+
+func (m *QueryResults) GetBookmark() string {
+	if m != nil {
+		return m.Bookmark
+	}
+	return ""
+}
+
+func (m *QueryResults) GetFetchedRecordsCount() int32 {
+	if m != nil {
+		return m.FetchedRecordsCount
+	}
+	return 0
+}
+
+// History is the modifications of a key, oldest first.
+type History struct {
+	Entries              []*HistoryEntry `protobuf:"bytes,1,rep,name=entries,proto3" json:"entries,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}        `json:"-"`
+	XXX_unrecognized     []byte          `json:"-"`
+	XXX_sizecache        int32           `json:"-"`
+}
+
+func (m *History) Reset()         { *m = History{} }
+func (m *History) String() string { return proto.CompactTextString(m) }
+func (*History) ProtoMessage()    {}
+func (*History) Descriptor() ([]byte, []int) {
+	return fileDescriptor_c63d885ce4650c73, []int{2}
+}
+
+func (m *History) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_History.Unmarshal(m, b)
+}
+func (m *History) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_History.Marshal(b, m, deterministic)
+}
+func (m *History) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_History.Merge(m, src)
+}
+func (m *History) XXX_Size() int {
+	return xxx_messageInfo_History.Size(m)
+}
+func (m *History) XXX_DiscardUnknown() {
+	xxx_messageInfo_History.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_History proto.InternalMessageInfo
+
+func (m *History) GetEntries() []*HistoryEntry {
+	if m != nil {
+		return m.Entries
+	}
+	return nil
+}
+
+// HistoryEntry is a modification of a key: the record it set, or none for a
+// deletion.
+type HistoryEntry struct {
+	TxId                 string               `protobuf:"bytes,1,opt,name=tx_id,json=txId,proto3" json:"tx_id,omitempty"`
+	Timestamp            *timestamp.Timestamp `protobuf:"bytes,2,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	IsDelete             bool                 `protobuf:"varint,3,opt,name=is_delete,json=isDelete,proto3" json:"is_delete,omitempty"`
+	Record               *Record              `protobuf:"bytes,4,opt,name=record,proto3" json:"record,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}             `json:"-"`
+	XXX_unrecognized     []byte               `json:"-"`
+	XXX_sizecache        int32                `json:"-"`
+}
+
+func (m *HistoryEntry) Reset()         { *m = HistoryEntry{} }
+func (m *HistoryEntry) String() string { return proto.CompactTextString(m) }
+func (*HistoryEntry) ProtoMessage()    {}
+func (*HistoryEntry) Descriptor() ([]byte, []int) {
+	return fileDescriptor_c63d885ce4650c73, []int{3}
+}
+
+func (m *HistoryEntry) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_HistoryEntry.Unmarshal(m, b)
+}
+func (m *HistoryEntry) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_HistoryEntry.Marshal(b, m, deterministic)
+}
+func (m *HistoryEntry) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_HistoryEntry.Merge(m, src)
+}
+func (m *HistoryEntry) XXX_Size() int {
+	return xxx_messageInfo_HistoryEntry.Size(m)
+}
+func (m *HistoryEntry) XXX_DiscardUnknown() {
+	xxx_messageInfo_HistoryEntry.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_HistoryEntry proto.InternalMessageInfo
+
+func (m *HistoryEntry) GetTxId() string {
+	if m != nil {
+		return m.TxId
+	}
+	return ""
+}
+
+func (m *HistoryEntry) GetTimestamp() *timestamp.Timestamp {
+	if m != nil {
+		return m.Timestamp
+	}
+	return nil
+}
+
+func (m *HistoryEntry) GetIsDelete() bool {
+	if m != nil {
+		return m.IsDelete
+	}
+	return false
+}
+
+func (m *HistoryEntry) GetRecord() *Record {
+	if m != nil {
+		return m.Record
+	}
+	return nil
+}
+
+// ResponseEnvelope wraps a payload together with the status and the message
+// of the chaincode response, for clients that forward responses as is.
+type ResponseEnvelope struct {
+	Status               int32    `protobuf:"varint,1,opt,name=status,proto3" json:"status,omitempty"`
+	Message              string   `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
+	Payload              []byte   `protobuf:"bytes,3,opt,name=payload,proto3" json:"payload,omitempty"`
+	Format               string   `protobuf:"bytes,4,opt,name=format,proto3" json:"format,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ResponseEnvelope) Reset()         { *m = ResponseEnvelope{} }
+func (m *ResponseEnvelope) String() string { return proto.CompactTextString(m) }
+func (*ResponseEnvelope) ProtoMessage()    {}
+func (*ResponseEnvelope) Descriptor() ([]byte, []int) {
+	return fileDescriptor_c63d885ce4650c73, []int{4}
+}
+
+func (m *ResponseEnvelope) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ResponseEnvelope.Unmarshal(m, b)
+}
+func (m *ResponseEnvelope) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ResponseEnvelope.Marshal(b, m, deterministic)
+}
+func (m *ResponseEnvelope) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ResponseEnvelope.Merge(m, src)
+}
+func (m *ResponseEnvelope) XXX_Size() int {
+	return xxx_messageInfo_ResponseEnvelope.Size(m)
+}
+func (m *ResponseEnvelope) XXX_DiscardUnknown() {
+	xxx_messageInfo_ResponseEnvelope.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ResponseEnvelope proto.InternalMessageInfo
+
+func (m *ResponseEnvelope) GetStatus() int32 {
+	if m != nil {
+		return m.Status
+	}
+	return 0
+}
+
+func (m *ResponseEnvelope) GetMessage() string {
+	if m != nil {
+		return m.Message
+	}
+	return ""
+}
+
+func (m *ResponseEnvelope) GetPayload() []byte {
+	if m != nil {
+		return m.Payload
+	}
+	return nil
+}
+
+func (m *ResponseEnvelope) GetFormat() string {
+	if m != nil {
+		return m.Format
+	}
+	return ""
+}
+
+// ArchivalManifest is the payload of the archivalManifest event.
+type ArchivalManifest struct {
+	ObjType              string               `protobuf:"bytes,1,opt,name=obj_type,json=objType,proto3" json:"obj_type,omitempty"`
+	Action               string               `protobuf:"bytes,2,opt,name=action,proto3" json:"action,omitempty"`
+	AppliedAt            *timestamp.Timestamp `protobuf:"bytes,3,opt,name=applied_at,json=appliedAt,proto3" json:"applied_at,omitempty"`
+	Cutoff               *timestamp.Timestamp `protobuf:"bytes,4,opt,name=cutoff,proto3" json:"cutoff,omitempty"`
+	Records              []*ArchivedRecord    `protobuf:"bytes,5,rep,name=records,proto3" json:"records,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}             `json:"-"`
+	XXX_unrecognized     []byte               `json:"-"`
+	XXX_sizecache        int32                `json:"-"`
+}
+
+func (m *ArchivalManifest) Reset()         { *m = ArchivalManifest{} }
+func (m *ArchivalManifest) String() string { return proto.CompactTextString(m) }
+func (*ArchivalManifest) ProtoMessage()    {}
+func (*ArchivalManifest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_c63d885ce4650c73, []int{5}
+}
+
+func (m *ArchivalManifest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ArchivalManifest.Unmarshal(m, b)
+}
+func (m *ArchivalManifest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ArchivalManifest.Marshal(b, m, deterministic)
+}
+func (m *ArchivalManifest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ArchivalManifest.Merge(m, src)
+}
+func (m *ArchivalManifest) XXX_Size() int {
+	return xxx_messageInfo_ArchivalManifest.Size(m)
+}
+func (m *ArchivalManifest) XXX_DiscardUnknown() {
+	xxx_messageInfo_ArchivalManifest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ArchivalManifest proto.InternalMessageInfo
+
+func (m *ArchivalManifest) GetObjType() string {
+	if m != nil {
+		return m.ObjType
+	}
+	return ""
+}
+
+func (m *ArchivalManifest) GetAction() string {
+	if m != nil {
+		return m.Action
+	}
+	return ""
+}
+
+func (m *ArchivalManifest) GetAppliedAt() *timestamp.Timestamp {
+	if m != nil {
+		return m.AppliedAt
+	}
+	return nil
+}
+
+func (m *ArchivalManifest) GetCutoff() *timestamp.Timestamp {
+	if m != nil {
+		return m.Cutoff
+	}
+	return nil
+}
+
+func (m *ArchivalManifest) GetRecords() []*ArchivedRecord {
+	if m != nil {
+		return m.Records
+	}
+	return nil
+}
+
+type ArchivedRecord struct {
+	Key                  string               `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	CreatedAt            *timestamp.Timestamp `protobuf:"bytes,2,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	UpdatedAt            *timestamp.Timestamp `protobuf:"bytes,3,opt,name=updated_at,json=updatedAt,proto3" json:"updated_at,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}             `json:"-"`
+	XXX_unrecognized     []byte               `json:"-"`
+	XXX_sizecache        int32                `json:"-"`
+}
+
+func (m *ArchivedRecord) Reset()         { *m = ArchivedRecord{} }
+func (m *ArchivedRecord) String() string { return proto.CompactTextString(m) }
+func (*ArchivedRecord) ProtoMessage()    {}
+func (*ArchivedRecord) Descriptor() ([]byte, []int) {
+	return fileDescriptor_c63d885ce4650c73, []int{6}
+}
+
+func (m *ArchivedRecord) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ArchivedRecord.Unmarshal(m, b)
+}
+func (m *ArchivedRecord) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ArchivedRecord.Marshal(b, m, deterministic)
+}
+func (m *ArchivedRecord) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ArchivedRecord.Merge(m, src)
+}
+func (m *ArchivedRecord) XXX_Size() int {
+	return xxx_messageInfo_ArchivedRecord.Size(m)
+}
+func (m *ArchivedRecord) XXX_DiscardUnknown() {
+	xxx_messageInfo_ArchivedRecord.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ArchivedRecord proto.InternalMessageInfo
+
+func (m *ArchivedRecord) GetKey() string {
+	if m != nil {
+		return m.Key
+	}
+	return ""
+}
+
+func (m *ArchivedRecord) GetCreatedAt() *timestamp.Timestamp {
+	if m != nil {
+		return m.CreatedAt
+	}
+	return nil
+}
+
+func (m *ArchivedRecord) GetUpdatedAt() *timestamp.Timestamp {
+	if m != nil {
+		return m.UpdatedAt
+	}
+	return nil
+}
+
+// BatchRequest carries the entries of a putBatch, getBatchRecords or
+// delBatch, as an alternative to a JSON array.
+type BatchRequest struct {
+	Entries              []*BatchEntry `protobuf:"bytes,1,rep,name=entries,proto3" json:"entries,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}      `json:"-"`
+	XXX_unrecognized     []byte        `json:"-"`
+	XXX_sizecache        int32         `json:"-"`
+}
+
+func (m *BatchRequest) Reset()         { *m = BatchRequest{} }
+func (m *BatchRequest) String() string { return proto.CompactTextString(m) }
+func (*BatchRequest) ProtoMessage()    {}
+func (*BatchRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_c63d885ce4650c73, []int{7}
+}
+
+func (m *BatchRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_BatchRequest.Unmarshal(m, b)
+}
+func (m *BatchRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_BatchRequest.Marshal(b, m, deterministic)
+}
+func (m *BatchRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_BatchRequest.Merge(m, src)
+}
+func (m *BatchRequest) XXX_Size() int {
+	return xxx_messageInfo_BatchRequest.Size(m)
+}
+func (m *BatchRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_BatchRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_BatchRequest proto.InternalMessageInfo
+
+func (m *BatchRequest) GetEntries() []*BatchEntry {
+	if m != nil {
+		return m.Entries
+	}
+	return nil
+}
+
+type BatchEntry struct {
+	ObjType              string   `protobuf:"bytes,1,opt,name=obj_type,json=objType,proto3" json:"obj_type,omitempty"`
+	Key                  string   `protobuf:"bytes,2,opt,name=key,proto3" json:"key,omitempty"`
+	Value                string   `protobuf:"bytes,3,opt,name=value,proto3" json:"value,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *BatchEntry) Reset()         { *m = BatchEntry{} }
+func (m *BatchEntry) String() string { return proto.CompactTextString(m) }
+func (*BatchEntry) ProtoMessage()    {}
+func (*BatchEntry) Descriptor() ([]byte, []int) {
+	return fileDescriptor_c63d885ce4650c73, []int{8}
+}
+
+func (m *BatchEntry) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_BatchEntry.Unmarshal(m, b)
+}
+func (m *BatchEntry) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_BatchEntry.Marshal(b, m, deterministic)
+}
+func (m *BatchEntry) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_BatchEntry.Merge(m, src)
+}
+func (m *BatchEntry) XXX_Size() int {
+	return xxx_messageInfo_BatchEntry.Size(m)
+}
+func (m *BatchEntry) XXX_DiscardUnknown() {
+	xxx_messageInfo_BatchEntry.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_BatchEntry proto.InternalMessageInfo
+
+func (m *BatchEntry) GetObjType() string {
+	if m != nil {
+		return m.ObjType
+	}
+	return ""
+}
+
+func (m *BatchEntry) GetKey() string {
+	if m != nil {
+		return m.Key
+	}
+	return ""
+}
+
+func (m *BatchEntry) GetValue() string {
+	if m != nil {
+		return m.Value
+	}
+	return ""
+}
+
+func init() {
+	proto.RegisterType((*Record)(nil), "simplechaincode.Record")
+	proto.RegisterType((*QueryResults)(nil), "simplechaincode.QueryResults")
+	proto.RegisterType((*History)(nil), "simplechaincode.History")
+	proto.RegisterType((*HistoryEntry)(nil), "simplechaincode.HistoryEntry")
+	proto.RegisterType((*ResponseEnvelope)(nil), "simplechaincode.ResponseEnvelope")
+	proto.RegisterType((*ArchivalManifest)(nil), "simplechaincode.ArchivalManifest")
+	proto.RegisterType((*ArchivedRecord)(nil), "simplechaincode.ArchivedRecord")
+	proto.RegisterType((*BatchRequest)(nil), "simplechaincode.BatchRequest")
+	proto.RegisterType((*BatchEntry)(nil), "simplechaincode.BatchEntry")
+}
+
+func init() { proto.RegisterFile("simple_chaincode.proto", fileDescriptor_c63d885ce4650c73) }
+
+var fileDescriptor_c63d885ce4650c73 = []byte{
+	// 777 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x9c, 0x55, 0xdd, 0x6e, 0xeb, 0x44,
+	0x10, 0x96, 0xf3, 0xe3, 0xc4, 0x13, 0xd3, 0xe6, 0xec, 0x81, 0x62, 0x7a, 0x84, 0x4e, 0xb0, 0x90,
+	0x08, 0x12, 0x4a, 0x45, 0x10, 0x3a, 0x1c, 0x71, 0xe5, 0x40, 0x25, 0x7a, 0x51, 0x21, 0x96, 0x5e,
+	0x71, 0x63, 0x6d, 0xec, 0x49, 0xe3, 0xc6, 0xf6, 0x1a, 0xef, 0x3a, 0xaa, 0x79, 0x0b, 0xee, 0x78,
+	0x07, 0x5e, 0x81, 0x77, 0xe2, 0x15, 0x90, 0x77, 0xd7, 0x69, 0x9a, 0x16, 0x02, 0xdc, 0x79, 0x66,
+	0xbe, 0xb1, 0xbf, 0xfd, 0xf6, 0x9b, 0x31, 0x9c, 0x89, 0x24, 0x2b, 0x52, 0x0c, 0xa3, 0x35, 0x4b,
+	0xf2, 0x88, 0xc7, 0x38, 0x2b, 0x4a, 0x2e, 0x39, 0x39, 0xd5, 0xf9, 0x5d, 0xfa, 0xfc, 0xf5, 0x2d,
+	0xe7, 0xb7, 0x29, 0x5e, 0xa8, 0xf2, 0xb2, 0x5a, 0x5d, 0xc8, 0x24, 0x43, 0x21, 0x59, 0x56, 0xe8,
+	0x0e, 0xff, 0x8f, 0x3e, 0xd8, 0x14, 0x23, 0x5e, 0xc6, 0x64, 0x0c, 0xdd, 0x0d, 0xd6, 0x9e, 0x35,
+	0xb1, 0xa6, 0x0e, 0x6d, 0x1e, 0xc9, 0xbb, 0xd0, 0xdf, 0xb2, 0xb4, 0x42, 0xaf, 0x33, 0xb1, 0xa6,
+	0x2e, 0xd5, 0x01, 0xf9, 0x08, 0xdc, 0x88, 0xe7, 0x12, 0x73, 0x19, 0xca, 0xba, 0x40, 0xaf, 0xab,
+	0x1a, 0x46, 0x26, 0x77, 0x53, 0x17, 0x48, 0xde, 0x02, 0x44, 0x25, 0x32, 0x89, 0x71, 0xc8, 0xa4,
+	0xd7, 0x9b, 0x58, 0xd3, 0xd1, 0xfc, 0x7c, 0xa6, 0xb9, 0xcc, 0x5a, 0x2e, 0xb3, 0x9b, 0x96, 0x0b,
+	0x75, 0x0c, 0x3a, 0x90, 0x4d, 0x6b, 0x55, 0xc4, 0x6d, 0x6b, 0xff, 0x78, 0xab, 0x41, 0x07, 0x92,
+	0x7c, 0x0d, 0x23, 0x56, 0x46, 0xeb, 0x64, 0xab, 0x7b, 0xed, 0xa3, 0xbd, 0xd0, 0xc2, 0x03, 0x49,
+	0xde, 0x80, 0x53, 0xe5, 0x29, 0x8f, 0x36, 0x4d, 0xeb, 0xe0, 0x68, 0xeb, 0x50, 0x83, 0x03, 0x49,
+	0xce, 0x61, 0x18, 0xad, 0x31, 0xda, 0x88, 0x2a, 0xf3, 0x86, 0x4a, 0x8a, 0x5d, 0x4c, 0x08, 0xf4,
+	0x44, 0xf2, 0x0b, 0x7a, 0xce, 0xc4, 0x9a, 0x76, 0xa9, 0x7a, 0x26, 0x1e, 0x0c, 0xb6, 0x58, 0x8a,
+	0x84, 0xe7, 0x1e, 0x4c, 0xac, 0x69, 0x8f, 0xb6, 0x21, 0x79, 0x09, 0x7d, 0x79, 0x1f, 0x26, 0xb1,
+	0x37, 0x52, 0xaf, 0xe9, 0xc9, 0xfb, 0xab, 0x98, 0x7c, 0x0c, 0x27, 0x4a, 0x1c, 0x5e, 0x86, 0x99,
+	0x28, 0x9a, 0xaa, 0xab, 0xaa, 0xae, 0xc9, 0x5e, 0x8b, 0xe2, 0x2a, 0x26, 0x9f, 0xc0, 0x69, 0x8b,
+	0x12, 0xd5, 0xf2, 0x0e, 0x23, 0xe9, 0xbd, 0xa3, 0x60, 0x6d, 0xf3, 0x8f, 0x3a, 0xdb, 0xc8, 0x1b,
+	0x63, 0x8a, 0x46, 0xde, 0x93, 0xe3, 0xf2, 0x1a, 0x74, 0x20, 0xc9, 0xa7, 0xf0, 0xa2, 0x6d, 0x5d,
+	0xd6, 0x2d, 0x99, 0x53, 0xfd, 0x15, 0x53, 0x58, 0xd4, 0x9a, 0xce, 0x67, 0x40, 0xf6, 0xa0, 0x2d,
+	0xa3, 0xb1, 0xc2, 0x8e, 0x77, 0xd8, 0x3d, 0x4e, 0x78, 0x5f, 0x24, 0x25, 0x8a, 0x86, 0xd3, 0x8b,
+	0xe3, 0x9c, 0x0c, 0x3a, 0x90, 0xfe, 0xaf, 0x16, 0xb8, 0x3f, 0x54, 0x58, 0xd6, 0x14, 0x45, 0x95,
+	0x4a, 0x41, 0x3e, 0x87, 0x41, 0xa9, 0xec, 0x2c, 0x3c, 0x6b, 0xd2, 0x9d, 0x8e, 0xe6, 0xef, 0xcf,
+	0x0e, 0x66, 0x62, 0xa6, 0xed, 0x4e, 0x5b, 0x5c, 0x73, 0x81, 0x4b, 0xce, 0x37, 0x19, 0x2b, 0x37,
+	0xca, 0xe8, 0x0e, 0xdd, 0xc5, 0x64, 0x0e, 0xef, 0xad, 0x50, 0x46, 0x6b, 0x8c, 0x43, 0x03, 0x0f,
+	0x23, 0x5e, 0xe5, 0x52, 0x99, 0xbe, 0x4f, 0x5f, 0x9a, 0xa2, 0x7e, 0xa5, 0xf8, 0xa6, 0x29, 0xf9,
+	0x0b, 0x18, 0x7c, 0x97, 0x08, 0xc9, 0xcb, 0x9a, 0xbc, 0x81, 0x01, 0xe6, 0xb2, 0x4c, 0xb0, 0x65,
+	0xf3, 0xe1, 0x13, 0x36, 0x06, 0x7a, 0x99, 0xcb, 0xb2, 0xa6, 0x2d, 0xda, 0xff, 0xdd, 0x02, 0x77,
+	0xbf, 0xf2, 0xe0, 0x0d, 0x6b, 0xcf, 0x1b, 0x5f, 0x81, 0xb3, 0x9b, 0x67, 0xaf, 0x73, 0x5c, 0xb7,
+	0x1d, 0x98, 0xbc, 0x02, 0x27, 0x11, 0xa1, 0xbe, 0x09, 0x75, 0x96, 0x21, 0x1d, 0x26, 0xe2, 0x5b,
+	0x15, 0x93, 0x0b, 0xb0, 0xf5, 0x61, 0xcd, 0xe4, 0xfe, 0xad, 0x84, 0x06, 0xe6, 0x6f, 0x61, 0x4c,
+	0x51, 0x14, 0x3c, 0x17, 0x78, 0x99, 0x6f, 0x31, 0xe5, 0x05, 0x92, 0x33, 0xb0, 0x85, 0x64, 0xb2,
+	0x12, 0x8a, 0x71, 0x9f, 0x9a, 0xa8, 0xb1, 0x7f, 0x86, 0x42, 0xb0, 0x5b, 0x34, 0x62, 0xb7, 0x61,
+	0x53, 0x29, 0x58, 0x9d, 0x72, 0x16, 0x2b, 0x46, 0x2e, 0x6d, 0xc3, 0xe6, 0x5d, 0x2b, 0x5e, 0x66,
+	0x66, 0x95, 0x38, 0xd4, 0x44, 0xfe, 0x9f, 0x16, 0x8c, 0x03, 0x35, 0xc2, 0x2c, 0xbd, 0x66, 0x79,
+	0xb2, 0x42, 0x21, 0xc9, 0x07, 0x30, 0xe4, 0xcb, 0x3b, 0xbd, 0x9a, 0xb4, 0x58, 0x03, 0xbe, 0xbc,
+	0x53, 0x6b, 0xe9, 0x0c, 0x6c, 0x16, 0xc9, 0x66, 0xf2, 0xf4, 0xa7, 0x4d, 0xd4, 0x18, 0x90, 0x15,
+	0x45, 0x9a, 0xe8, 0xa1, 0xe8, 0x1e, 0x17, 0xd2, 0xa0, 0x03, 0x49, 0xe6, 0x60, 0x47, 0x95, 0xe4,
+	0xab, 0xd5, 0xbf, 0xd8, 0x72, 0x06, 0x49, 0xde, 0x3e, 0x78, 0xb4, 0xaf, 0x5c, 0xf1, 0xfa, 0x89,
+	0xc0, 0x81, 0x59, 0x4c, 0x07, 0x5e, 0xf5, 0x7f, 0xb3, 0xe0, 0xe4, 0x71, 0xed, 0x99, 0xb5, 0xfd,
+	0x78, 0xfb, 0x76, 0xfe, 0xff, 0xf6, 0xed, 0xfe, 0x87, 0xed, 0xeb, 0x5f, 0x82, 0xbb, 0x60, 0x32,
+	0x5a, 0x53, 0xfc, 0xb9, 0x6a, 0xee, 0xe1, 0xcb, 0x43, 0xef, 0xbf, 0x7a, 0x72, 0x4a, 0x85, 0x3f,
+	0x70, 0xfe, 0xf7, 0x00, 0x0f, 0xe9, 0x7f, 0xba, 0x4c, 0x73, 0xee, 0xce, 0x33, 0xbf, 0x2b, 0xfd,
+	0x47, 0xd2, 0xc1, 0xc2, 0xfe, 0xa9, 0x97, 0xb1, 0x24, 0x5f, 0xda, 0x8a, 0xfe, 0x17, 0x7f, 0x0d,
+	0x00, 0x1f, 0xc1, 0x43, 0x19, 0x3c, 0x07, 0x00, 0x00,
+}
@@ -0,0 +1,2352 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/ledger/queryresult"
+	"github.com/hyperledger/fabric/protos/msp"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// The tests run the chaincode against shim.MockStub, which keeps the state
+// in memory and supports everything the chaincode uses but rich queries. A
+// test invokes functions the way a peer would, by name and string arguments,
+// and checks the responses.
+
+// testStub is a shim.MockStub with the creator and the transient map a client
+// would send, which the MockStub of Fabric 1.4 has no way to set, and with a
+// clock: unless now is zero, transactions are timestamped with it instead of
+// the current time. The chaincode is invoked with the testStub in place of
+// its MockStub, see testChaincode.
+type testStub struct {
+	*shim.MockStub
+	creator   []byte
+	transient map[string][]byte
+	now       time.Time
+}
+
+func (s *testStub) GetCreator() ([]byte, error) {
+	return s.creator, nil
+}
+
+func (s *testStub) GetTransient() (map[string][]byte, error) {
+	return s.transient, nil
+}
+
+func (s *testStub) GetTxTimestamp() (*timestamp.Timestamp, error) {
+	if s.now.IsZero() {
+		return s.MockStub.GetTxTimestamp()
+	}
+
+	return ptypes.TimestampProto(s.now)
+}
+
+// GetStateByRangeWithPagination and GetStateByPartialCompositeKeyWithPagination
+// page the queries the MockStub only answers whole, the bookmark being the key
+// the next page starts at.
+func (s *testStub) GetStateByRangeWithPagination(startKey, endKey string, pageSize int32,
+	bookmark string) (shim.StateQueryIteratorInterface, *pb.QueryResponseMetadata, error) {
+	it, err := s.GetStateByRange(startKey, endKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return readMockPage(it, pageSize, bookmark)
+}
+
+func (s *testStub) GetStateByPartialCompositeKeyWithPagination(objectType string, keys []string, pageSize int32,
+	bookmark string) (shim.StateQueryIteratorInterface, *pb.QueryResponseMetadata, error) {
+	it, err := s.GetStateByPartialCompositeKey(objectType, keys)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return readMockPage(it, pageSize, bookmark)
+}
+
+// mockPage is a page of the results of a query, see readMockPage.
+type mockPage struct {
+	kvs []*queryresult.KV
+}
+
+func (it *mockPage) HasNext() bool {
+	return len(it.kvs) > 0
+}
+
+func (it *mockPage) Next() (*queryresult.KV, error) {
+	kv := it.kvs[0]
+	it.kvs = it.kvs[1:]
+	return kv, nil
+}
+
+func (it *mockPage) Close() error {
+	return nil
+}
+
+func readMockPage(it shim.StateQueryIteratorInterface, pageSize int32,
+	bookmark string) (*mockPage, *pb.QueryResponseMetadata, error) {
+	defer it.Close()
+
+	page, metadata := &mockPage{}, &pb.QueryResponseMetadata{}
+	for it.HasNext() {
+		kv, err := it.Next()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if kv.Key < bookmark {
+			continue
+		}
+		if int32(len(page.kvs)) == pageSize {
+			metadata.Bookmark = kv.Key
+			break
+		}
+		page.kvs = append(page.kvs, kv)
+	}
+	metadata.FetchedRecordsCount = int32(len(page.kvs))
+
+	return page, metadata, nil
+}
+
+// testChaincode is the chaincode as the MockStub of a testStub invokes it.
+type testChaincode struct {
+	cc   *SimpleChaincode
+	stub *testStub
+}
+
+func (c testChaincode) Init(shim.ChaincodeStubInterface) pb.Response {
+	return c.cc.Init(c.stub)
+}
+
+func (c testChaincode) Invoke(shim.ChaincodeStubInterface) pb.Response {
+	return c.cc.Invoke(c.stub)
+}
+
+// newTestStub returns a testStub of a chaincode that isn't initialized yet.
+func newTestStub() *testStub {
+	stub := new(testStub)
+	stub.MockStub = shim.NewMockStub("simple", testChaincode{new(SimpleChaincode), stub})
+	return stub
+}
+
+var txCount int
+
+// resultEntry is an entry of a query result as a client decodes it.
+type resultEntry struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+func newStub(t testing.TB) *testStub {
+	stub := newTestStub()
+	if response := stub.MockInit("init", nil); response.Status != shim.OK {
+		t.Fatalf("Init failed: %d %s", response.Status, response.Message)
+	}
+	setCreator(t, stub, "Org1MSP", "alice", nil)
+
+	return stub
+}
+
+// setCreator makes stub invoke as the identity cn of mspID, with a
+// self-signed certificate carrying attributes the way the Fabric CA issues
+// them.
+func setCreator(t testing.TB, stub *testStub, mspID, cn string, attributes map[string]string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	if attributes != nil {
+		attrs, _ := json.Marshal(map[string]interface{}{"attrs": attributes})
+		template.ExtraExtensions = []pkix.Extension{{Id: attributesOID, Value: attrs}}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	creator, err := proto.Marshal(&msp.SerializedIdentity{
+		Mspid:   mspID,
+		IdBytes: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub.creator = creator
+}
+
+func invoke(stub *testStub, args ...string) pb.Response {
+	txCount++
+	argBytes := make([][]byte, len(args))
+	for i, arg := range args {
+		argBytes[i] = []byte(arg)
+	}
+
+	return stub.MockInvoke(fmt.Sprintf("tx%d", txCount), argBytes)
+}
+
+// mustInvoke invokes a function that's expected to succeed.
+func mustInvoke(t testing.TB, stub *testStub, args ...string) []byte {
+	t.Helper()
+	response := invoke(stub, args...)
+	if response.Status != shim.OK {
+		t.Fatalf("%v: %d %s", args, response.Status, response.Message)
+	}
+
+	return response.Payload
+}
+
+func expectStatus(t *testing.T, response pb.Response, status int32) {
+	t.Helper()
+	if response.Status != status {
+		t.Fatalf("expected the status %d, got %d %s", status, response.Status, response.Message)
+	}
+}
+
+// expectError checks that response failed with code, and returns the error.
+func expectError(t *testing.T, response pb.Response, code string) chaincodeError {
+	t.Helper()
+	expectStatus(t, response, errorStatuses[code])
+	var e chaincodeError
+	if err := json.Unmarshal(response.Payload, &e); err != nil {
+		t.Fatal(err)
+	}
+	if e.Code != code || response.Message != string(response.Payload) {
+		t.Fatalf("expected the code %s, got %s %s", code, e.Code, response.Message)
+	}
+
+	return e
+}
+
+func callerIDOf(t *testing.T, stub *testStub) string {
+	var caller identity
+	if err := json.Unmarshal(mustInvoke(t, stub, "whoami"), &caller); err != nil {
+		t.Fatal(err)
+	}
+
+	return caller.ID
+}
+
+func getValue(t *testing.T, stub *testStub, objType, key string) string {
+	t.Helper()
+	var r record
+	if err := json.Unmarshal(mustInvoke(t, stub, "get", objType, key), &r); err != nil {
+		t.Fatal(err)
+	}
+
+	return r.Value
+}
+
+func TestInit(t *testing.T) {
+	stub := newTestStub()
+	expectStatus(t, stub.MockInit("init", nil), shim.OK)
+}
+
+func TestUnknownFunction(t *testing.T) {
+	stub := newStub(t)
+	e := expectError(t, invoke(stub, "nosuchfunction"), errUnknownFunction)
+	if !strings.HasPrefix(e.Message, "unknown function name") {
+		t.Fatalf("unexpected message: %s", e.Message)
+	}
+}
+
+// TestWrongNumberOfArguments checks every function of the routing table
+// against one argument too many, and one too few.
+func TestWrongNumberOfArguments(t *testing.T) {
+	stub := newStub(t)
+	for _, r := range routes {
+		required, variadic := 0, false
+		for _, p := range r.params {
+			switch {
+			case strings.HasSuffix(p, "..."):
+				variadic = true
+			case !strings.HasSuffix(p, "?"):
+				required++
+			}
+		}
+
+		var calls [][]string
+		if !variadic {
+			calls = append(calls, make([]string, len(r.params)+1))
+		}
+		if required > 0 {
+			calls = append(calls, make([]string, required-1))
+		}
+
+		for _, args := range calls {
+			for i := range args {
+				args[i] = "x"
+			}
+
+			response := invoke(stub, append([]string{r.name}, args...)...)
+			if e := parseError(response); response.Status != 400 || e == nil || e.Code != errWrongArgumentCount {
+				t.Errorf("%s with %d arguments: %d %s", r.name, len(args), response.Status, response.Message)
+			}
+		}
+	}
+}
+
+func TestPutGetDel(t *testing.T) {
+	stub := newStub(t)
+
+	mustInvoke(t, stub, "put", "", "k", "v1")
+	if value := getValue(t, stub, "", "k"); value != "v1" {
+		t.Fatalf("expected v1, got %s", value)
+	}
+
+	mustInvoke(t, stub, "put", "", "k", "v2")
+	if value := getValue(t, stub, "", "k"); value != "v2" {
+		t.Fatalf("expected v2, got %s", value)
+	}
+
+	mustInvoke(t, stub, "del", "", "k")
+	expectStatus(t, invoke(stub, "get", "", "k"), 404)
+}
+
+func TestMissingKeys(t *testing.T) {
+	stub := newStub(t)
+
+	expectStatus(t, invoke(stub, "get", "", "missing"), 404)
+	expectStatus(t, invoke(stub, "get", "thing", "missing"), 404)
+	expectStatus(t, invoke(stub, "update", "thing", "missing", "v"), 404)
+	expectStatus(t, invoke(stub, "transfer", "thing", "missing", "bob"), 404)
+}
+
+func TestInvalidArguments(t *testing.T) {
+	stub := newStub(t)
+
+	expectStatus(t, invoke(stub, "put", "", "", "v"), 500)
+	expectStatus(t, invoke(stub, "put", "_access", "k", "v"), 500)
+	expectStatus(t, invoke(stub, "get", "", "k", "xml"), 400)
+}
+
+func TestUpdate(t *testing.T) {
+	stub := newStub(t)
+
+	mustInvoke(t, stub, "put", "thing", "k", "v1")
+	mustInvoke(t, stub, "update", "thing", "k", "v2")
+	if value := getValue(t, stub, "thing", "k"); value != "v2" {
+		t.Fatalf("expected v2, got %s", value)
+	}
+}
+
+func TestGetByRange(t *testing.T) {
+	stub := newStub(t)
+	for _, key := range []string{"a", "b", "c", "d"} {
+		mustInvoke(t, stub, "put", "", key, key)
+	}
+
+	var entries []resultEntry
+	if err := json.Unmarshal(mustInvoke(t, stub, "getByRange", "b", "d"), &entries); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 2 || entries[0].Key != "b" || entries[1].Key != "c" {
+		t.Fatalf("unexpected entries: %+v", entries)
+	}
+}
+
+func TestCompositeKeys(t *testing.T) {
+	stub := newStub(t)
+
+	// the same key under different object types is different pairs
+	mustInvoke(t, stub, "put", "cat", "tom", "cat")
+	mustInvoke(t, stub, "put", "mouse", "tom", "mouse")
+	if value := getValue(t, stub, "cat", "tom"); value != "cat" {
+		t.Fatalf("expected cat, got %s", value)
+	}
+	if value := getValue(t, stub, "mouse", "tom"); value != "mouse" {
+		t.Fatalf("expected mouse, got %s", value)
+	}
+	expectStatus(t, invoke(stub, "get", "", "tom"), 404)
+
+	mustInvoke(t, stub, "put", "thing", `["alice","a1"]`, "1")
+	mustInvoke(t, stub, "put", "thing", `["alice","a2"]`, "2")
+	mustInvoke(t, stub, "put", "thing", `["bob","b1"]`, "3")
+	if value := getValue(t, stub, "thing", `["alice","a2"]`); value != "2" {
+		t.Fatalf("expected 2, got %s", value)
+	}
+
+	var entries []resultEntry
+	payload := mustInvoke(t, stub, "getByPartialCompositeKey", "thing", `["alice"]`)
+	if err := json.Unmarshal(payload, &entries); err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Key != `["alice","a1"]` || entries[1].Key != `["alice","a2"]` {
+		t.Fatalf("unexpected entries: %+v", entries)
+	}
+
+	payload = mustInvoke(t, stub, "getByPartialCompositeKey", "thing", "")
+	if err := json.Unmarshal(payload, &entries); err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 entries, got %+v", entries)
+	}
+
+	expectStatus(t, invoke(stub, "put", "", `["alice","a3"]`, "v"), 500)
+	expectStatus(t, invoke(stub, "put", "thing", `["alice",""]`, "v"), 500)
+	expectStatus(t, invoke(stub, "getByPartialCompositeKey", "", `["alice"]`), 400)
+	expectStatus(t, invoke(stub, "getByPartialCompositeKey", "_access", ""), 400)
+}
+
+func TestAssetModel(t *testing.T) {
+	stub := newStub(t)
+
+	e := expectError(t, invoke(stub, "put", "asset", "a1", `{"id":"a2","quantity":-1,"color":"red"}`), errInvalidValue)
+
+	var problems []fieldError
+	if err := json.Unmarshal(e.Details, &problems); err != nil {
+		t.Fatal(err)
+	}
+	fields := make([]string, len(problems))
+	for i, problem := range problems {
+		fields[i] = problem.Field
+	}
+	if strings.Join(fields, ",") != "id,owner,docType,quantity,color" {
+		t.Fatalf("unexpected field errors: %+v", problems)
+	}
+
+	mustInvoke(t, stub, "put", "asset", "a1", `{"id":"a1","owner":"o","docType":"widget","quantity":3}`)
+	var a asset
+	if err := json.Unmarshal([]byte(getValue(t, stub, "asset", "a1")), &a); err != nil {
+		t.Fatal(err)
+	}
+	if a.Quantity != 3 || a.Version != 1 || a.CreatedAt.IsZero() {
+		t.Fatalf("unexpected asset: %+v", a)
+	}
+}
+
+func TestAccessPolicy(t *testing.T) {
+	stub := newStub(t)
+
+	expectStatus(t, invoke(stub, "setAccessPolicy", "thing", `{"write":{"mspIds":["Org1MSP"]}}`), 403)
+
+	setCreator(t, stub, "Org1MSP", "admin", map[string]string{"role": "admin"})
+	mustInvoke(t, stub, "setAccessPolicy", "thing", `{"write":{"mspIds":["Org1MSP"]}}`)
+
+	setCreator(t, stub, "Org2MSP", "bob", nil)
+	expectStatus(t, invoke(stub, "put", "thing", "k", "v"), 403)
+	mustInvoke(t, stub, "put", "other", "k", "v")
+
+	setCreator(t, stub, "Org1MSP", "alice", nil)
+	mustInvoke(t, stub, "put", "thing", "k", "v")
+}
+
+func TestTransfer(t *testing.T) {
+	stub := newStub(t)
+
+	setCreator(t, stub, "Org1MSP", "bob", nil)
+	bob := callerIDOf(t, stub)
+	setCreator(t, stub, "Org1MSP", "alice", nil)
+	alice := callerIDOf(t, stub)
+
+	mustInvoke(t, stub, "put", "asset", "a1",
+		fmt.Sprintf(`{"id":"a1","owner":"%s","docType":"widget","quantity":1}`, alice))
+
+	expectStatus(t, invoke(stub, "transferConditional", "asset", "a1", bob, "2"), 409)
+	expectStatus(t, invoke(stub, "transferConditional", "asset", "a1", bob, "one"), 400)
+	mustInvoke(t, stub, "transferConditional", "asset", "a1", bob, "1")
+
+	// alice no longer owns it
+	expectStatus(t, invoke(stub, "transfer", "asset", "a1", alice), 403)
+
+	setCreator(t, stub, "Org1MSP", "bob", nil)
+	mustInvoke(t, stub, "transfer", "asset", "a1", alice)
+
+	var a asset
+	if err := json.Unmarshal([]byte(getValue(t, stub, "asset", "a1")), &a); err != nil {
+		t.Fatal(err)
+	}
+	if a.Owner != alice || a.Version != 3 {
+		t.Fatalf("unexpected asset: %+v", a)
+	}
+}
+
+func TestReadOnlyFunctions(t *testing.T) {
+	stub := newStub(t)
+	mustInvoke(t, stub, "put", "", "k", "v")
+
+	readOnly := decorate(stub, readOnlyStore("get"))
+	if err := readOnly.PutState("k", []byte("w")); err == nil {
+		t.Fatal("a read-only function wrote to the ledger")
+	}
+	if err := readOnly.DelState("k"); err == nil {
+		t.Fatal("a read-only function deleted from the ledger")
+	}
+
+	// a write is caught even if the function ignores its error
+	careless := func(cc *SimpleChaincode, stub shim.ChaincodeStubInterface, args []string) pb.Response {
+		_ = stub.PutState("k", []byte("w"))
+		return shim.Success(nil)
+	}
+	h := decoratedStore(route{name: "careless", readOnly: true}, careless)
+	expectError(t, structuredError(h(new(SimpleChaincode), stub, nil)), errInternal)
+	if value := getValue(t, stub, "", "k"); value != "v" {
+		t.Fatalf("unexpected value: %s", value)
+	}
+
+	for _, r := range routes {
+		if r.readOnly && strings.HasPrefix(r.name, "put") {
+			t.Errorf("%s is routed as read-only", r.name)
+		}
+	}
+}
+
+func TestInvokeOther(t *testing.T) {
+	stub := newStub(t)
+	other := newStub(t)
+	stub.MockPeerChaincode("other", other.MockStub)
+
+	mustInvoke(t, stub, "invokeOther", "other", "", "put", "", "k", "v")
+	if value := getValue(t, other, "", "k"); value != "v" {
+		t.Fatalf("expected v, got %s", value)
+	}
+
+	// the status of the called chaincode is the status of the call
+	expectStatus(t, invoke(stub, "invokeOther", "other", "", "get", "", "missing"), 404)
+}
+
+func TestEncryptedValues(t *testing.T) {
+	stub := newStub(t)
+	encryptionKey := []byte("0123456789abcdef0123456789abcdef")
+
+	stub.transient = map[string][]byte{"ENCKEY": encryptionKey, "VALUE": []byte("secret")}
+	mustInvoke(t, stub, "putEncrypted", "thing", "k")
+
+	stub.transient = nil
+	if value := getValue(t, stub, "thing", "k"); strings.Contains(value, "secret") {
+		t.Fatalf("the value is stored in the clear: %s", value)
+	}
+
+	stub.transient = map[string][]byte{"ENCKEY": encryptionKey}
+	var r record
+	if err := json.Unmarshal(mustInvoke(t, stub, "getEncrypted", "thing", "k"), &r); err != nil {
+		t.Fatal(err)
+	}
+	if r.Value != "secret" {
+		t.Fatalf("expected secret, got %s", r.Value)
+	}
+
+	stub.transient = map[string][]byte{"ENCKEY": []byte("fedcba9876543210fedcba9876543210")}
+	expectStatus(t, invoke(stub, "getEncrypted", "thing", "k"), 403)
+
+	// the same transaction simulated again with another value gets another
+	// nonce, while endorsers of the same value agree on the ciphertext
+	stub.MockTransactionStart("resimulated")
+	defer stub.MockTransactionEnd("resimulated")
+	seal := func(value string) []byte {
+		t.Helper()
+		sealed, err := encryptValue(stub, encryptionKey, "k", []byte(value))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sealed
+	}
+	if nonceSize := 12; bytes.Equal(seal("one")[:nonceSize], seal("two")[:nonceSize]) {
+		t.Fatal("a nonce is used again for another value")
+	}
+	if !bytes.Equal(seal("one"), seal("one")) {
+		t.Fatal("endorsers don't agree on the ciphertext")
+	}
+}
+
+func TestBulkDeletes(t *testing.T) {
+	stub := newStub(t)
+	for _, key := range []string{"a", "b", "c"} {
+		mustInvoke(t, stub, "put", "", key, key)
+	}
+	mustInvoke(t, stub, "put", "thing", `["alice","a1"]`, "1")
+	mustInvoke(t, stub, "put", "thing", `["alice","a2"]`, "2")
+	mustInvoke(t, stub, "put", "thing", `["bob","b1"]`, "3")
+
+	var d deletion
+	if err := json.Unmarshal(mustInvoke(t, stub, "delByRange", "a", "c", "true"), &d); err != nil {
+		t.Fatal(err)
+	}
+	if !d.DryRun || strings.Join(d.Keys, ",") != "a,b" {
+		t.Fatalf("unexpected deletion: %+v", d)
+	}
+	getValue(t, stub, "", "a")
+
+	mustInvoke(t, stub, "delByRange", "a", "c")
+	expectStatus(t, invoke(stub, "get", "", "a"), 404)
+	expectStatus(t, invoke(stub, "get", "", "b"), 404)
+	getValue(t, stub, "", "c")
+	getValue(t, stub, "thing", `["alice","a1"]`)
+
+	if err := json.Unmarshal(mustInvoke(t, stub, "delByPartialCompositeKey", "thing", `["alice"]`), &d); err != nil {
+		t.Fatal(err)
+	}
+	if d.DryRun || strings.Join(d.Keys, ",") != `["alice","a1"],["alice","a2"]` {
+		t.Fatalf("unexpected deletion: %+v", d)
+	}
+	expectStatus(t, invoke(stub, "get", "thing", `["alice","a1"]`), 404)
+	getValue(t, stub, "thing", `["bob","b1"]`)
+
+	expectStatus(t, invoke(stub, "delByRange", "a", "c", "maybe"), 400)
+	expectStatus(t, invoke(stub, "delByPartialCompositeKey", "_access", ""), 400)
+}
+
+func TestKeyEndorsementPolicy(t *testing.T) {
+	stub := newStub(t)
+	mustInvoke(t, stub, "put", "asset", "a1", `{"id":"a1","owner":"o","docType":"widget","quantity":1}`)
+
+	mustInvoke(t, stub, "setKeyEndorsementPolicy", "asset", "a1", "Org2MSP", "Org1MSP")
+	var policy keyEndorsementPolicy
+	if err := json.Unmarshal(mustInvoke(t, stub, "getKeyEndorsementPolicy", "asset", "a1"), &policy); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(policy.Orgs, ",") != "Org1MSP,Org2MSP" {
+		t.Fatalf("unexpected orgs: %v", policy.Orgs)
+	}
+
+	mustInvoke(t, stub, "setKeyEndorsementPolicy", "asset", "a1")
+	if err := json.Unmarshal(mustInvoke(t, stub, "getKeyEndorsementPolicy", "asset", "a1"), &policy); err != nil {
+		t.Fatal(err)
+	}
+	if len(policy.Orgs) != 0 {
+		t.Fatalf("unexpected orgs: %v", policy.Orgs)
+	}
+
+	expectStatus(t, invoke(stub, "setKeyEndorsementPolicy", "asset", "missing", "Org1MSP"), 404)
+}
+
+func TestSeeding(t *testing.T) {
+	stub := newTestStub()
+	setCreator(t, stub, "Org1MSP", "alice", nil)
+	seed := `[{"key":"a","value":"1"},{"type":"thing","key":"b","value":"2"}]`
+
+	response := stub.MockInit("init", [][]byte{[]byte("init"), []byte(seed)})
+	expectStatus(t, response, shim.OK)
+	if value := getValue(t, stub, "thing", "b"); value != "2" {
+		t.Fatalf("expected 2, got %s", value)
+	}
+
+	// seeding again leaves newer values alone
+	mustInvoke(t, stub, "put", "", "a", "changed")
+	var s seeding
+	payload := mustInvoke(t, stub, "initLedger", `[{"key":"a","value":"1"},{"key":"c","value":"3"}]`)
+	if err := json.Unmarshal(payload, &s); err != nil {
+		t.Fatal(err)
+	}
+	if s.Created != 1 || s.Skipped != 1 {
+		t.Fatalf("unexpected seeding: %+v", s)
+	}
+	if value := getValue(t, stub, "", "a"); value != "changed" {
+		t.Fatalf("expected changed, got %s", value)
+	}
+
+	expectStatus(t, stub.MockInit("init", [][]byte{[]byte("init"), []byte("not a batch")}), 400)
+
+	// a malformed array is reported as JSON, not as a BatchRequest
+	response = invoke(stub, "initLedger", ` [{"key":"a","value":"1"}`)
+	expectStatus(t, response, 400)
+	if !strings.Contains(response.Message, "JSON array of {type, key, value}") {
+		t.Fatalf("unexpected message: %s", response.Message)
+	}
+}
+
+func TestMigrations(t *testing.T) {
+	stub := newTestStub()
+	setCreator(t, stub, "Org1MSP", "alice", nil)
+
+	// state as an earlier version of the chaincode left it
+	assetKey, _ := stub.CreateCompositeKey(assetObjType, []string{"a1"})
+	stub.MockTransactionStart("legacy")
+	stub.PutState("k", []byte("plain"))
+	stub.PutState(assetKey, []byte(`{"quantity":2,"docType":"widget","owner":"o","id":"a1"}`))
+	stub.MockTransactionEnd("legacy")
+
+	expectStatus(t, stub.MockInit("init", nil), shim.OK)
+
+	var status schemaStatus
+	if err := json.Unmarshal(mustInvoke(t, stub, "getSchemaVersion"), &status); err != nil {
+		t.Fatal(err)
+	}
+	if status.Version != len(migrations) || status.Pending {
+		t.Fatalf("unexpected schema status: %+v", status)
+	}
+
+	var r record
+	if err := json.Unmarshal(mustInvoke(t, stub, "get", "", "k"), &r); err != nil {
+		t.Fatal(err)
+	}
+	if r.Value != "plain" || r.Version != 1 || r.CreatedAt.IsZero() {
+		t.Fatalf("unexpected record: %+v", r)
+	}
+
+	var a asset
+	if err := json.Unmarshal([]byte(getValue(t, stub, "asset", "a1")), &a); err != nil {
+		t.Fatal(err)
+	}
+	if a.Quantity != 2 || a.Version != 1 {
+		t.Fatalf("unexpected asset: %+v", a)
+	}
+
+	// migrating again changes nothing
+	expectStatus(t, stub.MockInit("upgrade", nil), shim.OK)
+	if value := getValue(t, stub, "", "k"); value != "plain" {
+		t.Fatalf("expected plain, got %s", value)
+	}
+
+	expectStatus(t, invoke(stub, "migrate"), 403)
+}
+
+func TestAggregates(t *testing.T) {
+	stub := newStub(t)
+	mustInvoke(t, stub, "put", "", "o1", `{"total":10.5,"item":{"qty":1}}`)
+	mustInvoke(t, stub, "put", "", "o2", `{"total":"2.25","item":{"qty":3}}`)
+	mustInvoke(t, stub, "put", "", "o3", `{"total":7}`)
+	mustInvoke(t, stub, "put", "", "o4", `not json`)
+	mustInvoke(t, stub, "put", "thing", "o5", `{"total":100}`)
+
+	var count rangeCount
+	if err := json.Unmarshal(mustInvoke(t, stub, "countByRange", "o", "p"), &count); err != nil {
+		t.Fatal(err)
+	}
+	if count.Count != 4 {
+		t.Fatalf("expected 4 keys, got %d", count.Count)
+	}
+
+	for _, c := range []struct {
+		function, field, value string
+		count, skipped         int
+	}{
+		{"sumField", "total", "19.75", 3, 1},
+		{"minField", "total", "2.25", 3, 1},
+		{"maxField", "total", "10.5", 3, 1},
+		{"avgField", "/item/qty", "2.000000", 2, 2},
+	} {
+		var aggregate fieldAggregate
+		if err := json.Unmarshal(mustInvoke(t, stub, c.function, "o", "p", c.field), &aggregate); err != nil {
+			t.Fatal(err)
+		}
+		if aggregate.Value == nil || aggregate.Value.String() != c.value ||
+			aggregate.Count != c.count || aggregate.Skipped != c.skipped {
+			t.Errorf("%s: unexpected aggregate: %+v", c.function, aggregate)
+		}
+	}
+
+	var aggregate fieldAggregate
+	if err := json.Unmarshal(mustInvoke(t, stub, "sumField", "x", "y", "total"), &aggregate); err != nil {
+		t.Fatal(err)
+	}
+	if aggregate.Value != nil || aggregate.Count != 0 {
+		t.Fatalf("unexpected aggregate of an empty range: %+v", aggregate)
+	}
+}
+
+func TestGetByRangeChunk(t *testing.T) {
+	stub := newStub(t)
+	for _, key := range []string{"k1", "k2", "k3", "k4", "k5"} {
+		mustInvoke(t, stub, "put", "", key, key)
+	}
+	mustInvoke(t, stub, "put", "thing", "k6", "k6")
+
+	var meta rangeMeta
+	if err := json.Unmarshal(mustInvoke(t, stub, "getByRangeMeta", "k", "l", "2"), &meta); err != nil {
+		t.Fatal(err)
+	}
+	if meta != (rangeMeta{Count: 5, ChunkSize: 2, Chunks: 3}) {
+		t.Fatalf("unexpected meta: %+v", meta)
+	}
+
+	var keys []string
+	for i := 0; i < meta.Chunks+1; i++ {
+		var chunk struct {
+			Records []resultEntry `json:"records"`
+			More    bool          `json:"more"`
+		}
+		payload := mustInvoke(t, stub, "getByRangeChunk", "k", "l", strconv.Itoa(i), "2")
+		if err := json.Unmarshal(payload, &chunk); err != nil {
+			t.Fatal(err)
+		}
+		if chunk.More != (i < meta.Chunks-1) {
+			t.Errorf("chunk %d: unexpected more: %t", i, chunk.More)
+		}
+		for _, entry := range chunk.Records {
+			keys = append(keys, entry.Key)
+		}
+	}
+	if strings.Join(keys, ",") != "k1,k2,k3,k4,k5" {
+		t.Fatalf("unexpected keys: %v", keys)
+	}
+
+	expectStatus(t, invoke(stub, "getByRangeChunk", "k", "l", "-1", "2"), 400)
+	expectStatus(t, invoke(stub, "getByRangeChunk", "k", "l", "0", "0"), 400)
+	expectStatus(t, invoke(stub, "getByRangeMeta", "k", "l", "1001"), 400)
+}
+
+func TestResultFormats(t *testing.T) {
+	stub := newStub(t)
+	mustInvoke(t, stub, "put", "", "k1", "one")
+	mustInvoke(t, stub, "put", "", "k2", "two, \"quoted\"")
+
+	var m Record
+	if err := proto.Unmarshal(mustInvoke(t, stub, "get", "", "k1", "proto"), &m); err != nil {
+		t.Fatal(err)
+	}
+	if string(m.Value) != "one" || m.Version != 1 {
+		t.Fatalf("unexpected record: %v", &m)
+	}
+
+	rows, err := csv.NewReader(bytes.NewReader(mustInvoke(t, stub, "getByRange", "k", "l", "csv"))).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 || rows[0][0] != "key" || rows[0][1] != "value" ||
+		rows[1][0] != "k1" || rows[2][1] != "two, \"quoted\"" {
+		t.Fatalf("unexpected rows: %q", rows)
+	}
+
+	history := historyEntries{
+		{TxID: "tx1", Timestamp: time.Unix(1, 0).UTC(), record: &record{Value: "one", Version: 1}},
+		{TxID: "tx2", Timestamp: time.Unix(2, 0).UTC(), IsDelete: true},
+	}
+	rows, err = history.csvRows()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 || rows[1][3] != "one" || rows[2][2] != "true" || rows[2][3] != "" {
+		t.Fatalf("unexpected history rows: %q", rows)
+	}
+
+	rows, err = csv.NewReader(bytes.NewReader(mustInvoke(t, stub, "countByRange", "k", "l", "csv"))).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[0][0] != "count" || rows[1][0] != "2" {
+		t.Fatalf("unexpected rows: %q", rows)
+	}
+}
+
+func TestProvenance(t *testing.T) {
+	stub := newStub(t)
+	mustInvoke(t, stub, "put", "", "k", "v")
+	setCreator(t, stub, "Org2MSP", "bob", nil)
+	mustInvoke(t, stub, "put", "", "k", "w")
+
+	var r record
+	if err := json.Unmarshal(mustInvoke(t, stub, "get", "", "k"), &r); err != nil {
+		t.Fatal(err)
+	}
+	if r.TxID != fmt.Sprintf("tx%d", txCount-1) || r.Creator == nil ||
+		r.Creator.MSPID != "Org2MSP" || r.Creator.Subject != "CN=bob" {
+		t.Fatalf("unexpected provenance: %s %+v", r.TxID, r.Creator)
+	}
+
+	var m Record
+	if err := proto.Unmarshal(mustInvoke(t, stub, "get", "", "k", "proto"), &m); err != nil {
+		t.Fatal(err)
+	}
+	if m.TxId != r.TxID || m.CreatorMspId != "Org2MSP" || m.CreatorSubject != "CN=bob" {
+		t.Fatalf("unexpected provenance: %v", &m)
+	}
+}
+
+func TestDocHashes(t *testing.T) {
+	stub := newStub(t)
+	document := "%PDF-1.4 contract"
+	hash := sha256.Sum256([]byte(document))
+	hashArg := hex.EncodeToString(hash[:])
+
+	expectStatus(t, invoke(stub, "putDocHash", "d1", "not hex", "17", "application/pdf"), 400)
+	mustInvoke(t, stub, "putDocHash", "d1", hashArg, strconv.Itoa(len(document)), "application/pdf", "s3://docs/d1.pdf")
+	expectStatus(t, invoke(stub, "putDocHash", "d1", hashArg, "17", "application/pdf"), 409)
+
+	for _, c := range []struct {
+		document string
+		verified bool
+	}{
+		{document, true},
+		{document + " amended", false},
+	} {
+		var v docVerification
+		if err := json.Unmarshal(mustInvoke(t, stub, "verifyDoc", "d1", c.document), &v); err != nil {
+			t.Fatal(err)
+		}
+		if v.Verified != c.verified || v.Anchor == nil || v.Anchor.URI != "s3://docs/d1.pdf" {
+			t.Errorf("unexpected verification of %q: %+v", c.document, v)
+		}
+	}
+
+	expectStatus(t, invoke(stub, "verifyDoc", "d2", document), 404)
+}
+
+func TestAssetIndexes(t *testing.T) {
+	stub := newStub(t)
+	mustInvoke(t, stub, "put", "asset", "a1", `{"id":"a1","owner":"o","docType":"widget","quantity":1}`)
+	mustInvoke(t, stub, "put", "asset", "a2", `{"id":"a2","owner":"p","docType":"widget","quantity":2}`)
+	mustInvoke(t, stub, "put", "asset", "a3", `{"id":"a3","owner":"o","docType":"gadget","quantity":3}`)
+
+	list := func(args ...string) ([]string, string) {
+		t.Helper()
+		var page struct {
+			Records  []resultEntry `json:"records"`
+			Bookmark string        `json:"bookmark"`
+		}
+		if err := json.Unmarshal(mustInvoke(t, stub, args...), &page); err != nil {
+			t.Fatal(err)
+		}
+
+		keys := make([]string, len(page.Records))
+		for i, entry := range page.Records {
+			keys[i] = entry.Key
+		}
+		return keys, page.Bookmark
+	}
+
+	if keys, _ := list("listByOwner", "o", "10", ""); strings.Join(keys, ",") != "a1,a3" {
+		t.Fatalf("unexpected assets of o: %v", keys)
+	}
+
+	mustInvoke(t, stub, "update", "asset", "a1", `{"id":"a1","owner":"p","docType":"widget","quantity":1}`)
+	mustInvoke(t, stub, "del", "asset", "a3")
+	if keys, _ := list("listByOwner", "o", "10", ""); len(keys) != 0 {
+		t.Fatalf("unexpected assets of o: %v", keys)
+	}
+	if keys, _ := list("listByOwner", "p", "10", ""); strings.Join(keys, ",") != "a1,a2" {
+		t.Fatalf("unexpected assets of p: %v", keys)
+	}
+
+	keys, bookmark := list("listByOwner", "p", "1", "")
+	if strings.Join(keys, ",") != "a1" || bookmark == "" {
+		t.Fatalf("unexpected first page: %v %q", keys, bookmark)
+	}
+	if keys, bookmark = list("listByOwner", "p", "1", bookmark); strings.Join(keys, ",") != "a2" || bookmark != "" {
+		t.Fatalf("unexpected last page: %v %q", keys, bookmark)
+	}
+
+	// a stub without paginated queries fails the call rather than the chaincode
+	stub.MockTransactionStart("unpaged")
+	response := new(SimpleChaincode).listByOwner(stub.MockStub, []string{"p", "10", ""})
+	stub.MockTransactionEnd("unpaged")
+	expectError(t, structuredError(response), errInternal)
+
+	since := time.Now().Add(-time.Hour).Format(time.RFC3339)
+	keys = nil
+	for bookmark, pages := "", 0; pages == 0 || bookmark != ""; pages++ {
+		var page []string
+		page, bookmark = list("listByTypeSince", "widget", since, "1", bookmark)
+		keys = append(keys, page...)
+	}
+	if strings.Join(keys, ",") != "a1,a2" {
+		t.Fatalf("unexpected widgets: %v", keys)
+	}
+
+	later := time.Now().Add(time.Hour).Format(time.RFC3339)
+	if keys, _ := list("listByTypeSince", "widget", later, "10", ""); len(keys) != 0 {
+		t.Fatalf("unexpected widgets: %v", keys)
+	}
+	expectStatus(t, invoke(stub, "listByTypeSince", "widget", "yesterday", "10", ""), 400)
+}
+
+func TestTombstones(t *testing.T) {
+	stub := newStub(t)
+	expectStatus(t, invoke(stub, "setDeleteMode", "doc", "tombstone"), 403)
+	setCreator(t, stub, "Org1MSP", "admin", map[string]string{"role": "admin"})
+	expectStatus(t, invoke(stub, "setDeleteMode", "doc", "soft"), 400)
+	mustInvoke(t, stub, "setDeleteMode", "doc", "tombstone")
+
+	mustInvoke(t, stub, "put", "doc", "d1", "v1")
+	mustInvoke(t, stub, "put", "doc", "d2", "v2")
+	mustInvoke(t, stub, "del", "doc", "d1")
+
+	e := expectError(t, invoke(stub, "get", "doc", "d1"), errGone)
+	var r record
+	if err := json.Unmarshal(e.Details, &r); err != nil {
+		t.Fatal(err)
+	}
+	if r.DeletedAt == nil || r.DeletedBy == nil || r.DeletedBy.Subject != "CN=admin" || r.Value != "" {
+		t.Fatalf("unexpected tombstone: %+v", r)
+	}
+	expectStatus(t, invoke(stub, "update", "doc", "d1", "v3"), 410)
+
+	// listings show the tombstone without its value, batches leave it out
+	values := func(payload []byte) string {
+		t.Helper()
+		var entries []resultEntry
+		if err := json.Unmarshal(payload, &entries); err != nil {
+			t.Fatal(err)
+		}
+		s := make([]string, len(entries))
+		for i, entry := range entries {
+			s[i] = entry.Key + "=" + entry.Value
+		}
+		return strings.Join(s, ",")
+	}
+	if v := values(mustInvoke(t, stub, "getByPartialCompositeKey", "doc", "")); v != "d1=,d2=v2" {
+		t.Fatalf("unexpected entries: %s", v)
+	}
+	if v := values(mustInvoke(t, stub, "getBatchRecords", `[{"type":"doc","key":"d1"},{"type":"doc","key":"d2"}]`)); v != "d1=,d2=v2" {
+		t.Fatalf("unexpected batch: %s", v)
+	}
+
+	mustInvoke(t, stub, "setDeleteMode", "", "tombstone")
+	mustInvoke(t, stub, "put", "", "k1", "v1")
+	mustInvoke(t, stub, "put", "", "k2", "v2")
+	mustInvoke(t, stub, "del", "", "k1")
+	if v := values(mustInvoke(t, stub, "getByRange", "k", "l")); v != "k1=,k2=v2" {
+		t.Fatalf("unexpected entries: %s", v)
+	}
+
+	expectStatus(t, invoke(stub, "restore", "doc", "d2"), 409)
+	mustInvoke(t, stub, "restore", "doc", "d1")
+	if value := getValue(t, stub, "doc", "d1"); value != "v1" {
+		t.Fatalf("unexpected restored value: %s", value)
+	}
+
+	mustInvoke(t, stub, "del", "doc", "d1")
+	mustInvoke(t, stub, "purge", "doc", "d1")
+	expectStatus(t, invoke(stub, "get", "doc", "d1"), 404)
+	expectStatus(t, invoke(stub, "restore", "doc", "d1"), 404)
+
+	mustInvoke(t, stub, "setDeleteMode", "doc", "hard")
+	mustInvoke(t, stub, "del", "doc", "d2")
+	expectStatus(t, invoke(stub, "get", "doc", "d2"), 404)
+}
+
+func TestGetFromChannel(t *testing.T) {
+	stub := newStub(t)
+	other := newStub(t)
+	stub.MockPeerChaincode("simple/other", other.MockStub)
+	mustInvoke(t, other, "put", "", "k", "v")
+
+	var read struct {
+		channelRead
+		Result resultEntry `json:"result"`
+	}
+	if err := json.Unmarshal(mustInvoke(t, stub, "getFromChannel", "other", "simple", "", "k"), &read); err != nil {
+		t.Fatal(err)
+	}
+	if !read.CrossChannel || read.WritesCommitted || read.Channel != "other" || read.Result.Value != "v" {
+		t.Fatalf("unexpected read: %+v", read)
+	}
+
+	expectStatus(t, invoke(stub, "getFromChannel", "other", "simple", "", "missing"), 404)
+	expectStatus(t, invoke(stub, "getFromChannel", "other", "", "", "k"), 400)
+}
+
+func TestLoad(t *testing.T) {
+	stub := newStub(t)
+	expectStatus(t, invoke(stub, "putMany", "k", "3", "100"), 403)
+	setCreator(t, stub, "Org1MSP", "alice", map[string]string{"role": "admin"})
+	expectStatus(t, invoke(stub, "putMany", "k", "3", "100", "nested"), 400)
+	expectStatus(t, invoke(stub, "putMany", "k", "1001", "100"), 400)
+
+	for _, layout := range []string{loadLayoutFlat, loadLayoutComposite} {
+		mustInvoke(t, stub, "putMany", "k", "3", "100", layout)
+
+		var result loadResult
+		if err := json.Unmarshal(mustInvoke(t, stub, "readMany", "k", "5", layout), &result); err != nil {
+			t.Fatal(err)
+		}
+		if result != (loadResult{Layout: layout, Count: 5, Found: 3, Bytes: 300}) {
+			t.Fatalf("unexpected result: %+v", result)
+		}
+	}
+
+	if value := getValue(t, stub, "", "k00000001"); value != loadValue("k00000001", 100) {
+		t.Fatalf("unexpected value: %s", value)
+	}
+}
+
+// The load benchmarks measure a transaction putting or reading 100 keys,
+// e.g. go test -run - -bench Many -benchmem.
+func benchmarkLoad(b *testing.B, layout string, valueSize int) {
+	stub := newStub(b)
+	setCreator(b, stub, "Org1MSP", "alice", map[string]string{"role": "admin"})
+	size := strconv.Itoa(valueSize)
+
+	b.Run("putMany", func(b *testing.B) {
+		b.SetBytes(int64(100 * valueSize))
+		for i := 0; i < b.N; i++ {
+			mustInvoke(b, stub, "putMany", "k", "100", size, layout)
+		}
+	})
+
+	b.Run("readMany", func(b *testing.B) {
+		b.SetBytes(int64(100 * valueSize))
+		for i := 0; i < b.N; i++ {
+			mustInvoke(b, stub, "readMany", "k", "100", layout)
+		}
+	})
+}
+
+func BenchmarkFlatMany100B(b *testing.B)      { benchmarkLoad(b, loadLayoutFlat, 100) }
+func BenchmarkFlatMany10KB(b *testing.B)      { benchmarkLoad(b, loadLayoutFlat, 10<<10) }
+func BenchmarkCompositeMany100B(b *testing.B) { benchmarkLoad(b, loadLayoutComposite, 100) }
+func BenchmarkCompositeMany10KB(b *testing.B) { benchmarkLoad(b, loadLayoutComposite, 10<<10) }
+
+func TestErrorCodes(t *testing.T) {
+	stub := newStub(t)
+	expectError(t, invoke(stub, "get", "", "missing"), errKeyNotFound)
+	expectError(t, invoke(stub, "listByOwner", "", "10", ""), errBadArgument)
+	expectError(t, invoke(stub, "setDeleteMode", "doc", "tombstone"), errForbidden)
+	expectError(t, invoke(stub, "put", "", "k"), errWrongArgumentCount)
+
+	mustInvoke(t, stub, "put", "", "k", "v")
+	e := expectError(t, invoke(stub, "putDocHash", "d", "nothex", "1", "text/plain"), errBadArgument)
+	if !strings.Contains(e.Message, "hex SHA-256") || e.Details != nil {
+		t.Fatalf("unexpected error: %+v", e)
+	}
+
+	// the errors of another chaincode are kept as details
+	other := newStub(t)
+	stub.MockPeerChaincode("simple/other", other.MockStub)
+	e = expectError(t, invoke(stub, "getFromChannel", "other", "simple", "", "k"), errKeyNotFound)
+	if cause := parseError(pb.Response{Message: string(e.Details)}); cause == nil || cause.Code != errKeyNotFound {
+		t.Fatalf("unexpected details: %s", e.Details)
+	}
+}
+
+// shout is a record type whose values are put upper-cased, registered the
+// way a module of the chaincode would register its own put.
+func init() {
+	registerObjType("put", "shout", func(cc *SimpleChaincode, stub shim.ChaincodeStubInterface, args []string) pb.Response {
+		return cc.put(stub, []string{args[0], args[1], strings.ToUpper(args[2])})
+	}, accessChecked(accessWrite))
+}
+
+func TestObjTypeHandlers(t *testing.T) {
+	stub := newStub(t)
+	mustInvoke(t, stub, "put", "shout", "k", "hello")
+	mustInvoke(t, stub, "put", "other", "k", "hello")
+	if value := getValue(t, stub, "shout", "k"); value != "HELLO" {
+		t.Fatalf("unexpected value: %s", value)
+	}
+	if value := getValue(t, stub, "other", "k"); value != "hello" {
+		t.Fatalf("unexpected value: %s", value)
+	}
+
+	// the global middlewares still apply
+	expectError(t, invoke(stub, "put", "shout", "k"), errWrongArgumentCount)
+
+	setCreator(t, stub, "Org1MSP", "admin", map[string]string{"role": "admin"})
+	mustInvoke(t, stub, "setAccessPolicy", "shout", `{"write":{"mspIds":["Org2MSP"]}}`)
+	expectError(t, invoke(stub, "put", "shout", "k", "hello"), errForbidden)
+}
+
+func TestExportImportState(t *testing.T) {
+	source := newStub(t)
+	mustInvoke(t, source, "put", "", "a", `{"n":1}`)
+	mustInvoke(t, source, "put", "", "b", "text")
+	mustInvoke(t, source, "put", "", "c", "outside")
+	expectError(t, invoke(source, "exportState", "a", "c"), errForbidden)
+
+	setCreator(t, source, "Org1MSP", "admin", map[string]string{"role": "admin"})
+	snapshot := mustInvoke(t, source, "exportState", "a", "c")
+	if canonical, err := canonicalJSON(snapshot); err != nil || !bytes.Equal(canonical, snapshot) {
+		t.Fatalf("the snapshot isn't canonical: %s", snapshot)
+	}
+
+	target := newStub(t)
+	setCreator(t, target, "Org2MSP", "admin", map[string]string{"role": "admin"})
+	tampered := bytes.Replace(snapshot, []byte("text"), []byte("TEXT"), 1)
+	expectError(t, invoke(target, "importState", string(tampered)), errBadArgument)
+
+	var result snapshotImport
+	if err := json.Unmarshal(mustInvoke(t, target, "importState", string(snapshot)), &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Imported != 2 {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+
+	var r record
+	if err := json.Unmarshal(mustInvoke(t, target, "get", "", "b"), &r); err != nil {
+		t.Fatal(err)
+	}
+	if r.Value != "text" || r.Creator == nil || r.Creator.MSPID != "Org1MSP" {
+		t.Fatalf("unexpected record: %+v", r)
+	}
+	expectError(t, invoke(target, "get", "", "c"), errKeyNotFound)
+
+	// a snapshot of the imported range is the same but for when and where it was taken
+	var exported, reexported stateSnapshot
+	if err := json.Unmarshal(snapshot, &exported); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(mustInvoke(t, target, "exportState", "a", "c"), &reexported); err != nil {
+		t.Fatal(err)
+	}
+	exportedEntries, _ := json.Marshal(exported.Entries)
+	reexportedEntries, _ := json.Marshal(reexported.Entries)
+	if !bytes.Equal(exportedEntries, reexportedEntries) {
+		t.Fatalf("unexpected entries: %s, expected %s", reexportedEntries, exportedEntries)
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	stub := newStub(t)
+	mustInvoke(t, stub, "put", "", "fresh", "v", `{"ttl":"1h"}`)
+	mustInvoke(t, stub, "put", "", "stale", "v", `{"expiresAt":"2000-01-01T00:00:00Z"}`)
+	mustInvoke(t, stub, "put", "", "locked", "v", `{"notBefore":"2999-01-01T00:00:00Z","expiresAt":"3000-01-01T00:00:00Z"}`)
+	expectError(t, invoke(stub, "put", "", "k", "v", `{"ttl":"1h","expiresAt":"2999-01-01T00:00:00Z"}`), errBadArgument)
+	expectError(t, invoke(stub, "put", "", "k", "v", `{"notBefore":"2999-01-01T00:00:00Z","ttl":"1h"}`), errBadArgument)
+
+	if value := getValue(t, stub, "", "fresh"); value != "v" {
+		t.Fatalf("unexpected value: %s", value)
+	}
+	e := expectError(t, invoke(stub, "get", "", "stale"), errGone)
+	var r record
+	if err := json.Unmarshal(e.Details, &r); err != nil {
+		t.Fatal(err)
+	}
+	if r.ExpiresAt == nil || r.Value != "" {
+		t.Fatalf("unexpected record: %+v", r)
+	}
+	expectError(t, invoke(stub, "get", "", "locked"), errLocked)
+	expectError(t, invoke(stub, "update", "", "stale", "v2"), errGone)
+
+	var entries []resultEntry
+	if err := json.Unmarshal(mustInvoke(t, stub, "getByRange", "", ""), &entries); err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if (entry.Key == "stale" || entry.Key == "locked") && entry.Value != "" {
+			t.Fatalf("unexpected entry: %+v", entry)
+		}
+	}
+
+	expectError(t, invoke(stub, "sweepExpired", "", ""), errForbidden)
+	setCreator(t, stub, "Org1MSP", "admin", map[string]string{"role": "admin"})
+	var sweep expirySweep
+	if err := json.Unmarshal(mustInvoke(t, stub, "sweepExpired", "", ""), &sweep); err != nil {
+		t.Fatal(err)
+	}
+	if len(sweep.Swept) != 1 || sweep.Swept[0] != "stale" || sweep.More {
+		t.Fatalf("unexpected sweep: %+v", sweep)
+	}
+	expectError(t, invoke(stub, "get", "", "stale"), errKeyNotFound)
+
+	// a put without options brings an expired key back for good
+	mustInvoke(t, stub, "put", "", "fresh", "v2")
+	if value := getValue(t, stub, "", "fresh"); value != "v2" {
+		t.Fatalf("unexpected value: %s", value)
+	}
+}
+
+func TestApprovals(t *testing.T) {
+	stub := newStub(t)
+	mustInvoke(t, stub, "put", "contract", "c1", "v1")
+
+	var c changeRequest
+	if err := json.Unmarshal(mustInvoke(t, stub, "proposeChange", "contract", "c1", "v2"), &c); err != nil {
+		t.Fatal(err)
+	}
+	if c.Status != changeStatusPending || c.Threshold != defaultApprovalThreshold || len(c.Approvals) != 1 ||
+		c.BaseVersion != 1 {
+		t.Fatalf("unexpected change: %+v", c)
+	}
+
+	// another member of the same organization doesn't count
+	setCreator(t, stub, "Org1MSP", "bob", nil)
+	expectError(t, invoke(stub, "approve", c.ID), errConflict)
+	if value := getValue(t, stub, "contract", "c1"); value != "v1" {
+		t.Fatalf("unexpected value: %s", value)
+	}
+
+	setCreator(t, stub, "Org2MSP", "carol", nil)
+	if err := json.Unmarshal(mustInvoke(t, stub, "approve", c.ID), &c); err != nil {
+		t.Fatal(err)
+	}
+	if c.Status != changeStatusApplied || c.AppliedTxID == "" {
+		t.Fatalf("unexpected change: %+v", c)
+	}
+	if value := getValue(t, stub, "contract", "c1"); value != "v2" {
+		t.Fatalf("unexpected value: %s", value)
+	}
+	expectError(t, invoke(stub, "approve", c.ID), errConflict)
+	expectError(t, invoke(stub, "approve", "missing"), errKeyNotFound)
+
+	// a change of a record written since it was proposed goes stale
+	if err := json.Unmarshal(mustInvoke(t, stub, "proposeChange", "contract", "c1", "v3"), &c); err != nil {
+		t.Fatal(err)
+	}
+	mustInvoke(t, stub, "put", "contract", "c1", "v4")
+	setCreator(t, stub, "Org1MSP", "alice", nil)
+	if err := json.Unmarshal(mustInvoke(t, stub, "approve", c.ID), &c); err != nil {
+		t.Fatal(err)
+	}
+	if c.Status != changeStatusStale || getValue(t, stub, "contract", "c1") != "v4" {
+		t.Fatalf("unexpected change: %+v", c)
+	}
+
+	expectError(t, invoke(stub, "setApprovalThreshold", "contract", "1"), errForbidden)
+	setCreator(t, stub, "Org1MSP", "admin", map[string]string{"role": "admin"})
+	mustInvoke(t, stub, "setApprovalThreshold", "contract", "1")
+	if err := json.Unmarshal(mustInvoke(t, stub, "proposeChange", "contract", "c2", "v1"), &c); err != nil {
+		t.Fatal(err)
+	}
+	if c.Status != changeStatusApplied || getValue(t, stub, "contract", "c2") != "v1" {
+		t.Fatalf("unexpected change: %+v", c)
+	}
+}
+
+func TestIdempotencyTokens(t *testing.T) {
+	stub := newStub(t)
+	stub.transient = map[string][]byte{idempotencyTokenField: []byte("retry-1")}
+	defer func() { stub.transient = nil }()
+
+	// a failed call doesn't use the token up
+	expectStatus(t, invoke(stub, "update", "", "k", "v0"), 404)
+	first := txCount + 1
+	mustInvoke(t, stub, "put", "", "k", "v1")
+
+	e := expectError(t, invoke(stub, "put", "", "k", "v2"), errDuplicateRequest)
+	var processed processedToken
+	if err := json.Unmarshal(e.Details, &processed); err != nil {
+		t.Fatal(err)
+	}
+	if processed.TxID != fmt.Sprintf("tx%d", first) || processed.Function != "put" {
+		t.Fatalf("unexpected details: %+v", processed)
+	}
+	if value := getValue(t, stub, "", "k"); value != "v1" {
+		t.Fatalf("unexpected value: %s", value)
+	}
+
+	// tokens are scoped to the caller's organization
+	setCreator(t, stub, "Org2MSP", "carol", nil)
+	mustInvoke(t, stub, "put", "", "k", "v3")
+
+	setCreator(t, stub, "Org1MSP", "admin", map[string]string{"role": "admin"})
+	stub.transient = nil
+	key, _ := stub.CreateCompositeKey(idempotencyObjType, []string{"Org1MSP", "expired"})
+	stub.MockTransactionStart("expired")
+	if err := putJSON(stub, key, processedToken{Token: "expired", ExpiresAt: time.Now().Add(-time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	stub.MockTransactionEnd("expired")
+
+	var prune tokenPrune
+	if err := json.Unmarshal(mustInvoke(t, stub, "pruneIdempotencyTokens"), &prune); err != nil {
+		t.Fatal(err)
+	}
+	if prune.Pruned != 1 || prune.More {
+		t.Fatalf("unexpected result: %+v", prune)
+	}
+}
+
+func TestKeyTree(t *testing.T) {
+	stub := newStub(t)
+	for _, path := range []string{"org1/warehouse/itemX", "org1/warehouse/itemY", "org1/warehouse/bin/itemZ",
+		"org1/office", "org10/itemA"} {
+		mustInvoke(t, stub, "putNode", path, "v:"+path)
+	}
+	expectStatus(t, invoke(stub, "putNode", "org1//itemX", "v"), 400)
+
+	list := func(prefix, recursive string) string {
+		t.Helper()
+		var nodes []struct {
+			Path string `json:"path"`
+		}
+		if err := json.Unmarshal(mustInvoke(t, stub, "list", prefix, recursive), &nodes); err != nil {
+			t.Fatal(err)
+		}
+		paths := []string{}
+		for _, node := range nodes {
+			paths = append(paths, node.Path)
+		}
+		return strings.Join(paths, " ")
+	}
+
+	if paths := list("org1", "false"); paths != "org1/office" {
+		t.Fatalf("unexpected paths: %s", paths)
+	}
+	if paths := list("org1/warehouse", "true"); paths !=
+		"org1/warehouse/bin/itemZ org1/warehouse/itemX org1/warehouse/itemY" {
+		t.Fatalf("unexpected paths: %s", paths)
+	}
+	if paths := list("", ""); paths != "" {
+		t.Fatalf("unexpected paths: %s", paths)
+	}
+
+	expectStatus(t, invoke(stub, "setPathACL", "org1", `["Org1MSP"]`), 403)
+	setCreator(t, stub, "Org1MSP", "admin", map[string]string{"role": "admin"})
+	mustInvoke(t, stub, "setPathACL", "org1", `["Org1MSP"]`)
+	mustInvoke(t, stub, "setPathACL", "org1/warehouse/bin", `["Org1MSP", "Org2MSP"]`)
+
+	setCreator(t, stub, "Org2MSP", "carol", nil)
+	expectError(t, invoke(stub, "putNode", "org1/warehouse/itemX", "w"), errForbidden)
+	mustInvoke(t, stub, "putNode", "org1/warehouse/bin/itemZ", "w")
+	mustInvoke(t, stub, "putNode", "org10/itemA", "w")
+
+	var acl pathACL
+	if err := json.Unmarshal(mustInvoke(t, stub, "getPathACL", "org1/warehouse/itemX"), &acl); err != nil {
+		t.Fatal(err)
+	}
+	if acl.Prefix != "org1" || strings.Join(acl.MSPIDs, " ") != "Org1MSP" {
+		t.Fatalf("unexpected ACL: %+v", acl)
+	}
+	expectStatus(t, invoke(stub, "getPathACL", "org10/itemA"), 404)
+
+	// lifting the ACL of a prefix lets the one of its parent apply
+	setCreator(t, stub, "Org1MSP", "admin", map[string]string{"role": "admin"})
+	mustInvoke(t, stub, "setPathACL", "org1/warehouse/bin", `[]`)
+	setCreator(t, stub, "Org2MSP", "carol", nil)
+	expectError(t, invoke(stub, "putNode", "org1/warehouse/bin/itemZ", "w"), errForbidden)
+}
+
+func TestRetention(t *testing.T) {
+	stub := newStub(t)
+	setCreator(t, stub, "Org1MSP", "admin", map[string]string{"role": "admin"})
+	mustInvoke(t, stub, "put", "lot", `["o1","l1"]`, "v")
+	mustInvoke(t, stub, "tag", "lot", `["o1","l1"]`, "recalled")
+	mustInvoke(t, stub, "setRetention", "lot", "1ns", "delete")
+	expectStatus(t, invoke(stub, "setRetention", "lot", "forever", "delete"), 400)
+
+	var manifest archivalManifest
+	if err := json.Unmarshal(mustInvoke(t, stub, "applyRetention", "lot"), &manifest); err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest.Records) != 1 || manifest.Records[0].Key != `["o1","l1"]` {
+		t.Fatalf("unexpected manifest: %+v", manifest)
+	}
+	expectStatus(t, invoke(stub, "get", "lot", `["o1","l1"]`), 404)
+
+	var page struct {
+		Records []resultEntry `json:"records"`
+	}
+	if err := json.Unmarshal(mustInvoke(t, stub, "findByTag", "recalled", "10", ""), &page); err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Records) != 0 {
+		t.Fatalf("the tags of a deleted record are left: %+v", page.Records)
+	}
+
+	// the delete action follows the delete mode of the type, and records
+	// marked deleted are left alone afterwards
+	mustInvoke(t, stub, "setDeleteMode", "lot", "tombstone")
+	mustInvoke(t, stub, "put", "lot", `["o1","l2"]`, "v")
+	if err := json.Unmarshal(mustInvoke(t, stub, "applyRetention", "lot"), &manifest); err != nil {
+		t.Fatal(err)
+	}
+	if manifest.Action != "tombstone" || len(manifest.Records) != 1 || manifest.Records[0].Key != `["o1","l2"]` {
+		t.Fatalf("unexpected manifest: %+v", manifest)
+	}
+	expectStatus(t, invoke(stub, "get", "lot", `["o1","l2"]`), 410)
+	if err := json.Unmarshal(mustInvoke(t, stub, "applyRetention", "lot"), &manifest); err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest.Records) != 0 {
+		t.Fatalf("unexpected manifest: %+v", manifest)
+	}
+
+	// the tombstone action marks records deleted whatever the mode
+	mustInvoke(t, stub, "put", "crate", "c1", "v")
+	mustInvoke(t, stub, "setRetention", "crate", "1ns", "tombstone")
+	mustInvoke(t, stub, "applyRetention", "crate")
+	expectStatus(t, invoke(stub, "get", "crate", "c1"), 410)
+	mustInvoke(t, stub, "restore", "crate", "c1")
+}
+
+func TestOrphans(t *testing.T) {
+	stub := newStub(t)
+	setCreator(t, stub, "Org1MSP", "admin", map[string]string{"role": "admin"})
+	mustInvoke(t, stub, "setReferenceRule", "lot", "/warehouse", "warehouse")
+	mustInvoke(t, stub, "put", "warehouse", "w1", "{}")
+	mustInvoke(t, stub, "put", "lot", `["o1","l1"]`, `{"warehouse":"w1"}`)
+	mustInvoke(t, stub, "put", "lot", `["o1","l2"]`, `{"warehouse":"w2"}`)
+
+	var report orphansReport
+	if err := json.Unmarshal(mustInvoke(t, stub, "findOrphans", "lot"), &report); err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Orphans) != 1 || report.Orphans[0].Key != `["o1","l2"]` || report.Orphans[0].ParentKey != "w2" {
+		t.Fatalf("unexpected orphans: %+v", report.Orphans)
+	}
+
+	// a tombstone doesn't count as a parent
+	mustInvoke(t, stub, "setDeleteMode", "warehouse", "tombstone")
+	mustInvoke(t, stub, "del", "warehouse", "w1")
+	if err := json.Unmarshal(mustInvoke(t, stub, "findOrphans", "lot"), &report); err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Orphans) != 2 || report.Orphans[0].Key != `["o1","l1"]` {
+		t.Fatalf("unexpected orphans: %+v", report.Orphans)
+	}
+}
+
+// testCA issues the certificates of the signers of meta-transactions and
+// proposals.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  string
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testCA{cert: cert, key: key, pem: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))}
+}
+
+// issue returns a PEM certificate of cn for key, or for a new key if it's
+// nil, and the key.
+func (ca *testCA) issue(t *testing.T, cn string, key *ecdsa.PrivateKey) (string, *ecdsa.PrivateKey) {
+	if key == nil {
+		var err error
+		if key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})), key
+}
+
+// sign returns the base64 ASN.1 ECDSA signature of the hex digest.
+func sign(t *testing.T, key *ecdsa.PrivateKey, digestHex string) string {
+	digest, err := hex.DecodeString(digestHex)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signature, err := ecdsa.SignASN1(rand.Reader, key, digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return base64.StdEncoding.EncodeToString(signature)
+}
+
+func TestMultisig(t *testing.T) {
+	stub := newStub(t)
+	ca := newTestCA(t)
+
+	setCreator(t, stub, "Org1MSP", "admin", map[string]string{"role": "admin"})
+	mustInvoke(t, stub, "setSignerCA", "Org2MSP", ca.pem)
+	setCreator(t, stub, "Org1MSP", "alice", nil)
+
+	alice, aliceKey := ca.issue(t, "alice", nil)
+	bob, bobKey := ca.issue(t, "bob", nil)
+	carol, carolKey := ca.issue(t, "carol", nil)
+	signers := func(certs ...string) string {
+		s, _ := json.Marshal(certs)
+		return string(s)
+	}
+
+	// the signers must be issued by the signer CAs of an MSP
+	outsider, _ := newTestCA(t).issue(t, "mallory", nil)
+	expectStatus(t, invoke(stub, "propose", "put", "1", signers(alice, outsider), "", "k", "v"), 403)
+
+	// and hold distinct keys, even in distinct certificates
+	alias, _ := ca.issue(t, "alice again", aliceKey)
+	expectStatus(t, invoke(stub, "propose", "put", "2", signers(alice, bob, alias), "", "k", "v"), 400)
+
+	expectStatus(t, invoke(stub, "propose", "put", "4", signers(alice, bob, carol), "", "k", "v"), 400)
+	expectStatus(t, invoke(stub, "propose", "get", "1", signers(alice), "", "k"), 400)
+
+	var p proposal
+	if err := json.Unmarshal(mustInvoke(t, stub, "propose", "put", "2", signers(alice, bob, carol), "", "k", "v"), &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Status != proposalStatusPending || len(p.Signers) != 3 || p.Signers[0].MSPID != "Org2MSP" {
+		t.Fatalf("unexpected proposal %+v", p)
+	}
+
+	// below the threshold, the call waits
+	if err := json.Unmarshal(mustInvoke(t, stub, "signProposal", p.ID, alice, sign(t, aliceKey, p.Digest)), &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Status != proposalStatusPending {
+		t.Fatalf("expected the proposal to be pending, got %s", p.Status)
+	}
+	expectStatus(t, invoke(stub, "get", "", "k"), 404)
+
+	expectStatus(t, invoke(stub, "signProposal", p.ID, alice, sign(t, aliceKey, p.Digest)), 409)
+	expectStatus(t, invoke(stub, "signProposal", p.ID, bob, sign(t, carolKey, p.Digest)), 403)
+	expectStatus(t, invoke(stub, "signProposal", p.ID, outsider, sign(t, bobKey, p.Digest)), 403)
+
+	// the signature that meets it executes the call
+	if err := json.Unmarshal(mustInvoke(t, stub, "signProposal", p.ID, bob, sign(t, bobKey, p.Digest)), &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Status != proposalStatusExecuted || p.Response == nil || p.Response.Status != shim.OK {
+		t.Fatalf("expected the proposal to be executed, got %+v", p)
+	}
+	if value := getValue(t, stub, "", "k"); value != "v" {
+		t.Fatalf("expected v, got %s", value)
+	}
+
+	expectStatus(t, invoke(stub, "signProposal", p.ID, carol, sign(t, carolKey, p.Digest)), 409)
+}
+
+func TestLists(t *testing.T) {
+	stub := newStub(t)
+
+	if length := string(mustInvoke(t, stub, "rpush", "l", "a", "b")); length != "2" {
+		t.Fatalf("expected 2, got %s", length)
+	}
+	if length := string(mustInvoke(t, stub, "lpush", "l", "z")); length != "3" {
+		t.Fatalf("expected 3, got %s", length)
+	}
+
+	var values []string
+	if err := json.Unmarshal(mustInvoke(t, stub, "lrange", "l", "0", "-1"), &values); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(values, ",") != "z,a,b" {
+		t.Fatalf("unexpected values %v", values)
+	}
+
+	if value := string(mustInvoke(t, stub, "lpop", "l")); value != "z" {
+		t.Fatalf("expected z, got %s", value)
+	}
+	if err := json.Unmarshal(mustInvoke(t, stub, "lrange", "l", "-1", "-1"), &values); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(values, ",") != "b" {
+		t.Fatalf("unexpected values %v", values)
+	}
+
+	mustInvoke(t, stub, "lpop", "l")
+	mustInvoke(t, stub, "lpop", "l")
+	expectStatus(t, invoke(stub, "lpop", "l"), 404)
+	expectStatus(t, invoke(stub, "rpush", "", "a"), 400)
+	expectStatus(t, invoke(stub, "lrange", "l", "first", "-1"), 400)
+}
+
+func TestSets(t *testing.T) {
+	stub := newStub(t)
+
+	if added := string(mustInvoke(t, stub, "sadd", "s", "a", "b", "c", "a")); added != "3" {
+		t.Fatalf("expected 3 members added, got %s", added)
+	}
+	if removed := string(mustInvoke(t, stub, "srem", "s", "a", "d")); removed != "1" {
+		t.Fatalf("expected 1 member removed, got %s", removed)
+	}
+	if member := string(mustInvoke(t, stub, "sismember", "s", "a")); member != "false" {
+		t.Fatalf("expected a not to be a member, got %s", member)
+	}
+	if member := string(mustInvoke(t, stub, "sismember", "s", "b")); member != "true" {
+		t.Fatalf("expected b to be a member, got %s", member)
+	}
+
+	var page membersPage
+	if err := json.Unmarshal(mustInvoke(t, stub, "smembers", "s", "1", ""), &page); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(page.Members, ",") != "b" || page.Bookmark == "" {
+		t.Fatalf("unexpected page %+v", page)
+	}
+	if err := json.Unmarshal(mustInvoke(t, stub, "smembers", "s", "1", page.Bookmark), &page); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(page.Members, ",") != "c" || page.Bookmark != "" {
+		t.Fatalf("unexpected page %+v", page)
+	}
+
+	expectStatus(t, invoke(stub, "sadd", "", "a"), 400)
+	expectStatus(t, invoke(stub, "smembers", "s", "0", ""), 400)
+}
+
+func TestSortedSets(t *testing.T) {
+	stub := newStub(t)
+
+	mustInvoke(t, stub, "zadd", "z", "5", "a")
+	mustInvoke(t, stub, "zadd", "z", "-3", "b")
+	mustInvoke(t, stub, "zadd", "z", "10", "c")
+	// a new score replaces the old one
+	mustInvoke(t, stub, "zadd", "z", "1", "c")
+
+	var members []scoredMember
+	if err := json.Unmarshal(mustInvoke(t, stub, "zrangeByScore", "z", "-10", "5"), &members); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(members) != "[{b -3} {c 1} {a 5}]" {
+		t.Fatalf("unexpected members %v", members)
+	}
+
+	if rank := string(mustInvoke(t, stub, "zrank", "z", "a")); rank != "2" {
+		t.Fatalf("expected rank 2, got %s", rank)
+	}
+
+	// a range can't hold more than a page of members
+	for score := 1000; score <= 1000+maxPageSize; score++ {
+		mustInvoke(t, stub, "zadd", "z", strconv.Itoa(score), fmt.Sprintf("m%d", score))
+	}
+	expectStatus(t, invoke(stub, "zrangeByScore", "z", "-10", strconv.Itoa(1000+maxPageSize)), 400)
+	if err := json.Unmarshal(mustInvoke(t, stub, "zrangeByScore", "z", "6", strconv.Itoa(999+maxPageSize)), &members); err != nil {
+		t.Fatal(err)
+	}
+	if len(members) != maxPageSize || members[0].Score != 1000 {
+		t.Fatalf("unexpected members %v...", members[:1])
+	}
+
+	expectStatus(t, invoke(stub, "zrank", "z", "missing"), 404)
+	expectStatus(t, invoke(stub, "zadd", "z", "high", "a"), 400)
+	expectStatus(t, invoke(stub, "zrangeByScore", "z", "0", "high"), 400)
+}
+
+func TestCounters(t *testing.T) {
+	stub := newStub(t)
+	stub.now = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	mustInvoke(t, stub, "initCounter", "stock", "10")
+	expectStatus(t, invoke(stub, "initCounter", "stock", "5"), 409)
+
+	var r reservation
+	if err := json.Unmarshal(mustInvoke(t, stub, "reserve", "stock", "4", "15m"), &r); err != nil {
+		t.Fatal(err)
+	}
+	expectStatus(t, invoke(stub, "reserve", "stock", "7", "15m"), 409)
+
+	getCounter := func() string {
+		var c counter
+		if err := json.Unmarshal(mustInvoke(t, stub, "getCounter", "stock"), &c); err != nil {
+			t.Fatal(err)
+		}
+		return fmt.Sprintf("%s/%s", c.Available, c.Reserved)
+	}
+	if c := getCounter(); c != "6/4" {
+		t.Fatalf("expected 6 available and 4 reserved, got %s", c)
+	}
+
+	mustInvoke(t, stub, "confirm", "stock", r.ID)
+	if c := getCounter(); c != "6/0" {
+		t.Fatalf("expected 6 available and none reserved, got %s", c)
+	}
+	expectStatus(t, invoke(stub, "release", "stock", r.ID), 404)
+
+	// an expired reservation can only be released
+	if err := json.Unmarshal(mustInvoke(t, stub, "reserve", "stock", "1", "1m"), &r); err != nil {
+		t.Fatal(err)
+	}
+	stub.now = stub.now.Add(2 * time.Minute)
+	expectStatus(t, invoke(stub, "confirm", "stock", r.ID), 410)
+	mustInvoke(t, stub, "release", "stock", r.ID)
+	if c := getCounter(); c != "6/0" {
+		t.Fatalf("expected 6 available and none reserved, got %s", c)
+	}
+
+	expectStatus(t, invoke(stub, "getCounter", "missing"), 404)
+	expectStatus(t, invoke(stub, "reserve", "stock", "1", "forever"), 400)
+}
+
+// openAccounts opens the account a1 of alice, funded with 100.50 EUR, and the
+// account b1 of bob, and leaves alice as the creator.
+func openAccounts(t *testing.T, stub *testStub) {
+	setCreator(t, stub, "Org1MSP", "bob", nil)
+	mustInvoke(t, stub, "openAccount", "b1")
+	setCreator(t, stub, "Org1MSP", "admin", map[string]string{"role": "admin"})
+	mustInvoke(t, stub, "setRate", "EUR", "USD", "1.1")
+	setCreator(t, stub, "Org1MSP", "alice", nil)
+	mustInvoke(t, stub, "openAccount", "a1")
+	setCreator(t, stub, "Org1MSP", "admin", map[string]string{"role": "admin"})
+	mustInvoke(t, stub, "deposit", "a1", "EUR", "100.50")
+	setCreator(t, stub, "Org1MSP", "alice", nil)
+}
+
+func balancesOf(t *testing.T, stub *testStub, id string) string {
+	t.Helper()
+	var balances []balance
+	if err := json.Unmarshal(mustInvoke(t, stub, "getBalances", id), &balances); err != nil {
+		t.Fatal(err)
+	}
+
+	s := make([]string, len(balances))
+	for i, b := range balances {
+		s[i] = b.Amount.String() + " " + b.Currency
+	}
+	return strings.Join(s, ", ")
+}
+
+func TestAccounts(t *testing.T) {
+	stub := newStub(t)
+	openAccounts(t, stub)
+
+	mustInvoke(t, stub, "transferFunds", "a1", "b1", "EUR", "30")
+	if b := balancesOf(t, stub, "a1"); b != "70.50 EUR" {
+		t.Fatalf("unexpected balances of a1: %s", b)
+	}
+	if b := balancesOf(t, stub, "b1"); b != "30.00 EUR" {
+		t.Fatalf("unexpected balances of b1: %s", b)
+	}
+
+	var c conversion
+	if err := json.Unmarshal(mustInvoke(t, stub, "convert", "a1", "EUR", "USD", "10"), &c); err != nil {
+		t.Fatal(err)
+	}
+	if c.To.Amount.String() != "11.00" || c.Rate.String() != "1.1" {
+		t.Fatalf("unexpected conversion %+v", c)
+	}
+	if b := balancesOf(t, stub, "a1"); b != "60.50 EUR, 11.00 USD" {
+		t.Fatalf("unexpected balances of a1: %s", b)
+	}
+
+	expectStatus(t, invoke(stub, "openAccount", "a1"), 409)
+	expectStatus(t, invoke(stub, "deposit", "a1", "EUR", "1"), 403)
+	expectStatus(t, invoke(stub, "transferFunds", "a1", "b1", "EUR", "1000"), 409)
+	expectStatus(t, invoke(stub, "transferFunds", "a1", "b1", "EUR", "0.001"), 400)
+	expectStatus(t, invoke(stub, "convert", "a1", "USD", "JPY", "1"), 404)
+	setCreator(t, stub, "Org1MSP", "bob", nil)
+	expectStatus(t, invoke(stub, "transferFunds", "a1", "b1", "EUR", "1"), 403)
+}
+
+func TestJournal(t *testing.T) {
+	stub := newStub(t)
+	openAccounts(t, stub)
+	mustInvoke(t, stub, "transferFunds", "a1", "b1", "EUR", "30")
+
+	var tb trialBalance
+	if err := json.Unmarshal(mustInvoke(t, stub, "trialBalance"), &tb); err != nil {
+		t.Fatal(err)
+	}
+	if !tb.Balanced || len(tb.Totals) != 1 || tb.Totals[0].Debits.String() != "130.50" {
+		t.Fatalf("unexpected trial balance %+v", tb)
+	}
+	balances := map[string]string{}
+	for _, a := range tb.Accounts {
+		balances[a.Account] = a.Balance.String()
+	}
+	if balances["a1"] != "70.50" || balances["b1"] != "30.00" || balances[externalAccount] != "-100.50" {
+		t.Fatalf("unexpected balances %v", balances)
+	}
+
+	now := time.Now().UTC()
+	period := now.Add(-time.Hour).Format(time.RFC3339) + "/" + now.Add(time.Hour).Format(time.RFC3339)
+	var statement accountStatement
+	if err := json.Unmarshal(mustInvoke(t, stub, "accountStatement", "a1", period), &statement); err != nil {
+		t.Fatal(err)
+	}
+	if len(statement.Lines) != 2 || statement.Lines[1].Balance.String() != "70.50" {
+		t.Fatalf("unexpected statement lines %+v", statement.Lines)
+	}
+	if len(statement.Currencies) != 1 || statement.Currencies[0].Opening.String() != "0.00" ||
+		statement.Currencies[0].Closing.String() != "70.50" {
+		t.Fatalf("unexpected statement currencies %+v", statement.Currencies)
+	}
+
+	expectStatus(t, invoke(stub, "accountStatement", "a1", "last month"), 400)
+	expectStatus(t, invoke(stub, "accountStatement", "a1", now.Format(time.RFC3339)+"/"+now.Format(time.RFC3339)), 400)
+	expectStatus(t, invoke(stub, "trialBalance", "xml"), 400)
+}
+
+func TestSettlement(t *testing.T) {
+	stub := newStub(t)
+
+	first := string(mustInvoke(t, stub, "addSettlement", "Org1MSP", "Org2MSP", "EUR", "100"))
+	setCreator(t, stub, "Org2MSP", "carol", nil)
+	mustInvoke(t, stub, "addSettlement", "Org2MSP", "Org1MSP", "EUR", "30")
+	// only the payer adds an instruction
+	expectStatus(t, invoke(stub, "addSettlement", "Org1MSP", "Org2MSP", "EUR", "1"), 403)
+
+	expectStatus(t, invoke(stub, "closeBatch"), 403)
+	setCreator(t, stub, "Org1MSP", "admin", map[string]string{"role": "admin"})
+	var manifest batchManifest
+	if err := json.Unmarshal(mustInvoke(t, stub, "closeBatch"), &manifest); err != nil {
+		t.Fatal(err)
+	}
+	positions := map[string]string{}
+	for _, p := range manifest.Positions {
+		positions[p.Participant+" "+p.Currency] = p.Net.String()
+	}
+	// the instructions come in the order of their IDs, not of their addition
+	if manifest.Seq != 1 || len(manifest.Instructions) != 2 ||
+		(manifest.Instructions[0] != first && manifest.Instructions[1] != first) ||
+		positions["Org1MSP EUR"] != "-70.00" || positions["Org2MSP EUR"] != "70.00" {
+		t.Fatalf("unexpected manifest %+v, positions %v", manifest, positions)
+	}
+
+	// the instructions after the cut-off go to the next batch
+	expectStatus(t, invoke(stub, "closeBatch"), 409)
+
+	var closed batchManifest
+	if err := json.Unmarshal(mustInvoke(t, stub, "getBatch", "1"), &closed); err != nil {
+		t.Fatal(err)
+	}
+	if closed.TxID != manifest.TxID {
+		t.Fatalf("unexpected batch %+v", closed)
+	}
+	expectStatus(t, invoke(stub, "getBatch", "2"), 404)
+	expectStatus(t, invoke(stub, "getBatch", "first"), 400)
+}
+
+func TestNetting(t *testing.T) {
+	stub := newStub(t)
+
+	var set nettingSet
+	obligations := `[{"payer":"A","payee":"B","currency":"EUR","amount":"100"},
+		{"payer":"B","payee":"C","currency":"EUR","amount":"100"},
+		{"payer":"C","payee":"A","currency":"EUR","amount":"40"}]`
+	if err := json.Unmarshal(mustInvoke(t, stub, "netObligations", obligations), &set); err != nil {
+		t.Fatal(err)
+	}
+	if len(set.Transfers) != 1 || set.Transfers[0].Payer != "A" || set.Transfers[0].Payee != "C" ||
+		set.Transfers[0].Amount.String() != "60.00" {
+		t.Fatalf("unexpected transfers %+v", set.Transfers)
+	}
+
+	var got nettingSet
+	if err := json.Unmarshal(mustInvoke(t, stub, "getNetting", set.ID), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.TxID != set.TxID || len(got.Obligations) != 3 {
+		t.Fatalf("unexpected netting set %+v", got)
+	}
+
+	expectStatus(t, invoke(stub, "netObligations", `[{"payer":"A","payee":"A","currency":"EUR","amount":"1"}]`), 400)
+	expectStatus(t, invoke(stub, "netObligations", `[{"payer":"A","payee":"B","currency":"EUR"}]`), 400)
+	expectStatus(t, invoke(stub, "netObligations", `[]`), 400)
+	expectStatus(t, invoke(stub, "getNetting", "missing"), 404)
+}
+
+func TestAccrual(t *testing.T) {
+	stub := newStub(t)
+	stub.now = time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	expectStatus(t, invoke(stub, "setAccrual", "inv1", "EUR", "1000", "0.05", dayCountAct365), 403)
+	setCreator(t, stub, "Org1MSP", "admin", map[string]string{"role": "admin"})
+	mustInvoke(t, stub, "setAccrual", "inv1", "EUR", "1000", "0.05", dayCountAct365)
+
+	// a part of a day is left for the next accrual
+	stub.now = stub.now.Add(10*oneDay + time.Hour)
+	var entry accrualEntry
+	if err := json.Unmarshal(mustInvoke(t, stub, "accrue", "inv1"), &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry.Days != 10 || entry.Amount.String() != "1.37" || entry.Accrued.String() != "1.37" {
+		t.Fatalf("unexpected entry %+v", entry)
+	}
+	if payload := mustInvoke(t, stub, "accrue", "inv1"); len(payload) != 0 {
+		t.Fatalf("expected nothing to accrue, got %s", payload)
+	}
+
+	stub.now = stub.now.Add(23 * time.Hour)
+	if err := json.Unmarshal(mustInvoke(t, stub, "accrue", "inv1"), &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry.Days != 1 || entry.Amount.String() != "0.14" || entry.Accrued.String() != "1.51" {
+		t.Fatalf("unexpected entry %+v", entry)
+	}
+
+	expectStatus(t, invoke(stub, "setAccrual", "inv1", "USD", "1000", "0.05", dayCountAct365), 409)
+	expectStatus(t, invoke(stub, "setAccrual", "inv2", "EUR", "1000", "0.05", "30/360"), 400)
+	expectStatus(t, invoke(stub, "accrue", "inv2"), 404)
+}
+
+func TestScheduledPayments(t *testing.T) {
+	stub := newStub(t)
+	stub.now = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	openAccounts(t, stub)
+
+	due := stub.now.Add(oneDay).Format(time.RFC3339)
+	first := string(mustInvoke(t, stub, "schedulePayment", "a1", "b1", "EUR", "20", due))
+	second := string(mustInvoke(t, stub, "schedulePayment", "a1", "b1", "EUR", "100", due))
+	later := string(mustInvoke(t, stub, "schedulePayment", "a1", "b1", "EUR", "1", stub.now.Add(7*oneDay).Format(time.RFC3339)))
+
+	setCreator(t, stub, "Org1MSP", "bob", nil)
+	expectStatus(t, invoke(stub, "schedulePayment", "a1", "b1", "EUR", "1", due), 403)
+
+	setCreator(t, stub, "Org1MSP", "admin", map[string]string{"role": "admin"})
+	stub.now = stub.now.Add(2 * oneDay)
+	expectStatus(t, invoke(stub, "processDue", stub.now.Add(time.Hour).Format(time.RFC3339)), 400)
+
+	var results dueResults
+	if err := json.Unmarshal(mustInvoke(t, stub, "processDue", stub.now.Format(time.RFC3339)), &results); err != nil {
+		t.Fatal(err)
+	}
+	statuses := map[string]string{}
+	for _, p := range results.Processed {
+		statuses[p.ID] = p.Status
+	}
+	if len(statuses) != 2 || statuses[first] == statuses[second] || results.More {
+		t.Fatalf("unexpected results %+v", results)
+	}
+	if b := balancesOf(t, stub, "b1"); b != "20.00 EUR" && b != "100.00 EUR" {
+		t.Fatalf("unexpected balances of b1: %s", b)
+	}
+
+	var p scheduledPayment
+	if err := json.Unmarshal(mustInvoke(t, stub, "getScheduledPayment", later), &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Status != paymentStatusPending {
+		t.Fatalf("expected the later payment to be pending, got %s", p.Status)
+	}
+}
+
+func TestRelay(t *testing.T) {
+	stub := newStub(t)
+	ca := newTestCA(t)
+	setCreator(t, stub, "Org1MSP", "admin", map[string]string{"role": "admin"})
+	mustInvoke(t, stub, "setSignerCA", "Org2MSP", ca.pem)
+	setCreator(t, stub, "Org1MSP", "relayer", nil)
+
+	cert, key := ca.issue(t, "dave", nil)
+	relayArgs := func(nonce uint64, signer *ecdsa.PrivateKey, function string, args ...string) []string {
+		digest, err := relayDigest(stub.GetChannelID(), "Org2MSP", nonce, function, args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return append([]string{"relay", "Org2MSP", cert, strconv.FormatUint(nonce, 10), sign(t, signer, digest), function}, args...)
+	}
+
+	mustInvoke(t, stub, relayArgs(1, key, "put", "", "k", "v")...)
+	if value := getValue(t, stub, "", "k"); value != "v" {
+		t.Fatalf("expected v, got %s", value)
+	}
+
+	var n nonceState
+	if err := json.Unmarshal(mustInvoke(t, stub, "nonceOf", "Org2MSP", cert), &n); err != nil {
+		t.Fatal(err)
+	}
+	if n.Nonce != 1 {
+		t.Fatalf("expected nonce 1, got %d", n.Nonce)
+	}
+
+	// a signed call executes at most once, and in order
+	expectStatus(t, invoke(stub, relayArgs(1, key, "put", "", "k", "v")...), 409)
+	expectStatus(t, invoke(stub, relayArgs(3, key, "put", "", "k", "v3")...), 409)
+
+	other, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	expectStatus(t, invoke(stub, relayArgs(2, other, "put", "", "k", "v2")...), 403)
+	expectStatus(t, invoke(stub, relayArgs(2, key, "get", "", "k")...), 400)
+
+	outsider, outsiderKey := newTestCA(t).issue(t, "mallory", nil)
+	cert, key = outsider, outsiderKey
+	expectStatus(t, invoke(stub, relayArgs(1, key, "put", "", "k", "v2")...), 403)
+
+	if value := getValue(t, stub, "", "k"); value != "v" {
+		t.Fatalf("expected v, got %s", value)
+	}
+}
+
+func TestSimulate(t *testing.T) {
+	stub := newStub(t)
+
+	var s simulation
+	if err := json.Unmarshal(mustInvoke(t, stub, "simulate", "put", "", "k", "v"), &s); err != nil {
+		t.Fatal(err)
+	}
+	if s.Status != shim.OK || len(s.Writes) == 0 {
+		t.Fatalf("unexpected simulation %+v", s)
+	}
+	written := false
+	for _, w := range s.Writes {
+		written = written || w.Key == "k"
+	}
+	if !written {
+		t.Fatalf("expected a write of k, got %+v", s.Writes)
+	}
+	expectStatus(t, invoke(stub, "get", "", "k"), 404)
+
+	// a failed function writes nothing
+	if err := json.Unmarshal(mustInvoke(t, stub, "simulate", "update", "", "k", "v2"), &s); err != nil {
+		t.Fatal(err)
+	}
+	if s.Status != 404 || len(s.Writes) != 0 {
+		t.Fatalf("unexpected simulation %+v", s)
+	}
+
+	expectStatus(t, invoke(stub, "simulate", "simulate", "put", "", "k", "v"), 400)
+	expectStatus(t, invoke(stub, "simulate", "unknown"), 400)
+}
+
+// protoField is a field of a message of simple_chaincode.proto.
+type protoField struct {
+	name     string
+	typ      string
+	number   int
+	repeated bool
+}
+
+var (
+	protoMessagePattern = regexp.MustCompile(`(?s)message\s+(\w+)\s*\{(.*?)\}`)
+	protoFieldPattern   = regexp.MustCompile(`(?m)^\s*(repeated\s+)?([\w.]+)\s+(\w+)\s*=\s*(\d+)\s*;`)
+)
+
+// parseProtoMessages reads the messages of simple_chaincode.proto, which has
+// neither nested messages nor enums, options or oneofs.
+func parseProtoMessages(t *testing.T) map[string][]protoField {
+	source, err := ioutil.ReadFile("simple_chaincode.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	messages := map[string][]protoField{}
+	for _, m := range protoMessagePattern.FindAllStringSubmatch(string(source), -1) {
+		fields := []protoField{}
+		for _, f := range protoFieldPattern.FindAllStringSubmatch(m[2], -1) {
+			number, _ := strconv.Atoi(f[4])
+			fields = append(fields, protoField{name: f[3], typ: f[2], number: number, repeated: f[1] != ""})
+		}
+		messages[m[1]] = fields
+	}
+
+	return messages
+}
+
+var protoScalarTypes = map[string]reflect.Type{
+	"string": reflect.TypeOf(""),
+	"bytes":  reflect.TypeOf([]byte(nil)),
+	"bool":   reflect.TypeOf(false),
+	"int32":  reflect.TypeOf(int32(0)),
+	"int64":  reflect.TypeOf(int64(0)),
+	"uint64": reflect.TypeOf(uint64(0)),
+
+	"google.protobuf.Timestamp": reflect.TypeOf(&timestamp.Timestamp{}),
+}
+
+// protoWireType is the wire type of the fields of a type, as a struct tag
+// names it.
+func protoWireType(typ string) string {
+	switch typ {
+	case "bool", "int32", "int64", "uint64":
+		return "varint"
+	}
+	return "bytes"
+}
+
+// fillMessage sets every field of m to a value that isn't the default, and
+// repeated fields to one element.
+func fillMessage(v reflect.Value) {
+	for i := 0; i < v.NumField(); i++ {
+		if _, ok := v.Type().Field(i).Tag.Lookup("protobuf"); !ok {
+			continue
+		}
+
+		field := v.Field(i)
+		switch field.Kind() {
+		case reflect.String:
+			field.SetString("s")
+		case reflect.Bool:
+			field.SetBool(true)
+		case reflect.Int32, reflect.Int64:
+			field.SetInt(-1)
+		case reflect.Uint64:
+			field.SetUint(1)
+		case reflect.Ptr:
+			field.Set(reflect.New(field.Type().Elem()))
+			fillMessage(field.Elem())
+		case reflect.Slice:
+			if field.Type().Elem().Kind() == reflect.Uint8 {
+				field.SetBytes([]byte{1})
+				break
+			}
+			element := reflect.New(field.Type().Elem().Elem())
+			fillMessage(element.Elem())
+			field.Set(reflect.Append(field, element))
+		}
+	}
+}
+
+// TestProtoMessages checks the generated messages against the messages of
+// simple_chaincode.proto, so that a .proto changed without regenerating
+// simple_chaincode.pb.go fails: their fields must match by name, number, type and
+// cardinality, and a message with every field set must encode on the wire as
+// the .proto declares it and decode back to itself.
+func TestProtoMessages(t *testing.T) {
+	generated := map[string]proto.Message{
+		"Record":           &Record{},
+		"QueryResults":     &QueryResults{},
+		"History":          &History{},
+		"HistoryEntry":     &HistoryEntry{},
+		"ResponseEnvelope": &ResponseEnvelope{},
+		"ArchivalManifest": &ArchivalManifest{},
+		"ArchivedRecord":   &ArchivedRecord{},
+		"BatchRequest":     &BatchRequest{},
+		"BatchEntry":       &BatchEntry{},
+	}
+
+	messages := parseProtoMessages(t)
+	if len(messages) != len(generated) {
+		t.Fatalf("simple_chaincode.proto has %d messages, simple_chaincode.pb.go %d", len(messages), len(generated))
+	}
+
+	for name, fields := range messages {
+		m, ok := generated[name]
+		if !ok {
+			t.Fatalf("the message %s has no Go type", name)
+		}
+
+		structType := reflect.TypeOf(m).Elem()
+		tags := map[int]reflect.StructField{}
+		for i := 0; i < structType.NumField(); i++ {
+			f := structType.Field(i)
+			tag, ok := f.Tag.Lookup("protobuf")
+			if !ok {
+				continue
+			}
+			number, _ := strconv.Atoi(strings.Split(tag, ",")[1])
+			tags[number] = f
+		}
+		if len(tags) != len(fields) {
+			t.Fatalf("%s has %d fields in simple_chaincode.proto, %d in Go", name, len(fields), len(tags))
+		}
+
+		wireTypes := map[int]uint64{}
+		for _, field := range fields {
+			f, ok := tags[field.number]
+			if !ok {
+				t.Fatalf("the field %s.%s has no Go field", name, field.name)
+			}
+
+			goType, ok := protoScalarTypes[field.typ]
+			if !ok {
+				goType = reflect.TypeOf(generated[field.typ])
+			}
+			cardinality := "opt"
+			if field.repeated {
+				goType, cardinality = reflect.SliceOf(goType), "rep"
+			}
+			if f.Type != goType {
+				t.Fatalf("%s.%s is a %s in simple_chaincode.proto, a %s in Go", name, field.name, goType, f.Type)
+			}
+
+			expected := fmt.Sprintf("%s,%d,%s,name=%s", protoWireType(field.typ), field.number, cardinality, field.name)
+			if tag := f.Tag.Get("protobuf"); !strings.HasPrefix(tag, expected+",") {
+				t.Fatalf("%s.%s has the tag %s, expected %s", name, field.name, tag, expected)
+			}
+
+			wireTypes[field.number] = proto.WireBytes
+			if protoWireType(field.typ) == "varint" {
+				wireTypes[field.number] = proto.WireVarint
+			}
+		}
+
+		filled := reflect.New(structType)
+		fillMessage(filled.Elem())
+		encoded, err := proto.Marshal(filled.Interface().(proto.Message))
+		if err != nil {
+			t.Fatalf("unable to marshal %s: %s", name, err.Error())
+		}
+
+		seen := map[int]bool{}
+		for rest := encoded; len(rest) > 0; {
+			key, n := proto.DecodeVarint(rest)
+			if n == 0 {
+				t.Fatalf("%s encodes a malformed key", name)
+			}
+			number, wireType := int(key>>3), key&7
+			if expected, ok := wireTypes[number]; !ok || wireType != expected {
+				t.Fatalf("%s encodes the field %d with the wire type %d, unknown to simple_chaincode.proto", name, number, wireType)
+			}
+
+			value, m := proto.DecodeVarint(rest[n:])
+			if m == 0 || wireType == proto.WireBytes && uint64(len(rest[n+m:])) < value {
+				t.Fatalf("%s encodes the field %d malformed", name, number)
+			}
+			rest = rest[n+m:]
+			if wireType == proto.WireBytes {
+				rest = rest[value:]
+			}
+			seen[number] = true
+		}
+		if len(seen) != len(fields) {
+			t.Fatalf("%s encodes %d of its %d fields", name, len(seen), len(fields))
+		}
+
+		decoded := reflect.New(structType).Interface().(proto.Message)
+		if err := proto.Unmarshal(encoded, decoded); err != nil {
+			t.Fatalf("unable to unmarshal %s: %s", name, err.Error())
+		}
+		if !proto.Equal(decoded, filled.Interface().(proto.Message)) {
+			t.Fatalf("%s doesn't round-trip: %v, got %v", name, filled.Interface(), decoded)
+		}
+	}
+}
+
+func TestVerifyChain(t *testing.T) {
+	stub := newStub(t)
+	mustInvoke(t, stub, "put", "thing", "doc", `{"b":1,"a":[true]}`)
+	mustInvoke(t, stub, "put", "thing", "text", "plain")
+	mustInvoke(t, stub, "update", "thing", "doc", `{"b":2}`)
+
+	verify := func() chainReport {
+		t.Helper()
+		var report chainReport
+		if err := json.Unmarshal(mustInvoke(t, stub, "verifyChain", "thing"), &report); err != nil {
+			t.Fatal(err)
+		}
+		return report
+	}
+	if report := verify(); !report.Valid || report.Entries != 3 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+
+	// the document copy of a JSON value must match the value
+	stub.MockTransactionStart("tamper")
+	key, _ := stub.CreateCompositeKey("thing", []string{"doc"})
+	stored, _ := stub.GetState(key)
+	stub.PutState(key, bytes.Replace(stored, []byte(`"doc":{"b":2}`), []byte(`"doc":{"b":3}`), 1))
+	stub.MockTransactionEnd("tamper")
+
+	report := verify()
+	if report.Valid || report.Break == nil || report.Break.Key != "doc" {
+		t.Fatalf("unexpected report %+v", report)
+	}
+}
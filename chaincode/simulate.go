@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// overlayStub keeps the writes of a simulated function to itself instead of
+// passing them on to the peer. Wrapped in a txStub, the function reads its
+// own writes as it would in a real transaction.
+type overlayStub struct {
+	shim.ChaincodeStubInterface
+	writes map[string][]byte
+	events []simulatedEvent
+}
+
+func (s *overlayStub) unwrap() shim.ChaincodeStubInterface {
+	return s.ChaincodeStubInterface
+}
+
+func (s *overlayStub) PutState(key string, value []byte) error {
+	s.writes[key] = value
+	return nil
+}
+
+func (s *overlayStub) DelState(key string) error {
+	s.writes[key] = nil
+	return nil
+}
+
+func (s *overlayStub) SetEvent(name string, payload []byte) error {
+	s.events = append(s.events, simulatedEvent{name, payload})
+	return nil
+}
+
+// simulatedWrite is an entry of the write set of a simulation. ObjType and
+// Attributes are set for composite keys.
+type simulatedWrite struct {
+	Key        string   `json:"key"`
+	ObjType    string   `json:"objType,omitempty"`
+	Attributes []string `json:"attributes,omitempty"`
+	Value      []byte   `json:"value,omitempty"`
+	IsDelete   bool     `json:"isDelete"`
+}
+
+type simulatedEvent struct {
+	Name    string `json:"name"`
+	Payload []byte `json:"payload"`
+}
+
+// simulation is what a function would have done: its response and, if it
+// succeeded, the write set, ordered by key as the peer orders it, and the
+// events. Values and payloads are base64-encoded.
+type simulation struct {
+	Function string           `json:"function"`
+	Status   int32            `json:"status"`
+	Message  string           `json:"message,omitempty"`
+	Payload  []byte           `json:"payload,omitempty"`
+	Writes   []simulatedWrite `json:"writes"`
+	Events   []simulatedEvent `json:"events"`
+}
+
+// simulate runs a function against an overlay of the state and returns its
+// response and the writes it would have made, without making any. simulate
+// is itself read-only, so its writes can't reach the ledger even by mistake.
+func (cc *SimpleChaincode) simulate(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.simulate")
+
+	if len(args) < 1 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected at least %d", len(args), 1)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	function, functionArgs := args[0], args[1:]
+	logger.Debugf("function: %s, args: %v", function, functionArgs)
+
+	r, ok := routesByName[function]
+	if !ok {
+		message := fmt.Sprintf("unknown function name: %s", function)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	if function == "simulate" {
+		message := "simulate can't simulate itself"
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	overlay := &overlayStub{ChaincodeStubInterface: stub, writes: map[string][]byte{}, events: []simulatedEvent{}}
+	response := structuredError(r.handlerFor(functionArgs)(cc, newTxStub(overlay), functionArgs))
+
+	result := simulation{
+		Function: function,
+		Status:   response.Status,
+		Message:  response.Message,
+		Payload:  response.Payload,
+		Writes:   []simulatedWrite{},
+		Events:   []simulatedEvent{},
+	}
+
+	// the peer drops the writes of failed transactions
+	if response.Status < shim.ERRORTHRESHOLD {
+		keys := make([]string, 0, len(overlay.writes))
+		for key := range overlay.writes {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			w := simulatedWrite{Key: key, Value: overlay.writes[key], IsDelete: overlay.writes[key] == nil}
+			if isCompositeKey(key) {
+				if objType, attributes, err := stub.SplitCompositeKey(key); err == nil {
+					w.ObjType, w.Attributes = objType, attributes
+				}
+			}
+			result.Writes = append(result.Writes, w)
+		}
+		result.Events = overlay.events
+	}
+
+	resultBytes, err := json.Marshal(result)
+	if err != nil {
+		message := fmt.Sprintf("unable to marshal the result: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.simulate exited successfully")
+	return shim.Success(resultBytes)
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// snapshotFormat is the version of the layout of stateSnapshot, for
+// importState to reject snapshots it doesn't know how to replay.
+const snapshotFormat = 1
+
+// stateSnapshot is a range of the world state as exportState writes it, in
+// canonical JSON, see canonicalJSON. Checksum is the canonical hash of the
+// snapshot without it, so that a snapshot altered on its way from one network
+// to another, even reformatted, is told apart.
+type stateSnapshot struct {
+	Format     int             `json:"format"`
+	Channel    string          `json:"channel"`
+	KeyFrom    string          `json:"keyFrom"`
+	KeyTo      string          `json:"keyTo"`
+	ExportedAt time.Time       `json:"exportedAt"`
+	TxID       string          `json:"txId"`
+	Entries    []snapshotEntry `json:"entries"`
+	Algorithm  string          `json:"algorithm"`
+	Checksum   string          `json:"checksum,omitempty"`
+}
+
+// snapshotEntry is a record of a snapshot, metadata included, so that it's
+// imported as it was exported.
+type snapshotEntry struct {
+	Key    string  `json:"key"`
+	Record *record `json:"record"`
+}
+
+// snapshotImport is the result of importState.
+type snapshotImport struct {
+	Imported int    `json:"imported"`
+	Checksum string `json:"checksum"`
+}
+
+func (s *stateSnapshot) checksum() (string, error) {
+	unsealed := *s
+	unsealed.Checksum = ""
+	return canonicalHash(unsealed)
+}
+
+// exportState returns the records of the simple keys in the range
+// [keyFrom, keyTo) as a snapshot for importState, up to maxPageSize of them;
+// a larger range is exported in parts. Records are exported as stored, locked
+// ones included, so only admins export state.
+func (cc *SimpleChaincode) exportState(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.exportState")
+
+	if len(args) != 2 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d", len(args), 2)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	keyFrom, keyTo := args[0], args[1]
+	logger.Debugf("range: [\"%s\", \"%s\")", keyFrom, keyTo)
+
+	if err := requireAdmin(stub); err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 403, Message: message}
+	}
+
+	now, err := txTime(stub)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the transaction timestamp: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	it, err := stub.GetStateByRange(keyFrom, keyTo)
+	if err != nil {
+		message := fmt.Sprintf("unable to get an iterator over the range [\"%s\", \"%s\"): %s",
+			keyFrom, keyTo, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+	defer it.Close()
+
+	s := stateSnapshot{Format: snapshotFormat, Channel: stub.GetChannelID(), KeyFrom: keyFrom, KeyTo: keyTo,
+		ExportedAt: now, TxID: stub.GetTxID(), Entries: []snapshotEntry{}, Algorithm: hashAlgorithm}
+	for it.HasNext() {
+		response, err := it.Next()
+		if err != nil {
+			message := fmt.Sprintf("unable to get the next element: %s", err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		if len(s.Entries) == maxPageSize {
+			message := fmt.Sprintf("the range holds more than %d keys, export it in parts", maxPageSize)
+			logger.Error(message)
+			return pb.Response{Status: 400, Message: message}
+		}
+
+		r := decodeRecord(response.Value)
+		if err := r.verify(); err != nil {
+			message := fmt.Sprintf("unable to get a value for the key %s: %s", response.Key, err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		s.Entries = append(s.Entries, snapshotEntry{Key: response.Key, Record: r})
+	}
+
+	if s.Checksum, err = s.checksum(); err != nil {
+		message := fmt.Sprintf("unable to compute the checksum of the snapshot: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	snapshotBytes, err := json.Marshal(s)
+	if err == nil {
+		snapshotBytes, err = canonicalJSON(snapshotBytes)
+	}
+	if err != nil {
+		message := fmt.Sprintf("unable to marshal the snapshot: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.exportState exited successfully")
+	return shim.Success(snapshotBytes)
+}
+
+// importState checks a snapshot written by exportState, on this network or
+// another one, and replays it: its records are put as they were exported,
+// over the values of their keys if any. Keys of the range missing from the
+// snapshot are left alone. Only admins import snapshots.
+func (cc *SimpleChaincode) importState(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.importState")
+
+	if len(args) != 1 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d", len(args), 1)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+	logger.Debugf("snapshot: %d bytes", len(args[0]))
+
+	if err := requireAdmin(stub); err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 403, Message: message}
+	}
+
+	var s stateSnapshot
+	if err := json.Unmarshal([]byte(args[0]), &s); err != nil {
+		message := fmt.Sprintf("unable to parse the snapshot: %s", err.Error())
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	if s.Format != snapshotFormat || s.Algorithm != hashAlgorithm {
+		message := fmt.Sprintf("unsupported snapshot: format %d, algorithm %s, expected format %d, algorithm %s",
+			s.Format, s.Algorithm, snapshotFormat, hashAlgorithm)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	if len(s.Entries) > maxPageSize {
+		message := fmt.Sprintf("the snapshot holds more than %d entries", maxPageSize)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	if checksum, err := s.checksum(); err != nil || checksum != s.Checksum {
+		message := "the snapshot doesn't match its checksum"
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	for i, e := range s.Entries {
+		inRange := e.Key >= s.KeyFrom && (s.KeyTo == "" || e.Key < s.KeyTo)
+		if e.Key == "" || isCompositeKey(e.Key) || !inRange || e.Record == nil {
+			message := fmt.Sprintf("the entry %d isn't a record of a simple key of the range", i)
+			logger.Error(message)
+			return pb.Response{Status: 400, Message: message}
+		}
+
+		if i > 0 && e.Key <= s.Entries[i-1].Key {
+			message := fmt.Sprintf("the entry %d is out of order", i)
+			logger.Error(message)
+			return pb.Response{Status: 400, Message: message}
+		}
+
+		if err := e.Record.verify(); err != nil {
+			message := fmt.Sprintf("the entry %d: %s", i, err.Error())
+			logger.Error(message)
+			return pb.Response{Status: 400, Message: message}
+		}
+	}
+
+	for _, e := range s.Entries {
+		var err error
+		if e.Record.UpdatedAt.IsZero() {
+			// a value stored before the envelope was introduced, as is
+			err = stub.PutState(e.Key, []byte(e.Record.Value))
+		} else {
+			err = storeRecord(stub, e.Key, e.Record)
+		}
+		if response, ok := invalidValueResponse(err); ok {
+			return response
+		}
+		if err != nil {
+			message := fmt.Sprintf("unable to put a value for the key %s: %s", e.Key, err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		if err := appendAudit(stub, "import", "", e.Key, e.Record); err != nil {
+			message := fmt.Sprintf("unable to append to the audit log: %s", err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+	}
+
+	result, err := json.Marshal(snapshotImport{Imported: len(s.Entries), Checksum: s.Checksum})
+	if err != nil {
+		message := fmt.Sprintf("unable to marshal the result: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.importState exited successfully")
+	return shim.Success(result)
+}
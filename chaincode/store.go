@@ -0,0 +1,111 @@
+package main
+
+import (
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// stateStore is a decorator of the stub that applies a single policy, e.g.
+// reading the transaction's own writes or rejecting writes altogether, and
+// passes everything else on to the stub it wraps. Handlers see the stack as a
+// plain stub; code that depends on a particular decorator finds it by
+// unwrapping the stack, so the decorators compose in any order.
+type stateStore interface {
+	shim.ChaincodeStubInterface
+	unwrap() shim.ChaincodeStubInterface
+}
+
+type storeDecorator func(shim.ChaincodeStubInterface) shim.ChaincodeStubInterface
+
+// decorate wraps stub in decorators, the first one innermost, i.e. the
+// closest to the peer.
+func decorate(stub shim.ChaincodeStubInterface, decorators ...storeDecorator) shim.ChaincodeStubInterface {
+	for _, d := range decorators {
+		stub = d(stub)
+	}
+
+	return stub
+}
+
+// findTxStub returns the innermost txStub of a stack of decorators: nested
+// ones, e.g. around a simulation, share the transaction it stands for.
+func findTxStub(stub shim.ChaincodeStubInterface) *txStub {
+	var found *txStub
+	for stub != nil {
+		if s, ok := stub.(*txStub); ok {
+			found = s
+		}
+
+		store, ok := stub.(stateStore)
+		if !ok {
+			break
+		}
+		stub = store.unwrap()
+	}
+
+	return found
+}
+
+func txStore(stub shim.ChaincodeStubInterface) shim.ChaincodeStubInterface {
+	return newTxStub(stub)
+}
+
+func readOnlyStore(function string) storeDecorator {
+	return func(stub shim.ChaincodeStubInterface) shim.ChaincodeStubInterface {
+		return &readOnlyStub{ChaincodeStubInterface: stub, function: function}
+	}
+}
+
+// metricsStub counts the state accesses of a function that reach the peer,
+// to be logged once the function returns.
+type metricsStub struct {
+	shim.ChaincodeStubInterface
+	reads, writes, deletes, queries int
+	bytesRead, bytesWritten         int
+}
+
+func (s *metricsStub) unwrap() shim.ChaincodeStubInterface {
+	return s.ChaincodeStubInterface
+}
+
+func (s *metricsStub) GetState(key string) ([]byte, error) {
+	value, err := s.ChaincodeStubInterface.GetState(key)
+	s.reads++
+	s.bytesRead += len(value)
+	return value, err
+}
+
+func (s *metricsStub) PutState(key string, value []byte) error {
+	s.writes++
+	s.bytesWritten += len(value)
+	return s.ChaincodeStubInterface.PutState(key, value)
+}
+
+func (s *metricsStub) DelState(key string) error {
+	s.deletes++
+	return s.ChaincodeStubInterface.DelState(key)
+}
+
+func (s *metricsStub) GetStateByRange(startKey, endKey string) (shim.StateQueryIteratorInterface, error) {
+	s.queries++
+	return s.ChaincodeStubInterface.GetStateByRange(startKey, endKey)
+}
+
+func (s *metricsStub) GetStateByPartialCompositeKey(objectType string, keys []string) (shim.StateQueryIteratorInterface, error) {
+	s.queries++
+	return s.ChaincodeStubInterface.GetStateByPartialCompositeKey(objectType, keys)
+}
+
+func (s *metricsStub) GetQueryResult(query string) (shim.StateQueryIteratorInterface, error) {
+	s.queries++
+	return s.ChaincodeStubInterface.GetQueryResult(query)
+}
+
+func (s *metricsStub) GetHistoryForKey(key string) (shim.HistoryQueryIteratorInterface, error) {
+	s.queries++
+	return s.ChaincodeStubInterface.GetHistoryForKey(key)
+}
+
+func (s *metricsStub) log(function string) {
+	logger.Infof("%s: %d reads (%d bytes), %d writes (%d bytes), %d deletes, %d queries",
+		function, s.reads, s.bytesRead, s.writes, s.bytesWritten, s.deletes, s.queries)
+}
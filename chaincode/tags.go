@@ -0,0 +1,247 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+const (
+	// tagObjType keys index records by tag for findByTag, taggedObjType ones
+	// list the tags of a record so they can be dropped along with it
+	tagObjType    = reservedObjTypePrefix + "tag"
+	taggedObjType = reservedObjTypePrefix + "tagged"
+)
+
+type taggedRecord struct {
+	ObjType string  `json:"objType"`
+	Key     string  `json:"key"`
+	Record  *record `json:"record"`
+}
+
+type taggedPage struct {
+	Records             []taggedRecord `json:"records"`
+	Bookmark            string         `json:"bookmark"`
+	FetchedRecordsCount int32          `json:"fetchedRecordsCount"`
+}
+
+func (page taggedPage) ndjsonLines() []interface{} {
+	lines := make([]interface{}, 0, len(page.Records)+1)
+	for _, r := range page.Records {
+		lines = append(lines, r)
+	}
+
+	return append(lines, ndjsonCursor{bookmarkCursor{page.Bookmark, page.FetchedRecordsCount}})
+}
+
+func (cc *SimpleChaincode) tag(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.tag")
+	return cc.updateTags(stub, args, true)
+}
+
+func (cc *SimpleChaincode) untag(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.untag")
+	return cc.updateTags(stub, args, false)
+}
+
+// updateTags attaches the tags to or removes them from an existing record.
+func (cc *SimpleChaincode) updateTags(stub shim.ChaincodeStubInterface, args []string, attach bool) pb.Response {
+	if len(args) < 3 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected at least %d", len(args), 3)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	objType, key, tags := args[0], args[1], args[2:]
+	logger.Debugf("type: %s, key: %s, tags: %v, attach: %t", objType, key, tags, attach)
+
+	compositeKey, err := createCompositeKey(stub, objType, key)
+	if err != nil {
+		message := fmt.Sprintf("unable to create a composite key: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	valueBytes, err := stub.GetState(compositeKey)
+	if err != nil {
+		message := fmt.Sprintf("unable to get a value for the key %s: %s", key, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if valueBytes == nil {
+		message := fmt.Sprintf("a value for the key %s not found", key)
+		logger.Error(message)
+		return pb.Response{Status: 404, Message: message}
+	}
+
+	for _, t := range tags {
+		if t == "" {
+			message := "tags must be non-empty strings"
+			logger.Error(message)
+			return pb.Response{Status: 400, Message: message}
+		}
+
+		if err := setTag(stub, objType, key, t, attach); err != nil {
+			message := fmt.Sprintf("unable to update the tag %s: %s", t, err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+	}
+
+	logger.Info("SimpleChaincode.updateTags exited successfully")
+	return shim.Success(nil)
+}
+
+func setTag(stub shim.ChaincodeStubInterface, objType, key, tag string, attach bool) error {
+	tagKey, err := stub.CreateCompositeKey(tagObjType, []string{tag, objType, key})
+	if err != nil {
+		return err
+	}
+
+	taggedKey, err := stub.CreateCompositeKey(taggedObjType, []string{objType, key, tag})
+	if err != nil {
+		return err
+	}
+
+	for _, k := range []string{tagKey, taggedKey} {
+		if attach {
+			err = stub.PutState(k, presenceMarker)
+		} else {
+			err = stub.DelState(k)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// dropTags removes all the tags of the record objType/key.
+func dropTags(stub shim.ChaincodeStubInterface, objType, key string) error {
+	it, err := stub.GetStateByPartialCompositeKey(taggedObjType, []string{objType, key})
+	if err != nil {
+		return err
+	}
+	defer it.Close()
+
+	for it.HasNext() {
+		response, err := it.Next()
+		if err != nil {
+			return err
+		}
+
+		_, attributes, err := stub.SplitCompositeKey(response.Key)
+		if err != nil {
+			return err
+		}
+
+		if err := setTag(stub, objType, key, attributes[2], false); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (cc *SimpleChaincode) findByTag(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.findByTag")
+
+	if len(args) != 3 && len(args) != 4 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d or %d", len(args), 3, 4)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	tag, pageSizeArg, bookmark, format := args[0], args[1], args[2], formatJSON
+	if len(args) == 4 {
+		format = args[3]
+	}
+	logger.Debugf("tag: %s, pageSize: %s, bookmark: %s, format: %s", tag, pageSizeArg, bookmark, format)
+
+	if err := checkFormat(format); err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	pageSize, err := strconv.ParseInt(pageSizeArg, 10, 32)
+	if err != nil || pageSize < 1 || pageSize > maxPageSize {
+		message := fmt.Sprintf("page size must be an integer in [1, %d], got \"%s\"", maxPageSize, pageSizeArg)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	now, err := txTime(stub)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the transaction timestamp: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	it, metadata, err := stub.GetStateByPartialCompositeKeyWithPagination(tagObjType, []string{tag},
+		int32(pageSize), bookmark)
+	if err == nil && it == nil {
+		err = errPaginationUnsupported
+	}
+	if err != nil {
+		message := fmt.Sprintf("unable to get an iterator over the tag %s: %s", tag, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+	defer it.Close()
+
+	page := taggedPage{
+		Records:             []taggedRecord{},
+		Bookmark:            metadata.Bookmark,
+		FetchedRecordsCount: metadata.FetchedRecordsCount,
+	}
+	for it.HasNext() {
+		response, err := it.Next()
+		if err != nil {
+			message := fmt.Sprintf("unable to get the next element: %s", err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		_, attributes, err := stub.SplitCompositeKey(response.Key)
+		if err != nil {
+			message := fmt.Sprintf("unable to split the composite key: %s", err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		objType, key := attributes[1], attributes[2]
+		compositeKey, err := createCompositeKey(stub, objType, key)
+		if err != nil {
+			message := fmt.Sprintf("unable to create a composite key: %s", err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		r, err := getRecord(stub, compositeKey)
+		if err != nil {
+			message := fmt.Sprintf("unable to get a value for the key %s: %s", key, err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		if r != nil {
+			r = r.readableAt(now)
+		}
+		page.Records = append(page.Records, taggedRecord{ObjType: objType, Key: key, Record: r})
+	}
+
+	result, err := marshalResult(page, format)
+	if err != nil {
+		message := fmt.Sprintf("unable to marshal the result: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.findByTag exited successfully")
+	return shim.Success(result)
+}
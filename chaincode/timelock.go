@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// lockedAt reports whether the value of r can't be read yet at now.
+func (r *record) lockedAt(now time.Time) bool {
+	return r.UnlockAt != nil && now.Before(*r.UnlockAt)
+}
+
+// sealed returns a copy of r with the value left out.
+func (r *record) sealed() *record {
+	sealed := *r
+	// the checksum would let short values be guessed
+	sealed.Value, sealed.Checksum = "", ""
+	return &sealed
+}
+
+// readableAt returns r itself, or its sealed copy while it's locked, once
+// it's expired and once it's marked deleted, so that listings only show the
+// metadata of such records.
+func (r *record) readableAt(now time.Time) *record {
+	if r.DeletedAt != nil || r.lockedAt(now) || r.expiredAt(now) {
+		return r.sealed()
+	}
+
+	return r
+}
+
+func (cc *SimpleChaincode) putTimeLocked(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.putTimeLocked")
+
+	if len(args) != 4 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d", len(args), 4)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	objType, key, value, unlockAtArg := args[0], args[1], args[2], args[3]
+	logger.Debugf("type: %s, key: %s, value: %s, unlockAt: %s", objType, key, value, unlockAtArg)
+
+	if response, denied := accessDenied(stub, accessWrite, objType); denied {
+		return response
+	}
+
+	unlockAt, err := time.Parse(time.RFC3339Nano, unlockAtArg)
+	if err != nil {
+		message := fmt.Sprintf("unlockAt must be in RFC 3339 format: %s", err.Error())
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+	unlockAt = unlockAt.UTC()
+
+	compositeKey, err := createCompositeKey(stub, objType, key)
+	if err != nil {
+		message := fmt.Sprintf("unable to create a composite key: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	r, err := newRecordVersion(stub, compositeKey, value)
+	if err != nil {
+		message := fmt.Sprintf("unable to put a key-value pair: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+	r.UnlockAt = &unlockAt
+
+	if err := storeRecord(stub, compositeKey, r); err != nil {
+		message := fmt.Sprintf("unable to put a key-value pair: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if err := appendAudit(stub, "putTimeLocked", objType, key, r); err != nil {
+		message := fmt.Sprintf("unable to append to the audit log: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.putTimeLocked exited successfully")
+	return shim.Success(nil)
+}
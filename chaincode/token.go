@@ -0,0 +1,367 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// The token contract is a fungible token in the style of ERC-20, next to the
+// key-value one. Its functions are named token:<function>, the way contracts
+// of a chaincode are told apart by the contract API. Holders are identified
+// by the id of their certificate, as whoami returns it; amounts are integers
+// of the smallest unit, as decimal strings.
+const (
+	tokenObjType = reservedObjTypePrefix + "token"
+
+	tokenTransferEvent = "Transfer"
+)
+
+var tokenValuePattern = regexp.MustCompile(`^[0-9]+$`)
+
+func init() {
+	register(route{"token:mint", (*SimpleChaincode).tokenMint, false, []string{"to", "value"}})
+	register(route{"token:burn", (*SimpleChaincode).tokenBurn, false, []string{"value"}})
+	register(route{"token:transfer", (*SimpleChaincode).tokenTransfer, false, []string{"to", "value"}})
+	register(route{"token:balanceOf", (*SimpleChaincode).tokenBalanceOf, true, []string{"holder?", "format?"}})
+	register(route{"token:totalSupply", (*SimpleChaincode).tokenTotalSupply, true, []string{"format?"}})
+}
+
+// tokenTransfer is the payload of the Transfer event. From is empty for a
+// mint and To for a burn.
+type tokenTransfer struct {
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Value string `json:"value"`
+}
+
+// tokenBalance is the balance of a holder, or with an empty Holder, the total
+// supply.
+type tokenBalance struct {
+	Holder string `json:"holder,omitempty"`
+	Value  string `json:"value"`
+}
+
+func parseTokenValue(valueArg string) (*amount, error) {
+	var value amount
+	if !tokenValuePattern.MatchString(valueArg) {
+		return nil, fmt.Errorf("value must be a positive integer, got \"%s\"", valueArg)
+	}
+
+	value.SetString(valueArg, 10)
+	if value.Sign() <= 0 {
+		return nil, fmt.Errorf("value must be a positive integer, got \"%s\"", valueArg)
+	}
+
+	return &value, nil
+}
+
+// tokenKey returns the key of the balance of holder, or of the total supply
+// for an empty holder.
+func tokenKey(stub shim.ChaincodeStubInterface, holder string) (string, error) {
+	if holder == "" {
+		return stub.CreateCompositeKey(tokenObjType, []string{"supply"})
+	}
+
+	return stub.CreateCompositeKey(tokenObjType, []string{"balance", holder})
+}
+
+// getTokenBalance returns the balance of holder, or the total supply, zero if
+// none was ever recorded.
+func getTokenBalance(stub shim.ChaincodeStubInterface, holder string) (string, *amount, error) {
+	balanceKey, err := tokenKey(stub, holder)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var value amount
+	valueBytes, err := stub.GetState(balanceKey)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if valueBytes != nil {
+		if _, ok := value.SetString(string(valueBytes), 10); !ok {
+			return "", nil, fmt.Errorf("the balance under %s is corrupted", balanceKey)
+		}
+	}
+
+	return balanceKey, &value, nil
+}
+
+// moveTokens takes value from the balance of from and adds it to the balance
+// of to, an empty holder standing for the total supply, which mints and burns
+// go through. It reports a short balance as false.
+func moveTokens(stub shim.ChaincodeStubInterface, from, to string, value *amount) (bool, error) {
+	fromKey, fromBalance, err := getTokenBalance(stub, from)
+	if err != nil {
+		return false, err
+	}
+
+	if from != "" {
+		if fromBalance.cmp(value) < 0 {
+			return false, nil
+		}
+		fromBalance.sub(value)
+	} else {
+		fromBalance.add(value)
+	}
+
+	if err := stub.PutState(fromKey, []byte(fromBalance.String())); err != nil {
+		return false, err
+	}
+
+	// a transfer to oneself reads its own write
+	toKey, toBalance, err := getTokenBalance(stub, to)
+	if err != nil {
+		return false, err
+	}
+
+	if to != "" {
+		toBalance.add(value)
+	} else {
+		toBalance.sub(value)
+	}
+
+	if err := stub.PutState(toKey, []byte(toBalance.String())); err != nil {
+		return false, err
+	}
+
+	transfer, err := json.Marshal(tokenTransfer{From: from, To: to, Value: value.String()})
+	if err != nil {
+		return false, err
+	}
+
+	return true, stub.SetEvent(tokenTransferEvent, transfer)
+}
+
+// tokenMint creates tokens on the balance of a holder. Only admins mint.
+func (cc *SimpleChaincode) tokenMint(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.tokenMint")
+
+	if len(args) != 2 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d", len(args), 2)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	to, valueArg := args[0], args[1]
+	logger.Debugf("to: %s, value: %s", to, valueArg)
+
+	if err := requireAdmin(stub); err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 403, Message: message}
+	}
+
+	if to == "" {
+		message := "the holder must be a non-empty string"
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	value, err := parseTokenValue(valueArg)
+	if err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	if _, err := moveTokens(stub, "", to, value); err != nil {
+		message := fmt.Sprintf("unable to mint: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.tokenMint exited successfully")
+	return shim.Success(nil)
+}
+
+// tokenBurn destroys tokens of the caller.
+func (cc *SimpleChaincode) tokenBurn(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.tokenBurn")
+
+	if len(args) != 1 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d", len(args), 1)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	valueArg := args[0]
+	logger.Debugf("value: %s", valueArg)
+
+	value, err := parseTokenValue(valueArg)
+	if err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	from, err := callerID(stub)
+	if err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	ok, err := moveTokens(stub, from, "", value)
+	if err != nil {
+		message := fmt.Sprintf("unable to burn: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if !ok {
+		message := fmt.Sprintf("the balance of %s is short of %s", from, value.String())
+		logger.Error(message)
+		return pb.Response{Status: 409, Message: message}
+	}
+
+	logger.Info("SimpleChaincode.tokenBurn exited successfully")
+	return shim.Success(nil)
+}
+
+// tokenTransfer moves tokens of the caller to another holder.
+func (cc *SimpleChaincode) tokenTransfer(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.tokenTransfer")
+
+	if len(args) != 2 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d", len(args), 2)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	to, valueArg := args[0], args[1]
+	logger.Debugf("to: %s, value: %s", to, valueArg)
+
+	if to == "" {
+		message := "the holder must be a non-empty string"
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	value, err := parseTokenValue(valueArg)
+	if err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	from, err := callerID(stub)
+	if err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	ok, err := moveTokens(stub, from, to, value)
+	if err != nil {
+		message := fmt.Sprintf("unable to transfer: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if !ok {
+		message := fmt.Sprintf("the balance of %s is short of %s", from, value.String())
+		logger.Error(message)
+		return pb.Response{Status: 409, Message: message}
+	}
+
+	logger.Info("SimpleChaincode.tokenTransfer exited successfully")
+	return shim.Success(nil)
+}
+
+// tokenBalanceOf returns the balance of a holder, the caller by default.
+func (cc *SimpleChaincode) tokenBalanceOf(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.tokenBalanceOf")
+
+	if len(args) > 2 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected at most %d", len(args), 2)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	holder, format := "", formatJSON
+	if len(args) >= 1 {
+		holder = args[0]
+	}
+	if len(args) == 2 {
+		format = args[1]
+	}
+	logger.Debugf("holder: %s, format: %s", holder, format)
+
+	if err := checkFormat(format); err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	if holder == "" {
+		id, err := callerID(stub)
+		if err != nil {
+			message := err.Error()
+			logger.Error(message)
+			return shim.Error(message)
+		}
+		holder = id
+	}
+
+	_, value, err := getTokenBalance(stub, holder)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the balance of %s: %s", holder, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	result, err := marshalResult(tokenBalance{Holder: holder, Value: value.String()}, format)
+	if err != nil {
+		message := fmt.Sprintf("unable to marshal the result: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.tokenBalanceOf exited successfully")
+	return shim.Success(result)
+}
+
+func (cc *SimpleChaincode) tokenTotalSupply(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.tokenTotalSupply")
+
+	if len(args) > 1 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d or %d", len(args), 0, 1)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	format := formatJSON
+	if len(args) == 1 {
+		format = args[0]
+	}
+	logger.Debugf("format: %s", format)
+
+	if err := checkFormat(format); err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	_, value, err := getTokenBalance(stub, "")
+	if err != nil {
+		message := fmt.Sprintf("unable to get the total supply: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	result, err := marshalResult(tokenBalance{Value: value.String()}, format)
+	if err != nil {
+		message := fmt.Sprintf("unable to marshal the result: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.tokenTotalSupply exited successfully")
+	return shim.Success(result)
+}
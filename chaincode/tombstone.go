@@ -0,0 +1,278 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// In the tombstone delete mode of an object type, deleting a record only
+// marks it deleted, so that it can be restored; get answers 410 Gone for it.
+// purge deletes a record for good, in either mode. Past values stay in the
+// history of the key all the same: data that must be erased for real belongs
+// in a private data collection, whose purge drops it from the peers.
+const (
+	deleteModeObjType = reservedObjTypePrefix + "deletemode"
+
+	deleteModeHard      = "hard"
+	deleteModeTombstone = "tombstone"
+)
+
+func deleteModeKey(stub shim.ChaincodeStubInterface, objType string) (string, error) {
+	return stub.CreateCompositeKey(deleteModeObjType, []string{objType})
+}
+
+// tombstoned reports whether objType is in the tombstone delete mode.
+func tombstoned(stub shim.ChaincodeStubInterface, objType string) (bool, error) {
+	modeKey, err := deleteModeKey(stub, objType)
+	if err != nil {
+		return false, err
+	}
+
+	modeBytes, err := stub.GetState(modeKey)
+	return modeBytes != nil, err
+}
+
+// removeRecord deletes the record objType/key, stored under compositeKey, as
+// the delete mode of objType has it. A record marked deleted keeps its tags,
+// but drops out of the asset indexes until it's restored.
+func removeRecord(stub shim.ChaincodeStubInterface, objType, key, compositeKey string) error {
+	tombstone, err := tombstoned(stub, objType)
+	if err != nil {
+		return fmt.Errorf("unable to get the delete mode of the object type %s: %s", objType, err.Error())
+	}
+
+	if !tombstone {
+		return purgeRecord(stub, objType, key, compositeKey, "del")
+	}
+
+	r, err := readRecord(stub, compositeKey)
+	if err != nil {
+		return fmt.Errorf("unable to get a value for the key %s: %s", key, err.Error())
+	}
+
+	if r == nil || r.DeletedAt != nil {
+		return nil
+	}
+
+	return markDeleted(stub, objType, key, compositeKey, r, "tombstone")
+}
+
+// markDeleted marks r, the record objType/key stored under compositeKey,
+// deleted and audits it as op.
+func markDeleted(stub shim.ChaincodeStubInterface, objType, key, compositeKey string, r *record, op string) error {
+	now, err := txTime(stub)
+	if err != nil {
+		return fmt.Errorf("unable to get the transaction timestamp: %s", err.Error())
+	}
+
+	if r.DeletedBy, err = txCreator(stub); err != nil {
+		return err
+	}
+	r.DeletedAt = &now
+
+	if err := storeRecord(stub, compositeKey, r); err != nil {
+		return fmt.Errorf("unable to mark the key %s deleted: %s", key, err.Error())
+	}
+
+	if err := appendAudit(stub, op, objType, key, r); err != nil {
+		return fmt.Errorf("unable to append to the audit log: %s", err.Error())
+	}
+
+	return nil
+}
+
+// purgeRecord deletes the record objType/key for good, along with its tags,
+// and audits it as op.
+func purgeRecord(stub shim.ChaincodeStubInterface, objType, key, compositeKey, op string) error {
+	if err := deleteRecord(stub, compositeKey); err != nil {
+		return fmt.Errorf("unable to delete a pair associated with the key %s: %s", key, err.Error())
+	}
+
+	if err := dropTags(stub, objType, key); err != nil {
+		return fmt.Errorf("unable to drop the tags of the key %s: %s", key, err.Error())
+	}
+
+	if err := appendAudit(stub, op, objType, key, nil); err != nil {
+		return fmt.Errorf("unable to append to the audit log: %s", err.Error())
+	}
+
+	return nil
+}
+
+// setDeleteMode sets how the records of an object type, the simple keys for
+// an empty one, are deleted: for good, "hard", the default, or marked
+// deleted, "tombstone". Only admins set it.
+func (cc *SimpleChaincode) setDeleteMode(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.setDeleteMode")
+
+	if len(args) != 2 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d", len(args), 2)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	objType, mode := args[0], args[1]
+	logger.Debugf("type: %s, mode: %s", objType, mode)
+
+	if err := requireAdmin(stub); err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 403, Message: message}
+	}
+
+	if strings.HasPrefix(objType, reservedObjTypePrefix) {
+		message := fmt.Sprintf("a delete mode can't be set for the object type \"%s\"", objType)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	if mode != deleteModeHard && mode != deleteModeTombstone {
+		message := fmt.Sprintf("unknown delete mode: %s, expected one of {%s, %s}",
+			mode, deleteModeHard, deleteModeTombstone)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	modeKey, err := deleteModeKey(stub, objType)
+	if err != nil {
+		message := fmt.Sprintf("unable to create a composite key: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if mode == deleteModeTombstone {
+		err = stub.PutState(modeKey, presenceMarker)
+	} else {
+		err = stub.DelState(modeKey)
+	}
+	if err != nil {
+		message := fmt.Sprintf("unable to set the delete mode: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.setDeleteMode exited successfully")
+	return shim.Success(nil)
+}
+
+// restore brings back a record marked deleted, as it was. A put over a
+// deleted key brings it back too, with the new value.
+func (cc *SimpleChaincode) restore(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.restore")
+
+	if len(args) != 2 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d", len(args), 2)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	objType, key := args[0], args[1]
+	logger.Debugf("type: %s, key: %s", objType, key)
+
+	if response, denied := accessDenied(stub, accessDelete, objType); denied {
+		return response
+	}
+
+	compositeKey, err := createCompositeKey(stub, objType, key)
+	if err != nil {
+		message := fmt.Sprintf("unable to create a composite key: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	r, err := getRecord(stub, compositeKey)
+	if err != nil {
+		message := fmt.Sprintf("unable to get a value for the key %s: %s", key, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if r == nil {
+		message := fmt.Sprintf("a value for the key %s not found", key)
+		logger.Error(message)
+		return pb.Response{Status: 404, Message: message}
+	}
+
+	if r.DeletedAt == nil {
+		message := fmt.Sprintf("the key %s is not deleted", key)
+		logger.Error(message)
+		return pb.Response{Status: 409, Message: message}
+	}
+
+	r.DeletedAt, r.DeletedBy = nil, nil
+	if err := storeRecord(stub, compositeKey, r); err != nil {
+		message := fmt.Sprintf("unable to restore the key %s: %s", key, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if err := appendAudit(stub, "restore", objType, key, r); err != nil {
+		message := fmt.Sprintf("unable to append to the audit log: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.restore exited successfully")
+	return shim.Success(nil)
+}
+
+// purge deletes a record for good, whether it's marked deleted or not.
+func (cc *SimpleChaincode) purge(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.purge")
+
+	if len(args) != 2 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d", len(args), 2)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	objType, key := args[0], args[1]
+	logger.Debugf("type: %s, key: %s", objType, key)
+
+	if response, denied := accessDenied(stub, accessDelete, objType); denied {
+		return response
+	}
+
+	compositeKey, err := createCompositeKey(stub, objType, key)
+	if err != nil {
+		message := fmt.Sprintf("unable to create a composite key: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	valueBytes, err := stub.GetState(compositeKey)
+	if err != nil {
+		message := fmt.Sprintf("unable to get a value for the key %s: %s", key, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if valueBytes == nil {
+		message := fmt.Sprintf("a value for the key %s not found", key)
+		logger.Error(message)
+		return pb.Response{Status: 404, Message: message}
+	}
+
+	if err := purgeRecord(stub, objType, key, compositeKey, "purge"); err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.purge exited successfully")
+	return shim.Success(nil)
+}
+
+// deletedResponse is the response to a read of a record marked deleted, with
+// its metadata as payload.
+func deletedResponse(key string, r *record) pb.Response {
+	message := fmt.Sprintf("the value for the key %s was deleted at %s", key, r.DeletedAt.Format(time.RFC3339))
+	logger.Error(message)
+	metadata, _ := json.Marshal(r.sealed())
+	return pb.Response{Status: 410, Message: message, Payload: metadata}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// transferOwnership hands the JSON document objType/key over to newOwner. Owners
+// are identified by the id of their certificate, as whoami returns it, and
+// only the current one transfers. With expectedVersion set, the transfer also
+// fails unless the record is still at that version: a client that read the
+// record before deciding on the transfer knows it decided on what's current.
+func (cc *SimpleChaincode) transferOwnership(stub shim.ChaincodeStubInterface, objType, key, newOwner string, expectedVersion *uint64) pb.Response {
+	if response, denied := accessDenied(stub, accessWrite, objType); denied {
+		return response
+	}
+
+	if newOwner == "" {
+		message := "the new owner must be a non-empty string"
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	compositeKey, err := createCompositeKey(stub, objType, key)
+	if err != nil {
+		message := fmt.Sprintf("unable to create a composite key: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	r, err := getRecord(stub, compositeKey)
+	if err != nil {
+		message := fmt.Sprintf("unable to get a value for the key %s: %s", key, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if r == nil {
+		message := fmt.Sprintf("a value for the key %s not found", key)
+		logger.Error(message)
+		return pb.Response{Status: 404, Message: message}
+	}
+
+	now, err := txTime(stub)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the transaction timestamp: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if response, ok := unreadableResponse(key, r, now); ok {
+		return response
+	}
+
+	if expectedVersion != nil && r.Version != *expectedVersion {
+		message := fmt.Sprintf("the key %s is at version %d, expected %d", key, r.Version, *expectedVersion)
+		logger.Error(message)
+		return pb.Response{Status: 409, Message: message}
+	}
+
+	doc, err := decodeJSON([]byte(r.Value))
+	fields, ok := doc.(map[string]interface{})
+	if err != nil || !ok {
+		message := fmt.Sprintf("the value for the key %s is not a JSON object", key)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	owner, ok := fields["owner"].(string)
+	if !ok {
+		message := fmt.Sprintf("the value for the key %s has no owner", key)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	caller, err := callerID(stub)
+	if err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if caller != owner {
+		message := fmt.Sprintf("the caller doesn't own the key %s", key)
+		logger.Error(message)
+		return pb.Response{Status: 403, Message: message}
+	}
+
+	fields["owner"] = newOwner
+	docBytes, err := json.Marshal(fields)
+	if err != nil {
+		message := fmt.Sprintf("unable to marshal the document: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	transferred, err := putRecord(stub, compositeKey, string(docBytes))
+	if response, ok := invalidValueResponse(err); ok {
+		return response
+	}
+	if err != nil {
+		message := fmt.Sprintf("unable to put a key-value pair: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if err := appendAudit(stub, "transfer", objType, key, transferred); err != nil {
+		message := fmt.Sprintf("unable to append to the audit log: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.transferOwnership exited successfully")
+	return shim.Success(nil)
+}
+
+// transfer sets the owner field of a JSON document, as its current owner.
+func (cc *SimpleChaincode) transfer(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.transfer")
+
+	if len(args) != 3 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d", len(args), 3)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	objType, key, newOwner := args[0], args[1], args[2]
+	logger.Debugf("type: %s, key: %s, newOwner: %s", objType, key, newOwner)
+
+	return cc.transferOwnership(stub, objType, key, newOwner, nil)
+}
+
+// transferConditional is transfer for a record still at the version the
+// caller read, 409 otherwise. Two transfers conditional on the same version
+// can't both succeed, even when endorsed concurrently: the second one either
+// sees the new version or fails the MVCC check at commit.
+func (cc *SimpleChaincode) transferConditional(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.transferConditional")
+
+	if len(args) != 4 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d", len(args), 4)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	objType, key, newOwner, expectedVersionArg := args[0], args[1], args[2], args[3]
+	logger.Debugf("type: %s, key: %s, newOwner: %s, expectedVersion: %s", objType, key, newOwner, expectedVersionArg)
+
+	expectedVersion, err := strconv.ParseUint(expectedVersionArg, 10, 64)
+	if err != nil {
+		message := fmt.Sprintf("expected version must be a non-negative integer, got \"%s\"", expectedVersionArg)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	return cc.transferOwnership(stub, objType, key, newOwner, &expectedVersion)
+}
@@ -0,0 +1,439 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+const (
+	// treeObjType keys hold the nodes of the key tree with one composite key
+	// attribute per path segment, so a path prefix is a partial composite key
+	treeObjType = reservedObjTypePrefix + "tree"
+
+	pathSeparator = "/"
+)
+
+type treeNode struct {
+	Path string `json:"path"`
+	*record
+}
+
+type treeChild struct {
+	Name     string `json:"name"`
+	HasValue bool   `json:"hasValue"`
+}
+
+type subtreePage struct {
+	Nodes               []treeNode `json:"nodes"`
+	Bookmark            string     `json:"bookmark"`
+	FetchedRecordsCount int32      `json:"fetchedRecordsCount"`
+}
+
+func (page subtreePage) ndjsonLines() []interface{} {
+	lines := make([]interface{}, 0, len(page.Nodes)+1)
+	for _, node := range page.Nodes {
+		lines = append(lines, node)
+	}
+
+	return append(lines, ndjsonCursor{bookmarkCursor{page.Bookmark, page.FetchedRecordsCount}})
+}
+
+// splitPath returns the segments of a slash-delimited path, ignoring leading
+// and trailing slashes. The root is the empty path.
+func splitPath(path string) ([]string, error) {
+	trimmed := strings.Trim(path, pathSeparator)
+	if trimmed == "" {
+		return []string{}, nil
+	}
+
+	segments := strings.Split(trimmed, pathSeparator)
+	for _, segment := range segments {
+		if segment == "" {
+			return nil, fmt.Errorf("path %s has an empty segment", path)
+		}
+	}
+
+	return segments, nil
+}
+
+func treeNodeKey(stub shim.ChaincodeStubInterface, path string) (string, error) {
+	segments, err := splitPath(path)
+	if err != nil {
+		return "", err
+	}
+
+	if len(segments) == 0 {
+		return "", fmt.Errorf("the root can't hold a value")
+	}
+
+	return stub.CreateCompositeKey(treeObjType, segments)
+}
+
+// putNode writes a value under a path, replacing its value if any, if the
+// caller's organization may write under it, see setPathACL.
+func (cc *SimpleChaincode) putNode(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.putNode")
+
+	if len(args) != 2 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d", len(args), 2)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	path, value := args[0], args[1]
+	logger.Debugf("path: %s, value: %s", path, value)
+
+	nodeKey, err := treeNodeKey(stub, path)
+	if err != nil {
+		message := fmt.Sprintf("unable to create a composite key: %s", err.Error())
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	if response, denied := pathWriteDenied(stub, path); denied {
+		return response
+	}
+
+	if _, err := putRecord(stub, nodeKey, value); err != nil {
+		message := fmt.Sprintf("unable to put the node %s: %s", path, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.putNode exited successfully")
+	return shim.Success(nil)
+}
+
+func (cc *SimpleChaincode) getNode(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.getNode")
+
+	if len(args) != 1 && len(args) != 2 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d or %d", len(args), 1, 2)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	path, format := args[0], formatJSON
+	if len(args) == 2 {
+		format = args[1]
+	}
+	logger.Debugf("path: %s, format: %s", path, format)
+
+	if err := checkFormat(format); err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	nodeKey, err := treeNodeKey(stub, path)
+	if err != nil {
+		message := fmt.Sprintf("unable to create a composite key: %s", err.Error())
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	r, err := getRecord(stub, nodeKey)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the node %s: %s", path, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if r == nil {
+		message := fmt.Sprintf("the node %s not found", path)
+		logger.Error(message)
+		return pb.Response{Status: 404, Message: message}
+	}
+
+	result, err := marshalResult(r, format)
+	if err != nil {
+		message := fmt.Sprintf("unable to marshal the result: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.getNode exited successfully")
+	return shim.Success(result)
+}
+
+// listChildren returns the names of the direct children of a path. Paths only
+// exist through the nodes below them, so the whole subtree is scanned.
+func (cc *SimpleChaincode) listChildren(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.listChildren")
+
+	if len(args) != 1 && len(args) != 2 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d or %d", len(args), 1, 2)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	path, format := args[0], formatJSON
+	if len(args) == 2 {
+		format = args[1]
+	}
+	logger.Debugf("path: %s, format: %s", path, format)
+
+	if err := checkFormat(format); err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	segments, err := splitPath(path)
+	if err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	it, err := stub.GetStateByPartialCompositeKey(treeObjType, segments)
+	if err != nil {
+		message := fmt.Sprintf("unable to get an iterator over the path %s: %s", path, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+	defer it.Close()
+
+	// keys are sorted by segment, so the nodes under a child are adjacent
+	var children = []treeChild{}
+	for it.HasNext() {
+		response, err := it.Next()
+		if err != nil {
+			message := fmt.Sprintf("unable to get the next element: %s", err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		_, attributes, err := stub.SplitCompositeKey(response.Key)
+		if err != nil {
+			message := fmt.Sprintf("unable to split the composite key: %s", err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		if len(attributes) == len(segments) {
+			continue
+		}
+
+		name, hasValue := attributes[len(segments)], len(attributes) == len(segments)+1
+		if n := len(children); n > 0 && children[n-1].Name == name {
+			children[n-1].HasValue = children[n-1].HasValue || hasValue
+			continue
+		}
+		children = append(children, treeChild{Name: name, HasValue: hasValue})
+	}
+
+	result, err := marshalResult(children, format)
+	if err != nil {
+		message := fmt.Sprintf("unable to marshal the result: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.listChildren exited successfully")
+	return shim.Success(result)
+}
+
+// subtree returns a page of the nodes under a path that are at most depth
+// levels below it, all of them if depth is 0. Nodes deeper than depth are
+// skipped, so a page may hold fewer nodes than the page size.
+func (cc *SimpleChaincode) subtree(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.subtree")
+
+	if len(args) != 4 && len(args) != 5 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d or %d", len(args), 4, 5)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	path, depthArg, pageSizeArg, bookmark, format := args[0], args[1], args[2], args[3], formatJSON
+	if len(args) == 5 {
+		format = args[4]
+	}
+	logger.Debugf("path: %s, depth: %s, pageSize: %s, bookmark: %s, format: %s", path, depthArg, pageSizeArg, bookmark, format)
+
+	if err := checkFormat(format); err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	segments, err := splitPath(path)
+	if err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	depth, err := strconv.Atoi(depthArg)
+	if err != nil || depth < 0 {
+		message := fmt.Sprintf("depth must be a non-negative integer, got \"%s\"", depthArg)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	pageSize, err := strconv.ParseInt(pageSizeArg, 10, 32)
+	if err != nil || pageSize < 1 || pageSize > maxPageSize {
+		message := fmt.Sprintf("page size must be an integer in [1, %d], got \"%s\"", maxPageSize, pageSizeArg)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	it, metadata, err := stub.GetStateByPartialCompositeKeyWithPagination(treeObjType, segments,
+		int32(pageSize), bookmark)
+	if err == nil && it == nil {
+		err = errPaginationUnsupported
+	}
+	if err != nil {
+		message := fmt.Sprintf("unable to get an iterator over the path %s: %s", path, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+	defer it.Close()
+
+	page := subtreePage{
+		Nodes:               []treeNode{},
+		Bookmark:            metadata.Bookmark,
+		FetchedRecordsCount: metadata.FetchedRecordsCount,
+	}
+	for it.HasNext() {
+		response, err := it.Next()
+		if err != nil {
+			message := fmt.Sprintf("unable to get the next element: %s", err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		_, attributes, err := stub.SplitCompositeKey(response.Key)
+		if err != nil {
+			message := fmt.Sprintf("unable to split the composite key: %s", err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		if depth > 0 && len(attributes)-len(segments) > depth {
+			continue
+		}
+
+		nodePath := strings.Join(attributes, pathSeparator)
+		r := decodeRecord(response.Value)
+		if err := r.verify(); err != nil {
+			message := fmt.Sprintf("unable to get the node %s: %s", nodePath, err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		page.Nodes = append(page.Nodes, treeNode{Path: nodePath, record: r})
+	}
+
+	result, err := marshalResult(page, format)
+	if err != nil {
+		message := fmt.Sprintf("unable to marshal the result: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.subtree exited successfully")
+	return shim.Success(result)
+}
+
+// list returns the nodes right under a prefix, the root if it's empty, or the
+// whole subtree if recursive, up to maxPageSize of them; larger subtrees are
+// paged with subtree.
+func (cc *SimpleChaincode) list(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.list")
+
+	if len(args) < 1 || len(args) > 3 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d to %d", len(args), 1, 3)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	prefix, recursive, format := args[0], false, formatJSON
+	if len(args) > 1 && args[1] != "" {
+		var err error
+		if recursive, err = strconv.ParseBool(args[1]); err != nil {
+			message := fmt.Sprintf("recursive must be a boolean, got \"%s\"", args[1])
+			logger.Error(message)
+			return pb.Response{Status: 400, Message: message}
+		}
+	}
+	if len(args) == 3 {
+		format = args[2]
+	}
+	logger.Debugf("prefix: %s, recursive: %t, format: %s", prefix, recursive, format)
+
+	if err := checkFormat(format); err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	segments, err := splitPath(prefix)
+	if err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	it, err := stub.GetStateByPartialCompositeKey(treeObjType, segments)
+	if err != nil {
+		message := fmt.Sprintf("unable to get an iterator over the path %s: %s", prefix, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+	defer it.Close()
+
+	nodes := []treeNode{}
+	for it.HasNext() {
+		response, err := it.Next()
+		if err != nil {
+			message := fmt.Sprintf("unable to get the next element: %s", err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		_, attributes, err := stub.SplitCompositeKey(response.Key)
+		if err != nil {
+			message := fmt.Sprintf("unable to split the composite key: %s", err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		// the prefix itself isn't under it
+		below := len(attributes) - len(segments)
+		if below == 0 || (!recursive && below > 1) {
+			continue
+		}
+
+		if len(nodes) == maxPageSize {
+			message := fmt.Sprintf("the path %s holds more than %d nodes, page them with subtree", prefix, maxPageSize)
+			logger.Error(message)
+			return pb.Response{Status: 400, Message: message}
+		}
+
+		nodePath := strings.Join(attributes, pathSeparator)
+		r := decodeRecord(response.Value)
+		if err := r.verify(); err != nil {
+			message := fmt.Sprintf("unable to get the node %s: %s", nodePath, err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		nodes = append(nodes, treeNode{Path: nodePath, record: r})
+	}
+
+	result, err := marshalResult(nodes, format)
+	if err != nil {
+		message := fmt.Sprintf("unable to marshal the result: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.list exited successfully")
+	return shim.Success(result)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// txStub lets a transaction read its own writes. The peer only applies the
+// write set after ordering, so without it a handler that updates the same key
+// twice (e.g. a chain head advanced once per affected record) would read a
+// stale value the second time. Range and composite-key queries still see the
+// committed state only.
+//
+// It also counts the ids newUUID generates in the transaction and collects
+// the mutations emitMutation emits events of.
+type txStub struct {
+	shim.ChaincodeStubInterface
+	writes       map[string][]byte
+	generatedIDs uint64
+	mutations    []mutation
+}
+
+func newTxStub(stub shim.ChaincodeStubInterface) *txStub {
+	return &txStub{ChaincodeStubInterface: stub, writes: map[string][]byte{}}
+}
+
+func (s *txStub) unwrap() shim.ChaincodeStubInterface {
+	return s.ChaincodeStubInterface
+}
+
+func (s *txStub) GetState(key string) ([]byte, error) {
+	if value, ok := s.writes[key]; ok {
+		return value, nil
+	}
+
+	return s.ChaincodeStubInterface.GetState(key)
+}
+
+func (s *txStub) PutState(key string, value []byte) error {
+	if err := s.ChaincodeStubInterface.PutState(key, value); err != nil {
+		return err
+	}
+
+	s.writes[key] = value
+	return nil
+}
+
+func (s *txStub) DelState(key string) error {
+	if err := s.ChaincodeStubInterface.DelState(key); err != nil {
+		return err
+	}
+
+	s.writes[key] = nil
+	return nil
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+const (
+	// zsetObjType keys order the members of a sorted set by score, the
+	// zsetScoreObjType ones map the members back to their scores
+	zsetObjType      = reservedObjTypePrefix + "zset"
+	zsetScoreObjType = reservedObjTypePrefix + "zscore"
+)
+
+type scoredMember struct {
+	Member string `json:"member"`
+	Score  int64  `json:"score"`
+}
+
+// encodeScore zero-pads score, shifted to be non-negative, so that the keys
+// of a sorted set are ordered by score.
+func encodeScore(score int64) string {
+	return fmt.Sprintf("%020d", uint64(score)+1<<63)
+}
+
+func decodeScore(encoded string) (int64, error) {
+	shifted, err := strconv.ParseUint(encoded, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+
+	return int64(shifted - 1<<63), nil
+}
+
+func (cc *SimpleChaincode) zadd(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.zadd")
+
+	if len(args) != 3 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d", len(args), 3)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	name, scoreArg, member := args[0], args[1], args[2]
+	logger.Debugf("zset: %s, score: %s, member: %s", name, scoreArg, member)
+
+	if name == "" {
+		message := "sorted set name must be a non-empty string"
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	score, err := strconv.ParseInt(scoreArg, 10, 64)
+	if err != nil {
+		message := fmt.Sprintf("score must be an integer, got \"%s\"", scoreArg)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	scoreKey, err := stub.CreateCompositeKey(zsetScoreObjType, []string{name, member})
+	if err != nil {
+		message := fmt.Sprintf("unable to create a composite key: %s", err.Error())
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	oldScore, err := stub.GetState(scoreKey)
+	if err != nil {
+		message := fmt.Sprintf("unable to get the score of %s: %s", member, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if oldScore != nil {
+		oldKey, err := stub.CreateCompositeKey(zsetObjType, []string{name, string(oldScore), member})
+		if err != nil {
+			message := fmt.Sprintf("unable to create a composite key: %s", err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		if err := stub.DelState(oldKey); err != nil {
+			message := fmt.Sprintf("unable to delete the old score of %s: %s", member, err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+	}
+
+	encoded := encodeScore(score)
+	orderKey, err := stub.CreateCompositeKey(zsetObjType, []string{name, encoded, member})
+	if err != nil {
+		message := fmt.Sprintf("unable to create a composite key: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if err := stub.PutState(orderKey, presenceMarker); err != nil {
+		message := fmt.Sprintf("unable to put the member %s: %s", member, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	if err := stub.PutState(scoreKey, []byte(encoded)); err != nil {
+		message := fmt.Sprintf("unable to put the score of %s: %s", member, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	added := 0
+	if oldScore == nil {
+		added = 1
+	}
+
+	logger.Info("SimpleChaincode.zadd exited successfully")
+	return shim.Success([]byte(strconv.Itoa(added)))
+}
+
+// zrangeByScore returns the members of a sorted set whose scores are in
+// [min, max], by score. A range of more than maxPageSize members fails and
+// has to be narrowed.
+func (cc *SimpleChaincode) zrangeByScore(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.zrangeByScore")
+
+	if len(args) != 3 && len(args) != 4 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d or %d", len(args), 3, 4)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	name, format := args[0], formatJSON
+	if len(args) == 4 {
+		format = args[3]
+	}
+	logger.Debugf("zset: %s, range: [%s, %s], format: %s", name, args[1], args[2], format)
+
+	if err := checkFormat(format); err != nil {
+		message := err.Error()
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	min, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		message := fmt.Sprintf("min must be an integer, got \"%s\"", args[1])
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	max, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		message := fmt.Sprintf("max must be an integer, got \"%s\"", args[2])
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	// composite keys can't be range-queried, but the bookmark of a paginated
+	// query is the key it starts at, so the scan seeks to the lowest key of
+	// min and stops once max is passed
+	seek, err := stub.CreateCompositeKey(zsetObjType, []string{name, encodeScore(min)})
+	if err != nil {
+		message := fmt.Sprintf("unable to create a composite key: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	it, _, err := stub.GetStateByPartialCompositeKeyWithPagination(zsetObjType, []string{name},
+		int32(maxPageSize+1), seek)
+	if err == nil && it == nil {
+		err = errPaginationUnsupported
+	}
+	if err != nil {
+		message := fmt.Sprintf("unable to get an iterator over the sorted set %s: %s", name, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+	defer it.Close()
+
+	var members = []scoredMember{}
+	for it.HasNext() {
+		response, err := it.Next()
+		if err != nil {
+			message := fmt.Sprintf("unable to get the next element: %s", err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		m, err := splitZsetKey(stub, response.Key)
+		if err != nil {
+			message := fmt.Sprintf("unable to split the composite key: %s", err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		if m.Score > max {
+			break
+		}
+
+		if len(members) == maxPageSize {
+			message := fmt.Sprintf("the range is too wide: it holds more than %d members", maxPageSize)
+			logger.Error(message)
+			return pb.Response{Status: 400, Message: message}
+		}
+		members = append(members, *m)
+	}
+
+	result, err := marshalResult(members, format)
+	if err != nil {
+		message := fmt.Sprintf("unable to marshal the result: %s", err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+
+	logger.Info("SimpleChaincode.zrangeByScore exited successfully")
+	return shim.Success(result)
+}
+
+func (cc *SimpleChaincode) zrank(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	logger.Info("SimpleChaincode.zrank")
+
+	if len(args) != 2 {
+		message := fmt.Sprintf("wrong number of arguments: passed %d, expected %d", len(args), 2)
+		logger.Error(message)
+		return pb.Response{Status: 400, Message: message}
+	}
+
+	name, member := args[0], args[1]
+	logger.Debugf("zset: %s, member: %s", name, member)
+
+	it, err := stub.GetStateByPartialCompositeKey(zsetObjType, []string{name})
+	if err != nil {
+		message := fmt.Sprintf("unable to get an iterator over the sorted set %s: %s", name, err.Error())
+		logger.Error(message)
+		return shim.Error(message)
+	}
+	defer it.Close()
+
+	for rank := 0; it.HasNext(); rank++ {
+		response, err := it.Next()
+		if err != nil {
+			message := fmt.Sprintf("unable to get the next element: %s", err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		m, err := splitZsetKey(stub, response.Key)
+		if err != nil {
+			message := fmt.Sprintf("unable to split the composite key: %s", err.Error())
+			logger.Error(message)
+			return shim.Error(message)
+		}
+
+		if m.Member == member {
+			logger.Info("SimpleChaincode.zrank exited successfully")
+			return shim.Success([]byte(strconv.Itoa(rank)))
+		}
+	}
+
+	message := fmt.Sprintf("the member %s of the sorted set %s not found", member, name)
+	logger.Error(message)
+	return pb.Response{Status: 404, Message: message}
+}
+
+func splitZsetKey(stub shim.ChaincodeStubInterface, key string) (*scoredMember, error) {
+	_, attributes, err := stub.SplitCompositeKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	score, err := decodeScore(attributes[1])
+	if err != nil {
+		return nil, err
+	}
+
+	return &scoredMember{Member: attributes[2], Score: score}, nil
+}
@@ -0,0 +1,309 @@
+// Command genclient generates a typed client for the chaincode from the
+// description its metadata function returns:
+//
+//	peer chaincode query -C mychannel -n simple -c '{"Args":["metadata"]}' > metadata.json
+//	genclient -in metadata.json -pkg simpleclient -out simpleclient/client.go -ts simpleclient.d.ts
+//
+// The Go client has one method per function and sends it through an Invoker,
+// submitting the functions that write and evaluating the read-only ones.
+// Regenerate the client whenever the chaincode gains or changes a function.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/format"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+type param struct {
+	Name     string `json:"name"`
+	Optional bool   `json:"optional"`
+	Variadic bool   `json:"variadic"`
+}
+
+type function struct {
+	Name     string  `json:"name"`
+	ReadOnly bool    `json:"readOnly"`
+	Params   []param `json:"params"`
+}
+
+type contract struct {
+	Name      string     `json:"name"`
+	Functions []function `json:"functions"`
+}
+
+func main() {
+	in := flag.String("in", "-", "the metadata file, - for stdin")
+	pkg := flag.String("pkg", "client", "the package name of the Go client")
+	out := flag.String("out", "-", "the Go file to write, - for stdout")
+	ts := flag.String("ts", "", "the TypeScript definitions file to write, if any")
+	flag.Parse()
+
+	c, err := readContract(*in)
+	if err != nil {
+		log.Fatalf("unable to read the metadata: %s", err)
+	}
+
+	src, err := generateGo(c, *pkg)
+	if err != nil {
+		log.Fatalf("unable to generate the Go client: %s", err)
+	}
+	if err := writeOutput(*out, src); err != nil {
+		log.Fatalf("unable to write the Go client: %s", err)
+	}
+
+	if *ts != "" {
+		defs, err := generateTS(c)
+		if err != nil {
+			log.Fatalf("unable to generate the TypeScript definitions: %s", err)
+		}
+		if err := writeOutput(*ts, defs); err != nil {
+			log.Fatalf("unable to write the TypeScript definitions: %s", err)
+		}
+	}
+}
+
+func readContract(path string) (*contract, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var c contract
+	if err := json.NewDecoder(r).Decode(&c); err != nil {
+		return nil, err
+	}
+
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+
+	return &c, nil
+}
+
+// validate checks that optional and variadic parameters come last, since
+// the chaincode reads its arguments by position.
+func (c *contract) validate() error {
+	if c.Name == "" {
+		return fmt.Errorf("the contract has no name")
+	}
+
+	for _, f := range c.Functions {
+		trailing := false
+		for i, p := range f.Params {
+			if p.Variadic && i != len(f.Params)-1 {
+				return fmt.Errorf("%s: the variadic parameter %s isn't the last one", f.Name, p.Name)
+			}
+			if trailing && !p.Optional && !p.Variadic {
+				return fmt.Errorf("%s: the parameter %s follows an optional one", f.Name, p.Name)
+			}
+			trailing = trailing || p.Optional
+		}
+	}
+
+	return nil
+}
+
+func writeOutput(path string, data []byte) error {
+	if path == "-" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+var goKeywords = map[string]bool{
+	"break": true, "case": true, "chan": true, "const": true, "continue": true,
+	"default": true, "defer": true, "else": true, "fallthrough": true, "for": true,
+	"func": true, "go": true, "goto": true, "if": true, "import": true,
+	"interface": true, "map": true, "package": true, "range": true, "return": true,
+	"select": true, "struct": true, "switch": true, "type": true, "var": true,
+}
+
+// goParam renames the parameters that would clash with a Go keyword or the
+// names the generated methods use themselves.
+func goParam(name string) string {
+	if goKeywords[name] || name == "c" || name == "args" || name == "append" {
+		return name + "Arg"
+	}
+
+	return name
+}
+
+// method turns the name of a function into a method name: the functions of
+// other contracts of the chaincode, named contract:function, become
+// contractFunction.
+func method(name string) string {
+	parts := strings.Split(name, ":")
+	for i := 1; i < len(parts); i++ {
+		parts[i] = upperFirst(parts[i])
+	}
+
+	return strings.Join(parts, "")
+}
+
+func exported(name string) string {
+	return upperFirst(method(name))
+}
+
+func upperFirst(s string) string {
+	r := []rune(s)
+	if len(r) > 0 {
+		r[0] = unicode.ToUpper(r[0])
+	}
+	return string(r)
+}
+
+func goSignature(f function) string {
+	var params []string
+	for _, p := range f.Params {
+		switch {
+		case p.Variadic:
+			params = append(params, goParam(p.Name)+" ...string")
+		case p.Optional:
+			params = append(params, goParam(p.Name)+" *string")
+		default:
+			params = append(params, goParam(p.Name)+" string")
+		}
+	}
+
+	return strings.Join(params, ", ")
+}
+
+func goCall(f function) string {
+	method := "Submit"
+	if f.ReadOnly {
+		method = "Evaluate"
+	}
+
+	return fmt.Sprintf("c.invoker.%s(%q, args...)", method, f.Name)
+}
+
+var goTemplate = template.Must(template.New("go").Funcs(template.FuncMap{
+	"call":      goCall,
+	"exported":  exported,
+	"param":     goParam,
+	"signature": goSignature,
+}).Parse(`// Code generated by genclient from the metadata of {{.Contract.Name}}. DO NOT EDIT.
+
+package {{.Package}}
+
+// Invoker sends a function call to the chaincode. Submit gets the transaction
+// endorsed and ordered, Evaluate only queries a peer.
+type Invoker interface {
+	Submit(function string, args ...string) ([]byte, error)
+	Evaluate(function string, args ...string) ([]byte, error)
+}
+
+// Client calls the functions of {{.Contract.Name}}. A nil optional argument
+// is left out, together with every argument after it.
+type Client struct {
+	invoker Invoker
+}
+
+func New(invoker Invoker) *Client {
+	return &Client{invoker: invoker}
+}
+{{range .Contract.Functions}}{{$call := call .}}
+// {{exported .Name}} {{if .ReadOnly}}evaluates{{else}}submits{{end}} {{.Name}}.
+func (c *Client) {{exported .Name}}({{signature .}}) ([]byte, error) {
+	args := []string{ {{- range .Params}}{{if not (or .Optional .Variadic)}}{{param .Name}}, {{end}}{{end -}} }
+{{- range .Params}}{{if .Optional}}
+	if {{param .Name}} == nil {
+		return {{$call}}
+	}
+	args = append(args, *{{param .Name}})
+{{- else if .Variadic}}
+	args = append(args, {{param .Name}}...)
+{{- end}}{{end}}
+	return {{$call}}
+}
+{{end}}`))
+
+type goData struct {
+	Package  string
+	Contract *contract
+}
+
+func generateGo(c *contract, pkg string) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := goTemplate.Execute(&buf, goData{pkg, c}); err != nil {
+		return nil, err
+	}
+
+	return format.Source(buf.Bytes())
+}
+
+var tsReserved = map[string]bool{
+	"break": true, "case": true, "catch": true, "class": true, "const": true,
+	"continue": true, "debugger": true, "default": true, "delete": true, "do": true,
+	"else": true, "enum": true, "export": true, "extends": true, "false": true,
+	"finally": true, "for": true, "function": true, "if": true, "import": true,
+	"in": true, "instanceof": true, "new": true, "null": true, "return": true,
+	"super": true, "switch": true, "this": true, "throw": true, "true": true,
+	"try": true, "typeof": true, "var": true, "void": true, "while": true, "with": true,
+}
+
+func tsParam(name string) string {
+	if tsReserved[name] {
+		return name + "Arg"
+	}
+
+	return name
+}
+
+func tsSignature(f function) string {
+	var params []string
+	for _, p := range f.Params {
+		switch {
+		case p.Variadic:
+			params = append(params, "..."+tsParam(p.Name)+": string[]")
+		case p.Optional:
+			params = append(params, tsParam(p.Name)+"?: string")
+		default:
+			params = append(params, tsParam(p.Name)+": string")
+		}
+	}
+
+	return strings.Join(params, ", ")
+}
+
+var tsTemplate = template.Must(template.New("ts").Funcs(template.FuncMap{
+	"method":    method,
+	"signature": tsSignature,
+}).Parse(`// Code generated by genclient from the metadata of {{.Name}}. DO NOT EDIT.
+
+export interface {{.Name}}Client {
+{{- range .Functions}}
+    /** {{if .ReadOnly}}Evaluates{{else}}Submits{{end}} {{.Name}}. */
+    {{method .Name}}({{signature .}}): Promise<Buffer>;
+{{- end}}
+}
+
+export type ReadOnlyFunction ={{range .Functions}}{{if .ReadOnly}}
+    | "{{.Name}}"{{end}}{{end}};
+`))
+
+func generateTS(c *contract) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := tsTemplate.Execute(&buf, c); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
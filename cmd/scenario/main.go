@@ -0,0 +1,492 @@
+// Command scenario runs scripted sequences of calls against the chaincode on
+// a live network and reports which of their expectations held, so that a lab
+// can be replayed step by step:
+//
+//	scenario -profile connection.yaml -wallet wallet -identity student labs/accounts.yaml
+//
+// A script is YAML, or JSON, which is YAML too:
+//
+//	name: Accounts
+//	channel: mychannel
+//	chaincode: simple
+//	steps:
+//	  - name: open an account
+//	    function: openAccount
+//	    args: [alice]
+//	  - name: the account is empty
+//	    function: getBalances
+//	    args: [alice]
+//	    expect:
+//	      payload: "[]"
+//	  - name: strangers can't deposit
+//	    function: deposit
+//	    args: [alice, USD, "10.00"]
+//	    expect:
+//	      status: 403
+//	  - name: schedule a payment
+//	    function: schedulePayment
+//	    args: [alice, bob, USD, "1.00", "2030-01-01T00:00:00Z"]
+//	    save:
+//	      payment: ""
+//	  - name: the payment is pending
+//	    function: getScheduledPayment
+//	    args: ["${payment}"]
+//	    expect:
+//	      json:
+//	        /status: pending
+//
+// A failed call can be expected by the code of its error, as well as by
+// status:
+//
+//	expect:
+//	  status: 404
+//	  code: ERR_KEY_NOT_FOUND
+//
+// A step expects status 200 unless it says otherwise. save keeps parts of the
+// payload, by JSON pointer ("" for the whole payload, as a string if it isn't
+// JSON), for later steps to use as ${name}. A step is submitted, or only
+// evaluated if the chaincode's metadata says its function is read-only;
+// mode: submit or mode: evaluate overrides that.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/errors/status"
+	"github.com/hyperledger/fabric-sdk-go/pkg/core/config"
+	"github.com/hyperledger/fabric-sdk-go/pkg/gateway"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	modeSubmit   = "submit"
+	modeEvaluate = "evaluate"
+)
+
+type script struct {
+	Name      string `yaml:"name"`
+	Channel   string `yaml:"channel"`
+	Chaincode string `yaml:"chaincode"`
+	Steps     []step `yaml:"steps"`
+}
+
+type step struct {
+	Name     string            `yaml:"name"`
+	Function string            `yaml:"function"`
+	Args     []string          `yaml:"args"`
+	Mode     string            `yaml:"mode"`
+	Expect   expectation       `yaml:"expect"`
+	Save     map[string]string `yaml:"save"`
+}
+
+// expectation is what a step's response must match. Status defaults to 200;
+// Message and Contains are substrings of the message and the payload, which
+// for an error are those of the chaincode's error, its details as payload.
+type expectation struct {
+	Status   int32                  `yaml:"status"`
+	Code     string                 `yaml:"code"`
+	Message  string                 `yaml:"message"`
+	Payload  *string                `yaml:"payload"`
+	Contains string                 `yaml:"contains"`
+	JSON     map[string]interface{} `yaml:"json"`
+}
+
+type response struct {
+	status  int32
+	code    string
+	message string
+	payload []byte
+}
+
+type runner struct {
+	contract  *gateway.Contract
+	readOnly  map[string]bool
+	variables map[string]string
+	verbose   bool
+}
+
+func main() {
+	profile := flag.String("profile", "connection.yaml", "the connection profile of the network")
+	walletPath := flag.String("wallet", "wallet", "the directory of the wallet")
+	identity := flag.String("identity", "", "the label of the identity in the wallet to call the chaincode as")
+	channel := flag.String("channel", "", "the channel, unless the script sets it")
+	chaincode := flag.String("chaincode", "", "the chaincode, unless the script sets it")
+	verbose := flag.Bool("v", false, "print the response of every step")
+	flag.Parse()
+
+	if flag.NArg() == 0 || *identity == "" {
+		fmt.Fprintln(os.Stderr, "usage: scenario -identity label [flags] script...")
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+
+	wallet, err := gateway.NewFileSystemWallet(*walletPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to open the wallet: %s\n", err)
+		os.Exit(2)
+	}
+
+	gw, err := gateway.Connect(gateway.WithConfig(config.FromFile(*profile)), gateway.WithIdentity(wallet, *identity))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to connect to the gateway: %s\n", err)
+		os.Exit(2)
+	}
+	defer gw.Close()
+
+	failed := 0
+	for _, path := range flag.Args() {
+		s, err := readScript(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "unable to read the script %s: %s\n", path, err)
+			os.Exit(2)
+		}
+
+		if s.Channel == "" {
+			s.Channel = *channel
+		}
+		if s.Chaincode == "" {
+			s.Chaincode = *chaincode
+		}
+
+		network, err := gw.GetNetwork(s.Channel)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "unable to get the channel %s: %s\n", s.Channel, err)
+			os.Exit(2)
+		}
+
+		r := &runner{contract: network.GetContract(s.Chaincode), variables: map[string]string{}, verbose: *verbose}
+		if err := r.loadMetadata(); err != nil {
+			fmt.Fprintf(os.Stderr, "unable to get the metadata of %s: %s\n", s.Chaincode, err)
+			os.Exit(2)
+		}
+
+		failed += r.run(s)
+	}
+
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+func readScript(path string) (*script, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var s script
+	if err := yaml.UnmarshalStrict(data, &s); err != nil {
+		return nil, err
+	}
+
+	if s.Name == "" {
+		s.Name = path
+	}
+
+	for i, st := range s.Steps {
+		if st.Function == "" {
+			return nil, fmt.Errorf("step %d has no function", i+1)
+		}
+		if st.Mode != "" && st.Mode != modeSubmit && st.Mode != modeEvaluate {
+			return nil, fmt.Errorf("step %d: mode must be %s or %s", i+1, modeSubmit, modeEvaluate)
+		}
+	}
+
+	return &s, nil
+}
+
+// loadMetadata learns from the chaincode which of its functions are
+// read-only.
+func (r *runner) loadMetadata() error {
+	payload, err := r.contract.EvaluateTransaction("metadata")
+	if err != nil {
+		return err
+	}
+
+	var metadata struct {
+		Functions []struct {
+			Name     string `json:"name"`
+			ReadOnly bool   `json:"readOnly"`
+		} `json:"functions"`
+	}
+	if err := json.Unmarshal(payload, &metadata); err != nil {
+		return err
+	}
+
+	r.readOnly = map[string]bool{}
+	for _, f := range metadata.Functions {
+		r.readOnly[f.Name] = f.ReadOnly
+	}
+
+	return nil
+}
+
+// run runs the steps of a script, all of them even if some fail, prints a
+// report and returns the number of failed steps.
+func (r *runner) run(s *script) int {
+	fmt.Printf("%s\n", s.Name)
+
+	failed := 0
+	for i, st := range s.Steps {
+		name := st.Name
+		if name == "" {
+			name = st.Function
+		}
+
+		resp, err := r.call(st)
+		if err == nil {
+			err = st.Expect.check(resp)
+		}
+		if err == nil {
+			err = r.save(st, resp)
+		}
+
+		if err != nil {
+			failed++
+			fmt.Printf("  FAIL %d. %s: %s\n", i+1, name, err)
+		} else {
+			fmt.Printf("  PASS %d. %s\n", i+1, name)
+		}
+
+		if r.verbose {
+			fmt.Printf("       %d %s %s\n", resp.status, resp.message, resp.payload)
+		}
+	}
+
+	fmt.Printf("%d passed, %d failed\n\n", len(s.Steps)-failed, failed)
+	return failed
+}
+
+var variablePattern = regexp.MustCompile(`\$\{(\w+)\}`)
+
+func (r *runner) expand(arg string) (string, error) {
+	var err error
+	expanded := variablePattern.ReplaceAllStringFunc(arg, func(m string) string {
+		name := m[2 : len(m)-1]
+		value, ok := r.variables[name]
+		if !ok {
+			err = fmt.Errorf("the variable %s isn't set", name)
+		}
+		return value
+	})
+
+	return expanded, err
+}
+
+func (r *runner) call(st step) (response, error) {
+	args := make([]string, len(st.Args))
+	for i, arg := range st.Args {
+		expanded, err := r.expand(arg)
+		if err != nil {
+			return response{}, err
+		}
+		args[i] = expanded
+	}
+
+	mode := st.Mode
+	if mode == "" {
+		mode = modeSubmit
+		if r.readOnly[st.Function] {
+			mode = modeEvaluate
+		}
+	}
+
+	var payload []byte
+	var err error
+	if mode == modeEvaluate {
+		payload, err = r.contract.EvaluateTransaction(st.Function, args...)
+	} else {
+		payload, err = r.contract.SubmitTransaction(st.Function, args...)
+	}
+
+	if err != nil {
+		// the SDK reports the status and message of a failed chaincode call
+		// as a status error; anything else didn't reach the chaincode
+		if s, ok := status.FromError(err); ok && s.Group == status.ChaincodeStatus {
+			return chaincodeError(s.Code, s.Message), nil
+		}
+		return response{status: 500, message: err.Error()}, nil
+	}
+
+	return response{status: 200, payload: payload}, nil
+}
+
+// chaincodeError returns the response of a call that failed with statusCode and
+// message, which the chaincode encodes as JSON along with a code.
+func chaincodeError(statusCode int32, message string) response {
+	var e struct {
+		Code    string          `json:"code"`
+		Message string          `json:"message"`
+		Details json.RawMessage `json:"details"`
+	}
+	if err := json.Unmarshal([]byte(message), &e); err != nil || e.Code == "" {
+		return response{status: statusCode, message: message}
+	}
+
+	return response{status: statusCode, code: e.Code, message: e.Message, payload: e.Details}
+}
+
+func (e expectation) check(resp response) error {
+	want := e.Status
+	if want == 0 {
+		want = 200
+	}
+
+	if resp.status != want {
+		return fmt.Errorf("got status %d (%s), expected %d", resp.status, resp.message, want)
+	}
+
+	if e.Code != "" && resp.code != e.Code {
+		return fmt.Errorf("got the error code %q (%s), expected %q", resp.code, resp.message, e.Code)
+	}
+
+	if !strings.Contains(resp.message, e.Message) {
+		return fmt.Errorf("got message %q, expected it to contain %q", resp.message, e.Message)
+	}
+
+	if e.Payload != nil && string(resp.payload) != *e.Payload {
+		return fmt.Errorf("got payload %s, expected %s", resp.payload, *e.Payload)
+	}
+
+	if !bytes.Contains(resp.payload, []byte(e.Contains)) {
+		return fmt.Errorf("got payload %s, expected it to contain %s", resp.payload, e.Contains)
+	}
+
+	if len(e.JSON) == 0 {
+		return nil
+	}
+
+	var doc interface{}
+	if err := json.Unmarshal(resp.payload, &doc); err != nil {
+		return fmt.Errorf("the payload isn't JSON: %s", err)
+	}
+
+	for pointer, expected := range e.JSON {
+		actual, err := resolvePointer(doc, pointer)
+		if err != nil {
+			return err
+		}
+
+		if !sameJSON(actual, expected) {
+			actualBytes, _ := json.Marshal(actual)
+			return fmt.Errorf("got %s at %s, expected %v", actualBytes, pointer, expected)
+		}
+	}
+
+	return nil
+}
+
+// save sets the variables a step saves from its payload.
+func (r *runner) save(st step, resp response) error {
+	if len(st.Save) == 0 {
+		return nil
+	}
+
+	var doc interface{}
+	isJSON := json.Unmarshal(resp.payload, &doc) == nil
+
+	for name, pointer := range st.Save {
+		if !isJSON {
+			if pointer != "" {
+				return fmt.Errorf("unable to save %s: the payload isn't JSON", name)
+			}
+			r.variables[name] = string(resp.payload)
+			continue
+		}
+
+		v, err := resolvePointer(doc, pointer)
+		if err != nil {
+			return fmt.Errorf("unable to save %s: %s", name, err)
+		}
+
+		if s, ok := v.(string); ok {
+			r.variables[name] = s
+		} else {
+			b, _ := json.Marshal(v)
+			r.variables[name] = string(b)
+		}
+	}
+
+	return nil
+}
+
+// resolvePointer returns the value a JSON pointer (RFC 6901) points to.
+func resolvePointer(doc interface{}, pointer string) (interface{}, error) {
+	if pointer == "" {
+		return doc, nil
+	}
+
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("the pointer %q doesn't start with /", pointer)
+	}
+
+	for _, token := range strings.Split(pointer[1:], "/") {
+		token = strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+
+		switch node := doc.(type) {
+		case map[string]interface{}:
+			v, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("nothing at %s", pointer)
+			}
+			doc = v
+		case []interface{}:
+			i, err := strconv.Atoi(token)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, fmt.Errorf("nothing at %s", pointer)
+			}
+			doc = node[i]
+		default:
+			return nil, fmt.Errorf("nothing at %s", pointer)
+		}
+	}
+
+	return doc, nil
+}
+
+// sameJSON compares a value decoded from JSON with one decoded from YAML by
+// their JSON encodings; YAML decodes maps with interface{} keys, which
+// encoding/json can't encode, so those are converted first.
+func sameJSON(actual, expected interface{}) bool {
+	a, err := json.Marshal(actual)
+	if err != nil {
+		return false
+	}
+
+	e, err := json.Marshal(fromYAML(expected))
+	if err != nil {
+		return false
+	}
+
+	var av, ev interface{}
+	json.Unmarshal(a, &av)
+	json.Unmarshal(e, &ev)
+	return reflect.DeepEqual(av, ev)
+}
+
+func fromYAML(v interface{}) interface{} {
+	switch node := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(node))
+		for k, v := range node {
+			m[fmt.Sprint(k)] = fromYAML(v)
+		}
+		return m
+	case []interface{}:
+		for i := range node {
+			node[i] = fromYAML(node[i])
+		}
+		return node
+	default:
+		return v
+	}
+}
@@ -0,0 +1,37 @@
+// Command contract is the key-value chaincode written against the contract
+// API, fabric-contract-api-go, next to the shim version in ../chaincode, so
+// that the two programming models can be compared function by function.
+//
+// Where the shim version reads its function name and string arguments from
+// GetFunctionAndParameters and dispatches them itself, the contract API
+// routes a transaction to the exported method of the same name, converts the
+// arguments to the method's parameter types and the result back to JSON, and
+// describes the methods in the metadata it returns for
+// org.hyperledger.fabric:GetMetadata, which client SDKs discover the
+// contract from:
+//
+//	peer chaincode query -C mychannel -n simplecontract -c '{"Args":["org.hyperledger.fabric:GetMetadata"]}'
+//
+// The contract API is built on the Fabric 2.x shim, which is why this is a
+// chaincode of its own rather than a second contract of ../chaincode.
+package main
+
+import (
+	"log"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+func main() {
+	chaincode, err := contractapi.NewChaincode(new(SimpleContract))
+	if err != nil {
+		log.Panicf("Error creating SimpleContract: %s", err)
+	}
+
+	chaincode.Info.Title = "simple"
+	chaincode.Info.Version = "1.0.0"
+
+	if err := chaincode.Start(); err != nil {
+		log.Panicf("Error starting SimpleContract: %s", err)
+	}
+}
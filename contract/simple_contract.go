@@ -0,0 +1,385 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// reservedObjTypePrefix marks the object types the chaincode keeps its own
+// bookkeeping under, as in the shim version.
+const reservedObjTypePrefix = "_"
+
+// SimpleContract is the key-value store of the shim version: put, get, del,
+// range and partial composite key queries, and owner transfers. Each
+// exported method is a transaction; the contract API passes it the
+// transaction context, from which it gets the stub and the caller, instead of
+// a bare stub.
+//
+// The contract API fails a transaction with status 500 whatever the error,
+// so unlike the shim version, a missing key isn't a 404: the error message is
+// all a client gets.
+type SimpleContract struct {
+	contractapi.Contract
+}
+
+// Record is the envelope values are stored in, the same as the record of the
+// shim version minus the metadata the functions below don't use.
+type Record struct {
+	Value     string    `json:"value"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	Version   uint64    `json:"version,omitempty"`
+}
+
+type QueryResult struct {
+	Key    string  `json:"key"`
+	Record *Record `json:"record"`
+}
+
+// Identity is the caller as Whoami describes it.
+type Identity struct {
+	MSPID string `json:"mspId"`
+	ID    string `json:"id"`
+}
+
+// GetEvaluateTransactions tags the functions that only read, so that the
+// metadata tells clients to evaluate them rather than submit them.
+func (c *SimpleContract) GetEvaluateTransactions() []string {
+	return []string{"Get", "GetByRange", "GetByPartialCompositeKey", "Whoami"}
+}
+
+// keyParts returns the attributes of key, a JSON array of them for a key of
+// several parts, as in the shim version.
+func keyParts(key string) ([]string, error) {
+	if !strings.HasPrefix(key, "[") {
+		return []string{key}, nil
+	}
+
+	var parts []string
+	if err := json.Unmarshal([]byte(key), &parts); err != nil {
+		return nil, fmt.Errorf("a key starting with \"[\" must be a JSON array of strings: %s", err.Error())
+	}
+
+	for _, part := range parts {
+		if part == "" {
+			return nil, errors.New("key parts must be non-empty strings")
+		}
+	}
+
+	return parts, nil
+}
+
+func formatKey(parts []string) string {
+	if len(parts) == 1 && !strings.HasPrefix(parts[0], "[") {
+		return parts[0]
+	}
+
+	keyBytes, _ := json.Marshal(parts)
+	return string(keyBytes)
+}
+
+func createCompositeKey(ctx contractapi.TransactionContextInterface, objType, key string) (string, error) {
+	if key == "" {
+		return "", errors.New("key must be a non-empty string")
+	}
+
+	if strings.HasPrefix(objType, reservedObjTypePrefix) {
+		return "", fmt.Errorf("object types starting with %q are reserved", reservedObjTypePrefix)
+	}
+
+	parts, err := keyParts(key)
+	if err != nil {
+		return "", err
+	}
+
+	if len(parts) == 0 {
+		return "", errors.New("key must have at least one part")
+	}
+
+	if objType == "" {
+		if len(parts) > 1 {
+			return "", errors.New("a key of several parts needs an object type")
+		}
+		return parts[0], nil
+	}
+
+	return ctx.GetStub().CreateCompositeKey(objType, parts)
+}
+
+// txTime returns the timestamp of the current transaction in UTC.
+func txTime(ctx contractapi.TransactionContextInterface) (time.Time, error) {
+	ts, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return time.Unix(ts.Seconds, int64(ts.Nanos)).UTC(), nil
+}
+
+func getRecord(ctx contractapi.TransactionContextInterface, compositeKey string) (*Record, error) {
+	recordBytes, err := ctx.GetStub().GetState(compositeKey)
+	if err != nil || recordBytes == nil {
+		return nil, err
+	}
+
+	var r Record
+	if err := json.Unmarshal(recordBytes, &r); err != nil {
+		return nil, err
+	}
+
+	return &r, nil
+}
+
+// putRecord stores value under compositeKey, keeping the creation time and
+// bumping the version of the record it replaces, if any.
+func putRecord(ctx contractapi.TransactionContextInterface, compositeKey, value string) error {
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	prev, err := getRecord(ctx, compositeKey)
+	if err != nil {
+		return err
+	}
+
+	r := Record{Value: value, CreatedAt: now, UpdatedAt: now, Version: 1}
+	if prev != nil {
+		r.CreatedAt, r.Version = prev.CreatedAt, prev.Version+1
+	}
+
+	recordBytes, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	return ctx.GetStub().PutState(compositeKey, recordBytes)
+}
+
+// Put stores a value under a key of an object type.
+func (c *SimpleContract) Put(ctx contractapi.TransactionContextInterface, objType, key, value string) error {
+	compositeKey, err := createCompositeKey(ctx, objType, key)
+	if err != nil {
+		return fmt.Errorf("unable to create a composite key: %s", err.Error())
+	}
+
+	if err := putRecord(ctx, compositeKey, value); err != nil {
+		return fmt.Errorf("unable to put a key-value pair: %s", err.Error())
+	}
+
+	return nil
+}
+
+// Update is Put for a key that must already have a value.
+func (c *SimpleContract) Update(ctx contractapi.TransactionContextInterface, objType, key, value string) error {
+	compositeKey, err := createCompositeKey(ctx, objType, key)
+	if err != nil {
+		return fmt.Errorf("unable to create a composite key: %s", err.Error())
+	}
+
+	r, err := getRecord(ctx, compositeKey)
+	if err != nil {
+		return fmt.Errorf("unable to get a value for the key %s: %s", key, err.Error())
+	}
+
+	if r == nil {
+		return fmt.Errorf("a value for the key %s not found", key)
+	}
+
+	if err := putRecord(ctx, compositeKey, value); err != nil {
+		return fmt.Errorf("unable to put a key-value pair: %s", err.Error())
+	}
+
+	return nil
+}
+
+// Get returns the record under a key of an object type.
+func (c *SimpleContract) Get(ctx contractapi.TransactionContextInterface, objType, key string) (*Record, error) {
+	compositeKey, err := createCompositeKey(ctx, objType, key)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create a composite key: %s", err.Error())
+	}
+
+	r, err := getRecord(ctx, compositeKey)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get a value for the key %s: %s", key, err.Error())
+	}
+
+	if r == nil {
+		return nil, fmt.Errorf("a value for the key %s not found", key)
+	}
+
+	return r, nil
+}
+
+func (c *SimpleContract) Del(ctx contractapi.TransactionContextInterface, objType, key string) error {
+	compositeKey, err := createCompositeKey(ctx, objType, key)
+	if err != nil {
+		return fmt.Errorf("unable to create a composite key: %s", err.Error())
+	}
+
+	if err := ctx.GetStub().DelState(compositeKey); err != nil {
+		return fmt.Errorf("unable to delete a pair associated with the key %s: %s", key, err.Error())
+	}
+
+	return nil
+}
+
+// GetByRange returns the records of the simple keys in [keyFrom, keyTo).
+func (c *SimpleContract) GetByRange(ctx contractapi.TransactionContextInterface, keyFrom, keyTo string) ([]QueryResult, error) {
+	it, err := ctx.GetStub().GetStateByRange(keyFrom, keyTo)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get an iterator over the range [\"%s\", \"%s\"): %s",
+			keyFrom, keyTo, err.Error())
+	}
+	defer it.Close()
+
+	results := []QueryResult{}
+	for it.HasNext() {
+		response, err := it.Next()
+		if err != nil {
+			return nil, fmt.Errorf("unable to get the next element: %s", err.Error())
+		}
+
+		var r Record
+		if err := json.Unmarshal(response.Value, &r); err != nil {
+			return nil, fmt.Errorf("unable to get a value for the key %s: %s", response.Key, err.Error())
+		}
+
+		results = append(results, QueryResult{Key: response.Key, Record: &r})
+	}
+
+	return results, nil
+}
+
+// GetByPartialCompositeKey returns the records of an object type whose keys
+// start with the given parts; an empty partial key matches every key.
+func (c *SimpleContract) GetByPartialCompositeKey(ctx contractapi.TransactionContextInterface, objType, partialKey string) ([]QueryResult, error) {
+	if objType == "" || strings.HasPrefix(objType, reservedObjTypePrefix) {
+		return nil, fmt.Errorf("the object type \"%s\" has no composite keys to query", objType)
+	}
+
+	var parts []string
+	if partialKey != "" {
+		var err error
+		if parts, err = keyParts(partialKey); err != nil {
+			return nil, err
+		}
+	}
+
+	stub := ctx.GetStub()
+	it, err := stub.GetStateByPartialCompositeKey(objType, parts)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get an iterator over the partial key %s: %s", partialKey, err.Error())
+	}
+	defer it.Close()
+
+	results := []QueryResult{}
+	for it.HasNext() {
+		response, err := it.Next()
+		if err != nil {
+			return nil, fmt.Errorf("unable to get the next element: %s", err.Error())
+		}
+
+		_, attributes, err := stub.SplitCompositeKey(response.Key)
+		if err != nil {
+			return nil, fmt.Errorf("unable to split the composite key %s: %s", response.Key, err.Error())
+		}
+
+		var r Record
+		if err := json.Unmarshal(response.Value, &r); err != nil {
+			return nil, fmt.Errorf("unable to get a value for the key %s: %s", response.Key, err.Error())
+		}
+
+		results = append(results, QueryResult{Key: formatKey(attributes), Record: &r})
+	}
+
+	return results, nil
+}
+
+// Transfer sets the owner field of a JSON document, as its current owner.
+func (c *SimpleContract) Transfer(ctx contractapi.TransactionContextInterface, objType, key, newOwner string) error {
+	return transferOwnership(ctx, objType, key, newOwner, nil)
+}
+
+// TransferConditional is Transfer for a record still at the version the
+// caller read. The contract API parses expectedVersion from its argument
+// and rejects anything but a non-negative integer before the call.
+func (c *SimpleContract) TransferConditional(ctx contractapi.TransactionContextInterface, objType, key, newOwner string, expectedVersion uint64) error {
+	return transferOwnership(ctx, objType, key, newOwner, &expectedVersion)
+}
+
+func transferOwnership(ctx contractapi.TransactionContextInterface, objType, key, newOwner string, expectedVersion *uint64) error {
+	if newOwner == "" {
+		return errors.New("the new owner must be a non-empty string")
+	}
+
+	compositeKey, err := createCompositeKey(ctx, objType, key)
+	if err != nil {
+		return fmt.Errorf("unable to create a composite key: %s", err.Error())
+	}
+
+	r, err := getRecord(ctx, compositeKey)
+	if err != nil {
+		return fmt.Errorf("unable to get a value for the key %s: %s", key, err.Error())
+	}
+
+	if r == nil {
+		return fmt.Errorf("a value for the key %s not found", key)
+	}
+
+	if expectedVersion != nil && r.Version != *expectedVersion {
+		return fmt.Errorf("the key %s is at version %d, expected %d", key, r.Version, *expectedVersion)
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(r.Value), &fields); err != nil || fields == nil {
+		return fmt.Errorf("the value for the key %s is not a JSON object", key)
+	}
+
+	owner, ok := fields["owner"].(string)
+	if !ok {
+		return fmt.Errorf("the value for the key %s has no owner", key)
+	}
+
+	caller, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("unable to get the caller's identity: %s", err.Error())
+	}
+
+	if caller != owner {
+		return fmt.Errorf("the caller doesn't own the key %s", key)
+	}
+
+	fields["owner"] = newOwner
+	docBytes, err := json.Marshal(fields)
+	if err != nil {
+		return fmt.Errorf("unable to marshal the document: %s", err.Error())
+	}
+
+	if err := putRecord(ctx, compositeKey, string(docBytes)); err != nil {
+		return fmt.Errorf("unable to put a key-value pair: %s", err.Error())
+	}
+
+	return nil
+}
+
+// Whoami returns the caller's identity, the owner id transfers compare with.
+func (c *SimpleContract) Whoami(ctx contractapi.TransactionContextInterface) (*Identity, error) {
+	mspID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return nil, fmt.Errorf("unable to get the caller's MSP id: %s", err.Error())
+	}
+
+	id, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return nil, fmt.Errorf("unable to get the caller's identity: %s", err.Error())
+	}
+
+	return &Identity{MSPID: mspID, ID: id}, nil
+}